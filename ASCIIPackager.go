@@ -3,8 +3,6 @@ package modbus
 import (
 	"bytes"
 	"encoding/hex"
-	"errors"
-	"log"
 
 	"github.com/tarm/serial"
 )
@@ -12,6 +10,7 @@ import (
 // ASCIIPackager implements the Packager interface for Modbus ASCII.
 type ASCIIPackager struct {
 	packagerSettings
+	turnaround
 	*serial.Port
 }
 
@@ -23,9 +22,11 @@ func NewASCIIPackager(c ConnectionSettings) (*ASCIIPackager, error) {
 		return nil, err
 	}
 	return &ASCIIPackager{
-		Port: p,
+		Port:       p,
+		turnaround: newTurnaround(c),
 		packagerSettings: packagerSettings{
-			Debug: c.Debug,
+			Debug:   c.Debug,
+			timeout: c.Timeout,
 		},
 	}, nil
 }
@@ -35,16 +36,24 @@ func (pkgr *ASCIIPackager) generateADU(q Query) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkBroadcast(q); err != nil {
+		return nil, err
+	}
+	return pkgr.generateRawADU(q.SlaveID, q.FunctionCode, data)
+}
 
-	if q.SlaveID == 0 {
-		return nil, errors.New("SlaveID cannot be 0 for Modbus ASCII")
+// generateRawADU frames the given PDU data as an ASCII packet.
+func (pkgr *ASCIIPackager) generateRawADU(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	if len(data) > MaxPDUSize-1 {
+		return nil, errPDUTooLarge
 	}
 
 	packetLen := 2
 	packetLen += len(data) + 1
 	rawPkt := make([]byte, packetLen)
-	rawPkt[0] = q.SlaveID
-	rawPkt[1] = byte(q.FunctionCode)
+	rawPkt[0] = slaveID
+	rawPkt[1] = byte(fCode)
 	bytesUsed := 2
 
 	bytesUsed += copy(rawPkt[bytesUsed:], data)
@@ -68,35 +77,83 @@ func (pkgr *ASCIIPackager) generateADU(q Query) ([]byte, error) {
 	return bytes.ToUpper(asciiPkt), nil
 }
 
-// Send sends the Query and returns the result or and error code.
+// Send sends the Query and returns the result or and error code. If the
+// Query is a broadcast to SlaveID 0, no response is awaited and nil data is
+// returned.
 func (pkgr *ASCIIPackager) Send(q Query) ([]byte, error) {
 	adu, err := pkgr.generateADU(q)
 	if err != nil {
 		return nil, err
 	}
 
+	response, err := pkgr.transmit(q.SlaveID, adu)
+	if err != nil || q.SlaveID == 0 {
+		return nil, err
+	}
+
+	// Check the validity of the response
+	if valid, err := q.isValidResponse(response); !valid {
+		return nil, err
+	}
+
+	// Return only the data payload
+	return q.responseData(response), nil
+}
+
+// SendRaw sends the data as the PDU for the fCode and returns the raw
+// response PDU after only checking the framing and LRC.
+func (pkgr *ASCIIPackager) SendRaw(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	adu, err := pkgr.generateRawADU(slaveID, fCode, data)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := pkgr.transmit(slaveID, adu)
+	if err != nil || slaveID == 0 {
+		return nil, err
+	}
+
+	// Strip the SlaveID
+	return response[1:], nil
+}
+
+// transmit writes the adu and reads back the response, returning it decoded
+// to raw bytes without the LRC. Broadcasts to slaveID 0 return nil without
+// reading a response.
+func (pkgr *ASCIIPackager) transmit(slaveID byte, adu []byte) ([]byte,
+	error) {
+	pkgr.turnaround.wait()
+
 	if pkgr.Debug {
-		log.Printf("Tx: %x\n", adu)
-		log.Printf("Tx: %s\n", adu)
+		logFrame("Tx", ModeASCII, adu, DirectionRequest)
 	}
 
-	_, err = pkgr.Write(adu)
+	_, err := pkgr.Write(adu)
 	if err != nil {
 		return nil, err
 	}
+	deadline := pkgr.deadline()
+
+	if slaveID == 0 {
+		pkgr.turnaround.start()
+		return nil, nil
+	}
 
 	asciiResponse := make([]byte, MaxASCIISize)
-	asciiN, rerr := pkgr.Read(asciiResponse)
+	asciiN, rerr := readFrame(pkgr, asciiResponse, asciiFrameComplete,
+		deadline)
 	if rerr != nil {
 		return nil, rerr
 	}
 
 	if pkgr.Debug {
-		log.Printf("Rx Full: %x\n", asciiResponse)
+		logFrame("Rx", ModeASCII, asciiResponse[:asciiN],
+			DirectionResponse)
 	}
 
 	// Check the framing of the response
-	if asciiResponse[0] != ':' ||
+	if asciiN < 9 || asciiResponse[0] != ':' ||
 		asciiResponse[asciiN-2] != '\r' ||
 		asciiResponse[asciiN-1] != '\n' {
 		return nil, exceptions[exceptionBadFraming]
@@ -115,20 +172,13 @@ func (pkgr *ASCIIPackager) Send(q Query) ([]byte, error) {
 
 	response = response[:rawN-1]
 
-	if pkgr.Debug {
-		log.Printf("Rx: %x\n", response)
-	}
-
-	// Check the validity of the response
-	if valid, err := q.isValidResponse(response); !valid {
-		return nil, err
-	}
+	return response, nil
+}
 
-	// Return only the data payload
-	if isReadFunction(q.FunctionCode) {
-		return response[3:], nil
-	}
-	return response[2:], nil
+// asciiFrameComplete reports whether a received ASCII frame has been
+// terminated by CR LF.
+func asciiFrameComplete(frame []byte) bool {
+	return bytes.HasSuffix(frame, []byte("\r\n"))
 }
 
 // Modbus ASCII uses Longitudinal Redundancy Check. lrc computes and returns
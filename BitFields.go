@@ -0,0 +1,69 @@
+package modbus
+
+import "fmt"
+
+// BitFields names individual bits of a status register by their bit number,
+// where 0 is the least significant bit. For example, BitFields{"Running": 3}
+// names bit 3 of the register.
+type BitFields map[string]uint
+
+// Bit returns the state of the named bit of the register value.
+func (bf BitFields) Bit(value uint16, name string) (bool, error) {
+	bit, err := bf.bit(name)
+	if nil != err {
+		return false, err
+	}
+	return value&(1<<bit) != 0, nil
+}
+
+// Decode returns the state of every named bit of the register value.
+func (bf BitFields) Decode(value uint16) map[string]bool {
+	states := make(map[string]bool, len(bf))
+	for name, bit := range bf {
+		if bit < 16 {
+			states[name] = value&(1<<bit) != 0
+		}
+	}
+	return states
+}
+
+// Encode returns the register value with the named bits set to the given
+// states and all other bits taken from value.
+func (bf BitFields) Encode(value uint16, states map[string]bool) (uint16,
+	error) {
+	andMask, orMask, err := bf.Masks(states)
+	if nil != err {
+		return 0, err
+	}
+	return value&andMask | orMask, nil
+}
+
+// Masks returns the AND and OR masks for a MaskWriteRegister Query that sets
+// the named bits to the given states and leaves all other bits unchanged.
+func (bf BitFields) Masks(states map[string]bool) (andMask, orMask uint16,
+	err error) {
+	andMask = 0xFFFF
+	for name, state := range states {
+		bit, err := bf.bit(name)
+		if nil != err {
+			return 0, 0, err
+		}
+		andMask &^= 1 << bit
+		if state {
+			orMask |= 1 << bit
+		}
+	}
+	return andMask, orMask, nil
+}
+
+func (bf BitFields) bit(name string) (uint, error) {
+	bit, ok := bf[name]
+	if !ok {
+		return 0, fmt.Errorf("Unknown bit field: %v", name)
+	}
+	if bit > 15 {
+		return 0, fmt.Errorf("Bit field %v: bit %v out of range [0, 15]",
+			name, bit)
+	}
+	return bit, nil
+}
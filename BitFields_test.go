@@ -0,0 +1,38 @@
+package modbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBitFields(t *testing.T) {
+	bf := BitFields{"Running": 3, "Fault": 0, "Invalid": 16}
+	status := uint16(0x0008)
+
+	if running, err := bf.Bit(status, "Running"); nil != err || !running {
+		t.Errorf("Running want: true got: %v, %v", running, err)
+	}
+	if _, err := bf.Bit(status, "Unknown"); nil == err {
+		t.Error("Unknown bit field err is nil")
+	}
+	if _, err := bf.Bit(status, "Invalid"); nil == err {
+		t.Error("Out of range bit field err is nil")
+	}
+
+	want := map[string]bool{"Running": true, "Fault": false}
+	if states := bf.Decode(status); !reflect.DeepEqual(states, want) {
+		t.Errorf("Decode want: %v got: %v", want, states)
+	}
+
+	states := map[string]bool{"Running": false, "Fault": true}
+	andMask, orMask, err := bf.Masks(states)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if andMask != 0xFFF6 || orMask != 0x0001 {
+		t.Errorf("Masks want: fff6, 0001 got: %04x, %04x", andMask, orMask)
+	}
+	if v, _ := bf.Encode(0xF0F8, states); v != 0xF0F1 {
+		t.Errorf("Encode want: f0f1 got: %04x", v)
+	}
+}
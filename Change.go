@@ -0,0 +1,303 @@
+package modbus
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Edge selects which transitions of a boolean value are reported as changes.
+type Edge byte
+
+// The Edges of a ChangeOptions.
+const (
+	// EdgeBoth reports every transition.
+	EdgeBoth Edge = iota
+	// EdgeRising reports only transitions from false to true.
+	EdgeRising
+	// EdgeFalling reports only transitions from true to false.
+	EdgeFalling
+)
+
+// EdgeNames maps Edge to a string description.
+var EdgeNames = map[Edge]string{
+	EdgeBoth:    "both",
+	EdgeRising:  "rising",
+	EdgeFalling: "falling",
+}
+
+// String returns the name of the Edge.
+func (e Edge) String() string {
+	if s, ok := EdgeNames[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("Edge(%d)", byte(e))
+}
+
+// ChangeReason is the reason a ChangeEvent was reported.
+type ChangeReason byte
+
+// The ChangeReasons of a ChangeEvent.
+const (
+	// ReasonInitial is the first Sample of a value.
+	ReasonInitial ChangeReason = iota + 1
+	// ReasonChange is a value that changed by more than its deadband, or a
+	// boolean edge.
+	ReasonChange
+	// ReasonQuality is a change of Quality, such as a failed read.
+	ReasonQuality
+	// ReasonIntegrity is an unchanged value that is reported because it was
+	// not reported for the Integrity period.
+	ReasonIntegrity
+)
+
+// ChangeReasonNames maps ChangeReason to a string description.
+var ChangeReasonNames = map[ChangeReason]string{
+	ReasonInitial:   "initial",
+	ReasonChange:    "change",
+	ReasonQuality:   "quality",
+	ReasonIntegrity: "integrity",
+}
+
+// String returns the name of the ChangeReason.
+func (r ChangeReason) String() string {
+	if s, ok := ChangeReasonNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("ChangeReason(%d)", byte(r))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r ChangeReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// ChangeOptions decide which Samples of a value are reported.
+type ChangeOptions struct {
+	// A numeric value is reported if it differs from the last reported
+	// value by more than Absolute and by more than Percent of the last
+	// reported value. Comparing against the last reported value, rather
+	// than the last Sample, ensures that slow drifts are reported
+	// eventually. If both are zero every change is reported.
+	Absolute float64
+	Percent  float64
+	// Edge selects the transitions of boolean values that are reported.
+	Edge Edge
+	// Integrity, if not zero, is the longest time a value goes unreported,
+	// even if it does not change.
+	Integrity time.Duration
+}
+
+// ChangeEvent is a Sample reported by a ChangeFilter.
+type ChangeEvent struct {
+	Sample
+	// Previous is the last reported Value, or nil for ReasonInitial.
+	Previous interface{}
+	Reason   ChangeReason
+}
+
+// ChangeFilter reports the Samples of each Poll or Tag that differ from the
+// last reported Sample according to its ChangeOptions, so that consumers do
+// not need to compare successive values themselves. The zero value uses the
+// default ChangeOptions, reporting every change. A ChangeFilter is safe for
+// concurrent use.
+type ChangeFilter struct {
+	// ChangeOptions are used for Samples without Options.
+	ChangeOptions
+	// Options are the ChangeOptions of the Tags or Polls by name. The
+	// options of the Tag take precedence over those of its Poll.
+	Options map[string]ChangeOptions
+
+	mtx    sync.Mutex
+	values map[sampleKey]*changeState
+}
+
+// sampleKey identifies the Samples of a value.
+type sampleKey struct {
+	poll, tag string
+}
+
+// changeState is the last reported and the last good Sample of a value.
+type changeState struct {
+	reported ChangeEvent
+	seen     Sample
+}
+
+// options returns the ChangeOptions of the Sample.
+func (f *ChangeFilter) options(s Sample) ChangeOptions {
+	if opts, ok := f.Options[s.Tag]; ok && len(s.Tag) > 0 {
+		return opts
+	}
+	if opts, ok := f.Options[s.Poll]; ok {
+		return opts
+	}
+	return f.ChangeOptions
+}
+
+// Filter returns the ChangeEvent for the Sample and whether it should be
+// reported. Samples of each value must be passed in the order they were
+// read.
+func (f *ChangeFilter) Filter(s Sample) (ChangeEvent, bool) {
+	e, ok := f.peek(s)
+	if ok {
+		f.commit(e)
+	}
+	return e, ok
+}
+
+// peek returns the ChangeEvent for the Sample and whether it should be
+// reported, like Filter, but the ChangeEvent only becomes the last reported
+// Sample once it is passed to commit. Until then the following Samples are
+// compared against the previous report, so that a ChangeEvent that could not
+// be delivered is not lost.
+func (f *ChangeFilter) peek(s Sample) (ChangeEvent, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	st, ok := f.values[sampleKey{s.Poll, s.Tag}]
+	if !ok {
+		return ChangeEvent{Sample: s, Reason: ReasonInitial}, true
+	}
+
+	e := ChangeEvent{Sample: s, Previous: st.reported.Value}
+	opts := f.options(s)
+	switch {
+	case s.Quality != st.reported.Quality:
+		e.Reason = ReasonQuality
+	case QualityGood == s.Quality &&
+		opts.changed(st.seen, st.reported.Sample, s):
+		e.Reason = ReasonChange
+	case opts.Integrity > 0 &&
+		s.Time.Sub(st.reported.Time) >= opts.Integrity:
+		e.Reason = ReasonIntegrity
+	default:
+		if QualityGood == s.Quality {
+			st.seen = s
+		}
+		return e, false
+	}
+	return e, true
+}
+
+// commit records the ChangeEvent returned by peek as reported.
+func (f *ChangeFilter) commit(e ChangeEvent) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if nil == f.values {
+		f.values = make(map[sampleKey]*changeState)
+	}
+	key := sampleKey{e.Poll, e.Tag}
+	st, ok := f.values[key]
+	if !ok {
+		st = &changeState{seen: e.Sample}
+		f.values[key] = st
+	}
+	if QualityGood == e.Quality {
+		st.seen = e.Sample
+	}
+	st.reported = e
+}
+
+// Reset forgets the last reported Sample of the Tag of the Poll, or of the
+// Poll itself if tag is empty, so that its next Sample is reported with
+// ReasonInitial.
+func (f *ChangeFilter) Reset(poll, tag string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	delete(f.values, sampleKey{poll, tag})
+}
+
+// changed returns whether the good Sample s differs from the last reported
+// Sample, or, for booleans, whether it is a selected edge from the last good
+// Sample seen.
+func (opts ChangeOptions) changed(seen, reported, s Sample) bool {
+	if b, ok := s.Value.(bool); ok {
+		prev, ok := seen.Value.(bool)
+		if !ok || QualityGood != seen.Quality {
+			prev, _ = reported.Value.(bool)
+		}
+		if b == prev {
+			return false
+		}
+		switch opts.Edge {
+		case EdgeRising:
+			return b
+		case EdgeFalling:
+			return !b
+		}
+		return true
+	}
+	v, vOK := ToFloat64(s.Value)
+	prev, pOK := ToFloat64(reported.Value)
+	if vOK && pOK {
+		d := math.Abs(v - prev)
+		return d > 0 && d > opts.Absolute &&
+			d > opts.Percent/100*math.Abs(prev)
+	}
+	if nil == s.Value && nil == reported.Value {
+		return !bytes.Equal(s.Data, reported.Data)
+	}
+	return !reflect.DeepEqual(s.Value, reported.Value)
+}
+
+// ToFloat64 returns the value v of a Tag as a float64, if it is a number.
+func ToFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// OnChange calls f with the ChangeEvents that the filter reports for the
+// Samples of the Polls or Tags with the given names, or of all Polls if no
+// names are given. See OnSample.
+func (p *Poller) OnChange(filter *ChangeFilter, f func(ChangeEvent),
+	names ...string) {
+	p.OnSample(func(s Sample) {
+		if e, ok := filter.Filter(s); ok {
+			f(e)
+		}
+	}, names...)
+}
+
+// SubscribeChanges returns a channel receiving the ChangeEvents that the
+// filter reports for the Samples of the Polls or Tags with the given names, or
+// of all Polls if no names are given. See Subscribe. A ChangeEvent that is
+// dropped because the channel's buffer is full is not recorded as reported,
+// so the change is reported again with a later Sample.
+func (p *Poller) SubscribeChanges(buffer int, filter *ChangeFilter,
+	names ...string) <-chan ChangeEvent {
+	ch := make(chan ChangeEvent, buffer)
+	p.subscribe(&subscriber{
+		f: func(s Sample) {
+			e, ok := filter.peek(s)
+			if !ok {
+				return
+			}
+			select {
+			case ch <- e:
+				filter.commit(e)
+			default:
+			}
+		},
+		done: func() { close(ch) },
+	}, names)
+	return ch
+}
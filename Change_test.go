@@ -0,0 +1,214 @@
+package modbus
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+type changeTest struct {
+	Value   interface{}
+	Quality Quality
+	Reason  ChangeReason // Zero if not reported
+}
+
+func testChangeFilter(t *testing.T, name string, f *ChangeFilter,
+	tag string, tests []changeTest) {
+	start := time.Now()
+	for i, test := range tests {
+		s := Sample{Poll: "poll", Tag: tag, Value: test.Value,
+			Quality: test.Quality,
+			Time:    start.Add(time.Duration(i) * time.Second)}
+		if QualityCommError == test.Quality {
+			s.Err = errors.New("Test failure")
+		}
+		e, ok := f.Filter(s)
+		if ok != (0 != test.Reason) || (ok && e.Reason != test.Reason) {
+			t.Errorf("%v %v: Sample %v: expected %v but got %v %v",
+				name, i, test.Value, test.Reason, ok, e.Reason)
+		}
+	}
+}
+
+func TestChangeFilter(t *testing.T) {
+	testChangeFilter(t, "Default", &ChangeFilter{}, "x", []changeTest{
+		{uint16(1), QualityGood, ReasonInitial},
+		{uint16(1), QualityGood, 0},
+		{uint16(2), QualityGood, ReasonChange},
+		{nil, QualityCommError, ReasonQuality},
+		{nil, QualityCommError, 0},
+		{uint16(2), QualityGood, ReasonQuality},
+		{uint16(2), QualityStale, ReasonQuality},
+		{"a", QualityGood, ReasonQuality},
+		{"b", QualityGood, ReasonChange},
+	})
+
+	testChangeFilter(t, "Absolute", &ChangeFilter{
+		ChangeOptions: ChangeOptions{Absolute: 0.5},
+	}, "x", []changeTest{
+		{10.0, QualityGood, ReasonInitial},
+		{10.4, QualityGood, 0},
+		{10.5, QualityGood, 0},
+		// Drift is measured from the last reported value.
+		{10.6, QualityGood, ReasonChange},
+		{10.2, QualityGood, 0},
+		{9.9, QualityGood, ReasonChange},
+	})
+
+	testChangeFilter(t, "Percent", &ChangeFilter{
+		Options: map[string]ChangeOptions{"x": {Percent: 10}},
+	}, "x", []changeTest{
+		{int32(100), QualityGood, ReasonInitial},
+		{int32(109), QualityGood, 0},
+		{int32(111), QualityGood, ReasonChange},
+		{int32(100), QualityGood, 0},
+		{int32(99), QualityGood, ReasonChange},
+	})
+
+	testChangeFilter(t, "Rising", &ChangeFilter{
+		Options: map[string]ChangeOptions{"poll": {Edge: EdgeRising}},
+	}, "x", []changeTest{
+		{false, QualityGood, ReasonInitial},
+		{true, QualityGood, ReasonChange},
+		{false, QualityGood, 0},
+		{false, QualityGood, 0},
+		{true, QualityGood, ReasonChange},
+		{true, QualityGood, 0},
+	})
+
+	testChangeFilter(t, "Falling", &ChangeFilter{
+		ChangeOptions: ChangeOptions{Edge: EdgeFalling},
+	}, "x", []changeTest{
+		{true, QualityGood, ReasonInitial},
+		{false, QualityGood, ReasonChange},
+		{true, QualityGood, 0},
+		{false, QualityGood, ReasonChange},
+	})
+
+	testChangeFilter(t, "Integrity", &ChangeFilter{
+		ChangeOptions: ChangeOptions{Absolute: 1,
+			Integrity: 3 * time.Second},
+	}, "x", []changeTest{
+		{uint16(1), QualityGood, ReasonInitial},
+		{uint16(1), QualityGood, 0},
+		{uint16(2), QualityGood, 0},
+		{uint16(1), QualityGood, ReasonIntegrity},
+		{uint16(3), QualityGood, ReasonChange},
+		{uint16(3), QualityGood, 0},
+		{uint16(3), QualityGood, 0},
+		{uint16(3), QualityGood, ReasonIntegrity},
+	})
+}
+
+func TestChangeFilterData(t *testing.T) {
+	f := &ChangeFilter{}
+	for i, test := range []struct {
+		data   string
+		report bool
+	}{{"\x00\x01", true}, {"\x00\x01", false}, {"\x00\x02", true}} {
+		_, ok := f.Filter(Sample{Poll: "query", Data: []byte(test.data)})
+		if ok != test.report {
+			t.Errorf("Sample %v: expected %v but got %v", i, test.report,
+				ok)
+		}
+	}
+}
+
+func TestChangeFilterReset(t *testing.T) {
+	f := &ChangeFilter{}
+	s := Sample{Poll: "poll", Tag: "x", Value: uint16(1)}
+	for i, want := range []ChangeReason{ReasonInitial, 0, ReasonInitial} {
+		if 2 == i {
+			f.Reset("poll", "y")
+			f.Reset("poll", "x")
+		}
+		e, ok := f.Filter(s)
+		if ok != (0 != want) || (ok && e.Reason != want) {
+			t.Errorf("Sample %v: expected %v but got %v %v", i, want, ok,
+				e.Reason)
+		}
+	}
+}
+
+func TestPollerChanges(t *testing.T) {
+	s := newTestRegisterSender()
+	s.registers[10] = 200
+	p := NewPoller(s)
+	if err := p.Add(Poll{Name: "tags", Interval: 5 * time.Millisecond,
+		Tags: testPollTags}); nil != err {
+		t.Fatal(err)
+	}
+	ch := p.SubscribeChanges(10, &ChangeFilter{
+		ChangeOptions: ChangeOptions{Absolute: 1},
+	}, "temp")
+	stop := runPoller(t, p)
+	defer stop()
+
+	e := nextChange(t, ch)
+	if ReasonInitial != e.Reason || !approx(e.Value, 20) {
+		t.Errorf("Unexpected ChangeEvent: %+v", e)
+	}
+	// 0.5 is within the deadband.
+	s.Lock()
+	s.registers[10] = 205
+	s.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	s.Lock()
+	s.registers[10] = 250
+	s.Unlock()
+	e = nextChange(t, ch)
+	if ReasonChange != e.Reason || !approx(e.Value, 25) ||
+		!approx(e.Previous, 20) {
+		t.Errorf("Unexpected ChangeEvent: %+v", e)
+	}
+}
+
+func TestPollerChangesDropped(t *testing.T) {
+	s := newTestRegisterSender()
+	s.registers[10] = 200
+	p := NewPoller(s)
+	if err := p.Add(Poll{Name: "tags", Interval: 5 * time.Millisecond,
+		Tags: testPollTags}); nil != err {
+		t.Fatal(err)
+	}
+	// Without a buffer, the ChangeEvents are dropped while the reader is
+	// busy.
+	ch := p.SubscribeChanges(0, &ChangeFilter{}, "temp")
+	stop := runPoller(t, p)
+	defer stop()
+
+	time.Sleep(20 * time.Millisecond)
+	e := nextChange(t, ch)
+	if ReasonInitial != e.Reason || !approx(e.Value, 20) {
+		t.Errorf("Unexpected ChangeEvent: %+v", e)
+	}
+	s.Lock()
+	s.registers[10] = 250
+	s.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	e = nextChange(t, ch)
+	if ReasonChange != e.Reason || !approx(e.Value, 25) ||
+		!approx(e.Previous, 20) {
+		t.Errorf("Unexpected ChangeEvent: %+v", e)
+	}
+}
+
+// approx returns whether the numeric value v is close to want.
+func approx(v interface{}, want float64) bool {
+	f, ok := ToFloat64(v)
+	return ok && math.Abs(f-want) < 1e-9
+}
+
+// nextChange returns the next ChangeEvent from ch or fails the test after a
+// second.
+func nextChange(t *testing.T, ch <-chan ChangeEvent) ChangeEvent {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("No ChangeEvent received")
+	}
+	return ChangeEvent{}
+}
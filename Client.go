@@ -30,6 +30,7 @@
 package modbus
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -40,12 +41,18 @@ import (
 // Host string holds the full path to the serial device (Linux) or the name of
 // the COM port (Windows) and BaudRate must be specified. The Timeout is
 // the response timeout for the the underlying connection.
+//
+// For ModeRTU and ModeASCII, write Queries with a SlaveID of 0 are broadcast
+// to all slaves and no response is awaited. The TurnaroundDelay is then
+// observed before the next Query is sent. If it is zero,
+// DefaultTurnaroundDelay is used.
 type ConnectionSettings struct {
 	Mode
-	Host    string
-	Baud    uint
-	Timeout time.Duration
-	Debug   bool
+	Host            string
+	Baud            uint
+	Timeout         time.Duration
+	TurnaroundDelay time.Duration
+	Debug           bool
 }
 
 // GetClientHandle returns a new ClientHandle for a client with the given
@@ -167,30 +174,108 @@ type ClientHandle interface {
 	// Send sends the Query to the underlying client for transmission and
 	// waits for the response data.
 	Send(q Query) ([]byte, error)
+	// SendContext is like Send but gives up waiting for the Query to be
+	// sent or for its response when the ctx is done, and returns
+	// ctx.Err().
+	SendContext(ctx context.Context, q Query) ([]byte, error)
+	// SendRaw sends the data as the PDU for the fCode to the underlying
+	// client for transmission and waits for the raw response PDU. See
+	// Packager.SendRaw.
+	SendRaw(slaveID byte, fCode FunctionCode, data []byte) ([]byte, error)
 	// Close closes the ClientHandle. Once all ClientHandles for a given Client
 	// have been closed, the Client will shutdown.
 	Close() error
 	// GetConnectionSettings returns the ConnectionSettings for the client
 	// associated with this ClientHandle.
 	GetConnectionSettings() ConnectionSettings
+	// Device returns a Device that sends Queries to slaveID through this
+	// ClientHandle using the opts.
+	Device(slaveID byte, opts DeviceOptions) *Device
+
+	// ReadCoils reads quantity coils starting at address.
+	ReadCoils(ctx context.Context, slaveID byte,
+		address, quantity uint16) ([]bool, error)
+	// ReadDiscreteInputs reads quantity discrete inputs starting at
+	// address.
+	ReadDiscreteInputs(ctx context.Context, slaveID byte,
+		address, quantity uint16) ([]bool, error)
+	// ReadHoldingRegisters reads quantity holding registers starting at
+	// address.
+	ReadHoldingRegisters(ctx context.Context, slaveID byte,
+		address, quantity uint16) ([]uint16, error)
+	// ReadInputRegisters reads quantity input registers starting at
+	// address.
+	ReadInputRegisters(ctx context.Context, slaveID byte,
+		address, quantity uint16) ([]uint16, error)
+	// WriteCoil sets the coil at address to value.
+	WriteCoil(ctx context.Context, slaveID byte, address uint16,
+		value bool) error
+	// WriteCoils sets len(values) coils starting at address.
+	WriteCoils(ctx context.Context, slaveID byte, address uint16,
+		values []bool) error
+	// WriteRegister sets the holding register at address to value.
+	WriteRegister(ctx context.Context, slaveID byte,
+		address, value uint16) error
+	// WriteRegisters sets len(values) holding registers starting at
+	// address.
+	WriteRegisters(ctx context.Context, slaveID byte, address uint16,
+		values []uint16) error
+	// MaskWriteRegister modifies the holding register at address using
+	// the andMask and orMask.
+	MaskWriteRegister(ctx context.Context, slaveID byte,
+		address, andMask, orMask uint16) error
 }
 
 // clientHandle is the underlying type implementing ClientHandle.
 type clientHandle struct {
 	queryQueue chan query
-	response   chan queryResponse
 	ConnectionSettings
 }
 
 // Send sends a Query to the associated Client and returns the response and
 // error.
 func (ch *clientHandle) Send(q Query) ([]byte, error) {
+	return ch.SendContext(context.Background(), q)
+}
+
+// SendContext sends a Query to the associated Client and returns the
+// response and error, or ctx.Err() if the ctx is done first.
+func (ch *clientHandle) SendContext(ctx context.Context, q Query) ([]byte,
+	error) {
+	return ch.send(query{ctx: ctx, Query: q})
+}
+
+// SendRaw sends a raw PDU to the associated Client and returns the raw
+// response PDU and error.
+func (ch *clientHandle) SendRaw(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	return ch.send(query{
+		ctx:     context.Background(),
+		Query:   Query{SlaveID: slaveID, FunctionCode: fCode},
+		raw:     true,
+		rawData: data,
+	})
+}
+
+// send queues the qry for the associated Client and waits for its response.
+// Each query gets its own buffered response channel so that a response that
+// is no longer awaited never blocks the Client.
+func (ch *clientHandle) send(qry query) ([]byte, error) {
 	if nil == ch.queryQueue {
 		return nil, fmt.Errorf("ClientHandle has been closed")
 	}
-	ch.queryQueue <- query{Query: q, response: ch.response}
-	res := <-ch.response
-	return res.data, res.err
+	qry.response = make(chan queryResponse, 1)
+	select {
+	case ch.queryQueue <- qry:
+	case <-qry.ctx.Done():
+		return nil, qry.ctx.Err()
+	}
+	select {
+	case res := <-qry.response:
+		return res.data, res.err
+	case <-qry.ctx.Done():
+		return nil, qry.ctx.Err()
+	}
 }
 
 // Close closes the ClientHandle. Once all ClientHandles for a given Client
@@ -200,7 +285,6 @@ func (ch *clientHandle) Close() error {
 		return fmt.Errorf("ClientHandle was already closed")
 	}
 	close(ch.queryQueue)
-	close(ch.response)
 	ch.queryQueue = nil
 	return nil
 }
@@ -250,7 +334,6 @@ func (c *client) newClientHandle() (*clientHandle, error) {
 	ch := &clientHandle{
 		ConnectionSettings: c.ConnectionSettings,
 		queryQueue:         qq,
-		response:           make(chan queryResponse),
 	}
 	return ch, nil
 }
@@ -274,17 +357,42 @@ func (c *client) queryListener() {
 	// Set up connection for slave
 	for qry := range c.queries {
 		qry := qry
+		if err := qry.ctx.Err(); nil != err {
+			// The sender is no longer waiting for the response.
+			go qry.sendResponse(nil, err)
+			continue
+		}
 		time.Sleep(15 * time.Millisecond)
-		d, e := c.Send(qry.Query)
+		if qry.timeout > 0 {
+			c.SetTimeout(qry.timeout)
+		}
+		var d []byte
+		var e error
+		if qry.raw {
+			d, e = c.SendRaw(qry.SlaveID, qry.FunctionCode, qry.rawData)
+		} else {
+			d, e = c.Send(qry.Query)
+		}
+		if qry.timeout > 0 {
+			c.SetTimeout(c.Timeout)
+		}
 		go qry.sendResponse(d, e)
 	}
 }
 
 // query encapsulates a Query with a queryResponse channel so it can be sent to
-// a Client.
+// a Client. If raw is true, the rawData is sent as the PDU for the Query's
+// SlaveID and FunctionCode using SendRaw. Queries whose ctx is done by the
+// time they reach the front of the queue are not sent. A non-zero timeout
+// overrides the Client's Timeout for this query only.
 type query struct {
 	Query
+	ctx      context.Context
 	response chan queryResponse
+	timeout  time.Duration
+
+	raw     bool
+	rawData []byte
 }
 
 // sendResponse is used by Clients for sending the return queryResponse.
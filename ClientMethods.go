@@ -0,0 +1,111 @@
+package modbus
+
+import "context"
+
+// QuerySender sends Queries with a context and returns the response data. It
+// is implemented by ClientHandles and Devices.
+type QuerySender interface {
+	SendContext(ctx context.Context, q Query) ([]byte, error)
+}
+
+// readBits sends the ReadCoils or ReadDiscreteInputs Query q and decodes the
+// response.
+func readBits(ctx context.Context, s QuerySender, q Query,
+	err error) ([]bool, error) {
+	if nil != err {
+		return nil, err
+	}
+	data, err := s.SendContext(ctx, q)
+	if nil != err {
+		return nil, err
+	}
+	return DecodeCoils(data, q.Quantity)
+}
+
+// readRegisters sends the ReadHoldingRegisters or ReadInputRegisters Query q
+// and decodes the response.
+func readRegisters(ctx context.Context, s QuerySender, q Query,
+	err error) ([]uint16, error) {
+	if nil != err {
+		return nil, err
+	}
+	data, err := s.SendContext(ctx, q)
+	if nil != err {
+		return nil, err
+	}
+	return DecodeUint16(data, ByteOrderABCD)
+}
+
+// write sends the write Query q and discards the echoed response.
+func write(ctx context.Context, s QuerySender, q Query, err error) error {
+	if nil != err {
+		return err
+	}
+	_, err = s.SendContext(ctx, q)
+	return err
+}
+
+// ReadCoils reads quantity coils starting at address.
+func (ch *clientHandle) ReadCoils(ctx context.Context, slaveID byte,
+	address, quantity uint16) ([]bool, error) {
+	q, err := ReadCoils(slaveID, address, quantity)
+	return readBits(ctx, ch, q, err)
+}
+
+// ReadDiscreteInputs reads quantity discrete inputs starting at address.
+func (ch *clientHandle) ReadDiscreteInputs(ctx context.Context, slaveID byte,
+	address, quantity uint16) ([]bool, error) {
+	q, err := ReadDiscreteInputs(slaveID, address, quantity)
+	return readBits(ctx, ch, q, err)
+}
+
+// ReadHoldingRegisters reads quantity holding registers starting at address.
+func (ch *clientHandle) ReadHoldingRegisters(ctx context.Context,
+	slaveID byte, address, quantity uint16) ([]uint16, error) {
+	q, err := ReadHoldingRegisters(slaveID, address, quantity)
+	return readRegisters(ctx, ch, q, err)
+}
+
+// ReadInputRegisters reads quantity input registers starting at address.
+func (ch *clientHandle) ReadInputRegisters(ctx context.Context, slaveID byte,
+	address, quantity uint16) ([]uint16, error) {
+	q, err := ReadInputRegisters(slaveID, address, quantity)
+	return readRegisters(ctx, ch, q, err)
+}
+
+// WriteCoil sets the coil at address to value.
+func (ch *clientHandle) WriteCoil(ctx context.Context, slaveID byte,
+	address uint16, value bool) error {
+	q, err := WriteSingleCoil(slaveID, address, value)
+	return write(ctx, ch, q, err)
+}
+
+// WriteCoils sets len(values) coils starting at address.
+func (ch *clientHandle) WriteCoils(ctx context.Context, slaveID byte,
+	address uint16, values []bool) error {
+	q, err := WriteMultipleCoils(slaveID, address, values)
+	return write(ctx, ch, q, err)
+}
+
+// WriteRegister sets the holding register at address to value.
+func (ch *clientHandle) WriteRegister(ctx context.Context, slaveID byte,
+	address, value uint16) error {
+	q, err := WriteSingleRegister(slaveID, address, value)
+	return write(ctx, ch, q, err)
+}
+
+// WriteRegisters sets len(values) holding registers starting at address.
+func (ch *clientHandle) WriteRegisters(ctx context.Context, slaveID byte,
+	address uint16, values []uint16) error {
+	q, err := WriteMultipleRegisters(slaveID, address, uint16(len(values)),
+		values)
+	return write(ctx, ch, q, err)
+}
+
+// MaskWriteRegister modifies the holding register at address using the
+// andMask and orMask.
+func (ch *clientHandle) MaskWriteRegister(ctx context.Context, slaveID byte,
+	address, andMask, orMask uint16) error {
+	q, err := MaskWriteRegister(slaveID, address, andMask, orMask)
+	return write(ctx, ch, q, err)
+}
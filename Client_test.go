@@ -1,6 +1,8 @@
 package modbus
 
 import (
+	"context"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -21,6 +23,8 @@ func TestClient(t *testing.T) {
 	})
 
 	t.Run("Send", runSendTests)
+	t.Run("TypedMethods", runTypedMethodTests)
+	t.Run("Device", runDeviceTests)
 
 	// Shutdown the clntMngr, this is just for testing purposes to avoid a
 	// data race
@@ -142,3 +146,112 @@ func runSendTests(t *testing.T) {
 		}
 	}
 }
+
+func runTypedMethodTests(t *testing.T) {
+	for _, cs := range testConSettings {
+		if cs.isValid {
+			cs := cs
+			t.Run(ModeNames[cs.Mode], func(t *testing.T) {
+				testTypedMethods(t, cs.ConnectionSettings)
+			})
+		}
+	}
+}
+
+func testTypedMethods(t *testing.T, cs ConnectionSettings) {
+	ch, err := GetClientHandle(cs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ch.Close()
+	ctx := context.Background()
+
+	regs := []uint16{1, 2, 3}
+	if err := ch.WriteRegisters(ctx, 1, 10, regs); nil != err {
+		t.Fatal(err)
+	}
+	if err := ch.WriteRegister(ctx, 1, 12, 4); nil != err {
+		t.Fatal(err)
+	}
+	if err := ch.MaskWriteRegister(ctx, 1, 10, 0xFFFE, 0); nil != err {
+		t.Fatal(err)
+	}
+	got, err := ch.ReadHoldingRegisters(ctx, 1, 10, 3)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []uint16{0, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadHoldingRegisters want: %v got: %v", want, got)
+	}
+	if got, err := ch.ReadInputRegisters(ctx, 1, 0, 5); nil != err ||
+		len(got) != 5 {
+		t.Errorf("ReadInputRegisters got: %v, %v", got, err)
+	}
+
+	coils := []bool{true, false, true}
+	if err := ch.WriteCoils(ctx, 1, 3, coils); nil != err {
+		t.Fatal(err)
+	}
+	if err := ch.WriteCoil(ctx, 1, 4, true); nil != err {
+		t.Fatal(err)
+	}
+	gotCoils, err := ch.ReadCoils(ctx, 1, 3, 3)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []bool{true, true, true}; !reflect.DeepEqual(gotCoils, want) {
+		t.Errorf("ReadCoils want: %v got: %v", want, gotCoils)
+	}
+	if got, err := ch.ReadDiscreteInputs(ctx, 1, 0, 9); nil != err ||
+		len(got) != 9 {
+		t.Errorf("ReadDiscreteInputs got: %v, %v", got, err)
+	}
+
+	if _, err := ch.ReadHoldingRegisters(ctx, 1, 0, 0); nil == err {
+		t.Error("Invalid Query err is nil")
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := ch.ReadCoils(canceled, 1, 0, 1); context.Canceled != err {
+		t.Errorf("Canceled err want: %v got: %v", context.Canceled, err)
+	}
+}
+
+func runDeviceTests(t *testing.T) {
+	for _, cs := range testConSettings {
+		if cs.isValid {
+			cs := cs
+			t.Run(ModeNames[cs.Mode], func(t *testing.T) {
+				testDevice(t, cs.ConnectionSettings)
+			})
+		}
+	}
+}
+
+func testDevice(t *testing.T, cs ConnectionSettings) {
+	ch, err := GetClientHandle(cs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ch.Close()
+	ctx := context.Background()
+
+	d := ch.Device(1, DeviceOptions{
+		Timeout:       2 * cs.Timeout,
+		AddressOffset: -1,
+		MaxRegisters:  4,
+	})
+	if err := d.WriteRegisters(ctx, 21, []uint16{5, 6}); nil != err {
+		t.Fatal(err)
+	}
+	got, err := ch.ReadHoldingRegisters(ctx, 1, 20, 2)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []uint16{5, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Device offset want: %v got: %v", want, got)
+	}
+	if _, err := d.ReadHoldingRegisters(ctx, 21, 5); nil == err {
+		t.Error("MaxRegisters exceeded err is nil")
+	}
+}
@@ -0,0 +1,34 @@
+package modbus
+
+import "fmt"
+
+// packCoils packs the coil states into bytes as they are transmitted: the
+// first coil is the least significant bit of the first byte.
+func packCoils(coils []bool) []byte {
+	packed := make([]byte, (len(coils)+7)/8)
+	for i, c := range coils {
+		if c {
+			packed[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return packed
+}
+
+// unpackCoils returns the first quantity coil states packed in data.
+func unpackCoils(data []byte, quantity int) []bool {
+	coils := make([]bool, quantity)
+	for i := range coils {
+		coils[i] = data[i/8]&(1<<uint(i%8)) != 0
+	}
+	return coils
+}
+
+// DecodeCoils decodes the data returned by a ReadCoils or ReadDiscreteInputs
+// Query into exactly quantity coil states.
+func DecodeCoils(data []byte, quantity uint16) ([]bool, error) {
+	if expected := (int(quantity) + 7) / 8; len(data) != expected {
+		return nil, fmt.Errorf("len(data) should be %v for %v coils but "+
+			"it is: %v", expected, quantity, len(data))
+	}
+	return unpackCoils(data, int(quantity)), nil
+}
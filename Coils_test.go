@@ -0,0 +1,53 @@
+package modbus
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCoils(t *testing.T) {
+	coils := []bool{true, false, false, false, false, false, false, true,
+		true, false}
+	q, err := WriteMultipleCoils(1, 20, coils)
+	if nil != err {
+		t.Fatal(err)
+	}
+	data, err := q.data()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 20, 0, 10, 2, 0x81, 0x01}; !bytes.Equal(data, want) {
+		t.Errorf("data want: %x got: %x", want, data)
+	}
+	for _, q := range []Query{
+		{FunctionCode: FunctionWriteMultipleCoils, SlaveID: 1,
+			Quantity: 3, Coils: coils},
+		{FunctionCode: FunctionWriteMultipleCoils, SlaveID: 1,
+			Quantity: 10, Coils: coils, Values: []uint16{0x8101}},
+		{FunctionCode: FunctionWriteMultipleRegisters, SlaveID: 1,
+			Quantity: 10, Coils: coils},
+	} {
+		if _, err := q.IsValid(); nil == err {
+			t.Errorf("%+v is valid", q)
+		}
+	}
+
+	decoded, err := DecodeCoils([]byte{0x81, 0x01}, uint16(len(coils)))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, coils) {
+		t.Errorf("DecodeCoils want: %v got: %v", coils, decoded)
+	}
+	if _, err := DecodeCoils([]byte{0x81}, 10); nil == err {
+		t.Error("Short data err is nil")
+	}
+	if _, err := DecodeCoils([]byte{0x81, 0, 0}, 10); nil == err {
+		t.Error("Long data err is nil")
+	}
+
+	if _, err := WriteMultipleCoils(1, 0, nil); nil == err {
+		t.Error("No coils err is nil")
+	}
+}
@@ -1,7 +1,9 @@
 package modbus
 
 import (
+	"context"
 	"errors"
+	"net"
 )
 
 // Mode is the modbus connection mode type.
@@ -32,6 +34,10 @@ const (
 	MaxTCPSize   = 260
 )
 
+// MaxPDUSize is the maximum number of bytes in a Modbus PDU, i.e. the
+// FunctionCode and its data.
+const MaxPDUSize = 253
+
 // FunctionCode is the modbus function code type.
 type FunctionCode byte
 
@@ -45,6 +51,7 @@ const (
 	FunctionWriteSingleRegister                 = 0x06
 	FunctionWriteMultipleCoils                  = 0x0F
 	FunctionWriteMultipleRegisters              = 0x10
+	FunctionReportServerID                      = 0x11
 	FunctionMaskWriteRegister                   = 0x16
 )
 
@@ -58,6 +65,7 @@ var FunctionNames = map[FunctionCode]string{
 	FunctionWriteSingleRegister:    "WriteSingleRegister",
 	FunctionWriteMultipleCoils:     "WriteMultipleCoils",
 	FunctionWriteMultipleRegisters: "WriteMultipleRegisters",
+	FunctionReportServerID:         "ReportServerID",
 	FunctionMaskWriteRegister:      "MaskWriteRegister",
 }
 
@@ -138,3 +146,49 @@ var exceptions = map[uint16]error{
 	exceptionBadChecksum: errors.New(
 		"Response Error: Bad Checksum"),
 }
+
+// ExceptionNames maps the codes of the exceptions, as returned by
+// ExceptionCode, to short names suitable as metric labels. Codes 0x01 to 0x0B
+// are Modbus exception responses, the others are errors in the response.
+var ExceptionNames = map[uint16]string{
+	exceptionUnknown:                            "unknown",
+	exceptionIllegalFunction:                    "illegal-function",
+	exceptionDataAddress:                        "illegal-data-address",
+	exceptionDataValue:                          "illegal-data-value",
+	exceptionSlaveDeviceFailure:                 "slave-device-failure",
+	exceptionAcknowledge:                        "acknowledge",
+	exceptionSlaveDeviceBusy:                    "slave-device-busy",
+	exceptionMemoryParityError:                  "memory-parity-error",
+	exceptionGatewayPathUnavailable:             "gateway-path-unavailable",
+	exceptionGatewayTargetDeviceFailedToRespond: "gateway-target-no-response",
+
+	exceptionEmptyResponse:          "empty-response",
+	exceptionBadResponseLength:      "bad-response-length",
+	exceptionBadFraming:             "bad-framing",
+	exceptionSlaveIDMismatch:        "slave-id-mismatch",
+	exceptionWriteDataMismatch:      "write-data-mismatch",
+	exceptionResponseLengthMismatch: "response-length-mismatch",
+	exceptionBadChecksum:            "bad-checksum",
+}
+
+// ExceptionCode returns the code of the exception if err is, or wraps, a
+// Modbus exception response or an error in the response. See ExceptionNames.
+func ExceptionCode(err error) (uint16, bool) {
+	for code, e := range exceptions {
+		if errors.Is(err, e) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// IsTimeout returns whether err is the result of a Query that received no
+// response in time. A closed connection is not a timeout.
+func IsTimeout(err error) bool {
+	if errors.Is(err, errNoResponse) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
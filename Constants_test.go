@@ -0,0 +1,48 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestExceptionCode(t *testing.T) {
+	for code := range exceptions {
+		if _, ok := ExceptionNames[code]; !ok {
+			t.Errorf("Exception %#x has no name", code)
+		}
+	}
+	wrapped := &RangeError{Err: exceptions[exceptionDataAddress]}
+	if code, ok := ExceptionCode(wrapped); !ok ||
+		code != exceptionDataAddress {
+		t.Errorf("ExceptionCode want: %v got: %v %v",
+			exceptionDataAddress, code, ok)
+	}
+	if _, ok := ExceptionCode(errors.New("Other")); ok {
+		t.Error("ExceptionCode of an other error returned ok")
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	for _, err := range []error{
+		errNoResponse,
+		fmt.Errorf("Wrapped: %w", context.DeadlineExceeded),
+		&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded},
+	} {
+		if !IsTimeout(err) {
+			t.Errorf("IsTimeout(%v) returned false", err)
+		}
+	}
+	for _, err := range []error{
+		io.EOF,
+		exceptions[exceptionBadChecksum],
+	} {
+		if IsTimeout(err) {
+			t.Errorf("IsTimeout(%v) returned true", err)
+		}
+	}
+}
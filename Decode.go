@@ -0,0 +1,388 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Direction tells requests and responses apart, which share FunctionCodes but
+// not the layout of their data.
+type Direction byte
+
+// The Directions of a Frame.
+const (
+	DirectionRequest Direction = iota
+	DirectionResponse
+)
+
+// DirectionNames maps Direction to a string description.
+var DirectionNames = map[Direction]string{
+	DirectionRequest:  "request",
+	DirectionResponse: "response",
+}
+
+// String returns the name of the Direction.
+func (d Direction) String() string {
+	if s, ok := DirectionNames[d]; ok {
+		return s
+	}
+	return fmt.Sprintf("Direction(%d)", byte(d))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Frame describes a Modbus frame, see Decode. String renders it as a line of
+// text.
+type Frame struct {
+	Mode      Mode
+	Direction Direction
+
+	// TransactionID, ProtocolID and Length are the MBAP header of TCP
+	// frames.
+	TransactionID, ProtocolID, Length uint16
+
+	// SlaveID is the Unit ID of TCP frames.
+	SlaveID      byte
+	FunctionCode FunctionCode
+	// Exception is the exception code of an exception response, whose
+	// FunctionCode is that of the request, without the high bit.
+	Exception byte
+
+	// Address and Quantity are set for requests of the read and write
+	// functions, and for responses of the write functions, which have
+	// them. ByteCount is set for frames with a byte count.
+	Address, Quantity uint16
+	ByteCount         byte
+	// Coils are the coil and discrete input values, and Registers the
+	// register values, of the frame. Coils of read responses include the
+	// padding bits of the last byte, since the quantity is only known from
+	// the request.
+	Coils     []bool
+	Registers []uint16
+	// AndMask and OrMask are the masks of MaskWriteRegister.
+	AndMask, OrMask uint16
+	// Data is the data of the PDU following the FunctionCode.
+	Data []byte
+
+	// Checksum is the CRC of RTU frames or the LRC of ASCII frames, and
+	// ChecksumOK whether it matches the rest of the frame.
+	Checksum   uint16
+	ChecksumOK bool
+}
+
+// Decode decodes the raw frame, as sent or received in the mode, into a
+// Frame. RTU and TCP frames are raw bytes and ASCII frames the text including
+// the colon, and optionally the CR LF. The direction selects the layout of the
+// data of the standard FunctionCodes, while the data of other FunctionCodes is
+// only available as the Frame's Data.
+//
+// A bad checksum is reported by the Frame. Decode returns an error, along with
+// the part of the Frame that could be decoded, if the frame is malformed,
+// truncated, or longer than the layout of its FunctionCode and direction.
+func Decode(mode Mode, raw []byte, direction Direction) (Frame, error) {
+	f := Frame{Mode: mode, Direction: direction}
+	var pdu []byte
+	switch mode {
+	case ModeTCP:
+		if len(raw) < 8 {
+			return f, fmt.Errorf("TCP frame of %v bytes is too short",
+				len(raw))
+		}
+		f.TransactionID = binary.BigEndian.Uint16(raw[0:])
+		f.ProtocolID = binary.BigEndian.Uint16(raw[2:])
+		f.Length = binary.BigEndian.Uint16(raw[4:])
+		f.SlaveID = raw[6]
+		pdu = raw[7:]
+		f.ChecksumOK = true
+		if int(f.Length) != len(raw)-6 {
+			err := fmt.Errorf("MBAP length %v does not match the %v "+
+				"bytes following it", f.Length, len(raw)-6)
+			f.decodePDU(pdu)
+			return f, err
+		}
+	case ModeRTU:
+		if len(raw) < 4 {
+			return f, fmt.Errorf("RTU frame of %v bytes is too short",
+				len(raw))
+		}
+		n := len(raw) - 2
+		f.SlaveID = raw[0]
+		pdu = raw[1:n]
+		f.Checksum = binary.LittleEndian.Uint16(raw[n:])
+		f.ChecksumOK = crc(raw[:n]) == f.Checksum
+	case ModeASCII:
+		text := bytes.TrimSuffix(raw, []byte("\r\n"))
+		if len(text) < 7 || ':' != text[0] || len(text)%2 != 1 {
+			return f, fmt.Errorf("Invalid ASCII frame: %q", raw)
+		}
+		data := make([]byte, len(text)/2)
+		if _, err := hex.Decode(data, text[1:]); nil != err {
+			return f, fmt.Errorf("Invalid ASCII frame: %v", err)
+		}
+		n := len(data) - 1
+		f.SlaveID = data[0]
+		pdu = data[1:n]
+		f.Checksum = uint16(data[n])
+		f.ChecksumOK = lrc(data[:n]) == data[n]
+	default:
+		return f, fmt.Errorf("Invalid Mode: %v", byte(mode))
+	}
+	return f, f.decodePDU(pdu)
+}
+
+// decodePDU decodes the FunctionCode and data of the pdu.
+func (f *Frame) decodePDU(pdu []byte) error {
+	f.FunctionCode = FunctionCode(pdu[0] &^ 0x80)
+	f.Data = pdu[1:]
+	data := f.Data
+	if pdu[0]&0x80 != 0 {
+		if len(data) != 1 {
+			return fmt.Errorf("Exception response with %v bytes of data",
+				len(data))
+		}
+		f.Exception = data[0]
+		return nil
+	}
+
+	request := DirectionRequest == f.Direction
+	// need checks that the data holds at least n bytes.
+	need := func(n int) error {
+		if len(data) < n {
+			return fmt.Errorf("%v %v of %v bytes is truncated",
+				f.functionName(), f.Direction, len(f.Data))
+		}
+		return nil
+	}
+	uint16At := func(i int) uint16 {
+		return binary.BigEndian.Uint16(data[i:])
+	}
+	// byteCount decodes the byte count at data[i] and returns the data
+	// following it.
+	byteCount := func(i int) ([]byte, error) {
+		if err := need(i + 1); nil != err {
+			return nil, err
+		}
+		f.ByteCount = data[i]
+		values := data[i+1:]
+		if len(values) < int(f.ByteCount) {
+			return values, fmt.Errorf("Byte count %v exceeds the %v "+
+				"bytes following it", f.ByteCount, len(values))
+		}
+		return values[:f.ByteCount], nil
+	}
+	// length is the expected length of the data, if it is known.
+	length := -1
+	var err error
+	switch f.FunctionCode {
+	case FunctionReadCoils, FunctionReadDiscreteInputs,
+		FunctionReadHoldingRegisters, FunctionReadInputRegisters:
+		if request {
+			length = 4
+			if err = need(4); nil == err {
+				f.Address, f.Quantity = uint16At(0), uint16At(2)
+			}
+			break
+		}
+		var values []byte
+		values, err = byteCount(0)
+		length = 1 + int(f.ByteCount)
+		if FunctionReadCoils == f.FunctionCode ||
+			FunctionReadDiscreteInputs == f.FunctionCode {
+			f.Coils = decodeBits(values, 8*len(values))
+		} else {
+			f.Registers = decodeRegisters(values)
+		}
+	case FunctionWriteSingleCoil, FunctionWriteSingleRegister:
+		// Responses echo the request.
+		length = 4
+		if err = need(4); nil == err {
+			f.Address = uint16At(0)
+			if FunctionWriteSingleCoil == f.FunctionCode {
+				f.Coils = []bool{0xFF00 == uint16At(2)}
+			} else {
+				f.Registers = []uint16{uint16At(2)}
+			}
+		}
+	case FunctionWriteMultipleCoils, FunctionWriteMultipleRegisters:
+		length = 4
+		if err = need(4); nil != err {
+			break
+		}
+		f.Address, f.Quantity = uint16At(0), uint16At(2)
+		if !request {
+			break
+		}
+		var values []byte
+		values, err = byteCount(4)
+		length = 5 + int(f.ByteCount)
+		if FunctionWriteMultipleCoils == f.FunctionCode {
+			n := int(f.Quantity)
+			if n > 8*len(values) {
+				n = 8 * len(values)
+			}
+			f.Coils = decodeBits(values, n)
+		} else {
+			f.Registers = decodeRegisters(values)
+		}
+	case FunctionMaskWriteRegister:
+		// Responses echo the request.
+		length = 6
+		if err = need(6); nil == err {
+			f.Address = uint16At(0)
+			f.AndMask, f.OrMask = uint16At(2), uint16At(4)
+		}
+	case FunctionReportServerID:
+		length = 0
+		if !request {
+			_, err = byteCount(0)
+			length = 1 + int(f.ByteCount)
+		}
+	}
+	if nil == err && length >= 0 && len(data) != length {
+		err = fmt.Errorf("%v %v has %v bytes of data, want %v",
+			f.functionName(), f.Direction, len(data), length)
+	}
+	return err
+}
+
+// decodeBits returns the first n bits of data, least significant bit first.
+func decodeBits(data []byte, n int) []bool {
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = data[i/8]&(1<<uint(i%8)) != 0
+	}
+	return bits
+}
+
+// decodeRegisters returns the big endian registers of data, ignoring an odd
+// last byte.
+func decodeRegisters(data []byte) []uint16 {
+	regs := make([]uint16, len(data)/2)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return regs
+}
+
+// functionName returns the name of the FunctionCode followed by its hex
+// value, or only the hex value if it is unknown.
+func (f Frame) functionName() string {
+	name, ok := FunctionNames[f.FunctionCode]
+	if !ok {
+		name = "Function"
+	}
+	return fmt.Sprintf("%v(0x%02X)", name, byte(f.FunctionCode))
+}
+
+// String renders the Frame as a line of text, e.g.
+//
+//	RTU request slave=1 ReadHoldingRegisters(0x03) address=100 quantity=2 crc=0xD485 ok
+//	TCP response tid=7 pid=0 len=7 unit=1 ReadHoldingRegisters(0x03) bytes=4 registers=[0x3FC0 0x0000]
+func (f Frame) String() string {
+	fields := []string{ModeNames[f.Mode], f.Direction.String()}
+	add := func(format string, a ...interface{}) {
+		fields = append(fields, fmt.Sprintf(format, a...))
+	}
+	if ModeTCP == f.Mode {
+		add("tid=%v pid=%v len=%v unit=%v", f.TransactionID,
+			f.ProtocolID, f.Length, f.SlaveID)
+	} else {
+		add("slave=%v", f.SlaveID)
+	}
+	add("%v", f.functionName())
+
+	request := DirectionRequest == f.Direction
+	switch {
+	case 0 != f.Exception:
+		name, ok := ExceptionNames[uint16(f.Exception)]
+		if !ok {
+			name = "unknown"
+		}
+		add("exception=%v(0x%02X)", name, f.Exception)
+	case FunctionReadCoils == f.FunctionCode,
+		FunctionReadDiscreteInputs == f.FunctionCode,
+		FunctionReadHoldingRegisters == f.FunctionCode,
+		FunctionReadInputRegisters == f.FunctionCode:
+		if request {
+			add("address=%v quantity=%v", f.Address, f.Quantity)
+		} else {
+			add("bytes=%v", f.ByteCount)
+		}
+	case FunctionWriteSingleCoil == f.FunctionCode,
+		FunctionWriteSingleRegister == f.FunctionCode:
+		add("address=%v", f.Address)
+	case FunctionWriteMultipleCoils == f.FunctionCode,
+		FunctionWriteMultipleRegisters == f.FunctionCode:
+		add("address=%v quantity=%v", f.Address, f.Quantity)
+		if request {
+			add("bytes=%v", f.ByteCount)
+		}
+	case FunctionMaskWriteRegister == f.FunctionCode:
+		add("address=%v and=0x%04X or=0x%04X", f.Address, f.AndMask,
+			f.OrMask)
+	case len(f.Data) > 0:
+		add("data=%x", f.Data)
+	}
+	if 0 == f.Exception {
+		switch {
+		case len(f.Coils) > 0:
+			add("coils=%v", formatCoils(f.Coils))
+		case len(f.Registers) > 0:
+			regs := make([]string, len(f.Registers))
+			for i, r := range f.Registers {
+				regs[i] = fmt.Sprintf("0x%04X", r)
+			}
+			add("registers=[%v]", strings.Join(regs, " "))
+		}
+	}
+	switch {
+	case ModeRTU == f.Mode:
+		add("crc=0x%04X", f.Checksum)
+	case ModeASCII == f.Mode:
+		add("lrc=0x%02X", f.Checksum)
+	}
+	if ModeTCP != f.Mode {
+		if f.ChecksumOK {
+			add("ok")
+		} else {
+			add("bad")
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// formatCoils formats the coils as a string of 0s and 1s in the order of
+// their addresses.
+func formatCoils(coils []bool) string {
+	var b strings.Builder
+	for _, c := range coils {
+		if c {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// logFrame logs the frame sent or received by a Packager with the Debug
+// setting, decoded and in hex, or as text for ASCII.
+func logFrame(prefix string, mode Mode, raw []byte, direction Direction) {
+	f, err := Decode(mode, raw, direction)
+	rawText := fmt.Sprintf("%x", raw)
+	if ModeASCII == mode {
+		rawText = strings.TrimSpace(string(raw))
+	}
+	if nil != err {
+		log.Printf("%v: %v: %v (%v)\n", prefix, f, err, rawText)
+		return
+	}
+	log.Printf("%v: %v (%v)\n", prefix, f, rawText)
+}
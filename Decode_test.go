@@ -0,0 +1,179 @@
+package modbus
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rtuFrame appends the CRC to the frame.
+func rtuFrame(frame ...byte) []byte {
+	c := crc(frame)
+	return append(frame, byte(c), byte(c>>8))
+}
+
+// asciiFrame encodes the frame with its LRC as ASCII.
+func asciiFrame(frame ...byte) []byte {
+	frame = append(frame, lrc(frame))
+	return []byte(":" + strings.ToUpper(hex.EncodeToString(frame)) + "\r\n")
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode Mode
+		raw  []byte
+		dir  Direction
+		want string
+	}{{
+		name: "RTU read request",
+		mode: ModeRTU,
+		raw:  rtuFrame(1, 0x03, 0x00, 0x64, 0x00, 0x02),
+		dir:  DirectionRequest,
+		want: "RTU request slave=1 ReadHoldingRegisters(0x03) " +
+			"address=100 quantity=2 crc=0x%04X ok",
+	}, {
+		name: "RTU read response",
+		mode: ModeRTU,
+		raw:  rtuFrame(1, 0x03, 4, 0x3F, 0xC0, 0x00, 0x00),
+		dir:  DirectionResponse,
+		want: "RTU response slave=1 ReadHoldingRegisters(0x03) bytes=4 " +
+			"registers=[0x3FC0 0x0000] crc=0x%04X ok",
+	}, {
+		name: "RTU coils response",
+		mode: ModeRTU,
+		raw:  rtuFrame(2, 0x01, 1, 0x05),
+		dir:  DirectionResponse,
+		want: "RTU response slave=2 ReadCoils(0x01) bytes=1 " +
+			"coils=10100000 crc=0x%04X ok",
+	}, {
+		name: "RTU exception",
+		mode: ModeRTU,
+		raw:  rtuFrame(1, 0x83, 0x02),
+		dir:  DirectionResponse,
+		want: "RTU response slave=1 ReadHoldingRegisters(0x03) " +
+			"exception=illegal-data-address(0x02) crc=0x%04X ok",
+	}, {
+		name: "ASCII write coils request",
+		mode: ModeASCII,
+		raw:  asciiFrame(1, 0x0F, 0x00, 0x13, 0x00, 0x0A, 2, 0xCD, 0x01),
+		dir:  DirectionRequest,
+		want: "ASCII request slave=1 WriteMultipleCoils(0x0F) " +
+			"address=19 quantity=10 bytes=2 coils=1011001110 " +
+			"lrc=0x%02X ok",
+	}, {
+		name: "ASCII write coil response",
+		mode: ModeASCII,
+		raw:  asciiFrame(1, 0x05, 0x00, 0xAC, 0xFF, 0x00),
+		dir:  DirectionResponse,
+		want: "ASCII response slave=1 WriteSingleCoil(0x05) address=172 " +
+			"coils=1 lrc=0x%02X ok",
+	}, {
+		name: "TCP write registers request",
+		mode: ModeTCP,
+		raw: []byte{0x00, 0x07, 0x00, 0x00, 0x00, 0x0B, 0x01, 0x10,
+			0x00, 0x01, 0x00, 0x02, 0x04, 0x00, 0x0A, 0x01, 0x02},
+		dir: DirectionRequest,
+		want: "TCP request tid=7 pid=0 len=11 unit=1 " +
+			"WriteMultipleRegisters(0x10) address=1 quantity=2 bytes=4 " +
+			"registers=[0x000A 0x0102]",
+	}, {
+		name: "TCP mask write response",
+		mode: ModeTCP,
+		raw: []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x08, 0x11, 0x16,
+			0x00, 0x04, 0x00, 0xF2, 0x00, 0x25},
+		dir: DirectionResponse,
+		want: "TCP response tid=1 pid=0 len=8 unit=17 " +
+			"MaskWriteRegister(0x16) address=4 and=0x00F2 or=0x0025",
+	}, {
+		name: "TCP unknown function",
+		mode: ModeTCP,
+		raw:  []byte{0, 2, 0, 0, 0, 4, 1, 0x64, 0xAB, 0xCD},
+		dir:  DirectionRequest,
+		want: "TCP request tid=2 pid=0 len=4 unit=1 Function(0x64) " +
+			"data=abcd",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := Decode(test.mode, test.raw, test.dir)
+			if nil != err {
+				t.Fatal(err)
+			}
+			want := test.want
+			if strings.Contains(want, "%") {
+				want = fmt.Sprintf(want, f.Checksum)
+			}
+			if got := f.String(); got != want {
+				t.Errorf("String\nwant: %v\n got: %v", want, got)
+			}
+		})
+	}
+
+	t.Run("Fields", func(t *testing.T) {
+		f, err := Decode(ModeRTU, rtuFrame(1, 0x10, 0x00, 0x01, 0x00,
+			0x02, 4, 0x00, 0x0A, 0x01, 0x02), DirectionRequest)
+		if nil != err {
+			t.Fatal(err)
+		}
+		want := Frame{Mode: ModeRTU, Direction: DirectionRequest,
+			SlaveID: 1, FunctionCode: FunctionWriteMultipleRegisters,
+			Address: 1, Quantity: 2, ByteCount: 4,
+			Registers: []uint16{0x000A, 0x0102},
+			Data: []byte{0x00, 0x01, 0x00, 0x02, 4, 0x00, 0x0A,
+				0x01, 0x02},
+			Checksum: f.Checksum, ChecksumOK: true}
+		if !reflect.DeepEqual(f, want) {
+			t.Errorf("want: %+v\n got: %+v", want, f)
+		}
+	})
+
+	t.Run("BadChecksum", func(t *testing.T) {
+		raw := rtuFrame(1, 0x03, 0x00, 0x00, 0x00, 0x01)
+		raw[len(raw)-1] ^= 0xFF
+		f, err := Decode(ModeRTU, raw, DirectionRequest)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if f.ChecksumOK || !strings.HasSuffix(f.String(), " bad") {
+			t.Errorf("bad CRC decoded as: %v", f)
+		}
+		raw = asciiFrame(1, 0x03, 0x00, 0x00, 0x00, 0x01)
+		raw[len(raw)-3] = '0'
+		if f, err = Decode(ModeASCII, raw, DirectionRequest); nil != err {
+			t.Fatal(err)
+		}
+		if f.ChecksumOK {
+			t.Errorf("bad LRC decoded as: %v", f)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		for _, test := range []struct {
+			mode Mode
+			raw  []byte
+			dir  Direction
+		}{
+			{ModeRTU, []byte{1, 3, 0}, DirectionRequest},
+			{ModeRTU, rtuFrame(1, 0x03, 0x00, 0x00), DirectionRequest},
+			{ModeRTU, rtuFrame(1, 0x03, 4, 0x00), DirectionResponse},
+			{ModeRTU, rtuFrame(1, 0x83), DirectionResponse},
+			{ModeRTU, rtuFrame(1, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00),
+				DirectionRequest},
+			{ModeRTU, rtuFrame(1, 0x03, 0x00, 0x00, 0x00, 0x01),
+				DirectionResponse},
+			{ModeASCII, []byte(":0103\r\n"), DirectionRequest},
+			{ModeASCII, []byte(":01030X0000FC\r\n"), DirectionRequest},
+			{ModeASCII, []byte("01030000FC\r\n"), DirectionRequest},
+			{ModeTCP, []byte{0, 1, 0, 0, 0}, DirectionRequest},
+			{ModeTCP, []byte{0, 1, 0, 0, 0, 9, 1, 3, 0, 0, 0, 1},
+				DirectionRequest},
+			{Mode(9), []byte{1, 3, 0, 0, 0, 1}, DirectionRequest},
+		} {
+			if f, err := Decode(test.mode, test.raw, test.dir); nil == err {
+				t.Errorf("%q decoded as: %v", test.raw, f)
+			}
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeviceOptions holds the settings for a single slave device on a shared
+// bus. The zero value of each field leaves the corresponding setting
+// unchanged.
+type DeviceOptions struct {
+	// Timeout overrides ConnectionSettings.Timeout for Queries sent to the
+	// device.
+	Timeout time.Duration
+	// AddressOffset is added to the Address of every Query sent to the
+	// device, e.g. -1 for devices documented with 1-based addresses.
+	AddressOffset int
+	// MaxRegisters limits the Quantity of register reads and writes sent
+	// to the device, for devices that support less than the protocol
+	// maximum.
+	MaxRegisters uint16
+	// MaxCoils limits the Quantity of coil and discrete input reads and
+	// coil writes sent to the device.
+	MaxCoils uint16
+}
+
+// Device sends Queries to a single slave device through a ClientHandle. The
+// SlaveID of every Query is set to the Device's SlaveID and its
+// DeviceOptions are applied. Queries still go through the shared queue of
+// the ClientHandle's Client, so Devices on the same bus never transmit at
+// the same time.
+type Device struct {
+	SlaveID byte
+	DeviceOptions
+
+	ch *clientHandle
+}
+
+// Device returns a Device bound to slaveID using the opts.
+func (ch *clientHandle) Device(slaveID byte, opts DeviceOptions) *Device {
+	return &Device{SlaveID: slaveID, DeviceOptions: opts, ch: ch}
+}
+
+// Send sends the Query to the Device and waits for the response data.
+func (d *Device) Send(q Query) ([]byte, error) {
+	return d.SendContext(context.Background(), q)
+}
+
+// SendContext is like Send but gives up waiting for the Query to be sent or
+// for its response when the ctx is done, and returns ctx.Err().
+func (d *Device) SendContext(ctx context.Context, q Query) ([]byte, error) {
+	q, err := d.prepare(q)
+	if nil != err {
+		return nil, err
+	}
+	return d.ch.send(query{ctx: ctx, Query: q, timeout: d.Timeout})
+}
+
+// SendRaw sends the data as the PDU for the fCode to the Device and waits
+// for the raw response PDU. See Packager.SendRaw. The AddressOffset and
+// quantity limits are not applied.
+func (d *Device) SendRaw(fCode FunctionCode, data []byte) ([]byte, error) {
+	return d.ch.send(query{
+		ctx:     context.Background(),
+		Query:   Query{SlaveID: d.SlaveID, FunctionCode: fCode},
+		timeout: d.Timeout,
+		raw:     true,
+		rawData: data,
+	})
+}
+
+// prepare returns a copy of q with the Device's SlaveID and AddressOffset
+// applied, or an error if the resulting Address is out of range or the
+// Quantity exceeds the Device's limits.
+func (d *Device) prepare(q Query) (Query, error) {
+	q.SlaveID = d.SlaveID
+	address := int(q.Address) + d.AddressOffset
+	if address < 0 || address > 0xFFFF {
+		return q, fmt.Errorf("Address %v with offset %v is out of range",
+			q.Address, d.AddressOffset)
+	}
+	q.Address = uint16(address)
+	if max := d.maxQuantity(q.FunctionCode); max > 0 && q.Quantity > max {
+		return q, fmt.Errorf("Quantity %v exceeds the device limit of %v",
+			q.Quantity, max)
+	}
+	return q, nil
+}
+
+// maxQuantity returns the Device's Quantity limit for the fCode, or 0 if
+// there is none.
+func (d *Device) maxQuantity(fCode FunctionCode) uint16 {
+	switch fCode {
+	case FunctionReadCoils, FunctionReadDiscreteInputs,
+		FunctionWriteMultipleCoils:
+		return d.MaxCoils
+	case FunctionReadHoldingRegisters, FunctionReadInputRegisters,
+		FunctionWriteMultipleRegisters:
+		return d.MaxRegisters
+	}
+	return 0
+}
+
+// ReadCoils reads quantity coils starting at address.
+func (d *Device) ReadCoils(ctx context.Context,
+	address, quantity uint16) ([]bool, error) {
+	q, err := ReadCoils(d.SlaveID, address, quantity)
+	return readBits(ctx, d, q, err)
+}
+
+// ReadDiscreteInputs reads quantity discrete inputs starting at address.
+func (d *Device) ReadDiscreteInputs(ctx context.Context,
+	address, quantity uint16) ([]bool, error) {
+	q, err := ReadDiscreteInputs(d.SlaveID, address, quantity)
+	return readBits(ctx, d, q, err)
+}
+
+// ReadHoldingRegisters reads quantity holding registers starting at address.
+func (d *Device) ReadHoldingRegisters(ctx context.Context,
+	address, quantity uint16) ([]uint16, error) {
+	q, err := ReadHoldingRegisters(d.SlaveID, address, quantity)
+	return readRegisters(ctx, d, q, err)
+}
+
+// ReadInputRegisters reads quantity input registers starting at address.
+func (d *Device) ReadInputRegisters(ctx context.Context,
+	address, quantity uint16) ([]uint16, error) {
+	q, err := ReadInputRegisters(d.SlaveID, address, quantity)
+	return readRegisters(ctx, d, q, err)
+}
+
+// WriteCoil sets the coil at address to value.
+func (d *Device) WriteCoil(ctx context.Context, address uint16,
+	value bool) error {
+	q, err := WriteSingleCoil(d.SlaveID, address, value)
+	return write(ctx, d, q, err)
+}
+
+// WriteCoils sets len(values) coils starting at address.
+func (d *Device) WriteCoils(ctx context.Context, address uint16,
+	values []bool) error {
+	q, err := WriteMultipleCoils(d.SlaveID, address, values)
+	return write(ctx, d, q, err)
+}
+
+// WriteRegister sets the holding register at address to value.
+func (d *Device) WriteRegister(ctx context.Context,
+	address, value uint16) error {
+	q, err := WriteSingleRegister(d.SlaveID, address, value)
+	return write(ctx, d, q, err)
+}
+
+// WriteRegisters sets len(values) holding registers starting at address.
+func (d *Device) WriteRegisters(ctx context.Context, address uint16,
+	values []uint16) error {
+	q, err := WriteMultipleRegisters(d.SlaveID, address,
+		uint16(len(values)), values)
+	return write(ctx, d, q, err)
+}
+
+// MaskWriteRegister modifies the holding register at address using the
+// andMask and orMask.
+func (d *Device) MaskWriteRegister(ctx context.Context,
+	address, andMask, orMask uint16) error {
+	q, err := MaskWriteRegister(d.SlaveID, address, andMask, orMask)
+	return write(ctx, d, q, err)
+}
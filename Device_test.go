@@ -0,0 +1,56 @@
+package modbus
+
+import "testing"
+
+func TestDevicePrepare(t *testing.T) {
+	d := &Device{SlaveID: 3, DeviceOptions: DeviceOptions{
+		AddressOffset: -1,
+		MaxRegisters:  10,
+		MaxCoils:      100,
+	}}
+	q, err := d.prepare(Query{
+		SlaveID:      1,
+		FunctionCode: FunctionReadHoldingRegisters,
+		Address:      1,
+		Quantity:     10,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if q.SlaveID != 3 || q.Address != 0 {
+		t.Errorf("SlaveID, Address want: 3, 0 got: %v, %v", q.SlaveID,
+			q.Address)
+	}
+
+	var tests = []struct {
+		Query
+		valid bool
+	}{
+		{Query{FunctionCode: FunctionReadHoldingRegisters, Address: 0,
+			Quantity: 1}, false},
+		{Query{FunctionCode: FunctionReadInputRegisters, Address: 1,
+			Quantity: 11}, false},
+		{Query{FunctionCode: FunctionWriteMultipleRegisters, Address: 1,
+			Quantity: 11}, false},
+		{Query{FunctionCode: FunctionReadCoils, Address: 1,
+			Quantity: 100}, true},
+		{Query{FunctionCode: FunctionReadDiscreteInputs, Address: 1,
+			Quantity: 101}, false},
+		{Query{FunctionCode: FunctionWriteMultipleCoils, Address: 1,
+			Quantity: 101}, false},
+		{Query{FunctionCode: FunctionWriteSingleRegister, Address: 1,
+			Quantity: 0}, true},
+	}
+	for _, test := range tests {
+		if _, err := d.prepare(test.Query); test.valid != (nil == err) {
+			t.Errorf("%v Address=%v Quantity=%v valid want: %v got: %v",
+				test.FunctionCode, test.Address, test.Quantity,
+				test.valid, err)
+		}
+	}
+
+	d.AddressOffset = 1
+	if _, err := d.prepare(Query{Address: 0xFFFF}); nil == err {
+		t.Error("Address out of range err is nil")
+	}
+}
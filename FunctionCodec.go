@@ -0,0 +1,62 @@
+package modbus
+
+import "fmt"
+
+// FunctionCodec implements the request encoding and response decoding for a
+// FunctionCode that is not natively supported by this package, such as the
+// user defined function codes 65-72 and 100-110 or vendor specific function
+// codes. Once registered with RegisterFunction, Queries with the FunctionCode
+// can be sent through any Packager or ClientHandle.
+type FunctionCodec interface {
+	// Validate returns an error if the Query is not well formed. It is
+	// called by Query.IsValid.
+	Validate(q Query) error
+	// Encode returns the request PDU data that follows the FunctionCode.
+	Encode(q Query) ([]byte, error)
+	// ResponseLength returns the expected length of the response PDU
+	// data that follows the FunctionCode, or -1 if it is not known in
+	// advance. This is used by the framing layer to detect the end of a
+	// response.
+	ResponseLength(q Query) int
+	// Decode validates the response PDU data that follows the
+	// FunctionCode and returns the data payload to be returned by Send.
+	Decode(q Query, data []byte) ([]byte, error)
+}
+
+var codecs = map[FunctionCode]FunctionCodec{}
+
+// RegisterFunction registers the FunctionCodec for the given FunctionCode
+// and adds name to the FunctionNames and FunctionCodes maps. It returns an
+// error if the FunctionCode is already supported or is not a valid function
+// code.
+//
+// RegisterFunction is not safe for concurrent use, since the FunctionNames
+// and FunctionCodes maps are read without locking. It must only be called
+// from an init function.
+func RegisterFunction(fCode FunctionCode, name string,
+	codec FunctionCodec) error {
+	if nil == codec {
+		return fmt.Errorf("FunctionCodec for %#x is nil", byte(fCode))
+	}
+	if fCode == 0 || fCode >= 0x80 {
+		return fmt.Errorf("Invalid FunctionCode: %#x", byte(fCode))
+	}
+
+	if _, ok := FunctionNames[fCode]; ok {
+		return fmt.Errorf("FunctionCode %#x is already registered",
+			byte(fCode))
+	}
+	if _, ok := FunctionCodes[name]; ok {
+		return fmt.Errorf("Function name %#v is already registered", name)
+	}
+	codecs[fCode] = codec
+	FunctionNames[fCode] = name
+	FunctionCodes[name] = fCode
+	return nil
+}
+
+// lookupCodec returns the registered FunctionCodec for the fCode, if any.
+func lookupCodec(fCode FunctionCode) (FunctionCodec, bool) {
+	codec, ok := codecs[fCode]
+	return codec, ok
+}
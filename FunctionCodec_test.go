@@ -0,0 +1,162 @@
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+const testFunctionCode FunctionCode = 0x41
+
+// testCodec implements a user defined function that sends len(Values) bytes
+// and expects them to be echoed back.
+type testCodec struct{}
+
+func (testCodec) Validate(q Query) error {
+	if len(q.Values) == 0 {
+		return errors.New("len(Values) is 0")
+	}
+	return nil
+}
+
+func (testCodec) Encode(q Query) ([]byte, error) {
+	data := make([]byte, len(q.Values))
+	for i, v := range q.Values {
+		data[i] = byte(v)
+	}
+	return data, nil
+}
+
+func (testCodec) ResponseLength(q Query) int {
+	return len(q.Values)
+}
+
+func (c testCodec) Decode(q Query, data []byte) ([]byte, error) {
+	expected, _ := c.Encode(q)
+	if !bytes.Equal(data, expected) {
+		return nil, exceptions[exceptionWriteDataMismatch]
+	}
+	return data, nil
+}
+
+func init() {
+	if err := RegisterFunction(testFunctionCode, "TestFunction",
+		testCodec{}); nil != err {
+		panic(err)
+	}
+}
+
+func TestFunctionCodec(t *testing.T) {
+	t.Run("RegisterFunction", func(t *testing.T) {
+		if FunctionCodes["TestFunction"] != testFunctionCode {
+			t.Error("FunctionCodes not updated")
+		}
+		if nil == RegisterFunction(testFunctionCode, "Other", testCodec{}) {
+			t.Error("Duplicate FunctionCode err is nil")
+		}
+		if nil == RegisterFunction(FunctionReadCoils, "Other", testCodec{}) {
+			t.Error("Built in FunctionCode err is nil")
+		}
+		if nil == RegisterFunction(0x81, "Other", testCodec{}) {
+			t.Error("Exception FunctionCode err is nil")
+		}
+		if nil == RegisterFunction(0x42, "TestFunction", testCodec{}) {
+			t.Error("Duplicate name err is nil")
+		}
+	})
+
+	q := Query{SlaveID: 1, FunctionCode: testFunctionCode,
+		Values: []uint16{0xAA, 0xBB}}
+	t.Run("IsValid", func(t *testing.T) {
+		if valid, err := q.IsValid(); !valid {
+			t.Error(err)
+		}
+		if valid, _ := (Query{FunctionCode: testFunctionCode}).IsValid(); valid {
+			t.Error("Invalid Query marked valid")
+		}
+	})
+	t.Run("data", func(t *testing.T) {
+		data, err := q.data()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte{0xAA, 0xBB}) {
+			t.Errorf("data want: aabb got: %x", data)
+		}
+	})
+	t.Run("isValidResponse", func(t *testing.T) {
+		response := []byte{1, byte(testFunctionCode), 0xAA, 0xBB}
+		if valid, err := q.isValidResponse(response); !valid {
+			t.Fatal(err)
+		}
+		if data := q.responseData(response); !bytes.Equal(data,
+			[]byte{0xAA, 0xBB}) {
+			t.Errorf("responseData want: aabb got: %x", data)
+		}
+		testIsValidResponse(t, q, response[:3],
+			exceptions[exceptionWriteDataMismatch])
+		testIsValidResponse(t, q, []byte{1, byte(testFunctionCode) | 0x80,
+			exceptionIllegalFunction},
+			exceptions[exceptionIllegalFunction])
+	})
+	t.Run("responseLength", func(t *testing.T) {
+		if n := q.responseLength(); n != 3 {
+			t.Errorf("responseLength want: 3 got: %v", n)
+		}
+	})
+}
+
+// chunkReader returns its chunks one Read at a time, followed by io.EOF.
+type chunkReader [][]byte
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, (*r)[0])
+	*r = (*r)[1:]
+	return n, nil
+}
+
+func TestReadFrame(t *testing.T) {
+	q := Query{SlaveID: 1, FunctionCode: testFunctionCode,
+		Values: []uint16{0xAA, 0xBB}}
+	frame := []byte{1, byte(testFunctionCode), 0xAA, 0xBB, 0x00, 0x00}
+	trailing := []byte{0x01, 0x02}
+	complete := rtuFrameComplete(q.responseLength())
+
+	r := &chunkReader{frame[:1], frame[1:4], append(frame[4:], trailing...)}
+	buf := make([]byte, MaxRTUSize)
+	n, err := readFrame(r, buf, complete, time.Time{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if n < len(frame) || len(*r) != 0 {
+		t.Errorf("n want: >= %v got: %v", len(frame), n)
+	}
+
+	r = &chunkReader{frame[:3]}
+	n, err = readFrame(r, buf, complete, time.Time{})
+	if nil != err || n != 3 {
+		t.Errorf("Silence did not end frame: n: %v err: %v", n, err)
+	}
+
+	r = &chunkReader{}
+	if _, err = readFrame(r, buf, complete, time.Time{}); io.EOF != err {
+		t.Errorf("err want: %v got: %v", io.EOF, err)
+	}
+	r = &chunkReader{}
+	if _, err = readFrame(r, buf, complete,
+		time.Now().Add(-time.Millisecond)); errNoResponse != err {
+		t.Errorf("err want: %v got: %v", errNoResponse, err)
+	}
+
+	r = &chunkReader{[]byte{1, byte(testFunctionCode) | 0x80}, []byte{1, 0, 0},
+		[]byte{0xFF}}
+	n, _ = readFrame(r, buf, complete, time.Time{})
+	if n != 5 {
+		t.Errorf("Exception response n want: 5 got: %v", n)
+	}
+}
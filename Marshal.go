@@ -0,0 +1,508 @@
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The modbus struct tag maps a struct field to a Tag:
+//
+//	modbus:"<table>,<address>[,<type>][,<order>][,<access>][,len=<n>]"
+//
+// The table is one of the TableNames and the address may be decimal or
+// hexadecimal with a 0x prefix. The optional type, order and access are any
+// of the DataTypeNames, ByteOrderNames and AccessNames and may be given in
+// any order. The type defaults to the DataType matching the field's Go type,
+// with int and uint stored as 64 bit values, and len is the number of
+// registers of a string. For example:
+//
+//	type Meter struct {
+//		Voltage float32 `modbus:"ir,0,cdab"`
+//		Energy  uint64  `modbus:"ir,2"`
+//		Serial  string  `modbus:"hr,10,len=8,r"`
+//		Limit   int16   `modbus:"hr,20"`
+//		Enabled bool    `modbus:"coil,0"`
+//	}
+//
+// Fields without a modbus struct tag, or tagged "-", are ignored. The fields
+// of embedded structs without a modbus struct tag are included.
+
+// structField is a struct field mapped to a Tag by its modbus struct tag.
+type structField struct {
+	Tag
+	index []int
+}
+
+// structFields returns the structFields of v, which must be a struct or a
+// pointer to one, sorted by Table and Address, and the reflect.Value of the
+// struct.
+func structFields(v interface{}) ([]structField, reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, rv, fmt.Errorf("Expected a struct but got %T", v)
+	}
+	fields, err := typeFields(rv.Type(), nil)
+	if nil != err {
+		return nil, rv, err
+	}
+	tags := make([]Tag, len(fields))
+	for i := range fields {
+		tags[i] = fields[i].Tag
+	}
+	m, err := NewTagMap(tags...)
+	if nil != err {
+		return nil, rv, err
+	}
+	for i, t := range m.Tags() {
+		fields[i].Tag = t
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i], fields[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Address < b.Address
+	})
+	return fields, rv, nil
+}
+
+// typeFields returns the structFields of the struct type t, whose index is
+// prefixed by index.
+func typeFields(t reflect.Type, index []int) ([]structField, error) {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fIndex := append(append([]int{}, index...), i)
+		tag, ok := f.Tag.Lookup("modbus")
+		if !ok {
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				embedded, err := typeFields(f.Type, fIndex)
+				if nil != err {
+					return nil, err
+				}
+				fields = append(fields, embedded...)
+			}
+			continue
+		}
+		if "-" == tag {
+			continue
+		}
+		if len(f.PkgPath) > 0 {
+			return nil, fmt.Errorf("Field %v is unexported", f.Name)
+		}
+		t, err := parseStructTag(f.Name, tag)
+		if nil != err {
+			return nil, err
+		}
+		if 0 == t.Type {
+			t.Type = kindDataTypes[f.Type.Kind()]
+		}
+		if 0 == t.Type || !kindDataTypeCompatible(f.Type.Kind(), t.Type) {
+			return nil, fmt.Errorf("Field %v: Cannot store %v as %v",
+				f.Name, f.Type, t.Type)
+		}
+		fields = append(fields, structField{Tag: t, index: fIndex})
+	}
+	return fields, nil
+}
+
+// parseStructTag returns the Tag named name described by the modbus struct
+// tag.
+func parseStructTag(name, tag string) (Tag, error) {
+	t := Tag{Name: name}
+	parts := strings.Split(tag, ",")
+	if len(parts) < 2 {
+		return t, fmt.Errorf("Field %v: Invalid modbus struct tag: %q",
+			name, tag)
+	}
+	if err := t.Table.UnmarshalText([]byte(
+		strings.TrimSpace(parts[0]))); nil != err {
+		return t, fmt.Errorf("Field %v: %v", name, err)
+	}
+	var err error
+	if t.Address, err = parseUint16(strings.TrimSpace(parts[1])); nil != err {
+		return t, fmt.Errorf("Field %v: Invalid address: %v", name, err)
+	}
+	for _, opt := range parts[2:] {
+		opt = strings.TrimSpace(opt)
+		if dataType, ok := DataTypesByName[strings.ToLower(opt)]; ok {
+			t.Type = dataType
+		} else if order, ok := ByteOrderByName[strings.ToUpper(opt)]; ok {
+			t.ByteOrder = order
+		} else if access, ok := AccessByName[strings.ToLower(opt)]; ok {
+			t.Access = access
+		} else if strings.HasPrefix(opt, "len=") {
+			if t.Length, err = parseUint16(opt[4:]); nil != err {
+				return t, fmt.Errorf("Field %v: Invalid len: %v", name,
+					err)
+			}
+		} else {
+			return t, fmt.Errorf("Field %v: Unknown modbus struct tag "+
+				"option: %q", name, opt)
+		}
+	}
+	return t, nil
+}
+
+// kindDataTypes maps Go kinds to their default DataType.
+var kindDataTypes = map[reflect.Kind]DataType{
+	reflect.Bool:    DataTypeBool,
+	reflect.Int8:    DataTypeInt16,
+	reflect.Int16:   DataTypeInt16,
+	reflect.Int32:   DataTypeInt32,
+	reflect.Int:     DataTypeInt64,
+	reflect.Int64:   DataTypeInt64,
+	reflect.Uint8:   DataTypeUint16,
+	reflect.Uint16:  DataTypeUint16,
+	reflect.Uint32:  DataTypeUint32,
+	reflect.Uint:    DataTypeUint64,
+	reflect.Uint64:  DataTypeUint64,
+	reflect.Float32: DataTypeFloat32,
+	reflect.Float64: DataTypeFloat64,
+	reflect.String:  DataTypeString,
+}
+
+// kindDataTypeCompatible returns true if a field of the kind can hold values
+// of the DataType. Numeric fields can hold any numeric DataType, subject to
+// range checks when the value is set.
+func kindDataTypeCompatible(kind reflect.Kind, dataType DataType) bool {
+	switch kindDataTypes[kind] {
+	case DataTypeBool, DataTypeString:
+		return kindDataTypes[kind] == dataType
+	case 0:
+		return false
+	}
+	return dataType != DataTypeBool && dataType != DataTypeString
+}
+
+// setField sets the field f to the value decoded by Tag.Decode.
+func setField(f reflect.Value, name string, value interface{}) error {
+	v := reflect.ValueOf(value)
+	var overflow bool
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		var i int64
+		switch v.Kind() {
+		case reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			overflow = v.Uint() > 1<<63-1
+			i = int64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			i = int64(v.Float())
+			overflow = float64(i) != v.Float()
+		default:
+			i = v.Int()
+		}
+		overflow = overflow || f.OverflowInt(i)
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		var u uint64
+		switch v.Kind() {
+		case reflect.Int16, reflect.Int32, reflect.Int64:
+			overflow = v.Int() < 0
+			u = uint64(v.Int())
+		case reflect.Float32, reflect.Float64:
+			u = uint64(v.Float())
+			overflow = v.Float() < 0 || float64(u) != v.Float()
+		default:
+			u = v.Uint()
+		}
+		overflow = overflow || f.OverflowUint(u)
+		f.SetUint(u)
+	default:
+		f.Set(v.Convert(f.Type()))
+	}
+	if overflow {
+		return fmt.Errorf("Field %v: Value %v overflows %v", name, value,
+			f.Type())
+	}
+	return nil
+}
+
+// UnmarshalQuery sets the fields of the struct pointed to by v from the
+// response data of the read Query q. Only the fields in the Table read by q
+// are set. An error is returned if a field is only partly covered by q.
+func UnmarshalQuery(q Query, data []byte, v interface{}) error {
+	table, ok := readTable(q.FunctionCode)
+	if !ok {
+		return fmt.Errorf("Not a read Query: %v", q.FunctionCode)
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Expected a non-nil pointer but got %T", v)
+	}
+	fields, rv, err := structFields(v)
+	if nil != err {
+		return err
+	}
+	var bits []bool
+	if table.IsBits() {
+		if bits, err = DecodeCoils(data, q.Quantity); nil != err {
+			return err
+		}
+	} else if len(data) != 2*int(q.Quantity) {
+		return fmt.Errorf("Expected %v bytes but got %v", 2*q.Quantity,
+			len(data))
+	}
+	start, end := int(q.Address), int(q.Address)+int(q.Quantity)
+	for _, f := range fields {
+		fStart := int(f.Address)
+		fEnd := fStart + int(f.Quantity())
+		if f.Table != table || fEnd <= start || fStart >= end {
+			continue
+		}
+		if fStart < start || fEnd > end {
+			return fmt.Errorf("Field %v is only partly covered by the "+
+				"Query", f.Name)
+		}
+		fv := rv.FieldByIndex(f.index)
+		if table.IsBits() {
+			fv.SetBool(bits[fStart-start])
+			continue
+		}
+		value, err := f.Decode(data[2*(fStart-start) : 2*(fEnd-start)])
+		if nil != err {
+			return err
+		}
+		if err := setField(fv, f.Name, value); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// span returns the Table of the fields and the Address and Quantity covering
+// all of them, or an error if the fields are not all in one Table.
+func span(fields []structField) (Table, uint16, uint16, error) {
+	if len(fields) == 0 {
+		return 0, 0, 0, fmt.Errorf("No fields with a modbus struct tag")
+	}
+	first, last := fields[0], fields[len(fields)-1]
+	if first.Table != last.Table {
+		return 0, 0, 0, fmt.Errorf("Fields span Tables %v and %v",
+			first.Table, last.Table)
+	}
+	end := int(last.Address) + int(last.Quantity())
+	for _, f := range fields {
+		// A long field may end after the last field starts.
+		if fEnd := int(f.Address) + int(f.Quantity()); fEnd > end {
+			end = fEnd
+		}
+	}
+	return first.Table, first.Address, uint16(end - int(first.Address)), nil
+}
+
+// Unmarshal sets the fields of the struct pointed to by v from the data,
+// which holds the coils, discrete inputs or registers from the lowest to the
+// highest address used by the fields, as returned by a single read Query.
+// All fields must be in the same Table. Use ReadStruct or UnmarshalQuery for
+// structs spanning multiple Tables or Queries.
+func Unmarshal(data []byte, v interface{}) error {
+	fields, _, err := structFields(v)
+	if nil != err {
+		return err
+	}
+	table, address, quantity, err := span(fields)
+	if nil != err {
+		return err
+	}
+	q := Query{
+		FunctionCode: tableReadFunctions[table],
+		Address:      address,
+		Quantity:     quantity,
+	}
+	return UnmarshalQuery(q, data, v)
+}
+
+// Marshal returns the data for the fields of v, which must be a struct or a
+// pointer to one, in the format read by Unmarshal. Addresses between the
+// fields are zero.
+func Marshal(v interface{}) ([]byte, error) {
+	fields, rv, err := structFields(v)
+	if nil != err {
+		return nil, err
+	}
+	table, address, quantity, err := span(fields)
+	if nil != err {
+		return nil, err
+	}
+	if table.IsBits() {
+		bits := make([]bool, quantity)
+		for _, f := range fields {
+			bits[f.Address-address] = rv.FieldByIndex(f.index).Bool()
+		}
+		return packCoils(bits), nil
+	}
+	regs := make([]uint16, quantity)
+	for _, f := range fields {
+		fRegs, err := f.Encode(rv.FieldByIndex(f.index).Interface())
+		if nil != err {
+			return nil, err
+		}
+		copy(regs[f.Address-address:], fRegs)
+	}
+	return dataBlock(regs...), nil
+}
+
+// ReadQueries returns the read Queries for the readable fields of v, which
+// must be a struct or a pointer to one. Fields in the same Table are read
+// together, including any addresses between them, up to the maximum
+// Quantity of a read Query.
+func ReadQueries(slaveID byte, v interface{}) ([]Query, error) {
+	fields, _, err := structFields(v)
+	if nil != err {
+		return nil, err
+	}
+	var queries []Query
+	var table Table
+	var start, end int
+	add := func() error {
+		if end > start {
+			q, err := table.ReadQuery(slaveID, uint16(start),
+				uint16(end-start))
+			if nil != err {
+				return err
+			}
+			queries = append(queries, q)
+		}
+		return nil
+	}
+	for _, f := range fields {
+		if f.Access&AccessRead == 0 {
+			continue
+		}
+		fStart := int(f.Address)
+		fEnd := fStart + int(f.Quantity())
+		if f.Table != table || fEnd-start > int(table.MaxQuantity()) {
+			if err := add(); nil != err {
+				return nil, err
+			}
+			table, start, end = f.Table, fStart, fEnd
+		}
+		if fEnd > end {
+			end = fEnd
+		}
+	}
+	if err := add(); nil != err {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// WriteQueries returns the WriteMultipleCoils and WriteMultipleRegisters
+// Queries for the writable fields of v, which must be a struct or a pointer
+// to one. Adjacent fields are written together, up to the maximum Quantity
+// of a write Query.
+func WriteQueries(slaveID byte, v interface{}) ([]Query, error) {
+	fields, rv, err := structFields(v)
+	if nil != err {
+		return nil, err
+	}
+	var queries []Query
+	var table Table
+	var start uint16
+	var bits []bool
+	var regs []uint16
+	add := func() error {
+		var q Query
+		var err error
+		switch {
+		case len(bits) > 0:
+			q, err = WriteMultipleCoils(slaveID, start, bits)
+		case len(regs) > 0:
+			q, err = WriteMultipleRegisters(slaveID, start,
+				uint16(len(regs)), regs)
+		default:
+			return nil
+		}
+		if nil != err {
+			return err
+		}
+		queries = append(queries, q)
+		bits, regs = nil, nil
+		return nil
+	}
+	for _, f := range fields {
+		if f.Access&AccessWrite == 0 {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		if f.Table.IsBits() {
+			if f.Table != table || int(start)+len(bits) != int(f.Address) ||
+				len(bits) == maxWriteCoils {
+				if err := add(); nil != err {
+					return nil, err
+				}
+				table, start = f.Table, f.Address
+			}
+			bits = append(bits, fv.Bool())
+			continue
+		}
+		fRegs, err := f.Encode(fv.Interface())
+		if nil != err {
+			return nil, err
+		}
+		if f.Table != table || int(start)+len(regs) != int(f.Address) ||
+			len(regs)+len(fRegs) > maxWriteRegisters {
+			if err := add(); nil != err {
+				return nil, err
+			}
+			table, start = f.Table, f.Address
+		}
+		regs = append(regs, fRegs...)
+	}
+	if err := add(); nil != err {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// The maximum Quantity of the WriteMultipleCoils and WriteMultipleRegisters
+// Queries.
+const (
+	maxWriteCoils     = 1968
+	maxWriteRegisters = 123
+)
+
+// ReadStruct reads the readable fields of the struct pointed to by v from
+// slaveID using s, which may be a ClientHandle or a Device, and the
+// ReadQueries of v.
+func ReadStruct(ctx context.Context, s QuerySender, slaveID byte,
+	v interface{}) error {
+	queries, err := ReadQueries(slaveID, v)
+	if nil != err {
+		return err
+	}
+	for _, q := range queries {
+		data, err := s.SendContext(ctx, q)
+		if nil != err {
+			return err
+		}
+		if err := UnmarshalQuery(q, data, v); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteStruct writes the writable fields of v to slaveID using s, which may
+// be a ClientHandle or a Device, and the WriteQueries of v.
+func WriteStruct(ctx context.Context, s QuerySender, slaveID byte,
+	v interface{}) error {
+	queries, err := WriteQueries(slaveID, v)
+	if nil != err {
+		return err
+	}
+	for _, q := range queries {
+		if _, err := s.SendContext(ctx, q); nil != err {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package modbus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type testMeterInfo struct {
+	Serial string `modbus:"hr,10,len=4,r"`
+}
+
+type testMeter struct {
+	Voltage float32 `modbus:"hr,0,cdab"`
+	Energy  uint64  `modbus:"hr,2"`
+	Limit   int     `modbus:"hr,6,int16"`
+	testMeterInfo
+	Ignored int
+	Skipped int `modbus:"-"`
+	Enabled bool `modbus:"coil,1"`
+	Alarm   bool `modbus:"coil,0x3"`
+}
+
+func TestMarshalRegisters(t *testing.T) {
+	type registers struct {
+		A uint16  `modbus:"ir,5"`
+		B float64 `modbus:"ir,7,dcba"`
+		C string  `modbus:"ir,11,len=2,badc"`
+	}
+	in := registers{A: 7, B: -2.5, C: "abc"}
+	data, err := Marshal(in)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(data) != 2*8 {
+		t.Fatalf("len(data) want: 16 got: %v", len(data))
+	}
+	var out registers
+	if err := Unmarshal(data, &out); nil != err {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("Unmarshal want: %+v got: %+v", in, out)
+	}
+	if err := Unmarshal(data, out); nil == err {
+		t.Error("Non-pointer err is nil")
+	}
+	if err := Unmarshal(data[:4], &out); nil == err {
+		t.Error("Short data err is nil")
+	}
+}
+
+func TestMarshalCoils(t *testing.T) {
+	type coils struct {
+		A bool `modbus:"coil,2"`
+		B bool `modbus:"coil,4"`
+	}
+	data, err := Marshal(&coils{A: true, B: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, []byte{0x05}) {
+		t.Errorf("Marshal want: [5] got: %v", data)
+	}
+	var out coils
+	if err := Unmarshal([]byte{0x04}, &out); nil != err || out.A || !out.B {
+		t.Errorf("Unmarshal want: {false true} got: %+v, %v", out, err)
+	}
+}
+
+func TestMarshalDecimalAddress(t *testing.T) {
+	// Zero padded addresses are decimal, not octal.
+	qs, err := ReadQueries(1, &struct {
+		A uint16 `modbus:"hr,0100"`
+	}{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(qs) != 1 || qs[0].Address != 100 {
+		t.Errorf("ReadQueries want: address 100 got: %+v", qs)
+	}
+}
+
+func TestMarshalInvalid(t *testing.T) {
+	var tests = []struct {
+		name string
+		v    interface{}
+	}{
+		{"Not A Struct", 5},
+		{"Unknown Option", &struct {
+			A uint16 `modbus:"hr,0,big"`
+		}{}},
+		{"Missing Address", &struct {
+			A uint16 `modbus:"hr"`
+		}{}},
+		{"Incompatible Type", &struct {
+			A bool `modbus:"hr,0"`
+		}{}},
+		{"Overlap", &struct {
+			A uint32 `modbus:"hr,0"`
+			B uint16 `modbus:"hr,1"`
+		}{}},
+		{"Multiple Tables", &struct {
+			A uint16 `modbus:"hr,0"`
+			B bool   `modbus:"coil,0"`
+		}{}},
+		{"Unsupported Kind", &struct {
+			A []uint16 `modbus:"hr,0"`
+		}{}},
+	}
+	for _, test := range tests {
+		if _, err := Marshal(test.v); nil == err {
+			t.Errorf("%v: err is nil", test.name)
+		}
+	}
+
+	var overflow struct {
+		A int8 `modbus:"hr,0,uint16"`
+	}
+	if err := Unmarshal([]byte{0x01, 0x00}, &overflow); nil == err {
+		t.Error("Overflow err is nil")
+	}
+}
+
+func TestReadWriteStruct(t *testing.T) {
+	in := testMeter{
+		Voltage:       230.5,
+		Energy:        1 << 40,
+		Limit:         -5,
+		testMeterInfo: testMeterInfo{Serial: "AB12"},
+		Enabled:       true,
+	}
+	queries, err := WriteQueries(1, &in)
+	if nil != err {
+		t.Fatal(err)
+	}
+	// Serial is read only, so the registers are written with one Query and
+	// the coils with another since they are not adjacent.
+	if len(queries) != 3 {
+		t.Fatalf("len(WriteQueries) want: 3 got: %v", len(queries))
+	}
+	if q := queries[2]; q.FunctionCode != FunctionWriteMultipleRegisters ||
+		q.Address != 0 || q.Quantity != 7 {
+		t.Errorf("WriteQueries[2] want: WriteMultipleRegisters 0 7 got: "+
+			"%v %v %v", q.FunctionCode, q.Address, q.Quantity)
+	}
+
+	queries, err = ReadQueries(1, &in)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || queries[0].Quantity != 3 ||
+		queries[1].Quantity != 14 {
+		t.Errorf("ReadQueries want: coils 1-3, registers 0-13 got: %+v",
+			queries)
+	}
+
+	ctx := context.Background()
+	s := newTestRegisterSender()
+	if err := WriteStruct(ctx, s, 1, &in); nil != err {
+		t.Fatal(err)
+	}
+	s.registers[10], s.registers[11] = 0x4142, 0x3132
+	var out testMeter
+	if err := ReadStruct(ctx, s, 1, &out); nil != err {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("ReadStruct want: %+v got: %+v", in, out)
+	}
+}
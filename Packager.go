@@ -1,6 +1,11 @@
 package modbus
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
 
 // Transporter is the underlying connection interface. This is used to store
 // either a TCP connection or a serial/comm port.
@@ -16,21 +21,50 @@ type Transporter interface {
 // Modes: ASCIIPackager, RTUPackager and TCPPackager.
 type Packager interface {
 	Send(q Query) ([]byte, error)
+	// SendRaw sends the data as the PDU for the fCode, wrapped in the
+	// appropriate ADU, and returns the response PDU, starting with the
+	// FunctionCode. The response is only checked for correct framing and
+	// checksum, so Modbus exception responses are returned as data.
+	SendRaw(slaveID byte, fCode FunctionCode, data []byte) ([]byte, error)
 	Transporter
 	SetDebug(debug bool)
+	// SetTimeout sets the response timeout for subsequent Queries.
+	SetTimeout(timeout time.Duration)
 }
 
+// errPDUTooLarge is returned by SendRaw if the data does not fit in a PDU.
+var errPDUTooLarge = fmt.Errorf("PDU data exceeds %v bytes", MaxPDUSize-1)
+
+// errNoResponse is returned if no bytes of a response are received before
+// the deadline. See IsTimeout.
+var errNoResponse = errors.New("No response received before the timeout")
+
 // PackagerSettings holds settings and data that all packagers use.
 // Packagers subclass this struct and implement the Packager interface for
 // their respective Modbus protocols.
 type packagerSettings struct {
 	Debug bool
+
+	timeout time.Duration
 }
 
 func (ps *packagerSettings) SetDebug(debug bool) {
 	ps.Debug = debug
 }
 
+func (ps *packagerSettings) SetTimeout(timeout time.Duration) {
+	ps.timeout = timeout
+}
+
+// deadline returns the time by which a response must have been received, or
+// the zero Time if there is no timeout.
+func (ps *packagerSettings) deadline() time.Time {
+	if ps.timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ps.timeout)
+}
+
 // NewPackager returns a Packager according to the cs.Mode.
 func NewPackager(cs ConnectionSettings) (Packager, error) {
 	switch cs.Mode {
@@ -44,3 +78,39 @@ func NewPackager(cs ConnectionSettings) (Packager, error) {
 		return nil, errors.New("Invalid Mode")
 	}
 }
+
+// readFrame reads from r into buf until complete reports that the bytes read
+// so far form a whole frame, buf is full, or a read times out. A read timeout
+// after some bytes have been received is treated as the inter-frame silence
+// ending the frame. Read timeouts before any bytes have been received are
+// retried until the deadline, if it is not zero, and then errNoResponse is
+// returned. Otherwise, if no bytes are received the read error is returned.
+func readFrame(r io.Reader, buf []byte, complete func([]byte) bool,
+	deadline time.Time) (int, error) {
+	var n int
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if complete(buf[:n]) {
+			return n, nil
+		}
+		if m == 0 || nil != err {
+			if nil == err || io.EOF == err {
+				if n > 0 {
+					return n, nil
+				}
+				if !deadline.IsZero() {
+					if time.Now().Before(deadline) {
+						continue
+					}
+					return n, errNoResponse
+				}
+			}
+			if nil == err {
+				err = io.EOF
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -1,6 +1,7 @@
 package modbus
 
 import (
+	"bytes"
 	"testing"
 	"time"
 )
@@ -22,6 +23,7 @@ func TestPackager(t *testing.T) {
 					t.Fatal(err)
 				}
 				testPackager(t, p)
+				testPackagerSendRaw(t, p)
 				switch cs.Mode {
 				case ModeASCII:
 					fallthrough
@@ -31,6 +33,7 @@ func TestPackager(t *testing.T) {
 					if nil == err {
 						t.Error("SlaveID=0: err is nil")
 					}
+					testPackagerBroadcast(t, p)
 				}
 				if err := p.Close(); nil != err {
 					t.Error(err)
@@ -103,3 +106,51 @@ func testPackagerSend(t *testing.T, p Packager, q testQuery) {
 		}
 	}
 }
+
+func testPackagerSendRaw(t *testing.T, p Packager) {
+	pdu, err := p.SendRaw(1, FunctionReadHoldingRegisters,
+		[]byte{0, 0, 0, 2})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(pdu) != 6 || !bytes.Equal(pdu[:2],
+		[]byte{byte(FunctionReadHoldingRegisters), 4}) {
+		t.Errorf("Unexpected response PDU: %x", pdu)
+	}
+
+	// Exception responses are returned as data
+	pdu, err = p.SendRaw(1, FunctionReadHoldingRegisters,
+		[]byte{0, 0, 0, 0})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(pdu) != 2 || pdu[0] != byte(FunctionReadHoldingRegisters)|0x80 {
+		t.Errorf("Unexpected exception response PDU: %x", pdu)
+	}
+
+	if _, err := p.SendRaw(1, FunctionReadHoldingRegisters,
+		make([]byte, MaxPDUSize)); nil == err {
+		t.Error("Oversize PDU err is nil")
+	}
+}
+
+func testPackagerBroadcast(t *testing.T, p Packager) {
+	q, _ := WriteSingleRegister(0, 0, 1)
+	start := time.Now()
+	data, err := p.Send(q)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil != data {
+		t.Errorf("Broadcast data want: nil got: %x", data)
+	}
+
+	// The next query must wait for the turnaround delay.
+	q, _ = ReadHoldingRegisters(1, 0, 1)
+	if _, err := p.Send(q); nil != err {
+		t.Error(err)
+	}
+	if time.Since(start) < DefaultTurnaroundDelay {
+		t.Error("Turnaround delay was not observed")
+	}
+}
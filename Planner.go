@@ -0,0 +1,223 @@
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Range is a contiguous range of addresses in a Table of a slave device.
+type Range struct {
+	SlaveID  byte
+	Table    Table
+	Address  uint16
+	Quantity uint16
+}
+
+// Range returns the Range occupied by the Tag.
+func (t Tag) Range() Range {
+	return Range{
+		SlaveID:  t.SlaveID,
+		Table:    t.Table,
+		Address:  t.Address,
+		Quantity: t.Quantity(),
+	}
+}
+
+// end returns the address following the Range.
+func (r Range) end() int {
+	return int(r.Address) + int(r.Quantity)
+}
+
+// Planner coalesces the reads of many Ranges into as few read Queries as
+// possible.
+type Planner struct {
+	// MaxGap is the largest number of unused addresses between two Ranges
+	// that are read by the same Query. Reading a few unused addresses is
+	// usually much faster than an additional transaction, but some devices
+	// respond with an exception to reads of unmapped addresses.
+	MaxGap uint16
+	// MaxRegisters and MaxBits limit the Quantity of the Queries for
+	// devices that support less than the protocol maximum of 125 registers
+	// and 2000 coils or discrete inputs. Zero means the protocol maximum.
+	MaxRegisters uint16
+	MaxBits      uint16
+}
+
+// maxQuantity returns the largest Quantity of a read Query of the Table.
+func (p Planner) maxQuantity(t Table) uint16 {
+	max := t.MaxQuantity()
+	limit := p.MaxRegisters
+	if t.IsBits() {
+		limit = p.MaxBits
+	}
+	if limit > 0 && limit < max {
+		return limit
+	}
+	return max
+}
+
+// ReadPlan is a set of read Queries covering a set of Ranges.
+type ReadPlan struct {
+	// Queries are sorted by SlaveID, Table and Address.
+	Queries []Query
+
+	ranges []Range
+	// query and offset give the index of the Query reading each Range and
+	// the position of the Range within it.
+	query  []int
+	offset []uint16
+}
+
+// Plan returns the ReadPlan for the ranges. Ranges of the same SlaveID and
+// Table are read together if they overlap or are separated by no more than
+// MaxGap addresses, as long as the Query does not exceed the maximum
+// Quantity. An error is returned if a Range is invalid or exceeds the
+// maximum Quantity by itself.
+func (p Planner) Plan(ranges ...Range) (*ReadPlan, error) {
+	plan := &ReadPlan{
+		ranges: make([]Range, len(ranges)),
+		query:  make([]int, len(ranges)),
+		offset: make([]uint16, len(ranges)),
+	}
+	copy(plan.ranges, ranges)
+	order := make([]int, len(ranges))
+	for i, r := range ranges {
+		if _, ok := tableReadFunctions[r.Table]; !ok {
+			return nil, fmt.Errorf("Invalid Table: %v", byte(r.Table))
+		}
+		if 0 == r.Quantity || r.Quantity > p.maxQuantity(r.Table) ||
+			r.end() > 0x10000 {
+			return nil, fmt.Errorf("Invalid %v Range: Address %v "+
+				"Quantity %v", r.Table, r.Address, r.Quantity)
+		}
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := ranges[order[i]], ranges[order[j]]
+		if a.SlaveID != b.SlaveID {
+			return a.SlaveID < b.SlaveID
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Address < b.Address
+	})
+
+	var block Range
+	var end int
+	var members []int
+	add := func() error {
+		if len(members) == 0 {
+			return nil
+		}
+		block.Quantity = uint16(end - int(block.Address))
+		q, err := block.Table.ReadQuery(block.SlaveID, block.Address,
+			block.Quantity)
+		if nil != err {
+			return err
+		}
+		for _, i := range members {
+			plan.query[i] = len(plan.Queries)
+			plan.offset[i] = ranges[i].Address - block.Address
+		}
+		plan.Queries = append(plan.Queries, q)
+		members = members[:0]
+		return nil
+	}
+	for _, i := range order {
+		r := ranges[i]
+		newEnd := end
+		if r.end() > newEnd {
+			newEnd = r.end()
+		}
+		if len(members) == 0 || r.SlaveID != block.SlaveID ||
+			r.Table != block.Table ||
+			int(r.Address) > end+int(p.MaxGap) ||
+			newEnd-int(block.Address) > int(p.maxQuantity(r.Table)) {
+			if err := add(); nil != err {
+				return nil, err
+			}
+			block, newEnd = r, r.end()
+		}
+		end = newEnd
+		members = append(members, i)
+	}
+	if err := add(); nil != err {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// PlanTags returns the ReadPlan for the Ranges of the tags.
+func (p Planner) PlanTags(tags ...Tag) (*ReadPlan, error) {
+	ranges := make([]Range, len(tags))
+	for i, t := range tags {
+		ranges[i] = t.Range()
+	}
+	return p.Plan(ranges...)
+}
+
+// Execute sends the Queries of the plan using s, which may be a ClientHandle
+// or a Device, and returns the response data of each of the planned Ranges,
+// in the order they were given to Plan, as if each had been read by its own
+// Query. All Queries are sent even if some of them fail, in which case the
+// data of their Ranges is nil and the first error is returned. If the ctx is
+// done no further Queries are sent.
+func (plan *ReadPlan) Execute(ctx context.Context, s QuerySender) ([][]byte,
+	error) {
+	responses := make([][]byte, len(plan.Queries))
+	var firstErr error
+	for i, q := range plan.Queries {
+		data, err := s.SendContext(ctx, q)
+		if nil == err {
+			if err = checkReadData(q, data); nil == err {
+				responses[i] = data
+			}
+		}
+		if nil != err && nil == firstErr {
+			firstErr = err
+		}
+		if nil != ctx.Err() {
+			break
+		}
+	}
+	return plan.scatter(responses), firstErr
+}
+
+// scatter returns the data of each Range from the responses to the Queries.
+func (plan *ReadPlan) scatter(responses [][]byte) [][]byte {
+	data := make([][]byte, len(plan.ranges))
+	bits := make([][]bool, len(responses))
+	for i, r := range plan.ranges {
+		qi := plan.query[i]
+		if nil == responses[qi] {
+			continue
+		}
+		offset := int(plan.offset[i])
+		if r.Table.IsBits() {
+			if nil == bits[qi] {
+				bits[qi] = unpackCoils(responses[qi],
+					int(plan.Queries[qi].Quantity))
+			}
+			data[i] = packCoils(bits[qi][offset : offset+int(r.Quantity)])
+			continue
+		}
+		data[i] = responses[qi][2*offset : 2*(offset+int(r.Quantity))]
+	}
+	return data
+}
+
+// checkReadData returns an error if the length of the response data of the
+// read Query q is wrong.
+func checkReadData(q Query, data []byte) error {
+	want := 2 * int(q.Quantity)
+	if table, _ := readTable(q.FunctionCode); table.IsBits() {
+		want = (int(q.Quantity) + 7) / 8
+	}
+	if len(data) != want {
+		return fmt.Errorf("%v: Expected %v bytes of data but got %v",
+			FunctionNames[q.FunctionCode], want, len(data))
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package modbus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	var tests = []struct {
+		name    string
+		Planner
+		ranges  []Range
+		queries []Range
+	}{
+		{"Adjacent", Planner{}, []Range{
+			{1, TableHoldingRegisters, 12, 2},
+			{1, TableHoldingRegisters, 10, 2},
+			{1, TableHoldingRegisters, 15, 1},
+		}, []Range{
+			{1, TableHoldingRegisters, 10, 4},
+			{1, TableHoldingRegisters, 15, 1},
+		}},
+		{"MaxGap", Planner{MaxGap: 1}, []Range{
+			{1, TableHoldingRegisters, 12, 2},
+			{1, TableHoldingRegisters, 10, 2},
+			{1, TableHoldingRegisters, 15, 1},
+			{1, TableHoldingRegisters, 18, 1},
+		}, []Range{
+			{1, TableHoldingRegisters, 10, 6},
+			{1, TableHoldingRegisters, 18, 1},
+		}},
+		{"Overlap", Planner{}, []Range{
+			{1, TableInputRegisters, 0, 10},
+			{1, TableInputRegisters, 2, 2},
+			{1, TableInputRegisters, 9, 4},
+		}, []Range{
+			{1, TableInputRegisters, 0, 13},
+		}},
+		{"Tables And Slaves", Planner{MaxGap: 100}, []Range{
+			{2, TableHoldingRegisters, 0, 1},
+			{1, TableHoldingRegisters, 0, 1},
+			{1, TableInputRegisters, 0, 1},
+			{1, TableCoils, 5, 1},
+			{1, TableCoils, 0, 1},
+		}, []Range{
+			{1, TableCoils, 0, 6},
+			{1, TableInputRegisters, 0, 1},
+			{1, TableHoldingRegisters, 0, 1},
+			{2, TableHoldingRegisters, 0, 1},
+		}},
+		{"Max Quantity", Planner{MaxGap: 1000}, []Range{
+			{1, TableHoldingRegisters, 1000, 2},
+			{1, TableHoldingRegisters, 1122, 4},
+			{1, TableHoldingRegisters, 1123, 2},
+		}, []Range{
+			{1, TableHoldingRegisters, 1000, 2},
+			{1, TableHoldingRegisters, 1122, 4},
+		}},
+		{"MaxBits", Planner{MaxGap: 1000, MaxBits: 16}, []Range{
+			{1, TableDiscreteInputs, 0, 1},
+			{1, TableDiscreteInputs, 15, 1},
+			{1, TableDiscreteInputs, 16, 1},
+		}, []Range{
+			{1, TableDiscreteInputs, 0, 16},
+			{1, TableDiscreteInputs, 16, 1},
+		}},
+	}
+	for _, test := range tests {
+		plan, err := test.Plan(test.ranges...)
+		if nil != err {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		var got []Range
+		for _, q := range plan.Queries {
+			table, _ := readTable(q.FunctionCode)
+			got = append(got, Range{q.SlaveID, table, q.Address,
+				q.Quantity})
+		}
+		if !reflect.DeepEqual(got, test.queries) {
+			t.Errorf("%v: want: %v got: %v", test.name, test.queries, got)
+		}
+	}
+
+	var invalid = []Range{
+		{1, 0, 0, 1},
+		{1, TableHoldingRegisters, 0, 0},
+		{1, TableHoldingRegisters, 0, 126},
+		{1, TableHoldingRegisters, 65535, 2},
+	}
+	for _, r := range invalid {
+		if _, err := (Planner{}).Plan(r); nil == err {
+			t.Errorf("Invalid Range %v err is nil", r)
+		}
+	}
+}
+
+func TestReadPlanExecute(t *testing.T) {
+	s := newTestRegisterSender()
+	for i := uint16(0); i < 20; i++ {
+		s.registers[100+i] = i
+	}
+	s.coils[3], s.coils[9] = true, true
+	plan, err := (Planner{MaxGap: 10}).Plan(
+		Range{1, TableHoldingRegisters, 110, 2},
+		Range{1, TableCoils, 9, 1},
+		Range{1, TableHoldingRegisters, 101, 1},
+		Range{1, TableCoils, 2, 2},
+	)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(plan.Queries) != 2 {
+		t.Errorf("len(Queries) want: 2 got: %v", len(plan.Queries))
+	}
+	data, err := plan.Execute(context.Background(), s)
+	if nil != err {
+		t.Fatal(err)
+	}
+	want := [][]byte{{0, 10, 0, 11}, {0x01}, {0, 1}, {0x02}}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Execute want: %v got: %v", want, data)
+	}
+}
+
+func TestTagMapReadTags(t *testing.T) {
+	m, err := NewTagMap(
+		Tag{Name: "a", Table: TableHoldingRegisters, Address: 0},
+		Tag{Name: "b", Table: TableHoldingRegisters, Address: 3,
+			Type: DataTypeInt32},
+		Tag{Name: "c", Table: TableCoils, Address: 1},
+		Tag{Name: "d", Table: TableInputRegisters, Address: 1},
+		Tag{Name: "e", Table: TableHoldingRegisters, Address: 7,
+			Access: AccessWrite},
+	)
+	if nil != err {
+		t.Fatal(err)
+	}
+	s := newTestRegisterSender()
+	s.registers[0], s.registers[3], s.registers[4] = 5, 0xFFFF, 0xFFFE
+	s.coils[1] = true
+	ctx := context.Background()
+
+	values, err := m.ReadTags(ctx, s, Planner{MaxGap: 4}, "a", "b", "c")
+	if nil != err {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"a": uint16(5), "b": int32(-2),
+		"c": true}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("ReadTags want: %v got: %v", want, values)
+	}
+
+	// The test sender does not support input registers, so d fails while
+	// the other readable Tags are still returned.
+	values, err = m.ReadTags(ctx, s, Planner{})
+	if nil == err {
+		t.Error("Unsupported Query err is nil")
+	}
+	if len(values) != 3 {
+		t.Errorf("ReadTags all want: 3 values got: %v", values)
+	}
+	if _, err := m.ReadTags(ctx, s, Planner{}, "e"); nil == err {
+		t.Error("Write only Tag err is nil")
+	}
+}
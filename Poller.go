@@ -0,0 +1,441 @@
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quality describes the reliability of a polled value.
+type Quality byte
+
+// The Qualities of a Sample.
+const (
+	// QualityGood is a value that was just read successfully.
+	QualityGood Quality = iota
+	// QualityStale is the last good value of a Poll that could not be
+	// sent for more than one Interval, because the bus is too busy.
+	QualityStale
+	// QualityCommError is the result of a failed read.
+	QualityCommError
+)
+
+// QualityNames maps Quality to a string description.
+var QualityNames = map[Quality]string{
+	QualityGood:      "good",
+	QualityStale:     "stale",
+	QualityCommError: "comm-error",
+}
+
+// String returns the name of the Quality.
+func (q Quality) String() string {
+	if s, ok := QualityNames[q]; ok {
+		return s
+	}
+	return fmt.Sprintf("Quality(%d)", byte(q))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (q Quality) MarshalText() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (q *Quality) UnmarshalText(text []byte) error {
+	for quality, name := range QualityNames {
+		if name == string(text) {
+			*q = quality
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid Quality: %q", text)
+}
+
+// Poll is a Query, or a set of Tags, that a Poller reads at a fixed
+// Interval.
+type Poll struct {
+	// Name identifies the Poll and must be unique within a Poller.
+	Name     string
+	Interval time.Duration
+	// Priority decides which Poll is sent first when several are due.
+	// When the bus cannot keep up, Polls of lower Priority are delayed
+	// so that higher Priority Polls keep their Interval. A Poll that is
+	// overdue by more than its Interval goes ahead of all Priorities,
+	// so that no Poll is starved.
+	Priority int
+
+	// Query is sent if there are no Tags.
+	Query Query
+	// Tags are read with as few Queries as the Planner allows and each
+	// produces its own Sample.
+	Tags    []Tag
+	Planner Planner
+}
+
+// Sample is the result of reading a Poll, or one of its Tags.
+type Sample struct {
+	// Poll is the Name of the Poll and Tag the Name of the Tag, if the
+	// Poll has Tags.
+	Poll string
+	Tag  string
+	// Value is the value of the Tag, see Tag.Decode, and Data is the
+	// response data of the Query or the Tag.
+	Value interface{}
+	Data  []byte
+	// Time is when the value was read. Stale Samples repeat the Time of
+	// the last good value.
+	Time    time.Time
+	Quality Quality
+	// Err is the reason for QualityCommError.
+	Err error
+}
+
+// PollStats are the scheduling statistics of a Poll.
+type PollStats struct {
+	// Count and Errors are the number of times the Poll was sent and
+	// failed.
+	Count, Errors int
+	// Overruns is the number of Intervals that were skipped because the
+	// Poll could not be sent in time.
+	Overruns int
+	// Jitter is the delay between the scheduled and the actual start of
+	// the last poll, and MaxJitter the largest such delay.
+	Jitter, MaxJitter time.Duration
+}
+
+// Poller reads a set of Polls at their Intervals using a QuerySender, one
+// at a time, and publishes the resulting Samples to its subscribers.
+type Poller struct {
+	s QuerySender
+
+	mtx         sync.Mutex
+	polls       map[string]*pollState
+	subscribers []*subscriber
+	running     bool
+	wake        chan struct{}
+}
+
+// pollState is the schedule and last result of a Poll.
+type pollState struct {
+	Poll
+	plan    *ReadPlan
+	due     time.Time
+	stats   PollStats
+	last    []Sample
+	isStale bool
+}
+
+// subscriber receives Samples of the Polls or Tags with the given names, or
+// all Samples if names is empty, by calling f. If not nil, done is called when
+// Run returns.
+type subscriber struct {
+	names map[string]bool
+	f     func(Sample)
+	done  func()
+}
+
+// NewPoller returns a Poller that sends its Queries using s, which may be a
+// ClientHandle or a Device.
+func NewPoller(s QuerySender) *Poller {
+	return &Poller{
+		s:     s,
+		polls: make(map[string]*pollState),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Add adds the Poll, which is first sent as soon as possible. Polls may be
+// added while the Poller is running.
+func (p *Poller) Add(poll Poll) error {
+	if len(poll.Name) == 0 {
+		return fmt.Errorf("Poll has no Name")
+	}
+	if poll.Interval <= 0 {
+		return fmt.Errorf("Poll %q: Invalid Interval: %v", poll.Name,
+			poll.Interval)
+	}
+	if len(poll.Tags) > 0 {
+		tags := make([]Tag, len(poll.Tags))
+		copy(tags, poll.Tags)
+		for i := range tags {
+			if err := tags[i].Normalize(); nil != err {
+				return fmt.Errorf("Poll %q: %v", poll.Name, err)
+			}
+			if tags[i].Access&AccessRead == 0 {
+				return fmt.Errorf("Poll %q: Tag %q is not readable",
+					poll.Name, tags[i].Name)
+			}
+		}
+		poll.Tags = tags
+	}
+	ps := &pollState{Poll: poll, due: time.Now()}
+	if len(poll.Tags) > 0 {
+		var err error
+		if ps.plan, err = poll.Planner.PlanTags(poll.Tags...); nil != err {
+			return fmt.Errorf("Poll %q: %v", poll.Name, err)
+		}
+	} else if _, err := poll.Query.IsValid(); nil != err {
+		return fmt.Errorf("Poll %q: %v", poll.Name, err)
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if _, ok := p.polls[poll.Name]; ok {
+		return fmt.Errorf("Duplicate Poll Name: %q", poll.Name)
+	}
+	p.polls[poll.Name] = ps
+	p.notify()
+	return nil
+}
+
+// Remove removes the named Poll.
+func (p *Poller) Remove(name string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	delete(p.polls, name)
+}
+
+// Stats returns the PollStats of the named Poll.
+func (p *Poller) Stats(name string) (PollStats, bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	ps, ok := p.polls[name]
+	if !ok {
+		return PollStats{}, false
+	}
+	return ps.stats, true
+}
+
+// Subscribe returns a channel receiving the Samples of the Polls or Tags with
+// the given names, or of all Polls if no names are given. Samples are
+// dropped if the channel's buffer is full, so that a slow subscriber never
+// delays polling. The channel is closed when Run returns.
+func (p *Poller) Subscribe(buffer int, names ...string) <-chan Sample {
+	ch := make(chan Sample, buffer)
+	p.subscribe(&subscriber{
+		f: func(s Sample) {
+			select {
+			case ch <- s:
+			default:
+			}
+		},
+		done: func() { close(ch) },
+	}, names)
+	return ch
+}
+
+// OnSample calls f with the Samples of the Polls or Tags with the given
+// names, or of all Polls if no names are given. The calls are made from the
+// goroutine running the Poller, so f should return quickly.
+func (p *Poller) OnSample(f func(Sample), names ...string) {
+	p.subscribe(&subscriber{f: f}, names)
+}
+
+func (p *Poller) subscribe(sub *subscriber, names []string) {
+	if len(names) > 0 {
+		sub.names = make(map[string]bool, len(names))
+		for _, name := range names {
+			sub.names[name] = true
+		}
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.subscribers = append(p.subscribers, sub)
+}
+
+// notify wakes up Run to reschedule.
+func (p *Poller) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls until the ctx is done and then closes all subscribed channels
+// and returns ctx.Err(). A Poller can only be run once.
+func (p *Poller) Run(ctx context.Context) error {
+	p.mtx.Lock()
+	if p.running {
+		p.mtx.Unlock()
+		return fmt.Errorf("Poller is already running")
+	}
+	p.running = true
+	p.mtx.Unlock()
+	defer p.closeSubscribers()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		p.mtx.Lock()
+		now := time.Now()
+		stale := p.markStale(now)
+		ps, wait := p.next(now)
+		p.mtx.Unlock()
+		p.publish(stale)
+
+		if nil != ps {
+			p.poll(ctx, ps)
+			if nil != ctx.Err() {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// next returns the due Poll with the highest Priority, the earliest due
+// first among equals, or the time until the next Poll is due. Polls that are
+// overdue by more than their Interval come first, the earliest due first, so
+// that low Priority Polls age past higher ones.
+func (p *Poller) next(now time.Time) (*pollState, time.Duration) {
+	var next *pollState
+	wait := time.Hour
+	for _, ps := range p.polls {
+		if ps.due.After(now) {
+			if d := ps.due.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+		if nil == next || ps.precedes(next, now) {
+			next = ps
+		}
+	}
+	return next, wait
+}
+
+// precedes returns whether the due Poll is sent before the other due Poll.
+func (ps *pollState) precedes(other *pollState, now time.Time) bool {
+	overdue := now.Sub(ps.due) > ps.Interval
+	otherOverdue := now.Sub(other.due) > other.Interval
+	if overdue != otherOverdue {
+		return overdue
+	}
+	if !overdue && ps.Priority != other.Priority {
+		return ps.Priority > other.Priority
+	}
+	return ps.due.Before(other.due)
+}
+
+// markStale returns the last good Samples of Polls that are overdue by more
+// than their Interval as QualityStale, once per delay.
+func (p *Poller) markStale(now time.Time) []Sample {
+	var stale []Sample
+	for _, ps := range p.polls {
+		if ps.isStale || now.Sub(ps.due) <= ps.Interval {
+			continue
+		}
+		ps.isStale = true
+		for _, s := range ps.last {
+			if QualityGood == s.Quality {
+				s.Quality = QualityStale
+				stale = append(stale, s)
+			}
+		}
+	}
+	return stale
+}
+
+// poll sends the Poll, publishes its Samples and schedules the next poll.
+func (p *Poller) poll(ctx context.Context, ps *pollState) {
+	start := time.Now()
+	samples := p.read(ctx, ps.Poll, ps.plan, start)
+	if nil != ctx.Err() {
+		return
+	}
+
+	p.mtx.Lock()
+	ps.stats.Count++
+	ps.stats.Jitter = start.Sub(ps.due)
+	if ps.stats.Jitter > ps.stats.MaxJitter {
+		ps.stats.MaxJitter = ps.stats.Jitter
+	}
+	ps.due = ps.due.Add(ps.Interval)
+	if now := time.Now(); ps.due.Before(now) {
+		missed := int(now.Sub(ps.due)/ps.Interval) + 1
+		ps.stats.Overruns += missed
+		ps.due = ps.due.Add(time.Duration(missed) * ps.Interval)
+	}
+	ps.isStale = false
+	for _, s := range samples {
+		if QualityCommError == s.Quality {
+			ps.stats.Errors++
+			break
+		}
+	}
+	ps.last = samples
+	p.mtx.Unlock()
+	p.publish(samples)
+}
+
+// read sends the Query or reads the Tags of the Poll and returns the
+// resulting Samples.
+func (p *Poller) read(ctx context.Context, poll Poll, plan *ReadPlan,
+	t time.Time) []Sample {
+	if nil == plan {
+		s := Sample{Poll: poll.Name, Time: t}
+		s.Data, s.Err = p.s.SendContext(ctx, poll.Query)
+		if nil != s.Err {
+			s.Quality = QualityCommError
+		}
+		return []Sample{s}
+	}
+	data, err := plan.Execute(ctx, p.s)
+	samples := make([]Sample, len(poll.Tags))
+	for i, tag := range poll.Tags {
+		s := Sample{Poll: poll.Name, Tag: tag.Name, Data: data[i], Time: t}
+		if nil == data[i] {
+			s.Err = err
+		} else {
+			s.Value, s.Err = tag.Decode(data[i])
+		}
+		if nil != s.Err {
+			s.Quality = QualityCommError
+		}
+		samples[i] = s
+	}
+	return samples
+}
+
+// publish sends the samples to all matching subscribers. It must not be
+// called with the mtx locked, so that callbacks may use the Poller.
+func (p *Poller) publish(samples []Sample) {
+	if len(samples) == 0 {
+		return
+	}
+	p.mtx.Lock()
+	subscribers := p.subscribers
+	p.mtx.Unlock()
+	for _, s := range samples {
+		for _, sub := range subscribers {
+			if nil == sub.names || sub.names[s.Poll] ||
+				sub.names[s.Tag] {
+				sub.f(s)
+			}
+		}
+	}
+}
+
+func (p *Poller) closeSubscribers() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for _, sub := range p.subscribers {
+		if nil != sub.done {
+			sub.done()
+		}
+	}
+}
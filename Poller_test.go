@@ -0,0 +1,291 @@
+package modbus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowSender delays every Query to simulate a busy bus.
+type slowSender struct {
+	QuerySender
+	delay time.Duration
+}
+
+func (s slowSender) SendContext(ctx context.Context, q Query) ([]byte,
+	error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.QuerySender.SendContext(ctx, q)
+}
+
+// testPollTags are read by the Polls of the tests.
+var testPollTags = []Tag{
+	{Name: "temp", SlaveID: 1, Table: TableHoldingRegisters, Address: 10,
+		Type: DataTypeInt16, Scale: 0.1},
+	{Name: "run", SlaveID: 1, Table: TableCoils, Address: 0},
+}
+
+// runPoller runs p in the background and returns a function that stops it
+// and waits for Run to return.
+func runPoller(t *testing.T, p *Poller) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := p.Run(ctx); context.Canceled != err {
+			t.Errorf("Run returned: %v", err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// nextSample returns the next Sample from ch or fails the test after a
+// second.
+func nextSample(t *testing.T, ch <-chan Sample) Sample {
+	t.Helper()
+	select {
+	case s, ok := <-ch:
+		if !ok {
+			t.Fatal("Sample channel closed")
+		}
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("No Sample received")
+	}
+	return Sample{}
+}
+
+func TestPollerAdd(t *testing.T) {
+	p := NewPoller(newTestRegisterSender())
+	q, _ := ReadHoldingRegisters(1, 0, 1)
+	for _, poll := range []Poll{
+		{Interval: time.Second, Query: q},
+		{Name: "interval", Query: q},
+		{Name: "query", Interval: time.Second},
+		{Name: "tag", Interval: time.Second, Tags: []Tag{{Name: "x"}}},
+		{Name: "writeonly", Interval: time.Second, Tags: []Tag{{Name: "x",
+			Table: TableHoldingRegisters, Access: AccessWrite}}},
+	} {
+		if err := p.Add(poll); nil == err {
+			t.Errorf("Add %q expected an error", poll.Name)
+		}
+	}
+	if err := p.Add(Poll{Name: "a", Interval: time.Second,
+		Query: q}); nil != err {
+		t.Fatal(err)
+	}
+	if err := p.Add(Poll{Name: "a", Interval: time.Second,
+		Query: q}); nil == err {
+		t.Error("Add of a duplicate Name expected an error")
+	}
+	if _, ok := p.Stats("a"); !ok {
+		t.Error("Stats of Poll a not found")
+	}
+	p.Remove("a")
+	if _, ok := p.Stats("a"); ok {
+		t.Error("Stats of removed Poll a found")
+	}
+}
+
+func TestPollerSamples(t *testing.T) {
+	s := newTestRegisterSender()
+	s.registers[10] = 0xFFF6
+	s.coils[0] = true
+	s.registers[100] = 0x1234
+	p := NewPoller(s)
+	if err := p.Add(Poll{Name: "tags", Interval: 10 * time.Millisecond,
+		Tags: testPollTags}); nil != err {
+		t.Fatal(err)
+	}
+	q, _ := ReadHoldingRegisters(1, 100, 1)
+	if err := p.Add(Poll{Name: "query", Interval: 10 * time.Millisecond,
+		Query: q}); nil != err {
+		t.Fatal(err)
+	}
+	temp := p.Subscribe(10, "temp")
+	query := p.Subscribe(10, "query")
+	var mtx sync.Mutex
+	seen := make(map[string]bool)
+	p.OnSample(func(s Sample) {
+		// Callbacks may use the Poller.
+		p.Stats(s.Poll)
+		mtx.Lock()
+		defer mtx.Unlock()
+		seen[s.Poll+"/"+s.Tag] = true
+	})
+	stop := runPoller(t, p)
+
+	smp := nextSample(t, temp)
+	if "temp" != smp.Tag || QualityGood != smp.Quality || nil != smp.Err {
+		t.Errorf("Unexpected Sample: %+v", smp)
+	}
+	if v, ok := smp.Value.(float64); !ok || v < -1.0001 || v > -0.9999 {
+		t.Errorf("Expected temp -1.0 but got %v", smp.Value)
+	}
+	smp = nextSample(t, query)
+	if "query" != smp.Poll || "" != smp.Tag || QualityGood != smp.Quality ||
+		string(smp.Data) != "\x12\x34" {
+		t.Errorf("Unexpected Sample: %+v", smp)
+	}
+	nextSample(t, temp)
+	stop()
+
+	// The channels are closed when Run returns.
+	for range temp {
+	}
+	for range query {
+	}
+	for _, name := range []string{"tags/temp", "tags/run", "query/"} {
+		if !seen[name] {
+			t.Errorf("OnSample did not receive %v", name)
+		}
+	}
+	if stats, _ := p.Stats("tags"); stats.Count < 2 {
+		t.Errorf("Expected at least 2 polls but got %+v", stats)
+	}
+	if err := p.Run(context.Background()); nil == err {
+		t.Error("Second Run expected an error")
+	}
+}
+
+func TestPollerCommError(t *testing.T) {
+	s := failingSender{QuerySender: newTestRegisterSender(), fail: 10}
+	p := NewPoller(s)
+	if err := p.Add(Poll{Name: "tags", Interval: 10 * time.Millisecond,
+		Tags: testPollTags}); nil != err {
+		t.Fatal(err)
+	}
+	ch := p.Subscribe(10)
+	stop := runPoller(t, p)
+	defer stop()
+	for i := 0; i < 2; i++ {
+		smp := nextSample(t, ch)
+		switch smp.Tag {
+		case "temp":
+			if QualityCommError != smp.Quality || errTestFail != smp.Err {
+				t.Errorf("Expected comm-error but got %+v", smp)
+			}
+		case "run":
+			if QualityGood != smp.Quality || false != smp.Value {
+				t.Errorf("Expected good false but got %+v", smp)
+			}
+		}
+	}
+	if stats, _ := p.Stats("tags"); stats.Errors < 1 {
+		t.Errorf("Expected errors but got %+v", stats)
+	}
+}
+
+func TestPollerPriority(t *testing.T) {
+	s := slowSender{QuerySender: newTestRegisterSender(),
+		delay: 10 * time.Millisecond}
+	p := NewPoller(s)
+	q, _ := ReadHoldingRegisters(1, 0, 1)
+	if err := p.Add(Poll{Name: "low", Interval: 10 * time.Millisecond,
+		Query: q}); nil != err {
+		t.Fatal(err)
+	}
+	low := p.Subscribe(100, "low")
+	stop := runPoller(t, p)
+	defer stop()
+	if smp := nextSample(t, low); QualityGood != smp.Quality {
+		t.Fatalf("Unexpected Sample: %+v", smp)
+	}
+
+	// Two high priority Polls keep the bus busy.
+	for _, name := range []string{"high1", "high2"} {
+		if err := p.Add(Poll{Name: name, Interval: 20 * time.Millisecond,
+			Priority: 1, Query: q}); nil != err {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.After(time.Second)
+	for stale := false; !stale; {
+		select {
+		case smp := <-low:
+			stale = QualityStale == smp.Quality
+		case <-deadline:
+			t.Fatal("No stale Sample received")
+		}
+	}
+	lowStats, _ := p.Stats("low")
+	highStats, _ := p.Stats("high1")
+	if highStats.Count <= lowStats.Count/2 {
+		t.Errorf("Expected high priority Poll to be sent more often: "+
+			"high %+v low %+v", highStats, lowStats)
+	}
+}
+
+func TestPollerStarvation(t *testing.T) {
+	s := slowSender{QuerySender: newTestRegisterSender(),
+		delay: 10 * time.Millisecond}
+	p := NewPoller(s)
+	q, _ := ReadHoldingRegisters(1, 0, 1)
+	// Two high priority Polls alone keep the bus busy.
+	for _, name := range []string{"high1", "high2"} {
+		if err := p.Add(Poll{Name: name, Interval: 10 * time.Millisecond,
+			Priority: 1, Query: q}); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Add(Poll{Name: "low", Interval: 20 * time.Millisecond,
+		Query: q}); nil != err {
+		t.Fatal(err)
+	}
+	stop := runPoller(t, p)
+	time.Sleep(200 * time.Millisecond)
+	stop()
+	lowStats, _ := p.Stats("low")
+	highStats, _ := p.Stats("high1")
+	if lowStats.Count == 0 {
+		t.Errorf("Low priority Poll was starved: %+v", lowStats)
+	}
+	if highStats.Count <= lowStats.Count {
+		t.Errorf("Expected high priority Poll to be sent more often: "+
+			"high %+v low %+v", highStats, lowStats)
+	}
+}
+
+func TestPollerOverruns(t *testing.T) {
+	s := slowSender{QuerySender: newTestRegisterSender(),
+		delay: 12 * time.Millisecond}
+	p := NewPoller(s)
+	q, _ := ReadHoldingRegisters(1, 0, 1)
+	if err := p.Add(Poll{Name: "fast", Interval: 5 * time.Millisecond,
+		Query: q}); nil != err {
+		t.Fatal(err)
+	}
+	ch := p.Subscribe(10)
+	stop := runPoller(t, p)
+	nextSample(t, ch)
+	nextSample(t, ch)
+	nextSample(t, ch)
+	stop()
+	stats, _ := p.Stats("fast")
+	if stats.Overruns < 2 || stats.Overruns < stats.Count {
+		t.Errorf("Expected overruns but got %+v", stats)
+	}
+}
+
+func TestQualityText(t *testing.T) {
+	for q := range QualityNames {
+		text, _ := q.MarshalText()
+		var got Quality
+		if err := got.UnmarshalText(text); nil != err || got != q {
+			t.Errorf("UnmarshalText(%q) want: %v got: %v %v", text, q,
+				got, err)
+		}
+	}
+	var q Quality
+	if err := q.UnmarshalText([]byte("bad")); nil == err {
+		t.Error("UnmarshalText of an invalid name returned no error")
+	}
+}
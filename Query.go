@@ -13,12 +13,16 @@ type Query struct {
 	Address  uint16
 	Quantity uint16
 	Values   []uint16
+	// Coils are the Quantity coil states set by a WriteMultipleCoils
+	// Query. If Coils is nil, Values holds the coils packed as they are
+	// transmitted, 16 per value.
+	Coils []bool
 }
 
 // IsValid returns a bool representing whether the Query is well constructed
-// with a supported FunctionCode and appropriate Quantity and len(Values). If
-// the query is invalid, IsValid returns false, and an error describing the
-// reason for not passing. Otherwise it returns true, nil.
+// with a supported FunctionCode and appropriate Quantity and len(Values) or
+// len(Coils). If the query is invalid, IsValid returns false, and an error
+// describing the reason for not passing. Otherwise it returns true, nil.
 func (q Query) IsValid() (bool, error) {
 	errString, _ := FunctionNames[q.FunctionCode]
 	var maxQuantity uint16
@@ -47,18 +51,41 @@ func (q Query) IsValid() (bool, error) {
 		expectedLen = int(q.Quantity)
 	case FunctionMaskWriteRegister:
 		expectedLen = 2
+	case FunctionReportServerID:
 	default:
-		return false, fmt.Errorf("Invalid FunctionCode: %x", q.FunctionCode)
+		codec, ok := lookupCodec(q.FunctionCode)
+		if !ok {
+			return false, fmt.Errorf("Invalid FunctionCode: %x",
+				q.FunctionCode)
+		}
+		if err := codec.Validate(q); nil != err {
+			return false, err
+		}
+		return true, nil
 	}
 
 	// Check quantity
 	if (isReadFunction(q.FunctionCode) || isWriteMultipleFunction(q.FunctionCode)) &&
-		(q.Quantity == 0 || q.Address+q.Quantity > maxQuantity) {
-		return false, fmt.Errorf("%v: Requested address range [%v, %v] out of range [0, %v]",
-			errString, q.Address, q.Address+q.Quantity, maxQuantity)
+		(q.Quantity == 0 || q.Quantity > maxQuantity) {
+		return false, fmt.Errorf("%v: Requested quantity %v out of range [1, %v]",
+			errString, q.Quantity, maxQuantity)
 	}
-	// Check len(Values)
-	if isWriteFunction(q.FunctionCode) {
+	if int(q.Address)+int(q.Quantity) > 0x10000 {
+		return false, fmt.Errorf("%v: Requested address range [%v, %v] exceeds %v",
+			errString, q.Address, int(q.Address)+int(q.Quantity)-1, 0xFFFF)
+	}
+	// Check len(Coils) or len(Values)
+	if nil != q.Coils {
+		if FunctionWriteMultipleCoils != q.FunctionCode {
+			return false, fmt.Errorf("%v: Coils are only used by %v",
+				errString, FunctionNames[FunctionWriteMultipleCoils])
+		}
+		if len(q.Coils) != int(q.Quantity) || len(q.Values) > 0 {
+			return false, fmt.Errorf(
+				"%v: len(Coils) should be %v but it is: %v",
+				errString, q.Quantity, len(q.Coils))
+		}
+	} else if isWriteFunction(q.FunctionCode) {
 		if len(q.Values) != expectedLen {
 			return false, fmt.Errorf(
 				"%v: len(Values) should be %v but it is: %v",
@@ -109,6 +136,13 @@ func (q Query) isValidResponse(response []byte) (bool, error) {
 		return false, exceptions[exceptionUnknown]
 	}
 
+	if codec, ok := lookupCodec(q.FunctionCode); ok {
+		if _, err := codec.Decode(q, response[2:]); nil != err {
+			return false, err
+		}
+		return true, nil
+	}
+
 	if isWriteFunction(q.FunctionCode) {
 		data, _ := q.data()
 		for i := 0; i < 4; i++ {
@@ -141,16 +175,80 @@ func (q Query) isValidResponse(response []byte) (bool, error) {
 		}
 	}
 
+	if q.FunctionCode == FunctionReportServerID {
+		// The response has a variable length, so only the byte count
+		// can be verified.
+		if len(response) < 3 || int(response[2]) == 0 {
+			return false, exceptions[exceptionBadResponseLength]
+		}
+		if len(response[3:]) != int(response[2]) {
+			return false, exceptions[exceptionResponseLengthMismatch]
+		}
+	}
+
 	return true, nil
 }
 
+// responseData returns the data payload of a valid response, stripping the
+// SlaveID, FunctionCode and, where present, the byte count.
+func (q Query) responseData(response []byte) []byte {
+	if codec, ok := lookupCodec(q.FunctionCode); ok {
+		data, _ := codec.Decode(q, response[2:])
+		return data
+	}
+	if isReadFunction(q.FunctionCode) ||
+		q.FunctionCode == FunctionReportServerID {
+		return response[3:]
+	}
+	return response[2:]
+}
+
+// responseLength returns the expected length of the response PDU, including
+// the FunctionCode, or -1 if it cannot be known before the response is
+// received. Exception responses are always 2 bytes long.
+func (q Query) responseLength() int {
+	switch q.FunctionCode {
+	case FunctionReadCoils:
+		fallthrough
+	case FunctionReadDiscreteInputs:
+		return 2 + (int(q.Quantity)+7)/8
+	case FunctionReadHoldingRegisters:
+		fallthrough
+	case FunctionReadInputRegisters:
+		return 2 + 2*int(q.Quantity)
+	case FunctionWriteSingleCoil:
+		fallthrough
+	case FunctionWriteSingleRegister:
+		fallthrough
+	case FunctionWriteMultipleCoils:
+		fallthrough
+	case FunctionWriteMultipleRegisters:
+		return 5
+	case FunctionMaskWriteRegister:
+		return 7
+	}
+	if codec, ok := lookupCodec(q.FunctionCode); ok {
+		if n := codec.ResponseLength(q); n >= 0 {
+			return 1 + n
+		}
+	}
+	return -1
+}
+
 // data is called by a Packager to construct the data payload for the Query and
 // check if it IsValid().
 func (q Query) data() ([]byte, error) {
 	if valid, err := q.IsValid(); !valid {
 		return nil, err
 	}
+	if codec, ok := lookupCodec(q.FunctionCode); ok {
+		return codec.Encode(q)
+	}
 	if isWriteFunction(q.FunctionCode) {
+		if nil != q.Coils {
+			return dataBlockSuffix(packCoils(q.Coils), q.Address,
+				q.Quantity), nil
+		}
 		if isWriteMultipleFunction(q.FunctionCode) {
 			values := dataBlock(q.Values...)
 			if FunctionWriteMultipleCoils == q.FunctionCode {
@@ -176,6 +274,11 @@ func (q Query) data() ([]byte, error) {
 		}
 	}
 
+	if q.FunctionCode == FunctionReportServerID {
+		// The request has no data.
+		return []byte{}, nil
+	}
+
 	// isReadFunction() must be true
 	return dataBlock(q.Address, q.Quantity), nil
 }
@@ -287,11 +390,19 @@ func WriteSingleRegister(slaveID byte, address, value uint16) (Query, error) {
 	return WriteSingleQuery(slaveID, FunctionWriteSingleRegister, address, value)
 }
 
-// WriteMultipleCoils constructs a WriteMultipleCoils Query object.
-func WriteMultipleCoils(slaveID byte, address, quantity uint16,
-	value []uint16) (Query, error) {
-	return WriteMultipleQuery(slaveID, FunctionWriteMultipleCoils,
-		address, quantity, value)
+// WriteMultipleCoils constructs a WriteMultipleCoils Query object that sets
+// len(coils) coils starting at address.
+func WriteMultipleCoils(slaveID byte, address uint16,
+	coils []bool) (Query, error) {
+	q := Query{
+		SlaveID:      slaveID,
+		FunctionCode: FunctionWriteMultipleCoils,
+		Address:      address,
+		Quantity:     uint16(len(coils)),
+		Coils:        coils,
+	}
+	_, err := q.IsValid()
+	return q, err
 }
 
 // WriteMultipleRegisters constructs a WriteMultipleRegisters Query object.
@@ -313,6 +424,17 @@ func MaskWriteRegister(slaveID byte, address, andMask, orMask uint16) (Query, er
 	return q, err
 }
 
+// ReportServerID constructs a ReportServerID Query object. Use
+// ParseServerID to decode the response data.
+func ReportServerID(slaveID byte) (Query, error) {
+	q := Query{
+		SlaveID:      slaveID,
+		FunctionCode: FunctionReportServerID,
+	}
+	_, err := q.IsValid()
+	return q, err
+}
+
 // isReadFunction returns true if fCode is FunctionReadCoils,
 // FunctionReadDiscreteInputs, FunctionReadHoldingRegisters, or
 // FunctionReadInputRegisters.
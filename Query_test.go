@@ -37,10 +37,15 @@ var testQueries = []testQuery{
 		Address:      0,
 		Quantity:     2000,
 	}, Data: []byte{0, 0, 0x07, 0xD0}},
-	{isValid: false, test: "Max Exceeded Address=1 Quantity=2000", Query: Query{
+	{isValid: true, test: "Max Quantity=2000 Address=1", Query: Query{
 		FunctionCode: FunctionReadCoils,
 		Address:      1,
 		Quantity:     2000,
+	}, Data: []byte{0, 1, 0x07, 0xD0}},
+	{isValid: false, test: "Address Overflow Address=65535 Quantity=2", Query: Query{
+		FunctionCode: FunctionReadCoils,
+		Address:      65535,
+		Quantity:     2,
 	}},
 	{isValid: false, test: "Max Exceeded Quantity=2001", Query: Query{
 		FunctionCode: FunctionReadCoils,
@@ -61,10 +66,15 @@ var testQueries = []testQuery{
 		Address:      0,
 		Quantity:     2000,
 	}, Data: []byte{0, 0, 0x07, 0xD0}},
-	{isValid: false, test: "Max Exceeded Address=1 Quantity=2000", Query: Query{
+	{isValid: true, test: "Max Quantity=2000 Address=1", Query: Query{
 		FunctionCode: FunctionReadDiscreteInputs,
 		Address:      1,
 		Quantity:     2000,
+	}, Data: []byte{0, 1, 0x07, 0xD0}},
+	{isValid: false, test: "Address Overflow Address=65535 Quantity=2", Query: Query{
+		FunctionCode: FunctionReadDiscreteInputs,
+		Address:      65535,
+		Quantity:     2,
 	}},
 	{isValid: false, test: "Max Exceeded Quantity=2001", Query: Query{
 		FunctionCode: FunctionReadDiscreteInputs,
@@ -85,10 +95,15 @@ var testQueries = []testQuery{
 		Address:      0,
 		Quantity:     125,
 	}, Data: []byte{0, 0, 0, 125}},
-	{isValid: false, test: "Max Exceeded Address=1 Quantity=125", Query: Query{
+	{isValid: true, test: "Max Quantity=125 Address=1", Query: Query{
 		FunctionCode: FunctionReadHoldingRegisters,
 		Address:      1,
 		Quantity:     125,
+	}, Data: []byte{0, 1, 0, 125}},
+	{isValid: false, test: "Address Overflow Address=65535 Quantity=2", Query: Query{
+		FunctionCode: FunctionReadHoldingRegisters,
+		Address:      65535,
+		Quantity:     2,
 	}},
 	{isValid: false, test: "Max Exceeded Quantity=126", Query: Query{
 		FunctionCode: FunctionReadHoldingRegisters,
@@ -109,10 +124,15 @@ var testQueries = []testQuery{
 		Address:      0,
 		Quantity:     125,
 	}, Data: []byte{0, 0, 0, 125}},
-	{isValid: false, test: "Max Exceeded Address=1 Quantity=125", Query: Query{
+	{isValid: true, test: "Max Quantity=125 Address=1", Query: Query{
 		FunctionCode: FunctionReadInputRegisters,
 		Address:      1,
 		Quantity:     125,
+	}, Data: []byte{0, 1, 0, 125}},
+	{isValid: false, test: "Address Overflow Address=65535 Quantity=2", Query: Query{
+		FunctionCode: FunctionReadInputRegisters,
+		Address:      65535,
+		Quantity:     2,
 	}},
 	{isValid: false, test: "Max Exceeded Quantity=126", Query: Query{
 		FunctionCode: FunctionReadInputRegisters,
@@ -253,11 +273,11 @@ var testQueries = []testQuery{
 		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		0, 0, 0, 0, 0, 0,
 	}},
-	{isValid: false, test: "Max Exceeded Address=1 Quantity=123", Query: Query{
+	{isValid: false, test: "Address Overflow Address=65535 Quantity=2", Query: Query{
 		FunctionCode: FunctionWriteMultipleRegisters,
-		Address:      1,
-		Quantity:     123,
-		Values:       make([]uint16, 123),
+		Address:      65535,
+		Quantity:     2,
+		Values:       make([]uint16, 2),
 	}},
 	{isValid: false, test: "Max Exceeded Quantity=124", Query: Query{
 		FunctionCode: FunctionWriteMultipleRegisters,
@@ -428,7 +448,7 @@ func TestQuery(t *testing.T) {
 		}
 	})
 	t.Run("WriteMultipleCoils", func(t *testing.T) {
-		if _, err := WriteMultipleCoils(0, 0, 1, []uint16{0}); nil != err {
+		if _, err := WriteMultipleCoils(0, 0, []bool{true}); nil != err {
 			t.Error(err)
 		}
 	})
@@ -2,9 +2,6 @@ package modbus
 
 import (
 	"encoding/binary"
-	"errors"
-	"log"
-	"time"
 
 	"github.com/tarm/serial"
 )
@@ -12,6 +9,7 @@ import (
 // RTUPackager implements the Packager interface for Modbus RTU.
 type RTUPackager struct {
 	packagerSettings
+	turnaround
 	*serial.Port
 }
 
@@ -23,9 +21,11 @@ func NewRTUPackager(c ConnectionSettings) (*RTUPackager, error) {
 		return nil, err
 	}
 	return &RTUPackager{
-		Port: p,
+		Port:       p,
+		turnaround: newTurnaround(c),
 		packagerSettings: packagerSettings{
-			Debug: c.Debug,
+			Debug:   c.Debug,
+			timeout: c.Timeout,
 		}}, nil
 }
 
@@ -34,16 +34,24 @@ func (pkgr *RTUPackager) generateADU(q Query) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkBroadcast(q); err != nil {
+		return nil, err
+	}
+	return pkgr.generateRawADU(q.SlaveID, q.FunctionCode, data)
+}
 
-	if q.SlaveID == 0 {
-		return nil, errors.New("SlaveID cannot be 0 for Modbus RTU")
+// generateRawADU frames the given PDU data as an RTU packet.
+func (pkgr *RTUPackager) generateRawADU(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	if len(data) > MaxPDUSize-1 {
+		return nil, errPDUTooLarge
 	}
 
 	packetLen := len(data) + 4
 
 	packet := make([]byte, packetLen)
-	packet[0] = q.SlaveID
-	packet[1] = byte(q.FunctionCode)
+	packet[0] = slaveID
+	packet[1] = byte(fCode)
 	bytesUsed := 2
 
 	bytesUsed += copy(packet[bytesUsed:], data)
@@ -56,31 +64,83 @@ func (pkgr *RTUPackager) generateADU(q Query) ([]byte, error) {
 	return packet, nil
 }
 
-// Send sends the Query and returns the result or and error code.
+// Send sends the Query and returns the result or and error code. If the
+// Query is a broadcast to SlaveID 0, no response is awaited and nil data is
+// returned.
 func (pkgr *RTUPackager) Send(q Query) ([]byte, error) {
 	adu, err := pkgr.generateADU(q)
 	if err != nil {
 		return nil, err
 	}
 
+	response, err := pkgr.transmit(q.SlaveID, adu, q.responseLength())
+	if err != nil || q.SlaveID == 0 {
+		return nil, err
+	}
+
+	// Check the validity of the response
+	if valid, err := q.isValidResponse(response); !valid {
+		return nil, err
+	}
+
+	// Return only the data payload
+	return q.responseData(response), nil
+}
+
+// SendRaw sends the data as the PDU for the fCode and returns the raw
+// response PDU after only checking the framing and CRC.
+func (pkgr *RTUPackager) SendRaw(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	adu, err := pkgr.generateRawADU(slaveID, fCode, data)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := pkgr.transmit(slaveID, adu, -1)
+	if err != nil || slaveID == 0 {
+		return nil, err
+	}
+
+	// Strip the SlaveID
+	return response[1:], nil
+}
+
+// transmit writes the adu and reads back the response, returning it without
+// the CRC. The pduLen is the expected length of the response PDU, or -1 if
+// it is unknown. Broadcasts to slaveID 0 return nil without reading a
+// response.
+func (pkgr *RTUPackager) transmit(slaveID byte, adu []byte,
+	pduLen int) ([]byte, error) {
+	pkgr.turnaround.wait()
+
 	if pkgr.Debug {
-		log.Printf("Tx: %x\n", adu)
+		logFrame("Tx", ModeRTU, adu, DirectionRequest)
 	}
 
-	_, err = pkgr.Write(adu)
+	_, err := pkgr.Write(adu)
 	if err != nil {
 		return nil, err
 	}
+	deadline := pkgr.deadline()
+
+	if slaveID == 0 {
+		pkgr.turnaround.start()
+		return nil, nil
+	}
 
-	time.Sleep(20 * time.Millisecond)
 	response := make([]byte, MaxRTUSize)
-	n, rerr := pkgr.Read(response)
+	n, rerr := readFrame(pkgr, response, rtuFrameComplete(pduLen),
+		deadline)
 	if rerr != nil {
 		return nil, rerr
 	}
 
 	if pkgr.Debug {
-		log.Printf("Rx Full: %x\n", response)
+		logFrame("Rx", ModeRTU, response[:n], DirectionResponse)
+	}
+
+	if n < 4 {
+		return nil, exceptions[exceptionBadFraming]
 	}
 
 	// Confirm the checksum
@@ -90,22 +150,22 @@ func (pkgr *RTUPackager) Send(q Query) ([]byte, error) {
 	}
 	response = response[:n-2]
 
-	if pkgr.Debug {
-		log.Printf("Rx: %x\n", response)
-	}
-
-	// Check the validity of the response
-	if valid, err := q.isValidResponse(response); !valid {
-		return nil, err
-	}
+	return response, nil
+}
 
-	// Return only the data payload
-	if isReadFunction(q.FunctionCode) {
-		return response[3:], nil
+// rtuFrameComplete returns a function that reports whether a received RTU
+// frame holds a full response PDU of length pduLen. RTU frames are only
+// delimited by silence on the line, so the expected length is used to detect
+// the end of the response without waiting for the read timeout.
+func rtuFrameComplete(pduLen int) func([]byte) bool {
+	return func(frame []byte) bool {
+		if len(frame) >= 2 && frame[1]&0x80 != 0 {
+			// Exception response
+			return len(frame) >= 5
+		}
+		// SlaveID + PDU + CRC
+		return pduLen > 0 && len(frame) >= pduLen+3
 	}
-
-	// Return only the data payload
-	return response[2:], nil
 }
 
 // crc computes and returns a cyclic redundancy check of the given byte array.
@@ -0,0 +1,260 @@
+package modbus
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// StringFormat describes how a string is stored in registers, two
+// characters per register.
+type StringFormat struct {
+	// SwapBytes is true if the first character of each register is stored
+	// in its low byte.
+	SwapBytes bool
+	// TrimNull truncates a decoded string at its first NUL character.
+	TrimNull bool
+	// TrimSpace removes leading and trailing spaces from a decoded string.
+	TrimSpace bool
+	// Pad is used to fill the registers following an encoded string.
+	Pad byte
+}
+
+// DecodeString decodes the register data into a string stored in the given
+// StringFormat.
+func DecodeString(data []byte, f StringFormat) string {
+	b := make([]byte, len(data))
+	copy(b, data)
+	if f.SwapBytes {
+		for i := 0; i+1 < len(b); i += 2 {
+			b[i], b[i+1] = b[i+1], b[i]
+		}
+	}
+	if f.TrimNull {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+	}
+	s := string(b)
+	if f.TrimSpace {
+		s = strings.Trim(s, " ")
+	}
+	return s
+}
+
+// EncodeString returns numRegs register values holding s in the given
+// StringFormat. Unused characters are filled with f.Pad. An error is
+// returned if s does not fit.
+func EncodeString(s string, numRegs int, f StringFormat) ([]uint16, error) {
+	if len(s) > 2*numRegs {
+		return nil, fmt.Errorf("String of length %v does not fit in %v "+
+			"registers", len(s), numRegs)
+	}
+	b := bytes.Repeat([]byte{f.Pad}, 2*numRegs)
+	copy(b, s)
+	order := ByteOrderABCD
+	if f.SwapBytes {
+		order = ByteOrderBADC
+	}
+	regs := make([]uint16, numRegs)
+	for i := range regs {
+		regs[i] = order.registers(b[2*i : 2*i+2])[0]
+	}
+	return regs, nil
+}
+
+// maxBCDDigits is the number of packed BCD digits that always fit in a
+// uint64.
+const maxBCDDigits = 16
+
+// DecodeBCD decodes the register data as a packed BCD number, four digits
+// per register, stored in the given ByteOrder. At most 16 digits may be
+// decoded.
+func DecodeBCD(data []byte, order ByteOrder) (uint64, error) {
+	if len(data) == 0 || len(data)%2 != 0 {
+		return 0, fmt.Errorf("Invalid BCD data length: %v", len(data))
+	}
+	if len(data)*2 > maxBCDDigits {
+		return 0, fmt.Errorf("BCD value exceeds %v digits", maxBCDDigits)
+	}
+	values, err := order.splitValues(data, len(data))
+	if nil != err {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range values[0] {
+		for _, digit := range []byte{b >> 4, b & 0x0f} {
+			if digit > 9 {
+				return 0, fmt.Errorf("Invalid BCD digit: %#x", digit)
+			}
+			v = v*10 + uint64(digit)
+		}
+	}
+	return v, nil
+}
+
+// EncodeBCD returns numRegs register values holding v as a packed BCD
+// number in the given ByteOrder. An error is returned if v does not fit.
+func EncodeBCD(v uint64, numRegs int, order ByteOrder) ([]uint16, error) {
+	if _, ok := ByteOrderNames[order]; !ok {
+		return nil, fmt.Errorf("Invalid ByteOrder: %v", byte(order))
+	}
+	if numRegs < 1 {
+		return nil, fmt.Errorf("Invalid number of BCD registers: %v",
+			numRegs)
+	}
+	if numRegs*4 > maxBCDDigits {
+		return nil, fmt.Errorf("BCD value exceeds %v digits", maxBCDDigits)
+	}
+	b := make([]byte, 2*numRegs)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v%10) | byte(v/10%10)<<4
+		v /= 100
+	}
+	if v != 0 {
+		return nil, fmt.Errorf("BCD value does not fit in %v registers",
+			numRegs)
+	}
+	return order.registers(b), nil
+}
+
+// The IEC 61131-3 date and time types are stored as in most PLC runtimes:
+// TIME and TIME_OF_DAY as 32 bit milliseconds, DATE and DATE_AND_TIME as 32
+// bit seconds since 1970-01-01 UTC, and LTIME as 64 bit nanoseconds.
+
+// DecodeTime decodes the register data into IEC 61131-3 TIME values, stored
+// as milliseconds in the given ByteOrder.
+func DecodeTime(data []byte, order ByteOrder) ([]time.Duration, error) {
+	ms, err := DecodeInt32(data, order)
+	if nil != err {
+		return nil, err
+	}
+	d := make([]time.Duration, len(ms))
+	for i := range ms {
+		d[i] = time.Duration(ms[i]) * time.Millisecond
+	}
+	return d, nil
+}
+
+// EncodeTime returns the register values for storing the durations as IEC
+// 61131-3 TIME values in the given ByteOrder. An error is returned if a
+// duration does not fit in 32 bit milliseconds, about 24.8 days.
+func EncodeTime(order ByteOrder, values ...time.Duration) ([]uint16, error) {
+	ms := make([]int32, len(values))
+	for i, d := range values {
+		v := d / time.Millisecond
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("TIME out of range: %v", d)
+		}
+		ms[i] = int32(v)
+	}
+	return EncodeInt32(order, ms...), nil
+}
+
+// DecodeLTime decodes the register data into IEC 61131-3 LTIME values,
+// stored as nanoseconds in the given ByteOrder.
+func DecodeLTime(data []byte, order ByteOrder) ([]time.Duration, error) {
+	ns, err := DecodeInt64(data, order)
+	if nil != err {
+		return nil, err
+	}
+	d := make([]time.Duration, len(ns))
+	for i := range ns {
+		d[i] = time.Duration(ns[i])
+	}
+	return d, nil
+}
+
+// EncodeLTime returns the register values for storing the durations as IEC
+// 61131-3 LTIME values in the given ByteOrder.
+func EncodeLTime(order ByteOrder, values ...time.Duration) []uint16 {
+	ns := make([]int64, len(values))
+	for i, d := range values {
+		ns[i] = int64(d)
+	}
+	return EncodeInt64(order, ns...)
+}
+
+// DecodeTimeOfDay decodes the register data into IEC 61131-3 TIME_OF_DAY
+// values, stored as milliseconds since midnight in the given ByteOrder.
+func DecodeTimeOfDay(data []byte, order ByteOrder) ([]time.Duration, error) {
+	ms, err := DecodeUint32(data, order)
+	if nil != err {
+		return nil, err
+	}
+	d := make([]time.Duration, len(ms))
+	for i := range ms {
+		if ms[i] >= uint32(24*time.Hour/time.Millisecond) {
+			return nil, fmt.Errorf("Invalid TIME_OF_DAY: %vms", ms[i])
+		}
+		d[i] = time.Duration(ms[i]) * time.Millisecond
+	}
+	return d, nil
+}
+
+// EncodeTimeOfDay returns the register values for storing the durations
+// since midnight as IEC 61131-3 TIME_OF_DAY values in the given ByteOrder.
+// An error is returned if a duration is negative or not less than 24 hours.
+func EncodeTimeOfDay(order ByteOrder,
+	values ...time.Duration) ([]uint16, error) {
+	ms := make([]uint32, len(values))
+	for i, d := range values {
+		if d < 0 || d >= 24*time.Hour {
+			return nil, fmt.Errorf("Invalid TIME_OF_DAY: %v", d)
+		}
+		ms[i] = uint32(d / time.Millisecond)
+	}
+	return EncodeUint32(order, ms...), nil
+}
+
+// DecodeDate decodes the register data into IEC 61131-3 DATE values, stored
+// as seconds since 1970-01-01 UTC in the given ByteOrder.
+func DecodeDate(data []byte, order ByteOrder) ([]time.Time, error) {
+	return DecodeDateAndTime(data, order)
+}
+
+// EncodeDate returns the register values for storing the dates as IEC
+// 61131-3 DATE values in the given ByteOrder. The time of day is discarded.
+// An error is returned if a date is before 1970 or after 2106.
+func EncodeDate(order ByteOrder, values ...time.Time) ([]uint16, error) {
+	dates := make([]time.Time, len(values))
+	for i, t := range values {
+		y, m, d := t.Date()
+		dates[i] = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	return EncodeDateAndTime(order, dates...)
+}
+
+// DecodeDateAndTime decodes the register data into IEC 61131-3
+// DATE_AND_TIME values, stored as seconds since 1970-01-01 UTC in the given
+// ByteOrder.
+func DecodeDateAndTime(data []byte, order ByteOrder) ([]time.Time, error) {
+	s, err := DecodeUint32(data, order)
+	if nil != err {
+		return nil, err
+	}
+	t := make([]time.Time, len(s))
+	for i := range s {
+		t[i] = time.Unix(int64(s[i]), 0).UTC()
+	}
+	return t, nil
+}
+
+// EncodeDateAndTime returns the register values for storing the times as
+// IEC 61131-3 DATE_AND_TIME values in the given ByteOrder. An error is
+// returned if a time is outside the 32 bit range of seconds since
+// 1970-01-01 UTC, which ends in 2106.
+func EncodeDateAndTime(order ByteOrder,
+	values ...time.Time) ([]uint16, error) {
+	s := make([]uint32, len(values))
+	for i, t := range values {
+		v := t.Unix()
+		if v < 0 || v > math.MaxUint32 {
+			return nil, fmt.Errorf("DATE_AND_TIME out of range: %v", t)
+		}
+		s[i] = uint32(v)
+	}
+	return EncodeUint32(order, s...), nil
+}
@@ -0,0 +1,144 @@
+package modbus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestString(t *testing.T) {
+	data := []byte("SN1234\x00\x00  ")
+	if s := DecodeString(data, StringFormat{TrimNull: true}); s != "SN1234" {
+		t.Errorf("TrimNull want: SN1234 got: %q", s)
+	}
+	if s := DecodeString([]byte("  AB  "),
+		StringFormat{TrimSpace: true}); s != "AB" {
+		t.Errorf("TrimSpace want: AB got: %q", s)
+	}
+	if s := DecodeString([]byte("NS2143"), StringFormat{SwapBytes: true}); s !=
+		"SN1234" {
+		t.Errorf("SwapBytes want: SN1234 got: %q", s)
+	}
+
+	regs, err := EncodeString("SN1", 3, StringFormat{SwapBytes: true, Pad: ' '})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []uint16{0x4E53, 0x2031, 0x2020}; !reflect.DeepEqual(regs, want) {
+		t.Errorf("EncodeString want: %04x got: %04x", want, regs)
+	}
+	if _, err := EncodeString("TOO LONG", 2, StringFormat{}); nil == err {
+		t.Error("Oversize string err is nil")
+	}
+}
+
+func TestBCD(t *testing.T) {
+	regs, err := EncodeBCD(12345678, 2, ByteOrderABCD)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []uint16{0x1234, 0x5678}; !reflect.DeepEqual(regs, want) {
+		t.Errorf("EncodeBCD want: %04x got: %04x", want, regs)
+	}
+	for o := range ByteOrderNames {
+		regs, _ := EncodeBCD(9876, 2, o)
+		if v, err := DecodeBCD(dataBlock(regs...), o); nil != err || v != 9876 {
+			t.Errorf("%v: DecodeBCD want: 9876 got: %v, %v", o, v, err)
+		}
+	}
+	if _, err := EncodeBCD(12345, 1, ByteOrderABCD); nil == err {
+		t.Error("Oversize BCD err is nil")
+	}
+	for _, n := range []int{0, -1} {
+		if _, err := EncodeBCD(0, n, ByteOrderABCD); nil == err {
+			t.Errorf("EncodeBCD of %v registers err is nil", n)
+		}
+	}
+	if _, err := DecodeBCD([]byte{0x1A, 0x00}, ByteOrderABCD); nil == err {
+		t.Error("Invalid BCD digit err is nil")
+	}
+	if _, err := DecodeBCD(make([]byte, 10), ByteOrderABCD); nil == err {
+		t.Error("Too many BCD digits err is nil")
+	}
+}
+
+func TestDateAndTime(t *testing.T) {
+	o := ByteOrderCDAB
+	d := []time.Duration{-90 * time.Second, 1500 * time.Millisecond}
+	regs, err := EncodeTime(o, d...)
+	if nil != err {
+		t.Fatalf("EncodeTime: %v", err)
+	}
+	if v, err := DecodeTime(dataBlock(regs...), o); nil != err ||
+		!reflect.DeepEqual(v, d) {
+		t.Errorf("TIME want: %v got: %v, %v", d, v, err)
+	}
+	for _, d := range []time.Duration{25 * 24 * time.Hour,
+		-25 * 24 * time.Hour} {
+		if _, err := EncodeTime(o, d); nil == err {
+			t.Errorf("TIME %v err is nil", d)
+		}
+	}
+	if v, err := DecodeLTime(dataBlock(EncodeLTime(o, d...)...), o); nil != err ||
+		!reflect.DeepEqual(v, d) {
+		t.Errorf("LTIME want: %v got: %v, %v", d, v, err)
+	}
+
+	tod := []time.Duration{13*time.Hour + 5*time.Millisecond}
+	regs, err = EncodeTimeOfDay(o, tod...)
+	if nil != err {
+		t.Fatalf("EncodeTimeOfDay: %v", err)
+	}
+	if v, err := DecodeTimeOfDay(dataBlock(regs...), o); nil != err ||
+		!reflect.DeepEqual(v, tod) {
+		t.Errorf("TIME_OF_DAY want: %v got: %v, %v", tod, v, err)
+	}
+	for _, d := range []time.Duration{-time.Millisecond, 24 * time.Hour} {
+		if _, err := EncodeTimeOfDay(o, d); nil == err {
+			t.Errorf("TIME_OF_DAY %v err is nil", d)
+		}
+	}
+	if _, err := DecodeTimeOfDay(dataBlock(EncodeUint32(o,
+		uint32(24*time.Hour/time.Millisecond))...), o); nil == err {
+		t.Error("Invalid TIME_OF_DAY err is nil")
+	}
+
+	dt := time.Date(2018, 9, 1, 12, 30, 15, 0, time.UTC)
+	regs, err = EncodeDateAndTime(o, dt)
+	if nil != err {
+		t.Fatalf("EncodeDateAndTime: %v", err)
+	}
+	if v, err := DecodeDateAndTime(dataBlock(regs...), o); nil != err ||
+		!v[0].Equal(dt) {
+		t.Errorf("DATE_AND_TIME want: %v got: %v, %v", dt, v, err)
+	}
+	for _, dt := range []time.Time{
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2106, 2, 7, 6, 28, 16, 0, time.UTC),
+	} {
+		if _, err := EncodeDateAndTime(o, dt); nil == err {
+			t.Errorf("DATE_AND_TIME %v err is nil", dt)
+		}
+	}
+	last := time.Date(2106, 2, 7, 6, 28, 15, 0, time.UTC)
+	regs, err = EncodeDateAndTime(o, last)
+	if v, err2 := DecodeDateAndTime(dataBlock(regs...), o); nil != err ||
+		nil != err2 || !v[0].Equal(last) {
+		t.Errorf("DATE_AND_TIME want: %v got: %v, %v, %v", last, v, err,
+			err2)
+	}
+
+	date := time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC)
+	regs, err = EncodeDate(o, dt)
+	if nil != err {
+		t.Fatalf("EncodeDate: %v", err)
+	}
+	if v, err := DecodeDate(dataBlock(regs...), o); nil != err ||
+		!v[0].Equal(date) {
+		t.Errorf("DATE want: %v got: %v, %v", date, v, err)
+	}
+	if _, err := EncodeDate(o, time.Date(1960, 1, 1, 0, 0, 0, 0,
+		time.UTC)); nil == err {
+		t.Error("DATE before 1970 err is nil")
+	}
+}
@@ -0,0 +1,336 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ByteOrder is the order in which the bytes of a multi-register value are
+// stored in the registers. The letters name the bytes of a 32 bit value from
+// the most significant (A) to the least significant (D), in the order they
+// are transmitted. The same word and byte swapping applies to 16 and 64 bit
+// values.
+//
+// The Decode functions return an error for an invalid ByteOrder, while the
+// Encode functions, which return no error, panic.
+type ByteOrder byte
+
+// The available byte orders.
+const (
+	// ByteOrderABCD is big-endian: most significant word first, most
+	// significant byte first within each register.
+	ByteOrderABCD ByteOrder = iota
+	// ByteOrderCDAB is word swapped: least significant word first, most
+	// significant byte first within each register.
+	ByteOrderCDAB
+	// ByteOrderBADC is byte swapped: most significant word first, least
+	// significant byte first within each register.
+	ByteOrderBADC
+	// ByteOrderDCBA is little-endian: least significant word first, least
+	// significant byte first within each register.
+	ByteOrderDCBA
+)
+
+// ByteOrderNames maps ByteOrder to a string description.
+var ByteOrderNames = map[ByteOrder]string{
+	ByteOrderABCD: "ABCD",
+	ByteOrderCDAB: "CDAB",
+	ByteOrderBADC: "BADC",
+	ByteOrderDCBA: "DCBA",
+}
+
+// ByteOrderByName maps ByteOrderNames to their ByteOrder, i.e. the inverse of
+// ByteOrderNames.
+var ByteOrderByName = map[string]ByteOrder{}
+
+func init() {
+	for o, s := range ByteOrderNames {
+		ByteOrderByName[s] = o
+	}
+}
+
+// String returns the name of the ByteOrder.
+func (o ByteOrder) String() string {
+	if s, ok := ByteOrderNames[o]; ok {
+		return s
+	}
+	return fmt.Sprintf("ByteOrder(%d)", byte(o))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (o ByteOrder) MarshalText() ([]byte, error) {
+	if _, ok := ByteOrderNames[o]; !ok {
+		return nil, fmt.Errorf("Invalid ByteOrder: %v", byte(o))
+	}
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. The name is not case
+// sensitive.
+func (o *ByteOrder) UnmarshalText(text []byte) error {
+	order, ok := ByteOrderByName[strings.ToUpper(string(text))]
+	if !ok {
+		return fmt.Errorf("Invalid ByteOrder: %q", text)
+	}
+	*o = order
+	return nil
+}
+
+func (o ByteOrder) swapWords() bool {
+	return o == ByteOrderCDAB || o == ByteOrderDCBA
+}
+
+func (o ByteOrder) swapBytes() bool {
+	return o == ByteOrderBADC || o == ByteOrderDCBA
+}
+
+// reorder converts a value of len(b) bytes between the ByteOrder and
+// big-endian order. Since the conversion is its own inverse it is used for
+// both decoding and encoding.
+func (o ByteOrder) reorder(b []byte) []byte {
+	words := len(b) / 2
+	out := make([]byte, len(b))
+	for i := 0; i < words; i++ {
+		src := i
+		if o.swapWords() {
+			src = words - 1 - i
+		}
+		hi, lo := b[2*src], b[2*src+1]
+		if o.swapBytes() {
+			hi, lo = lo, hi
+		}
+		out[2*i], out[2*i+1] = hi, lo
+	}
+	return out
+}
+
+// splitValues checks that data holds a whole number of size byte values and
+// returns each of them reordered to big-endian.
+func (o ByteOrder) splitValues(data []byte, size int) ([][]byte, error) {
+	if _, ok := ByteOrderNames[o]; !ok {
+		return nil, fmt.Errorf("Invalid ByteOrder: %v", byte(o))
+	}
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("len(data) %v is not a multiple of %v",
+			len(data), size)
+	}
+	values := make([][]byte, len(data)/size)
+	for i := range values {
+		values[i] = o.reorder(data[i*size : (i+1)*size])
+	}
+	return values, nil
+}
+
+// registers reorders the big-endian value bytes and returns them as register
+// values. It panics if the ByteOrder is invalid.
+func (o ByteOrder) registers(value []byte) []uint16 {
+	if _, ok := ByteOrderNames[o]; !ok {
+		panic(fmt.Sprintf("modbus: Invalid ByteOrder: %v", byte(o)))
+	}
+	value = o.reorder(value)
+	regs := make([]uint16, len(value)/2)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(value[i*2:])
+	}
+	return regs
+}
+
+// DecodeUint16 decodes the register data, as returned by sending a read
+// Query, into uint16 values stored in the given ByteOrder.
+func DecodeUint16(data []byte, order ByteOrder) ([]uint16, error) {
+	values, err := order.splitValues(data, 2)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]uint16, len(values))
+	for i, b := range values {
+		v[i] = binary.BigEndian.Uint16(b)
+	}
+	return v, nil
+}
+
+// DecodeInt16 decodes the register data into int16 values stored in the
+// given ByteOrder.
+func DecodeInt16(data []byte, order ByteOrder) ([]int16, error) {
+	u, err := DecodeUint16(data, order)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]int16, len(u))
+	for i := range u {
+		v[i] = int16(u[i])
+	}
+	return v, nil
+}
+
+// DecodeUint32 decodes the register data into uint32 values stored in the
+// given ByteOrder. Each value occupies two registers.
+func DecodeUint32(data []byte, order ByteOrder) ([]uint32, error) {
+	values, err := order.splitValues(data, 4)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]uint32, len(values))
+	for i, b := range values {
+		v[i] = binary.BigEndian.Uint32(b)
+	}
+	return v, nil
+}
+
+// DecodeInt32 decodes the register data into int32 values stored in the
+// given ByteOrder. Each value occupies two registers.
+func DecodeInt32(data []byte, order ByteOrder) ([]int32, error) {
+	u, err := DecodeUint32(data, order)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]int32, len(u))
+	for i := range u {
+		v[i] = int32(u[i])
+	}
+	return v, nil
+}
+
+// DecodeUint64 decodes the register data into uint64 values stored in the
+// given ByteOrder. Each value occupies four registers.
+func DecodeUint64(data []byte, order ByteOrder) ([]uint64, error) {
+	values, err := order.splitValues(data, 8)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]uint64, len(values))
+	for i, b := range values {
+		v[i] = binary.BigEndian.Uint64(b)
+	}
+	return v, nil
+}
+
+// DecodeInt64 decodes the register data into int64 values stored in the
+// given ByteOrder. Each value occupies four registers.
+func DecodeInt64(data []byte, order ByteOrder) ([]int64, error) {
+	u, err := DecodeUint64(data, order)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]int64, len(u))
+	for i := range u {
+		v[i] = int64(u[i])
+	}
+	return v, nil
+}
+
+// DecodeFloat32 decodes the register data into IEEE 754 float32 values
+// stored in the given ByteOrder. Each value occupies two registers.
+func DecodeFloat32(data []byte, order ByteOrder) ([]float32, error) {
+	u, err := DecodeUint32(data, order)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]float32, len(u))
+	for i := range u {
+		v[i] = math.Float32frombits(u[i])
+	}
+	return v, nil
+}
+
+// DecodeFloat64 decodes the register data into IEEE 754 float64 values
+// stored in the given ByteOrder. Each value occupies four registers.
+func DecodeFloat64(data []byte, order ByteOrder) ([]float64, error) {
+	u, err := DecodeUint64(data, order)
+	if nil != err {
+		return nil, err
+	}
+	v := make([]float64, len(u))
+	for i := range u {
+		v[i] = math.Float64frombits(u[i])
+	}
+	return v, nil
+}
+
+// EncodeUint16 returns the register values for storing the values in the
+// given ByteOrder, ready to be used with WriteMultipleRegisters.
+func EncodeUint16(order ByteOrder, values ...uint16) []uint16 {
+	regs := make([]uint16, 0, len(values))
+	b := make([]byte, 2)
+	for _, v := range values {
+		binary.BigEndian.PutUint16(b, v)
+		regs = append(regs, order.registers(b)...)
+	}
+	return regs
+}
+
+// EncodeInt16 returns the register values for storing the values in the
+// given ByteOrder.
+func EncodeInt16(order ByteOrder, values ...int16) []uint16 {
+	u := make([]uint16, len(values))
+	for i, v := range values {
+		u[i] = uint16(v)
+	}
+	return EncodeUint16(order, u...)
+}
+
+// EncodeUint32 returns the register values for storing the values in the
+// given ByteOrder. Each value occupies two registers.
+func EncodeUint32(order ByteOrder, values ...uint32) []uint16 {
+	regs := make([]uint16, 0, 2*len(values))
+	b := make([]byte, 4)
+	for _, v := range values {
+		binary.BigEndian.PutUint32(b, v)
+		regs = append(regs, order.registers(b)...)
+	}
+	return regs
+}
+
+// EncodeInt32 returns the register values for storing the values in the
+// given ByteOrder. Each value occupies two registers.
+func EncodeInt32(order ByteOrder, values ...int32) []uint16 {
+	u := make([]uint32, len(values))
+	for i, v := range values {
+		u[i] = uint32(v)
+	}
+	return EncodeUint32(order, u...)
+}
+
+// EncodeUint64 returns the register values for storing the values in the
+// given ByteOrder. Each value occupies four registers.
+func EncodeUint64(order ByteOrder, values ...uint64) []uint16 {
+	regs := make([]uint16, 0, 4*len(values))
+	b := make([]byte, 8)
+	for _, v := range values {
+		binary.BigEndian.PutUint64(b, v)
+		regs = append(regs, order.registers(b)...)
+	}
+	return regs
+}
+
+// EncodeInt64 returns the register values for storing the values in the
+// given ByteOrder. Each value occupies four registers.
+func EncodeInt64(order ByteOrder, values ...int64) []uint16 {
+	u := make([]uint64, len(values))
+	for i, v := range values {
+		u[i] = uint64(v)
+	}
+	return EncodeUint64(order, u...)
+}
+
+// EncodeFloat32 returns the register values for storing the values as IEEE
+// 754 float32 in the given ByteOrder. Each value occupies two registers.
+func EncodeFloat32(order ByteOrder, values ...float32) []uint16 {
+	u := make([]uint32, len(values))
+	for i, v := range values {
+		u[i] = math.Float32bits(v)
+	}
+	return EncodeUint32(order, u...)
+}
+
+// EncodeFloat64 returns the register values for storing the values as IEEE
+// 754 float64 in the given ByteOrder. Each value occupies four registers.
+func EncodeFloat64(order ByteOrder, values ...float64) []uint16 {
+	u := make([]uint64, len(values))
+	for i, v := range values {
+		u[i] = math.Float64bits(v)
+	}
+	return EncodeUint64(order, u...)
+}
@@ -0,0 +1,112 @@
+package modbus
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+var testByteOrders = []struct {
+	ByteOrder
+	regs32 []uint16
+	regs64 []uint16
+}{
+	{ByteOrderABCD, []uint16{0x0102, 0x0304},
+		[]uint16{0x0102, 0x0304, 0x0506, 0x0708}},
+	{ByteOrderCDAB, []uint16{0x0304, 0x0102},
+		[]uint16{0x0708, 0x0506, 0x0304, 0x0102}},
+	{ByteOrderBADC, []uint16{0x0201, 0x0403},
+		[]uint16{0x0201, 0x0403, 0x0605, 0x0807}},
+	{ByteOrderDCBA, []uint16{0x0403, 0x0201},
+		[]uint16{0x0807, 0x0605, 0x0403, 0x0201}},
+}
+
+func TestRegisters(t *testing.T) {
+	for _, o := range testByteOrders {
+		o := o
+		t.Run(o.String(), func(t *testing.T) {
+			testRegisters(t, o.ByteOrder, o.regs32, o.regs64)
+		})
+	}
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := DecodeUint32(make([]byte, 6), ByteOrderABCD); nil == err {
+			t.Error("Partial value err is nil")
+		}
+		if _, err := DecodeUint16(make([]byte, 2), ByteOrder(9)); nil == err {
+			t.Error("Invalid ByteOrder err is nil")
+		}
+		if _, err := EncodeBCD(1, 1, ByteOrder(9)); nil == err {
+			t.Error("EncodeBCD invalid ByteOrder err is nil")
+		}
+		tag := Tag{Name: "t", Type: DataTypeUint32, ByteOrder: ByteOrder(9)}
+		if _, err := tag.Encode(1); nil == err {
+			t.Error("Tag.Encode invalid ByteOrder err is nil")
+		}
+		defer func() {
+			if nil == recover() {
+				t.Error("EncodeUint32 invalid ByteOrder did not panic")
+			}
+		}()
+		EncodeUint32(ByteOrder(9), 1)
+	})
+	t.Run("ByteOrderByName", func(t *testing.T) {
+		if ByteOrderByName["CDAB"] != ByteOrderCDAB {
+			t.Error("ByteOrderByName[CDAB] != ByteOrderCDAB")
+		}
+		var o ByteOrder
+		if err := o.UnmarshalText([]byte("dcba")); nil != err ||
+			o != ByteOrderDCBA {
+			t.Errorf("UnmarshalText(dcba) want: DCBA got: %v, %v", o, err)
+		}
+	})
+}
+
+func testRegisters(t *testing.T, o ByteOrder, regs32, regs64 []uint16) {
+	if regs := EncodeUint32(o, 0x01020304); !reflect.DeepEqual(regs, regs32) {
+		t.Errorf("EncodeUint32 want: %04x got: %04x", regs32, regs)
+	}
+	if v, _ := DecodeUint32(dataBlock(regs32...), o); v[0] != 0x01020304 {
+		t.Errorf("DecodeUint32 want: 0x01020304 got: %#x", v)
+	}
+	if regs := EncodeUint64(o, 0x0102030405060708); !reflect.DeepEqual(regs,
+		regs64) {
+		t.Errorf("EncodeUint64 want: %04x got: %04x", regs64, regs)
+	}
+	if v, _ := DecodeUint64(dataBlock(regs64...), o); v[0] != 0x0102030405060708 {
+		t.Errorf("DecodeUint64 want: 0x0102030405060708 got: %#x", v)
+	}
+
+	i16 := []int16{-2, 300}
+	if v, err := DecodeInt16(dataBlock(EncodeInt16(o, i16...)...), o); nil != err ||
+		!reflect.DeepEqual(v, i16) {
+		t.Errorf("Int16 want: %v got: %v, %v", i16, v, err)
+	}
+	i32 := []int32{-70000, 1}
+	if v, err := DecodeInt32(dataBlock(EncodeInt32(o, i32...)...), o); nil != err ||
+		!reflect.DeepEqual(v, i32) {
+		t.Errorf("Int32 want: %v got: %v, %v", i32, v, err)
+	}
+	i64 := []int64{math.MinInt64, 5}
+	if v, err := DecodeInt64(dataBlock(EncodeInt64(o, i64...)...), o); nil != err ||
+		!reflect.DeepEqual(v, i64) {
+		t.Errorf("Int64 want: %v got: %v, %v", i64, v, err)
+	}
+	f32 := []float32{-1.5, 3.25e10}
+	if v, err := DecodeFloat32(dataBlock(EncodeFloat32(o, f32...)...), o); nil != err ||
+		!reflect.DeepEqual(v, f32) {
+		t.Errorf("Float32 want: %v got: %v, %v", f32, v, err)
+	}
+	f64 := []float64{math.Pi, -1e-300}
+	if v, err := DecodeFloat64(dataBlock(EncodeFloat64(o, f64...)...), o); nil != err ||
+		!reflect.DeepEqual(v, f64) {
+		t.Errorf("Float64 want: %v got: %v, %v", f64, v, err)
+	}
+	u16 := []uint16{0x1234}
+	want := []uint16{0x1234}
+	if o.swapBytes() {
+		want = []uint16{0x3412}
+	}
+	if regs := EncodeUint16(o, u16...); !reflect.DeepEqual(regs, want) {
+		t.Errorf("EncodeUint16 want: %04x got: %04x", want, regs)
+	}
+}
@@ -0,0 +1,62 @@
+package modbus
+
+import "fmt"
+
+// Run indicator status values of a ReportServerID response.
+const (
+	runIndicatorOff = 0x00
+	runIndicatorOn  = 0xFF
+)
+
+// ServerID holds the decoded response data of a ReportServerID Query.
+type ServerID struct {
+	// ID holds the device specific server ID bytes.
+	ID []byte
+	// Running is true if the run indicator status is ON.
+	Running bool
+	// Additional holds any device specific data following the run
+	// indicator status.
+	Additional []byte
+	// Device holds the value returned by the ServerIDDecoder passed to
+	// ParseServerID, if any.
+	Device interface{}
+}
+
+// ServerIDDecoder is a vendor hook for decoding the device specific
+// additional data of a ReportServerID response.
+type ServerIDDecoder func(additional []byte) (interface{}, error)
+
+// ParseServerID decodes the data returned by sending a ReportServerID Query.
+// The length of the server ID is device specific and must be given by idLen.
+// The run indicator status is expected to immediately follow the server ID.
+// If decode is not nil, it is called with the additional data and its result
+// is stored in ServerID.Device.
+func ParseServerID(data []byte, idLen int, decode ServerIDDecoder) (ServerID,
+	error) {
+	var sid ServerID
+	if idLen < 0 || idLen >= len(data) {
+		return sid, fmt.Errorf("ServerID length %v out of range [0, %v)",
+			idLen, len(data))
+	}
+
+	switch data[idLen] {
+	case runIndicatorOff:
+	case runIndicatorOn:
+		sid.Running = true
+	default:
+		return sid, fmt.Errorf("Invalid run indicator status: %#x",
+			data[idLen])
+	}
+
+	sid.ID = append([]byte{}, data[:idLen]...)
+	sid.Additional = append([]byte{}, data[idLen+1:]...)
+
+	if nil != decode {
+		device, err := decode(sid.Additional)
+		if nil != err {
+			return sid, err
+		}
+		sid.Device = device
+	}
+	return sid, nil
+}
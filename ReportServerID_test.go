@@ -0,0 +1,70 @@
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReportServerID(t *testing.T) {
+	t.Run("Query", func(t *testing.T) {
+		q, err := ReportServerID(1)
+		if nil != err {
+			t.Fatal(err)
+		}
+		data, err := q.data()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if len(data) != 0 {
+			t.Errorf("data want: [] got: %v", data)
+		}
+	})
+	t.Run("isValidResponse", func(t *testing.T) {
+		q, _ := ReportServerID(1)
+		response := []byte{1, byte(FunctionReportServerID), 3, 0x42, 0xFF, 0x07}
+		if valid, err := q.isValidResponse(response); !valid {
+			t.Fatal(err)
+		}
+		if data := q.responseData(response); !bytes.Equal(data,
+			[]byte{0x42, 0xFF, 0x07}) {
+			t.Errorf("responseData want: [42 ff 07] got: %x", data)
+		}
+		testIsValidResponse(t, q, response[:5],
+			exceptions[exceptionResponseLengthMismatch])
+		testIsValidResponse(t, q, []byte{1, byte(FunctionReportServerID), 0},
+			exceptions[exceptionBadResponseLength])
+	})
+	t.Run("ParseServerID", func(t *testing.T) {
+		data := []byte{0x12, 0x34, runIndicatorOn, 'v', '1'}
+		sid, err := ParseServerID(data, 2, func(add []byte) (interface{}, error) {
+			return string(add), nil
+		})
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sid.ID, []byte{0x12, 0x34}) {
+			t.Errorf("ID want: 1234 got: %x", sid.ID)
+		}
+		if !sid.Running {
+			t.Error("Running want: true got: false")
+		}
+		if sid.Device != "v1" {
+			t.Errorf("Device want: v1 got: %v", sid.Device)
+		}
+
+		if _, err := ParseServerID(data, 1, nil); nil == err {
+			t.Error("Invalid run indicator err is nil")
+		}
+		if _, err := ParseServerID(data, len(data), nil); nil == err {
+			t.Error("idLen out of range err is nil")
+		}
+		decodeErr := errors.New("decode error")
+		_, err = ParseServerID(data, 2, func([]byte) (interface{}, error) {
+			return nil, decodeErr
+		})
+		if err != decodeErr {
+			t.Errorf("err want: %v got: %v", decodeErr, err)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+// DefaultScanStep is the ScanOptions.Step used if it is zero.
+const DefaultScanStep = 1024
+
+// RawSender sends raw PDUs, as described by Packager.SendRaw. It is
+// implemented by ClientHandles.
+type RawSender interface {
+	SendRaw(slaveID byte, fCode FunctionCode, data []byte) ([]byte, error)
+}
+
+// ScanOptions control Scan.
+type ScanOptions struct {
+	// SlaveIDs are the SlaveIDs to scan, in order. The default is 1 to
+	// 247, the unicast addresses of a serial bus.
+	SlaveIDs []byte
+	// Step is the distance between the addresses that are probed to find
+	// the readable Ranges. Shorter Ranges may be missed.
+	Step uint16
+	// SkipRanges skips the search for readable Ranges.
+	SkipRanges bool
+	// ProbeWrites also probes the support of the write functions, which
+	// Scan does not by default, since the probes are sent to devices that
+	// are not known yet. WriteSingleCoil is probed with the invalid value
+	// 0x1234 at coil 0, and WriteMultipleCoils and WriteMultipleRegisters
+	// with a quantity of 0 at address 0, which devices that follow the
+	// specification reject without writing. MaskWriteRegister is probed
+	// with an AND mask of 0xFFFF and an OR mask of 0 at holding register 0.
+	// The masks leave the register unchanged, but the device performs a
+	// read-modify-write that may race with its own updates. The support of
+	// WriteSingleRegister is never probed since all values are valid.
+	ProbeWrites bool
+}
+
+// ScanResult describes a device found by Scan.
+type ScanResult struct {
+	SlaveID byte
+	// Functions maps the probed FunctionCodes to whether the device
+	// supports them. FunctionCodes with inconclusive probes are missing.
+	Functions map[FunctionCode]bool
+	// ServerID is the response data to ReportServerID, without the byte
+	// count, if the device supports it.
+	ServerID []byte
+	// Ranges are the readable address ranges of the Tables, in the order
+	// coils, discrete inputs, input registers and holding registers.
+	Ranges []ScanRange
+}
+
+// ScanRange is a range of readable addresses of a Table from First to Last,
+// inclusive.
+type ScanRange struct {
+	Table       Table
+	First, Last uint16
+}
+
+// scanProbes are the requests used to probe the support of FunctionCodes.
+// The write probes are only sent with ScanOptions.ProbeWrites, see there.
+// The first probe also detects whether a device responds at all.
+var scanProbes = []struct {
+	fCode FunctionCode
+	data  []byte
+	write bool
+}{
+	{FunctionReadHoldingRegisters, []byte{0, 0, 0, 1}, false},
+	{FunctionReadInputRegisters, []byte{0, 0, 0, 1}, false},
+	{FunctionReadCoils, []byte{0, 0, 0, 1}, false},
+	{FunctionReadDiscreteInputs, []byte{0, 0, 0, 1}, false},
+	{FunctionReportServerID, nil, false},
+	{FunctionWriteSingleCoil, []byte{0, 0, 0x12, 0x34}, true},
+	{FunctionWriteMultipleCoils, []byte{0, 0, 0, 0, 0}, true},
+	{FunctionWriteMultipleRegisters, []byte{0, 0, 0, 0, 0}, true},
+	{FunctionMaskWriteRegister, []byte{0, 0, 0xFF, 0xFF, 0, 0}, true},
+}
+
+// scanTables are the Tables in the order of ScanResult.Ranges.
+var scanTables = []Table{TableCoils, TableDiscreteInputs,
+	TableInputRegisters, TableHoldingRegisters}
+
+// Scan looks for devices that respond to the SlaveIDs, using s, which should
+// have a short timeout since most SlaveIDs usually do not respond. For each
+// device found, Scan probes which FunctionCodes it supports, telling Illegal
+// Function exceptions apart from other responses, and searches the readable
+// Ranges of the Tables it can read using Illegal Data Address exceptions.
+// Only read functions are sent unless opts.ProbeWrites is set.
+//
+// SlaveIDs that do not respond with a valid frame, or whose gateway reports
+// that they did not respond, are skipped. Scan stops at the first error that
+// is not the result of a missing or invalid response, or when the ctx is
+// done, and returns the devices found so far along with the error.
+func Scan(ctx context.Context, s RawSender, opts ScanOptions) ([]ScanResult,
+	error) {
+	ids := opts.SlaveIDs
+	if len(ids) == 0 {
+		for id := 1; id <= 247; id++ {
+			ids = append(ids, byte(id))
+		}
+	}
+	if 0 == opts.Step {
+		opts.Step = DefaultScanStep
+	}
+	var results []ScanResult
+	for _, id := range ids {
+		res, found, err := scanSlave(ctx, s, id, opts)
+		if nil != err {
+			return results, err
+		}
+		if found {
+			results = append(results, res)
+		}
+	}
+	return results, nil
+}
+
+// scanSlave scans the SlaveID and returns whether a device responded.
+func scanSlave(ctx context.Context, s RawSender, slaveID byte,
+	opts ScanOptions) (ScanResult, bool, error) {
+	res := ScanResult{SlaveID: slaveID,
+		Functions: make(map[FunctionCode]bool)}
+	for i, p := range scanProbes {
+		if p.write && !opts.ProbeWrites {
+			continue
+		}
+		data, exception, ok, err := probe(ctx, s, slaveID, p.fCode,
+			p.data)
+		if nil != err {
+			return res, false, err
+		}
+		if 0 == i && (!ok ||
+			exceptionGatewayPathUnavailable == exception ||
+			exceptionGatewayTargetDeviceFailedToRespond == exception) {
+			return res, false, nil
+		}
+		if !ok {
+			continue
+		}
+		switch exception {
+		case exceptionIllegalFunction:
+			res.Functions[p.fCode] = false
+		case 0, exceptionDataAddress, exceptionDataValue:
+			// The device got past checking the FunctionCode.
+			res.Functions[p.fCode] = true
+		}
+		if FunctionReportServerID == p.fCode && 0 == exception &&
+			len(data) > 0 && int(data[0]) == len(data)-1 {
+			res.ServerID = data[1:]
+		}
+	}
+	if opts.SkipRanges {
+		return res, true, nil
+	}
+	for _, table := range scanTables {
+		if !res.Functions[tableReadFunctions[table]] {
+			continue
+		}
+		ranges, err := scanRanges(ctx, s, slaveID, table, opts.Step)
+		if nil != err {
+			return res, false, err
+		}
+		res.Ranges = append(res.Ranges, ranges...)
+	}
+	return res, true, nil
+}
+
+// scanRanges returns the readable ranges of the Table. The Table is probed
+// every step addresses and at its last address, and the first address with
+// the new result is searched between probes with different results.
+func scanRanges(ctx context.Context, s RawSender, slaveID byte, table Table,
+	step uint16) ([]ScanRange, error) {
+	fCode := tableReadFunctions[table]
+	readable := func(address int) (bool, error) {
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint16(data, uint16(address))
+		binary.BigEndian.PutUint16(data[2:], 1)
+		_, exception, ok, err := probe(ctx, s, slaveID, fCode, data)
+		return ok && 0 == exception, err
+	}
+
+	var ranges []ScanRange
+	prev, prevOK := 0, false
+	first := -1
+	for address := 0; ; address += int(step) {
+		if address > 0xFFFF {
+			address = 0xFFFF
+		}
+		ok, err := readable(address)
+		if nil != err {
+			return nil, err
+		}
+		edge := address
+		if address > 0 && ok != prevOK {
+			lo, hi := prev, address
+			for hi-lo > 1 {
+				mid := (lo + hi) / 2
+				midOK, err := readable(mid)
+				if nil != err {
+					return nil, err
+				}
+				if midOK == prevOK {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			edge = hi
+		}
+		switch {
+		case ok && first < 0:
+			first = edge
+		case !ok && first >= 0:
+			ranges = append(ranges, ScanRange{Table: table,
+				First: uint16(first), Last: uint16(edge - 1)})
+			first = -1
+		}
+		if 0xFFFF == address {
+			break
+		}
+		prev, prevOK = address, ok
+	}
+	if first >= 0 {
+		ranges = append(ranges, ScanRange{Table: table,
+			First: uint16(first), Last: 0xFFFF})
+	}
+	return ranges, nil
+}
+
+// probe sends the raw request and returns the response data following the
+// FunctionCode, or the code of the exception response, and true. Missing and
+// invalid responses return false and other errors are returned.
+func probe(ctx context.Context, s RawSender, slaveID byte,
+	fCode FunctionCode, data []byte) ([]byte, byte, bool, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, 0, false, err
+	}
+	pdu, err := s.SendRaw(slaveID, fCode, data)
+	if nil != err {
+		if _, ok := ExceptionCode(err); ok || IsTimeout(err) {
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, err
+	}
+	switch {
+	case len(pdu) == 2 && byte(fCode)|0x80 == pdu[0]:
+		return nil, pdu[1], true, nil
+	case len(pdu) > 0 && byte(fCode) == pdu[0]:
+		return pdu[1:], 0, true, nil
+	}
+	return nil, 0, false, nil
+}
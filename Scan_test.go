@@ -0,0 +1,182 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testScanSlave is a device simulated by a testScanSender.
+type testScanSlave struct {
+	unsupported map[FunctionCode]bool
+	// ranges are the readable ranges of the Tables.
+	ranges []ScanRange
+}
+
+// testScanSender simulates the slaves behind a gateway, which responds with
+// an exception for the gatewayID.
+type testScanSender struct {
+	slaves    map[byte]testScanSlave
+	gatewayID byte
+	requests  int
+	writes    int
+	// writeProbes counts the requests of write functions.
+	writeProbes int
+}
+
+func (s *testScanSender) SendRaw(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	s.requests++
+	if isWriteFunction(fCode) {
+		s.writeProbes++
+	}
+	exception := func(code byte) ([]byte, error) {
+		return []byte{byte(fCode) | 0x80, code}, nil
+	}
+	if slaveID == s.gatewayID {
+		return exception(exceptionGatewayTargetDeviceFailedToRespond)
+	}
+	slave, ok := s.slaves[slaveID]
+	if !ok {
+		return nil, context.DeadlineExceeded
+	}
+	if slave.unsupported[fCode] {
+		return exception(exceptionIllegalFunction)
+	}
+	switch fCode {
+	case FunctionReportServerID:
+		return []byte{byte(fCode), 2, 0x42, 0xFF}, nil
+	case FunctionWriteSingleCoil:
+		if v := binary.BigEndian.Uint16(data[2:]); 0 != v && 0xFF00 != v {
+			return exception(exceptionDataValue)
+		}
+	case FunctionWriteMultipleCoils, FunctionWriteMultipleRegisters:
+		if 0 == binary.BigEndian.Uint16(data[2:]) {
+			return exception(exceptionDataValue)
+		}
+	case FunctionMaskWriteRegister:
+		if 0xFFFF != binary.BigEndian.Uint16(data[2:]) {
+			s.writes++
+		}
+		return append([]byte{byte(fCode)}, data...), nil
+	}
+	table, ok := readTable(fCode)
+	if !ok {
+		s.writes++
+		return exception(exceptionIllegalFunction)
+	}
+	address := binary.BigEndian.Uint16(data)
+	for _, r := range slave.ranges {
+		if r.Table == table && r.First <= address && address <= r.Last {
+			return []byte{byte(fCode), 2, 0, 0}, nil
+		}
+	}
+	return exception(exceptionDataAddress)
+}
+
+func TestScan(t *testing.T) {
+	s := &testScanSender{
+		gatewayID: 4,
+		slaves: map[byte]testScanSlave{
+			2: {
+				unsupported: map[FunctionCode]bool{
+					FunctionReadCoils:          true,
+					FunctionReadDiscreteInputs: true,
+					FunctionWriteSingleCoil:    true,
+					FunctionWriteMultipleCoils: true,
+					FunctionReportServerID:     true,
+				},
+				ranges: []ScanRange{
+					{TableInputRegisters, 0, 0xFFFF},
+					{TableHoldingRegisters, 1, 1000},
+					{TableHoldingRegisters, 4000, 4999},
+					{TableHoldingRegisters, 65000, 0xFFFF},
+				},
+			},
+			5: {
+				ranges: []ScanRange{
+					{TableCoils, 10, 10},
+					{TableDiscreteInputs, 100, 199},
+					{TableHoldingRegisters, 3000, 3099},
+				},
+			},
+		},
+	}
+	all := map[FunctionCode]bool{
+		FunctionReadCoils:              true,
+		FunctionReadDiscreteInputs:     true,
+		FunctionReadHoldingRegisters:   true,
+		FunctionReadInputRegisters:     true,
+		FunctionReportServerID:         true,
+		FunctionWriteSingleCoil:        true,
+		FunctionWriteMultipleCoils:     true,
+		FunctionWriteMultipleRegisters: true,
+		FunctionMaskWriteRegister:      true,
+	}
+	functions2 := make(map[FunctionCode]bool)
+	for fCode := range all {
+		functions2[fCode] = !s.slaves[2].unsupported[fCode]
+	}
+	want := []ScanResult{
+		{SlaveID: 2, Functions: functions2, Ranges: s.slaves[2].ranges},
+		{SlaveID: 5, Functions: all, ServerID: []byte{0x42, 0xFF},
+			Ranges: []ScanRange{
+				// The coil is too short to be found.
+				{TableDiscreteInputs, 100, 199},
+				{TableHoldingRegisters, 3000, 3099},
+			}},
+	}
+
+	got, err := Scan(context.Background(), s, ScanOptions{Step: 128,
+		ProbeWrites: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %+v\ngot:  %+v", want, got)
+	}
+	if 0 != s.writes {
+		t.Errorf("Scan sent %v requests that write", s.writes)
+	}
+
+	// By default only read functions are sent.
+	s.writeProbes = 0
+	got, err = Scan(context.Background(), s, ScanOptions{Step: 128})
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, res := range want {
+		for fCode := range res.Functions {
+			if isWriteFunction(fCode) {
+				delete(res.Functions, fCode)
+			}
+		}
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %+v\ngot:  %+v", want, got)
+	}
+	if 0 != s.writeProbes {
+		t.Errorf("Scan sent %v write requests", s.writeProbes)
+	}
+
+	s.requests = 0
+	got, err = Scan(context.Background(), s, ScanOptions{
+		SlaveIDs: []byte{1, 5}, SkipRanges: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Ranges) > 0 ||
+		s.requests != 1+5 {
+		t.Errorf("Unexpected results %+v after %v requests", got,
+			s.requests)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Scan(ctx, s, ScanOptions{}); !errors.Is(err,
+		context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+}
@@ -0,0 +1,393 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// DefaultSniffTimeout is the SniffOptions.Timeout used if it is zero.
+const DefaultSniffTimeout = time.Second
+
+// minSilence is the shortest inter-frame silence of RTU, which the
+// specification fixes for baud rates above 19200.
+const minSilence = 1750 * time.Microsecond
+
+// SniffOptions control Sniff.
+type SniffOptions struct {
+	// Mode is ModeRTU or ModeASCII.
+	Mode
+	// Baud is the baud rate of the bus, which sets the default Silence.
+	Baud uint
+	// Silence is the silence on the line that ends an RTU frame. The
+	// default is 3.5 character times at the Baud, but at least 1.75ms.
+	// Serial adapters that deliver the received bytes in chunks may
+	// require a longer Silence.
+	Silence time.Duration
+	// Timeout is the time after which a request without a response is
+	// reported alone.
+	Timeout time.Duration
+}
+
+// SniffedFrame is a frame received by Sniff.
+type SniffedFrame struct {
+	Frame
+	// Time is the time the first bytes of the frame were received.
+	Time time.Time
+	// Raw is the frame as received.
+	Raw []byte
+	// Err is the error of Decode if the frame is malformed.
+	Err error
+}
+
+// Transaction is a request sniffed on a bus along with its response. The
+// Response is nil for broadcasts and requests that were not answered within
+// the Timeout, and the Request is nil for responses whose request was not
+// received. Frames with a bad checksum are never paired, and malformed frames
+// are reported as Requests unless they decode as a Response.
+type Transaction struct {
+	Request, Response *SniffedFrame
+}
+
+// Latency returns the time from the Request to the Response, or zero if
+// either is missing.
+func (t Transaction) Latency() time.Duration {
+	if nil == t.Request || nil == t.Response {
+		return 0
+	}
+	return t.Response.Time.Sub(t.Request.Time)
+}
+
+// sniffChunk is the result of a read of the bus.
+type sniffChunk struct {
+	data []byte
+	time time.Time
+	err  error
+}
+
+// sniffer segments the bytes read from a bus into frames and pairs them into
+// Transactions.
+type sniffer struct {
+	opts   SniffOptions
+	handle func(Transaction)
+
+	// buf holds the bytes of the current frame, which were first received
+	// at start and last received at last.
+	buf         []byte
+	start, last time.Time
+
+	// pending is the last request, which awaits its response.
+	pending *SniffedFrame
+}
+
+// Sniff reads the frames of a Modbus master and its slaves from r, which is
+// usually a serial port opened with OpenSerialTap, without sending anything.
+// RTU frames are separated by the silence on the line, and ASCII frames by
+// their colon and CR LF. Each frame is decoded and its checksum checked, and
+// the requests are paired with the responses of the same slave and function
+// that follow them. The Transactions are passed to handle as they complete.
+//
+// Sniff returns nil at the end of r, the read error of r, or the ctx error
+// when the ctx is done. Pending Transactions are passed to handle before
+// Sniff returns.
+func Sniff(ctx context.Context, r io.Reader, opts SniffOptions,
+	handle func(Transaction)) error {
+	if ModeRTU != opts.Mode && ModeASCII != opts.Mode {
+		return errors.New("Sniff requires ModeRTU or ModeASCII")
+	}
+	if 0 == opts.Silence {
+		opts.Silence = minSilence
+		if opts.Baud > 0 {
+			// 3.5 characters of 11 bits
+			charTime := time.Duration(11 * int64(time.Second) /
+				int64(opts.Baud))
+			if silence := charTime * 7 / 2; silence > minSilence {
+				opts.Silence = silence
+			}
+		}
+	}
+	if 0 == opts.Timeout {
+		opts.Timeout = DefaultSniffTimeout
+	}
+
+	chunks := make(chan sniffChunk)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			buf := make([]byte, MaxASCIISize)
+			n, err := r.Read(buf)
+			select {
+			case chunks <- sniffChunk{buf[:n], time.Now(), err}:
+			case <-done:
+				return
+			}
+			if nil != err {
+				return
+			}
+		}
+	}()
+
+	s := &sniffer{opts: opts, handle: handle}
+	defer s.flush()
+	timer := time.NewTimer(opts.Timeout)
+	defer timer.Stop()
+	for {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(s.wait(time.Now()))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case c := <-chunks:
+			if len(c.data) > 0 {
+				s.receive(c.data, c.time)
+			}
+			if nil != c.err {
+				if io.EOF == c.err {
+					return nil
+				}
+				return c.err
+			}
+		case now := <-timer.C:
+			s.tick(now)
+		}
+	}
+}
+
+// wait returns the time until the current RTU frame ends or the pending
+// request times out, or the Timeout if neither is due.
+func (s *sniffer) wait(now time.Time) time.Duration {
+	d := s.opts.Timeout
+	if ModeRTU == s.opts.Mode && len(s.buf) > 0 {
+		if end := s.last.Add(s.opts.Silence).Sub(now); end < d {
+			d = end
+		}
+	}
+	if nil != s.pending {
+		if end := s.pending.Time.Add(s.opts.Timeout).Sub(now); end < d {
+			d = end
+		}
+	}
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return d
+}
+
+// tick ends the current RTU frame after the Silence and reports the pending
+// request after the Timeout.
+func (s *sniffer) tick(now time.Time) {
+	if ModeRTU == s.opts.Mode && len(s.buf) > 0 &&
+		now.Sub(s.last) >= s.opts.Silence {
+		s.endRTU()
+	}
+	if nil != s.pending && now.Sub(s.pending.Time) >= s.opts.Timeout {
+		s.handle(Transaction{Request: s.pending})
+		s.pending = nil
+	}
+}
+
+// flush reports the frames received so far and the pending request.
+func (s *sniffer) flush() {
+	if ModeRTU == s.opts.Mode {
+		s.endRTU()
+	} else if len(bytes.TrimSpace(s.buf)) > 0 {
+		s.frame(s.buf, s.start)
+	}
+	s.buf = nil
+	if nil != s.pending {
+		s.handle(Transaction{Request: s.pending})
+		s.pending = nil
+	}
+}
+
+// receive adds the data received at t to the current frame, ending the frames
+// that it completes.
+func (s *sniffer) receive(data []byte, t time.Time) {
+	if ModeASCII == s.opts.Mode {
+		s.receiveASCII(data, t)
+		return
+	}
+	if len(s.buf) > 0 && t.Sub(s.last) >= s.opts.Silence {
+		s.endRTU()
+	}
+	if len(s.buf) == 0 {
+		s.start = t
+	}
+	s.buf = append(s.buf, data...)
+	s.last = t
+}
+
+// endRTU ends the current RTU frame. Since chunks of received bytes may hide
+// the silence between frames, frames of known length with a valid CRC are
+// split off the start of the bytes.
+func (s *sniffer) endRTU() {
+	buf := s.buf
+	for len(buf) > 0 {
+		n := rtuSplit(buf)
+		s.frame(buf[:n], s.start)
+		buf = buf[n:]
+	}
+	s.buf = nil
+}
+
+// rtuSplit returns the length of the first RTU frame of buf, which is the
+// length of a request or response with a valid CRC, or all of buf.
+func rtuSplit(buf []byte) int {
+	for _, dir := range []Direction{DirectionRequest, DirectionResponse} {
+		n := rtuFrameLength(buf, dir)
+		if n >= 4 && n < len(buf) &&
+			crc(buf[:n-2]) == binary.LittleEndian.Uint16(buf[n-2:]) {
+			return n
+		}
+	}
+	return len(buf)
+}
+
+// rtuFrameLength returns the length of the RTU frame at the start of buf
+// according to its FunctionCode and the direction, or 0 if it is unknown.
+func rtuFrameLength(buf []byte, dir Direction) int {
+	if len(buf) < 2 {
+		return 0
+	}
+	if buf[1]&0x80 != 0 {
+		return 5
+	}
+	// byteCount returns the length of a frame with a byte count at i.
+	byteCount := func(i int) int {
+		if len(buf) <= i {
+			return 0
+		}
+		return i + 1 + int(buf[i]) + 2
+	}
+	switch FunctionCode(buf[1]) {
+	case FunctionReadCoils, FunctionReadDiscreteInputs,
+		FunctionReadHoldingRegisters, FunctionReadInputRegisters:
+		if DirectionRequest == dir {
+			return 8
+		}
+		return byteCount(2)
+	case FunctionWriteSingleCoil, FunctionWriteSingleRegister:
+		return 8
+	case FunctionWriteMultipleCoils, FunctionWriteMultipleRegisters:
+		if DirectionRequest == dir {
+			return byteCount(6)
+		}
+		return 8
+	case FunctionMaskWriteRegister:
+		return 10
+	case FunctionReportServerID:
+		if DirectionRequest == dir {
+			return 4
+		}
+		return byteCount(2)
+	}
+	return 0
+}
+
+// receiveASCII adds the data received at t to the current frame. Frames
+// start with a colon and end with CR LF. Other bytes between frames are
+// reported as malformed frames, and so are frames that are cut short by the
+// colon of the next frame or exceed MaxASCIISize.
+func (s *sniffer) receiveASCII(data []byte, t time.Time) {
+	for _, b := range data {
+		if ':' == b && len(s.buf) > 0 {
+			if len(bytes.TrimSpace(s.buf)) > 0 {
+				s.frame(s.buf, s.start)
+			}
+			s.buf = nil
+		}
+		if len(s.buf) == 0 {
+			s.start = t
+		}
+		s.buf = append(s.buf, b)
+		if bytes.HasSuffix(s.buf, []byte("\r\n")) ||
+			len(s.buf) >= MaxASCIISize {
+			if len(bytes.TrimSpace(s.buf)) > 0 {
+				s.frame(s.buf, s.start)
+			}
+			s.buf = nil
+		}
+	}
+}
+
+// frame decodes the raw frame received at t and pairs it with the pending
+// request. A frame with a valid checksum that decodes as a response of the
+// slave and function of the pending request completes its Transaction.
+// Otherwise the pending request is reported alone and the frame becomes the
+// pending request, unless it is a broadcast, malformed, has a bad checksum,
+// or only decodes as a response. Such frames are reported alone, so that
+// noise on the bus cannot complete a Transaction or take the place of the
+// next response.
+func (s *sniffer) frame(raw []byte, t time.Time) {
+	raw = append([]byte{}, raw...)
+	if nil != s.pending {
+		f := s.decode(raw, t, DirectionResponse)
+		if nil == f.Err && f.ChecksumOK &&
+			f.SlaveID == s.pending.SlaveID &&
+			f.FunctionCode == s.pending.FunctionCode {
+			s.handle(Transaction{Request: s.pending, Response: f})
+			s.pending = nil
+			return
+		}
+		s.handle(Transaction{Request: s.pending})
+		s.pending = nil
+	}
+	f := s.decode(raw, t, DirectionRequest)
+	if nil != f.Err {
+		if resp := s.decode(raw, t, DirectionResponse); nil == resp.Err {
+			s.handle(Transaction{Response: resp})
+			return
+		}
+	}
+	if nil != f.Err || !f.ChecksumOK || 0 == f.SlaveID {
+		s.handle(Transaction{Request: f})
+		return
+	}
+	s.pending = f
+}
+
+// decode decodes the raw frame received at t in the direction.
+func (s *sniffer) decode(raw []byte, t time.Time,
+	dir Direction) *SniffedFrame {
+	f, err := Decode(s.opts.Mode, raw, dir)
+	return &SniffedFrame{Frame: f, Time: t, Raw: raw, Err: err}
+}
+
+// serialTap is a serial port that only returns from Read once bytes are
+// received.
+type serialTap struct {
+	*serial.Port
+}
+
+// OpenSerialTap opens the serial device, or COM port, at the baud rate for
+// Sniff. Reads of the returned port block until bytes are received, rather
+// than timing out.
+func OpenSerialTap(host string, baud uint) (io.ReadCloser, error) {
+	p, err := newSerialPort(ConnectionSettings{Mode: ModeRTU, Host: host,
+		Baud: baud, Timeout: serialReadTimeout})
+	if nil != err {
+		return nil, err
+	}
+	return serialTap{p}, nil
+}
+
+// Read reads the bytes received, retrying the reads that time out.
+func (t serialTap) Read(b []byte) (int, error) {
+	for {
+		n, err := t.Port.Read(b)
+		if n > 0 || nil != err && io.EOF != err {
+			return n, err
+		}
+	}
+}
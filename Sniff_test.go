@@ -0,0 +1,213 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// sniffBus writes the chunks to the returned reader, pausing for the
+// durations between them, and closes it after the last chunk.
+func sniffBus(chunks ...interface{}) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		for _, c := range chunks {
+			switch c := c.(type) {
+			case []byte:
+				w.Write(c)
+			case time.Duration:
+				time.Sleep(c)
+			}
+		}
+		w.Close()
+	}()
+	return r
+}
+
+// sniffAll sniffs r and returns the Transactions.
+func sniffAll(t *testing.T, r io.Reader, opts SniffOptions) []Transaction {
+	var transactions []Transaction
+	if err := Sniff(context.Background(), r, opts,
+		func(tr Transaction) {
+			transactions = append(transactions, tr)
+		}); nil != err {
+		t.Fatal(err)
+	}
+	return transactions
+}
+
+// checkTransaction checks that the Request and Response of tr are the raw
+// frames, or missing if nil.
+func checkTransaction(t *testing.T, tr Transaction, req, resp []byte) {
+	t.Helper()
+	for _, c := range []struct {
+		name string
+		f    *SniffedFrame
+		raw  []byte
+	}{{"Request", tr.Request, req}, {"Response", tr.Response, resp}} {
+		if nil == c.raw {
+			if nil != c.f {
+				t.Errorf("%v want: nil got: %x", c.name, c.f.Raw)
+			}
+			continue
+		}
+		if nil == c.f {
+			t.Errorf("%v want: %x got: nil", c.name, c.raw)
+			continue
+		}
+		if !bytes.Equal(c.f.Raw, c.raw) {
+			t.Errorf("%v want: %x got: %x", c.name, c.raw, c.f.Raw)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	readReq := rtuFrame(1, 0x03, 0x00, 0x00, 0x00, 0x02)
+	readResp := rtuFrame(1, 0x03, 4, 0x3F, 0xC0, 0x00, 0x00)
+	writeReq := rtuFrame(2, 0x06, 0x00, 0x01, 0x00, 0x07)
+	exception := rtuFrame(2, 0x86, 0x02)
+	broadcast := rtuFrame(0, 0x06, 0x00, 0x01, 0x00, 0x07)
+	opts := SniffOptions{Mode: ModeRTU, Silence: 10 * time.Millisecond,
+		Timeout: 100 * time.Millisecond}
+	gap := 30 * time.Millisecond
+
+	t.Run("RTU", func(t *testing.T) {
+		transactions := sniffAll(t, sniffBus(
+			readReq[:3], time.Millisecond, readReq[3:], gap,
+			readResp, gap,
+			writeReq, gap,
+			exception, gap,
+			broadcast, gap,
+			readReq), opts)
+		if len(transactions) != 4 {
+			t.Fatalf("want 4 transactions got: %v", len(transactions))
+		}
+		checkTransaction(t, transactions[0], readReq, readResp)
+		checkTransaction(t, transactions[1], writeReq, exception)
+		checkTransaction(t, transactions[2], broadcast, nil)
+		checkTransaction(t, transactions[3], readReq, nil)
+
+		tr := transactions[0]
+		if tr.Latency() < gap {
+			t.Errorf("Latency want: >= %v got: %v", gap, tr.Latency())
+		}
+		if !tr.Response.ChecksumOK ||
+			tr.Response.Registers[0] != 0x3FC0 {
+			t.Errorf("Response decoded as: %v", tr.Response)
+		}
+		if e := transactions[1].Response; e.Exception != 0x02 ||
+			e.FunctionCode != FunctionWriteSingleRegister {
+			t.Errorf("Exception decoded as: %v", e)
+		}
+	})
+
+	t.Run("Split", func(t *testing.T) {
+		// The silence between frames is lost in a single chunk.
+		chunk := append(append([]byte{}, readReq...), readResp...)
+		transactions := sniffAll(t, sniffBus(chunk), opts)
+		if len(transactions) != 1 {
+			t.Fatalf("want 1 transaction got: %v", len(transactions))
+		}
+		checkTransaction(t, transactions[0], readReq, readResp)
+	})
+
+	t.Run("Unpaired", func(t *testing.T) {
+		badCRC := append([]byte{}, readResp...)
+		badCRC[len(badCRC)-1] ^= 0xFF
+		transactions := sniffAll(t, sniffBus(
+			readResp, gap,
+			readReq, 2*opts.Timeout,
+			readResp, gap,
+			readReq, gap,
+			badCRC, gap,
+			[]byte{0x01}), opts)
+		if len(transactions) != 6 {
+			t.Fatalf("want 6 transactions got: %v", len(transactions))
+		}
+		checkTransaction(t, transactions[0], nil, readResp)
+		checkTransaction(t, transactions[1], readReq, nil)
+		checkTransaction(t, transactions[2], nil, readResp)
+		checkTransaction(t, transactions[3], readReq, nil)
+		checkTransaction(t, transactions[4], nil, badCRC)
+		checkTransaction(t, transactions[5], []byte{0x01}, nil)
+		if transactions[4].Response.ChecksumOK {
+			t.Error("Bad CRC is OK")
+		}
+		if nil == transactions[5].Request.Err {
+			t.Error("Malformed frame Err is nil")
+		}
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		// A corrupted response of the pending request is not paired,
+		// and a corrupted request does not take the next response.
+		badResp := append([]byte{}, readResp...)
+		badResp[3] ^= 0x01
+		badReq := append([]byte{}, readReq...)
+		badReq[5] ^= 0x01
+		transactions := sniffAll(t, sniffBus(
+			readReq, gap,
+			badResp, gap,
+			badReq, gap,
+			readResp), opts)
+		if len(transactions) != 4 {
+			t.Fatalf("want 4 transactions got: %v", len(transactions))
+		}
+		checkTransaction(t, transactions[0], readReq, nil)
+		checkTransaction(t, transactions[1], nil, badResp)
+		checkTransaction(t, transactions[2], badReq, nil)
+		checkTransaction(t, transactions[3], nil, readResp)
+	})
+
+	t.Run("ASCII", func(t *testing.T) {
+		req := asciiFrame(1, 0x03, 0x00, 0x00, 0x00, 0x02)
+		resp := asciiFrame(1, 0x03, 4, 0x3F, 0xC0, 0x00, 0x00)
+		truncated := []byte(":0103")
+		var chunk []byte
+		for _, b := range [][]byte{[]byte("xx"), req, resp, truncated,
+			req[:5]} {
+			chunk = append(chunk, b...)
+		}
+		transactions := sniffAll(t, sniffBus(chunk, req[5:], resp),
+			SniffOptions{Mode: ModeASCII})
+		if len(transactions) != 4 {
+			t.Fatalf("want 4 transactions got: %v", len(transactions))
+		}
+		checkTransaction(t, transactions[0], []byte("xx"), nil)
+		checkTransaction(t, transactions[1], req, resp)
+		checkTransaction(t, transactions[2], truncated, nil)
+		checkTransaction(t, transactions[3], req, resp)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		r, w := io.Pipe()
+		defer w.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		var transactions []Transaction
+		done := make(chan error)
+		go func() {
+			done <- Sniff(ctx, r, opts, func(tr Transaction) {
+				transactions = append(transactions, tr)
+			})
+		}()
+		w.Write(readReq)
+		time.Sleep(gap)
+		cancel()
+		if err := <-done; context.Canceled != err {
+			t.Errorf("err want: %v got: %v", context.Canceled, err)
+		}
+		if len(transactions) != 1 {
+			t.Fatalf("want 1 transaction got: %v", len(transactions))
+		}
+		checkTransaction(t, transactions[0], readReq, nil)
+	})
+
+	t.Run("Mode", func(t *testing.T) {
+		if err := Sniff(context.Background(), sniffBus(),
+			SniffOptions{Mode: ModeTCP}, nil); nil == err {
+			t.Error("ModeTCP err is nil")
+		}
+	})
+}
@@ -3,7 +3,6 @@ package modbus
 import (
 	"encoding/binary"
 	"errors"
-	"log"
 	"net"
 	"time"
 )
@@ -14,7 +13,6 @@ type TCPPackager struct {
 	net.Conn
 
 	transactionID uint16
-	timeout       time.Duration
 }
 
 // NewTCPPackager returns a new, ready to use TCPPackager with the given
@@ -28,10 +26,10 @@ func NewTCPPackager(c ConnectionSettings) (*TCPPackager, error) {
 	}
 	conn.SetKeepAlive(true)
 	return &TCPPackager{
-		Conn:    conn,
-		timeout: c.Timeout,
+		Conn: conn,
 		packagerSettings: packagerSettings{
-			Debug: c.Debug,
+			Debug:   c.Debug,
+			timeout: c.Timeout,
 		},
 	}, nil
 }
@@ -41,6 +39,15 @@ func (pkgr *TCPPackager) generateADU(q Query) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return pkgr.generateRawADU(q.SlaveID, q.FunctionCode, data)
+}
+
+// generateRawADU frames the given PDU data with an MBAP header.
+func (pkgr *TCPPackager) generateRawADU(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	if len(data) > MaxPDUSize-1 {
+		return nil, errPDUTooLarge
+	}
 
 	packetLen := len(data) + 8
 	packet := make([]byte, packetLen)
@@ -51,8 +58,8 @@ func (pkgr *TCPPackager) generateADU(q Query) ([]byte, error) {
 	packet[4] = byte((len(data) + 2) >> 8)   // Length of remaining packet (High Byte)
 	packet[5] = byte((len(data) + 2) & 0xff) // (Low Byte)
 
-	packet[6] = q.SlaveID
-	packet[7] = byte(q.FunctionCode)
+	packet[6] = slaveID
+	packet[7] = byte(fCode)
 	copy(packet[8:], data)
 
 	return packet, nil
@@ -65,27 +72,66 @@ func (pkgr *TCPPackager) Send(q Query) ([]byte, error) {
 		return nil, err
 	}
 
+	response, err := pkgr.transmit(adu)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the validity of the response
+	if valid, err := q.isValidResponse(response); !valid {
+		return nil, err
+	}
+
+	// Return only the data payload
+	return q.responseData(response), nil
+}
+
+// SendRaw sends the data as the PDU for the fCode and returns the raw
+// response PDU after only checking the framing and transaction ID.
+func (pkgr *TCPPackager) SendRaw(slaveID byte, fCode FunctionCode,
+	data []byte) ([]byte, error) {
+	adu, err := pkgr.generateRawADU(slaveID, fCode, data)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := pkgr.transmit(adu)
+	if err != nil {
+		return nil, err
+	}
+
+	// Strip the Unit ID
+	return response[1:], nil
+}
+
+// transmit writes the adu and reads back the response, returning it without
+// the MBAP header, i.e. starting with the Unit ID.
+func (pkgr *TCPPackager) transmit(adu []byte) ([]byte, error) {
 	defer func() { pkgr.transactionID++ }()
 	if pkgr.Debug {
-		log.Printf("Tx: %x\n", adu)
+		logFrame("Tx", ModeTCP, adu, DirectionRequest)
 	}
 
 	pkgr.SetDeadline(time.Now().Add(pkgr.timeout))
 
-	_, err = pkgr.Write(adu)
+	_, err := pkgr.Write(adu)
 	if err != nil {
 		return nil, err
 	}
 
 	pkgr.SetDeadline(time.Now().Add(pkgr.timeout))
 	response := make([]byte, MaxTCPSize)
-	n, err := pkgr.Read(response)
+	n, err := readFrame(pkgr, response, tcpFrameComplete, time.Time{})
 	if err != nil {
 		return nil, err
 	}
 
 	if pkgr.Debug {
-		log.Printf("Rx Full: %x\n", response)
+		logFrame("Rx", ModeTCP, response[:n], DirectionResponse)
+	}
+
+	if n < 8 {
+		return nil, exceptions[exceptionBadFraming]
 	}
 
 	// Check for matching transactionID
@@ -95,18 +141,12 @@ func (pkgr *TCPPackager) Send(q Query) ([]byte, error) {
 
 	response = response[6:n]
 
-	if pkgr.Debug {
-		log.Printf("Rx: %x\n", response)
-	}
-
-	// Check the validity of the response
-	if valid, err := q.isValidResponse(response); !valid {
-		return nil, err
-	}
+	return response, nil
+}
 
-	if isReadFunction(q.FunctionCode) {
-		return response[3:], nil
-	}
-	// return only the number of bytes read
-	return response[2:], nil
+// tcpFrameComplete reports whether a received TCP frame holds the number of
+// bytes given by the length field of its MBAP header.
+func tcpFrameComplete(frame []byte) bool {
+	return len(frame) >= 6 &&
+		len(frame) >= 6+int(binary.BigEndian.Uint16(frame[4:6]))
 }
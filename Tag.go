@@ -0,0 +1,571 @@
+package modbus
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Table is one of the four Modbus data tables.
+type Table byte
+
+// The Modbus data tables.
+const (
+	TableCoils Table = iota + 1
+	TableDiscreteInputs
+	TableInputRegisters
+	TableHoldingRegisters
+)
+
+// TableNames maps Table to the short name used in register map files.
+var TableNames = map[Table]string{
+	TableCoils:            "coil",
+	TableDiscreteInputs:   "di",
+	TableInputRegisters:   "ir",
+	TableHoldingRegisters: "hr",
+}
+
+// TablesByName maps TableNames to their Table, i.e. the inverse of
+// TableNames.
+var TablesByName = map[string]Table{}
+
+func init() {
+	for t, s := range TableNames {
+		TablesByName[s] = t
+	}
+}
+
+// String returns the name of the Table.
+func (t Table) String() string {
+	if s, ok := TableNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Table(%d)", byte(t))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t Table) MarshalText() ([]byte, error) {
+	if _, ok := TableNames[t]; !ok {
+		return nil, fmt.Errorf("Invalid Table: %v", byte(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. The name is not case
+// sensitive.
+func (t *Table) UnmarshalText(text []byte) error {
+	table, ok := TablesByName[strings.ToLower(string(text))]
+	if !ok {
+		return fmt.Errorf("Invalid Table: %q", text)
+	}
+	*t = table
+	return nil
+}
+
+// IsBits returns true for the coil and discrete input tables.
+func (t Table) IsBits() bool {
+	return t == TableCoils || t == TableDiscreteInputs
+}
+
+// Writable returns true for the coil and holding register tables.
+func (t Table) Writable() bool {
+	return t == TableCoils || t == TableHoldingRegisters
+}
+
+// MaxQuantity returns the maximum Quantity of a single read Query of the
+// Table.
+func (t Table) MaxQuantity() uint16 {
+	if t.IsBits() {
+		return 2000
+	}
+	return 125
+}
+
+// tableReadFunctions maps each Table to the FunctionCode that reads it.
+var tableReadFunctions = map[Table]FunctionCode{
+	TableCoils:            FunctionReadCoils,
+	TableDiscreteInputs:   FunctionReadDiscreteInputs,
+	TableInputRegisters:   FunctionReadInputRegisters,
+	TableHoldingRegisters: FunctionReadHoldingRegisters,
+}
+
+// readTable returns the Table read by the fCode.
+func readTable(fCode FunctionCode) (Table, bool) {
+	for t, f := range tableReadFunctions {
+		if f == fCode {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// ReadQuery returns the read Query of the Table.
+func (t Table) ReadQuery(slaveID byte, address, quantity uint16) (Query,
+	error) {
+	fCode, ok := tableReadFunctions[t]
+	if !ok {
+		return Query{}, fmt.Errorf("Invalid Table: %v", byte(t))
+	}
+	return ReadQuery(slaveID, fCode, address, quantity)
+}
+
+// DataType is the type of the value stored in a Tag.
+type DataType byte
+
+// The supported DataTypes. DataTypeBool is used for coils and discrete
+// inputs, all others for registers.
+const (
+	DataTypeBool DataType = iota + 1
+	DataTypeUint16
+	DataTypeInt16
+	DataTypeUint32
+	DataTypeInt32
+	DataTypeUint64
+	DataTypeInt64
+	DataTypeFloat32
+	DataTypeFloat64
+	DataTypeString
+)
+
+// DataTypeNames maps DataType to a string description.
+var DataTypeNames = map[DataType]string{
+	DataTypeBool:    "bool",
+	DataTypeUint16:  "uint16",
+	DataTypeInt16:   "int16",
+	DataTypeUint32:  "uint32",
+	DataTypeInt32:   "int32",
+	DataTypeUint64:  "uint64",
+	DataTypeInt64:   "int64",
+	DataTypeFloat32: "float32",
+	DataTypeFloat64: "float64",
+	DataTypeString:  "string",
+}
+
+// DataTypesByName maps DataTypeNames to their DataType, i.e. the inverse of
+// DataTypeNames.
+var DataTypesByName = map[string]DataType{}
+
+func init() {
+	for d, s := range DataTypeNames {
+		DataTypesByName[s] = d
+	}
+}
+
+// String returns the name of the DataType.
+func (d DataType) String() string {
+	if s, ok := DataTypeNames[d]; ok {
+		return s
+	}
+	return fmt.Sprintf("DataType(%d)", byte(d))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d DataType) MarshalText() ([]byte, error) {
+	if _, ok := DataTypeNames[d]; !ok {
+		return nil, fmt.Errorf("Invalid DataType: %v", byte(d))
+	}
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. The name is not case
+// sensitive.
+func (d *DataType) UnmarshalText(text []byte) error {
+	dataType, ok := DataTypesByName[strings.ToLower(string(text))]
+	if !ok {
+		return fmt.Errorf("Invalid DataType: %q", text)
+	}
+	*d = dataType
+	return nil
+}
+
+// Registers returns the number of registers occupied by a value of the
+// DataType, or 0 for DataTypeBool and DataTypeString.
+func (d DataType) Registers() uint16 {
+	switch d {
+	case DataTypeUint16, DataTypeInt16:
+		return 1
+	case DataTypeUint32, DataTypeInt32, DataTypeFloat32:
+		return 2
+	case DataTypeUint64, DataTypeInt64, DataTypeFloat64:
+		return 4
+	}
+	return 0
+}
+
+// Access is the access mode of a Tag.
+type Access byte
+
+// The Access modes.
+const (
+	AccessRead Access = 1 << iota
+	AccessWrite
+	AccessReadWrite = AccessRead | AccessWrite
+)
+
+// AccessNames maps Access to a string description.
+var AccessNames = map[Access]string{
+	AccessRead:      "r",
+	AccessWrite:     "w",
+	AccessReadWrite: "rw",
+}
+
+// AccessByName maps AccessNames to their Access, i.e. the inverse of
+// AccessNames.
+var AccessByName = map[string]Access{}
+
+func init() {
+	for a, s := range AccessNames {
+		AccessByName[s] = a
+	}
+}
+
+// String returns the name of the Access.
+func (a Access) String() string {
+	if s, ok := AccessNames[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("Access(%d)", byte(a))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Access) MarshalText() ([]byte, error) {
+	if _, ok := AccessNames[a]; !ok {
+		return nil, fmt.Errorf("Invalid Access: %v", byte(a))
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. The name is not case
+// sensitive.
+func (a *Access) UnmarshalText(text []byte) error {
+	access, ok := AccessByName[strings.ToLower(string(text))]
+	if !ok {
+		return fmt.Errorf("Invalid Access: %q", text)
+	}
+	*a = access
+	return nil
+}
+
+// Tag is a named value stored in a device's registers, coils or discrete
+// inputs.
+type Tag struct {
+	Name    string `json:"name" yaml:"name"`
+	SlaveID byte   `json:"unit" yaml:"unit"`
+	Table   Table  `json:"table" yaml:"table"`
+	Address uint16 `json:"address" yaml:"address"`
+	// Type defaults to DataTypeBool for coils and discrete inputs and to
+	// DataTypeUint16 for registers.
+	Type      DataType  `json:"type,omitempty" yaml:"type,omitempty"`
+	ByteOrder ByteOrder `json:"order,omitempty" yaml:"order,omitempty"`
+	// Length is the number of registers of a DataTypeString Tag.
+	Length uint16 `json:"length,omitempty" yaml:"length,omitempty"`
+	// A non-zero Scale and the Offset convert the raw value to the
+	// engineering value Scale*raw + Offset.
+	Scale  float64 `json:"scale,omitempty" yaml:"scale,omitempty"`
+	Offset float64 `json:"offset,omitempty" yaml:"offset,omitempty"`
+	Units  string  `json:"units,omitempty" yaml:"units,omitempty"`
+	// Access defaults to AccessReadWrite for coils and holding registers
+	// and to AccessRead for discrete inputs and input registers.
+	Access Access `json:"access,omitempty" yaml:"access,omitempty"`
+}
+
+// Quantity returns the number of coils, discrete inputs or registers
+// occupied by the Tag.
+func (t Tag) Quantity() uint16 {
+	switch t.Type {
+	case DataTypeBool:
+		return 1
+	case DataTypeString:
+		return t.Length
+	}
+	return t.Type.Registers()
+}
+
+// Normalize fills in the default Type and Access and returns an error if
+// the Tag is not valid. NewTagMap and Poller.Add normalize their Tags.
+func (t *Tag) Normalize() error {
+	if len(t.Name) == 0 {
+		return fmt.Errorf("Tag at %v %v has no name", t.Table, t.Address)
+	}
+	if _, ok := TableNames[t.Table]; !ok {
+		return fmt.Errorf("Tag %q: Invalid Table: %v", t.Name, byte(t.Table))
+	}
+	if 0 == t.Type {
+		t.Type = DataTypeUint16
+		if t.Table.IsBits() {
+			t.Type = DataTypeBool
+		}
+	}
+	if _, ok := DataTypeNames[t.Type]; !ok {
+		return fmt.Errorf("Tag %q: Invalid DataType: %v", t.Name,
+			byte(t.Type))
+	}
+	if t.Table.IsBits() != (DataTypeBool == t.Type) {
+		return fmt.Errorf("Tag %q: DataType %v cannot be stored in %v",
+			t.Name, t.Type, t.Table)
+	}
+	if _, ok := ByteOrderNames[t.ByteOrder]; !ok {
+		return fmt.Errorf("Tag %q: Invalid ByteOrder: %v", t.Name,
+			byte(t.ByteOrder))
+	}
+	if DataTypeString == t.Type {
+		if 0 == t.Length || t.Length > t.Table.MaxQuantity() {
+			return fmt.Errorf("Tag %q: Invalid string Length: %v",
+				t.Name, t.Length)
+		}
+	} else if 0 != t.Length {
+		return fmt.Errorf("Tag %q: Length is only valid for strings",
+			t.Name)
+	}
+	if 0 != t.Scale && (DataTypeBool == t.Type || DataTypeString == t.Type) {
+		return fmt.Errorf("Tag %q: DataType %v cannot be scaled", t.Name,
+			t.Type)
+	}
+	if 0 == t.Access {
+		t.Access = AccessRead
+		if t.Table.Writable() {
+			t.Access = AccessReadWrite
+		}
+	}
+	if _, ok := AccessNames[t.Access]; !ok {
+		return fmt.Errorf("Tag %q: Invalid Access: %v", t.Name,
+			byte(t.Access))
+	}
+	if t.Access&AccessWrite != 0 && !t.Table.Writable() {
+		return fmt.Errorf("Tag %q: %v is not writable", t.Name, t.Table)
+	}
+	if int(t.Address)+int(t.Quantity()) > 0x10000 {
+		return fmt.Errorf("Tag %q: Address %v + Quantity %v exceeds %v",
+			t.Name, t.Address, t.Quantity(), 0x10000)
+	}
+	return nil
+}
+
+// ReadQuery returns the Query for reading the Tag.
+func (t Tag) ReadQuery() (Query, error) {
+	return t.Table.ReadQuery(t.SlaveID, t.Address, t.Quantity())
+}
+
+// stringFormat returns the StringFormat of a DataTypeString Tag.
+func (t Tag) stringFormat() StringFormat {
+	return StringFormat{SwapBytes: t.ByteOrder.swapBytes(), TrimNull: true}
+}
+
+// Decode decodes the response data of the Tag's ReadQuery into its value. The
+// value is a bool, a string, a float64 if the Tag is scaled, or else the Go
+// type corresponding to the Tag's DataType.
+func (t Tag) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch t.Type {
+	case DataTypeBool:
+		var b []bool
+		if b, err = DecodeCoils(data, 1); nil == err {
+			v = b[0]
+		}
+	case DataTypeString:
+		if len(data) != 2*int(t.Length) {
+			return nil, fmt.Errorf("Tag %q: Expected %v bytes but got %v",
+				t.Name, 2*t.Length, len(data))
+		}
+		return DecodeString(data, t.stringFormat()), nil
+	default:
+		if len(data) != 2*int(t.Quantity()) {
+			return nil, fmt.Errorf("Tag %q: Expected %v bytes but got %v",
+				t.Name, 2*t.Quantity(), len(data))
+		}
+		v, err = t.decodeNumber(data)
+	}
+	if nil != err {
+		return nil, fmt.Errorf("Tag %q: %v", t.Name, err)
+	}
+	if 0 != t.Scale {
+		return t.Scale*reflect.ValueOf(v).Convert(float64Type).Float() +
+			t.Offset, nil
+	}
+	return v, nil
+}
+
+var float64Type = reflect.TypeOf(float64(0))
+
+// decodeNumber decodes a single value of a numeric DataType.
+func (t Tag) decodeNumber(data []byte) (interface{}, error) {
+	o := t.ByteOrder
+	switch t.Type {
+	case DataTypeUint16:
+		v, err := DecodeUint16(data, o)
+		return first(v, err)
+	case DataTypeInt16:
+		v, err := DecodeInt16(data, o)
+		return first(v, err)
+	case DataTypeUint32:
+		v, err := DecodeUint32(data, o)
+		return first(v, err)
+	case DataTypeInt32:
+		v, err := DecodeInt32(data, o)
+		return first(v, err)
+	case DataTypeUint64:
+		v, err := DecodeUint64(data, o)
+		return first(v, err)
+	case DataTypeInt64:
+		v, err := DecodeInt64(data, o)
+		return first(v, err)
+	case DataTypeFloat32:
+		v, err := DecodeFloat32(data, o)
+		return first(v, err)
+	case DataTypeFloat64:
+		v, err := DecodeFloat64(data, o)
+		return first(v, err)
+	}
+	return nil, fmt.Errorf("Invalid DataType: %v", byte(t.Type))
+}
+
+// first returns the first element of the slice returned by a Decode
+// function.
+func first(values interface{}, err error) (interface{}, error) {
+	if nil != err {
+		return nil, err
+	}
+	return reflect.ValueOf(values).Index(0).Interface(), nil
+}
+
+// WriteQuery returns the Query for writing the value to the Tag. The value
+// must be a bool for coils, a string for DataTypeString and otherwise any Go
+// integer or floating point type. Scaled Tags convert the engineering value
+// back to the raw value, rounding to the nearest integer for integer
+// DataTypes, while unscaled integer DataTypes reject fractional values.
+func (t Tag) WriteQuery(value interface{}) (Query, error) {
+	if t.Access&AccessWrite == 0 {
+		return Query{}, fmt.Errorf("Tag %q is not writable", t.Name)
+	}
+	if DataTypeBool == t.Type {
+		b, ok := value.(bool)
+		if !ok {
+			return Query{}, fmt.Errorf("Tag %q: Expected bool but got %T",
+				t.Name, value)
+		}
+		return WriteSingleCoil(t.SlaveID, t.Address, b)
+	}
+	regs, err := t.Encode(value)
+	if nil != err {
+		return Query{}, err
+	}
+	return t.writeRegisters(regs)
+}
+
+// Encode returns the registers for storing the value in a register Tag, the
+// inverse of Decode. See WriteQuery for the accepted values.
+func (t Tag) Encode(value interface{}) ([]uint16, error) {
+	if DataTypeBool == t.Type {
+		return nil, fmt.Errorf("Tag %q: %v is not stored in registers",
+			t.Name, t.Type)
+	}
+	if DataTypeString == t.Type {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Tag %q: Expected string but got %T",
+				t.Name, value)
+		}
+		regs, err := EncodeString(s, int(t.Length), t.stringFormat())
+		if nil != err {
+			return nil, fmt.Errorf("Tag %q: %v", t.Name, err)
+		}
+		return regs, nil
+	}
+	regs, err := t.encodeNumber(value)
+	if nil != err {
+		return nil, fmt.Errorf("Tag %q: %v", t.Name, err)
+	}
+	return regs, nil
+}
+
+// writeRegisters returns a WriteSingleRegister Query for single register
+// Tags, since some devices do not support WriteMultipleRegisters, and a
+// WriteMultipleRegisters Query otherwise.
+func (t Tag) writeRegisters(regs []uint16) (Query, error) {
+	if len(regs) == 1 {
+		return WriteSingleRegister(t.SlaveID, t.Address, regs[0])
+	}
+	return WriteMultipleRegisters(t.SlaveID, t.Address, uint16(len(regs)),
+		regs)
+}
+
+// encodeNumber returns the registers for storing the value in a Tag of a
+// numeric DataType.
+func (t Tag) encodeNumber(value interface{}) ([]uint16, error) {
+	// The value is converted to whichever of int64, uint64 and float64 it
+	// fits in.
+	var i int64
+	var u uint64
+	var f float64
+	var iOK, uOK bool
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		i, iOK = v.Int(), true
+		u, uOK = uint64(i), i >= 0
+		f = float64(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		u, uOK = v.Uint(), true
+		i, iOK = int64(u), u <= math.MaxInt64
+		f = float64(u)
+	case reflect.Float32, reflect.Float64:
+		f = v.Float()
+	default:
+		return nil, fmt.Errorf("Expected a number but got %T", value)
+	}
+	if 0 != t.Scale {
+		f = (f - t.Offset) / t.Scale
+	} else if !iOK && !uOK && f != math.Trunc(f) &&
+		DataTypeFloat32 != t.Type && DataTypeFloat64 != t.Type {
+		return nil, fmt.Errorf("Value %v is not an integer for %v",
+			value, t.Type)
+	}
+	if 0 != t.Scale || (!iOK && !uOK) {
+		r := math.Round(f)
+		iOK = r >= math.MinInt64 && r < math.MaxInt64
+		uOK = r >= 0 && r < math.MaxUint64
+		i, u = int64(r), uint64(r)
+	}
+
+	o := t.ByteOrder
+	if _, ok := ByteOrderNames[o]; !ok {
+		return nil, fmt.Errorf("Invalid ByteOrder: %v", byte(o))
+	}
+	inRange := iOK
+	var regs []uint16
+	switch t.Type {
+	case DataTypeUint16:
+		inRange = uOK && u <= math.MaxUint16
+		regs = EncodeUint16(o, uint16(u))
+	case DataTypeInt16:
+		inRange = iOK && i >= math.MinInt16 && i <= math.MaxInt16
+		regs = EncodeInt16(o, int16(i))
+	case DataTypeUint32:
+		inRange = uOK && u <= math.MaxUint32
+		regs = EncodeUint32(o, uint32(u))
+	case DataTypeInt32:
+		inRange = iOK && i >= math.MinInt32 && i <= math.MaxInt32
+		regs = EncodeInt32(o, int32(i))
+	case DataTypeUint64:
+		inRange = uOK
+		regs = EncodeUint64(o, u)
+	case DataTypeInt64:
+		regs = EncodeInt64(o, i)
+	case DataTypeFloat32:
+		inRange = !math.IsInf(f, 0) && math.Abs(f) <= math.MaxFloat32
+		regs = EncodeFloat32(o, float32(f))
+	case DataTypeFloat64:
+		inRange = true
+		regs = EncodeFloat64(o, f)
+	default:
+		return nil, fmt.Errorf("Invalid DataType: %v", byte(t.Type))
+	}
+	if !inRange {
+		return nil, fmt.Errorf("Value %v out of range for %v", value, t.Type)
+	}
+	return regs, nil
+}
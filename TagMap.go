@@ -0,0 +1,337 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TagMap is a set of uniquely named Tags that do not overlap.
+type TagMap struct {
+	tags   []Tag
+	byName map[string]int
+}
+
+// NewTagMap returns a TagMap of the tags, after filling in their default
+// Type and Access. An error is returned if any Tag is invalid, if any two
+// Tags have the same name, or if any two Tags of the same SlaveID and Table
+// overlap.
+func NewTagMap(tags ...Tag) (*TagMap, error) {
+	m := &TagMap{
+		tags:   make([]Tag, len(tags)),
+		byName: make(map[string]int, len(tags)),
+	}
+	copy(m.tags, tags)
+	for i := range m.tags {
+		t := &m.tags[i]
+		if err := t.Normalize(); nil != err {
+			return nil, err
+		}
+		if _, ok := m.byName[t.Name]; ok {
+			return nil, fmt.Errorf("Duplicate Tag name: %q", t.Name)
+		}
+		m.byName[t.Name] = i
+	}
+	if err := m.checkOverlap(); nil != err {
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkOverlap returns an error if any two Tags of the same SlaveID and
+// Table overlap.
+func (m *TagMap) checkOverlap() error {
+	sorted := make([]Tag, len(m.tags))
+	copy(sorted, m.tags)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.SlaveID != b.SlaveID {
+			return a.SlaveID < b.SlaveID
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Address < b.Address
+	})
+	for i := 1; i < len(sorted); i++ {
+		prev, t := sorted[i-1], sorted[i]
+		if prev.SlaveID != t.SlaveID || prev.Table != t.Table {
+			continue
+		}
+		if int(prev.Address)+int(prev.Quantity()) > int(t.Address) {
+			return fmt.Errorf("Tag %q overlaps Tag %q", t.Name,
+				prev.Name)
+		}
+	}
+	return nil
+}
+
+// Tags returns the Tags in the order they were defined.
+func (m *TagMap) Tags() []Tag {
+	tags := make([]Tag, len(m.tags))
+	copy(tags, m.tags)
+	return tags
+}
+
+// Tag returns the Tag with the given name.
+func (m *TagMap) Tag(name string) (Tag, bool) {
+	i, ok := m.byName[name]
+	if !ok {
+		return Tag{}, false
+	}
+	return m.tags[i], true
+}
+
+// lookup returns the Tag with the given name or an error.
+func (m *TagMap) lookup(name string) (Tag, error) {
+	t, ok := m.Tag(name)
+	if !ok {
+		return Tag{}, fmt.Errorf("Unknown Tag: %q", name)
+	}
+	return t, nil
+}
+
+// Read reads the value of the named Tag using s, which may be a ClientHandle
+// or a Device. See Tag.Decode for the type of the value.
+func (m *TagMap) Read(ctx context.Context, s QuerySender,
+	name string) (interface{}, error) {
+	t, err := m.lookup(name)
+	if nil != err {
+		return nil, err
+	}
+	if t.Access&AccessRead == 0 {
+		return nil, fmt.Errorf("Tag %q is not readable", t.Name)
+	}
+	q, err := t.ReadQuery()
+	if nil != err {
+		return nil, err
+	}
+	data, err := s.SendContext(ctx, q)
+	if nil != err {
+		return nil, err
+	}
+	return t.Decode(data)
+}
+
+// Write writes the value to the named Tag using s, which may be a
+// ClientHandle or a Device. See Tag.WriteQuery for the accepted values.
+func (m *TagMap) Write(ctx context.Context, s QuerySender, name string,
+	value interface{}) error {
+	t, err := m.lookup(name)
+	if nil != err {
+		return err
+	}
+	q, err := t.WriteQuery(value)
+	if nil != err {
+		return err
+	}
+	_, err = s.SendContext(ctx, q)
+	return err
+}
+
+// ReadTags reads the named Tags, or all readable Tags if no names are given,
+// with as few Queries as the planner allows and returns their values by
+// name. See Tag.Decode for the types of the values. If some Queries fail the
+// values of the other Tags are still returned along with the first error.
+func (m *TagMap) ReadTags(ctx context.Context, s QuerySender, planner Planner,
+	names ...string) (map[string]interface{}, error) {
+	var tags []Tag
+	if len(names) == 0 {
+		for _, t := range m.tags {
+			if t.Access&AccessRead != 0 {
+				tags = append(tags, t)
+			}
+		}
+	}
+	for _, name := range names {
+		t, err := m.lookup(name)
+		if nil != err {
+			return nil, err
+		}
+		if t.Access&AccessRead == 0 {
+			return nil, fmt.Errorf("Tag %q is not readable", t.Name)
+		}
+		tags = append(tags, t)
+	}
+	plan, err := planner.PlanTags(tags...)
+	if nil != err {
+		return nil, err
+	}
+	data, err := plan.Execute(ctx, s)
+	values := make(map[string]interface{}, len(tags))
+	for i, t := range tags {
+		if nil == data[i] {
+			continue
+		}
+		v, dErr := t.Decode(data[i])
+		if nil != dErr {
+			if nil == err {
+				err = dErr
+			}
+			continue
+		}
+		values[t.Name] = v
+	}
+	return values, err
+}
+
+// LoadTagMap reads a TagMap from a JSON, YAML or CSV file, depending on the
+// extension of the filename.
+func LoadTagMap(filename string) (*TagMap, error) {
+	var read func(io.Reader) (*TagMap, error)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		read = ReadTagMapJSON
+	case ".yaml", ".yml":
+		read = ReadTagMapYAML
+	case ".csv":
+		read = ReadTagMapCSV
+	default:
+		return nil, fmt.Errorf("Unknown register map file type: %q",
+			filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if nil != err {
+		return nil, err
+	}
+	m, err := read(bytes.NewReader(data))
+	if nil != err {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return m, nil
+}
+
+// ReadTagMapJSON reads a TagMap from a JSON array of Tags. The field names
+// are those of the Tag's json struct tags and unknown fields are an error.
+func ReadTagMapJSON(r io.Reader) (*TagMap, error) {
+	var tags []Tag
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tags); nil != err {
+		return nil, err
+	}
+	return NewTagMap(tags...)
+}
+
+// ReadTagMapYAML reads a TagMap from a YAML sequence of Tags. The field
+// names are those of the Tag's yaml struct tags and unknown fields are an
+// error.
+func ReadTagMapYAML(r io.Reader) (*TagMap, error) {
+	data, err := ioutil.ReadAll(r)
+	if nil != err {
+		return nil, err
+	}
+	var tags []Tag
+	if err := yaml.UnmarshalStrict(data, &tags); nil != err {
+		return nil, err
+	}
+	return NewTagMap(tags...)
+}
+
+// ReadTagMapCSV reads a TagMap from CSV with one Tag per row. The first row
+// must name the columns using the Tag's json field names, in any order and
+// case. The name, table and address columns are required. Other columns are
+// ignored so that spreadsheets may carry descriptions and notes. Empty cells
+// leave the field at its default. Numbers may be given in decimal or, with a
+// 0x prefix, in hexadecimal.
+func ReadTagMapCSV(r io.Reader) (*TagMap, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if nil != err {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("Missing CSV header")
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"name", "table", "address"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("Missing CSV column: %q", name)
+		}
+	}
+	tags := make([]Tag, len(rows)-1)
+	for i, row := range rows[1:] {
+		if err := parseCSVTag(&tags[i], columns, row); nil != err {
+			return nil, fmt.Errorf("Row %v: %v", i+2, err)
+		}
+	}
+	return NewTagMap(tags...)
+}
+
+// parseCSVTag sets the fields of t from the cells of the row.
+func parseCSVTag(t *Tag, columns map[string]int, row []string) error {
+	for column, i := range columns {
+		cell := strings.TrimSpace(row[i])
+		if len(cell) == 0 {
+			continue
+		}
+		var err error
+		switch column {
+		case "name":
+			t.Name = cell
+		case "unit":
+			t.SlaveID, err = parseUint8(cell)
+		case "table":
+			err = t.Table.UnmarshalText([]byte(cell))
+		case "address":
+			t.Address, err = parseUint16(cell)
+		case "type":
+			err = t.Type.UnmarshalText([]byte(cell))
+		case "order":
+			err = t.ByteOrder.UnmarshalText([]byte(cell))
+		case "length":
+			t.Length, err = parseUint16(cell)
+		case "scale":
+			t.Scale, err = strconv.ParseFloat(cell, 64)
+		case "offset":
+			t.Offset, err = strconv.ParseFloat(cell, 64)
+		case "units":
+			t.Units = cell
+		case "access":
+			err = t.Access.UnmarshalText([]byte(cell))
+		}
+		if nil != err {
+			return fmt.Errorf("Column %q: %v", column, err)
+		}
+	}
+	return nil
+}
+
+func parseUint8(s string) (byte, error) {
+	v, err := parseUint(s, 8)
+	return byte(v), err
+}
+
+func parseUint16(s string) (uint16, error) {
+	v, err := parseUint(s, 16)
+	return uint16(v), err
+}
+
+// parseUint parses a decimal number or, with a 0x prefix, a hexadecimal one.
+// Leading zeros, as in zero padded addresses, do not make it octal.
+func parseUint(s string, bitSize int) (uint64, error) {
+	if len(s) > 2 && '0' == s[0] && ('x' == s[1] || 'X' == s[1]) {
+		v, err := strconv.ParseUint(s[2:], 16, bitSize)
+		if nil != err {
+			return 0, fmt.Errorf("Invalid number: %q", s)
+		}
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, bitSize)
+	if nil != err {
+		return 0, fmt.Errorf("Invalid number: %q", s)
+	}
+	return v, nil
+}
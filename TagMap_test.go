@@ -0,0 +1,237 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegisterSender is a QuerySender that stores holding registers and
+// coils in memory.
+type testRegisterSender struct {
+	sync.Mutex
+	registers map[uint16]uint16
+	coils     map[uint16]bool
+}
+
+func newTestRegisterSender() *testRegisterSender {
+	return &testRegisterSender{
+		registers: make(map[uint16]uint16),
+		coils:     make(map[uint16]bool),
+	}
+}
+
+func (s *testRegisterSender) SendContext(ctx context.Context,
+	q Query) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	switch q.FunctionCode {
+	case FunctionReadHoldingRegisters:
+		data := make([]byte, 2*q.Quantity)
+		for i := uint16(0); i < q.Quantity; i++ {
+			binary.BigEndian.PutUint16(data[2*i:], s.registers[q.Address+i])
+		}
+		return data, nil
+	case FunctionWriteSingleRegister, FunctionWriteMultipleRegisters:
+		for i, v := range q.Values {
+			s.registers[q.Address+uint16(i)] = v
+		}
+		return nil, nil
+	case FunctionReadCoils:
+		coils := make([]bool, q.Quantity)
+		for i := range coils {
+			coils[i] = s.coils[q.Address+uint16(i)]
+		}
+		return packCoils(coils), nil
+	case FunctionWriteSingleCoil:
+		s.coils[q.Address] = q.Values[0] == 0xFF00
+		return nil, nil
+	case FunctionWriteMultipleCoils:
+		for i, c := range q.Coils {
+			s.coils[q.Address+uint16(i)] = c
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unsupported FunctionCode: %v", q.FunctionCode)
+}
+
+const testTagMapJSON = `[
+	{"name": "temp", "unit": 1, "table": "hr", "address": 10,
+		"type": "int16", "scale": 0.1, "units": "degC"},
+	{"name": "total", "unit": 1, "table": "hr", "address": 11,
+		"type": "float32", "order": "cdab"},
+	{"name": "run", "unit": 1, "table": "coil", "address": 0}
+]`
+
+const testTagMapYAML = `
+- name: temp
+  unit: 1
+  table: hr
+  address: 10
+  type: int16
+  scale: 0.1
+  units: degC
+- name: total
+  unit: 1
+  table: hr
+  address: 11
+  type: float32
+  order: CDAB
+- name: run
+  unit: 1
+  table: coil
+  address: 0
+`
+
+const testTagMapCSV = `Name,Unit,Table,Address,Type,Order,Scale,Units,Description
+temp,1,hr,0x0a,int16,,0.1,degC,Supply temperature
+total,1,hr,11,float32,CDAB,,,Totalizer
+run,1,coil,0,,,,,Run command
+`
+
+func TestTagMap(t *testing.T) {
+	var formats = []struct {
+		name string
+		read func(string) (*TagMap, error)
+		data string
+	}{
+		{"JSON", func(s string) (*TagMap, error) {
+			return ReadTagMapJSON(strings.NewReader(s))
+		}, testTagMapJSON},
+		{"YAML", func(s string) (*TagMap, error) {
+			return ReadTagMapYAML(strings.NewReader(s))
+		}, testTagMapYAML},
+		{"CSV", func(s string) (*TagMap, error) {
+			return ReadTagMapCSV(strings.NewReader(s))
+		}, testTagMapCSV},
+	}
+	for _, f := range formats {
+		f := f
+		t.Run(f.name, func(t *testing.T) {
+			m, err := f.read(f.data)
+			if nil != err {
+				t.Fatal(err)
+			}
+			testTagMap(t, m)
+		})
+	}
+}
+
+func testTagMap(t *testing.T, m *TagMap) {
+	if tags := m.Tags(); len(tags) != 3 || tags[0].Name != "temp" {
+		t.Fatalf("Tags: %+v", tags)
+	}
+	total, _ := m.Tag("total")
+	if total.Type != DataTypeFloat32 || total.ByteOrder != ByteOrderCDAB ||
+		total.Access != AccessReadWrite {
+		t.Errorf("total: %+v", total)
+	}
+
+	ctx := context.Background()
+	s := newTestRegisterSender()
+	if err := m.Write(ctx, s, "temp", 21.5); nil != err {
+		t.Fatal(err)
+	}
+	if s.registers[10] != 215 {
+		t.Errorf("temp register want: 215 got: %v", s.registers[10])
+	}
+	if err := m.Write(ctx, s, "total", float32(1.25)); nil != err {
+		t.Fatal(err)
+	}
+	if v, err := m.Read(ctx, s, "total"); nil != err || v != float32(1.25) {
+		t.Errorf("total want: 1.25 got: %v, %v", v, err)
+	}
+	if err := m.Write(ctx, s, "run", true); nil != err {
+		t.Fatal(err)
+	}
+	if v, err := m.Read(ctx, s, "run"); nil != err || v != true {
+		t.Errorf("run want: true got: %v, %v", v, err)
+	}
+	if _, err := m.Read(ctx, s, "missing"); nil == err {
+		t.Error("Unknown Tag err is nil")
+	}
+}
+
+func TestTagMapCSVNumbers(t *testing.T) {
+	m, err := ReadTagMapCSV(strings.NewReader("name,unit,table,address\n" +
+		"a,01,hr,0100\nb,1,hr,0108\nc,0x0A,hr,0X10\n"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	for _, want := range []Tag{
+		{Name: "a", SlaveID: 1, Address: 100},
+		{Name: "b", SlaveID: 1, Address: 108},
+		{Name: "c", SlaveID: 10, Address: 16},
+	} {
+		tag, _ := m.Tag(want.Name)
+		if tag.SlaveID != want.SlaveID || tag.Address != want.Address {
+			t.Errorf("%v want: unit %v address %v got: unit %v "+
+				"address %v", want.Name, want.SlaveID, want.Address,
+				tag.SlaveID, tag.Address)
+		}
+	}
+}
+
+func TestTagMapInvalid(t *testing.T) {
+	var tests = []struct {
+		name string
+		tags []Tag
+	}{
+		{"Duplicate", []Tag{
+			{Name: "a", Table: TableCoils},
+			{Name: "a", Table: TableCoils, Address: 1},
+		}},
+		{"Overlap", []Tag{
+			{Name: "a", Table: TableHoldingRegisters, Address: 0,
+				Type: DataTypeFloat64},
+			{Name: "b", Table: TableHoldingRegisters, Address: 5},
+			{Name: "c", Table: TableHoldingRegisters, Address: 3},
+		}},
+	}
+	for _, test := range tests {
+		if _, err := NewTagMap(test.tags...); nil == err {
+			t.Errorf("%v: err is nil", test.name)
+		}
+	}
+
+	// The same addresses in different Tables or SlaveIDs do not overlap.
+	if _, err := NewTagMap(
+		Tag{Name: "a", Table: TableHoldingRegisters},
+		Tag{Name: "b", Table: TableInputRegisters},
+		Tag{Name: "c", Table: TableHoldingRegisters, SlaveID: 2},
+	); nil != err {
+		t.Error(err)
+	}
+
+	var files = []struct {
+		name string
+		read func() (*TagMap, error)
+	}{
+		{"JSON Unknown Field", func() (*TagMap, error) {
+			return ReadTagMapJSON(strings.NewReader(
+				`[{"name": "a", "table": "hr", "adress": 1}]`))
+		}},
+		{"YAML Invalid Table", func() (*TagMap, error) {
+			return ReadTagMapYAML(strings.NewReader(
+				"- name: a\n  table: holding\n"))
+		}},
+		{"CSV Missing Column", func() (*TagMap, error) {
+			return ReadTagMapCSV(strings.NewReader("name,table\na,hr\n"))
+		}},
+		{"CSV Invalid Address", func() (*TagMap, error) {
+			return ReadTagMapCSV(strings.NewReader(
+				"name,table,address\na,hr,70000\n"))
+		}},
+		{"Unknown Extension", func() (*TagMap, error) {
+			return LoadTagMap("tags.txt")
+		}},
+	}
+	for _, f := range files {
+		if _, err := f.read(); nil == err {
+			t.Errorf("%v: err is nil", f.name)
+		}
+	}
+}
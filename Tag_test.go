@@ -0,0 +1,148 @@
+package modbus
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTagNormalize(t *testing.T) {
+	var tests = []struct {
+		name string
+		Tag
+		valid bool
+	}{
+		{"Defaults", Tag{Name: "a", Table: TableHoldingRegisters}, true},
+		{"No Name", Tag{Table: TableHoldingRegisters}, false},
+		{"No Table", Tag{Name: "a"}, false},
+		{"Bool Register", Tag{Name: "a", Table: TableInputRegisters,
+			Type: DataTypeBool}, false},
+		{"Float Coil", Tag{Name: "a", Table: TableCoils,
+			Type: DataTypeFloat32}, false},
+		{"String Without Length", Tag{Name: "a",
+			Table: TableHoldingRegisters, Type: DataTypeString}, false},
+		{"Length Without String", Tag{Name: "a",
+			Table: TableHoldingRegisters, Length: 2}, false},
+		{"Writable Input", Tag{Name: "a", Table: TableDiscreteInputs,
+			Access: AccessReadWrite}, false},
+		{"Scaled Bool", Tag{Name: "a", Table: TableCoils, Scale: 2}, false},
+		{"Out Of Range", Tag{Name: "a", Table: TableHoldingRegisters,
+			Address: 0xFFFF, Type: DataTypeUint32}, false},
+		{"Last Register", Tag{Name: "a", Table: TableHoldingRegisters,
+			Address: 0xFFFE, Type: DataTypeUint32}, true},
+	}
+	for _, test := range tests {
+		if err := test.Normalize(); test.valid != (nil == err) {
+			t.Errorf("%v: valid want: %v got: %v", test.name, test.valid,
+				err)
+		}
+	}
+
+	tag := Tag{Name: "a", Table: TableInputRegisters}
+	tag.Normalize()
+	if tag.Type != DataTypeUint16 || tag.Access != AccessRead {
+		t.Errorf("Default Type, Access want: uint16, r got: %v, %v",
+			tag.Type, tag.Access)
+	}
+}
+
+func TestTagEncodeDecode(t *testing.T) {
+	var tests = []struct {
+		Tag
+		value interface{}
+		want  interface{}
+	}{
+		{Tag{Type: DataTypeUint16}, 7, uint16(7)},
+		{Tag{Type: DataTypeInt16}, int8(-7), int16(-7)},
+		{Tag{Type: DataTypeUint32, ByteOrder: ByteOrderCDAB}, uint(70000),
+			uint32(70000)},
+		{Tag{Type: DataTypeInt32}, -70000, int32(-70000)},
+		{Tag{Type: DataTypeUint64}, uint64(1 << 63), uint64(1 << 63)},
+		{Tag{Type: DataTypeInt64, ByteOrder: ByteOrderDCBA}, -1, int64(-1)},
+		{Tag{Type: DataTypeFloat32}, 1.5, float32(1.5)},
+		{Tag{Type: DataTypeFloat64}, 2, float64(2)},
+		{Tag{Type: DataTypeInt16, Scale: 0.1, Offset: -40}, 21.5, 21.5},
+		{Tag{Type: DataTypeString, Length: 3}, "abcd", "abcd"},
+		{Tag{Type: DataTypeString, Length: 2, ByteOrder: ByteOrderBADC},
+			"ab", "ab"},
+	}
+	for _, test := range tests {
+		test.Name = test.Type.String()
+		test.Table = TableHoldingRegisters
+		if err := test.Normalize(); nil != err {
+			t.Fatal(err)
+		}
+		q, err := test.WriteQuery(test.value)
+		if nil != err {
+			t.Errorf("%v: %v", test.Name, err)
+			continue
+		}
+		if q.Quantity != test.Quantity() && !(1 == test.Quantity() &&
+			FunctionWriteSingleRegister == q.FunctionCode) {
+			t.Errorf("%v: Quantity want: %v got: %v", test.Name,
+				test.Quantity(), q.Quantity)
+		}
+		v, err := test.Decode(dataBlock(q.Values...))
+		if nil != err {
+			t.Errorf("%v: %v", test.Name, err)
+			continue
+		}
+		if f, ok := v.(float64); ok && 0 != test.Scale {
+			// Allow for rounding of the scaled value.
+			v = float64(int(f*10+0.5)) / 10
+		}
+		if !reflect.DeepEqual(v, test.want) {
+			t.Errorf("%v: want: %#v got: %#v", test.Name, test.want, v)
+		}
+	}
+
+	var errTests = []struct {
+		Tag
+		value interface{}
+	}{
+		{Tag{Type: DataTypeUint16}, -1},
+		{Tag{Type: DataTypeUint16}, 65536},
+		{Tag{Type: DataTypeInt16}, 40000.0},
+		{Tag{Type: DataTypeInt16}, 1.5},
+		{Tag{Type: DataTypeUint32}, float32(0.25)},
+		{Tag{Type: DataTypeInt32}, math.NaN()},
+		{Tag{Type: DataTypeInt64}, uint64(1 << 63)},
+		{Tag{Type: DataTypeUint16}, "1"},
+		{Tag{Type: DataTypeString, Length: 1}, "abc"},
+		{Tag{Type: DataTypeUint16, Access: AccessRead}, 1},
+	}
+	for _, test := range errTests {
+		test.Name = test.Type.String()
+		test.Table = TableHoldingRegisters
+		if err := test.Normalize(); nil != err {
+			t.Fatal(err)
+		}
+		if _, err := test.WriteQuery(test.value); nil == err {
+			t.Errorf("%v %v: err is nil", test.Name, test.value)
+		}
+	}
+}
+
+func TestTagCoil(t *testing.T) {
+	tag := Tag{Name: "run", Table: TableCoils, Address: 3}
+	if err := tag.Normalize(); nil != err {
+		t.Fatal(err)
+	}
+	q, err := tag.WriteQuery(true)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if q.FunctionCode != FunctionWriteSingleCoil || q.Address != 3 {
+		t.Errorf("WriteQuery want: WriteSingleCoil 3 got: %v %v",
+			q.FunctionCode, q.Address)
+	}
+	if v, err := tag.Decode([]byte{0x01}); nil != err || true != v {
+		t.Errorf("Decode want: true got: %v, %v", v, err)
+	}
+	if _, err := tag.WriteQuery(1); nil == err {
+		t.Error("Non-bool coil value err is nil")
+	}
+	if _, err := tag.Encode(true); nil == err {
+		t.Error("Encode coil err is nil")
+	}
+}
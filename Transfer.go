@@ -0,0 +1,252 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// TransferOptions control how ReadRange and WriteRange split a Range into
+// Queries and send them.
+type TransferOptions struct {
+	// MaxQuantity limits the Quantity of each Query. Zero means the
+	// protocol maximum, or the limit of the Device if a Device is used.
+	MaxQuantity uint16
+	// Pipeline is the number of Queries that are queued at the same time.
+	// Queuing the next Query before the response to the previous one
+	// arrives avoids idle time on the bus between Queries, but the queued
+	// Queries are sent concurrently and may reach the bus in any order.
+	// Values below 2 send the Queries one at a time, in order.
+	Pipeline int
+	// Progress, if not nil, is called after each successful Query with the
+	// number of addresses transferred so far and in total.
+	Progress func(done, total int)
+}
+
+// RangeError is returned by ReadRange and WriteRange if a Query fails. All
+// addresses before Range.Address were transferred successfully. With a
+// TransferOptions.Pipeline above 1, the Queries for addresses after the Range
+// may also have been sent, so they may have been written as well.
+type RangeError struct {
+	// Range is the part of the transfer sent by the failing Query.
+	Range
+	Err error
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%v Address %v Quantity %v: %v", e.Table, e.Address,
+		e.Quantity, e.Err)
+}
+
+// Unwrap returns the error of the failing Query.
+func (e *RangeError) Unwrap() error {
+	return e.Err
+}
+
+// quantityLimiter is implemented by QuerySenders with a Quantity limit, such
+// as Devices.
+type quantityLimiter interface {
+	maxQuantity(fCode FunctionCode) uint16
+}
+
+// chunkSize returns the Quantity of the Queries with the fCode, given the
+// protocol maximum.
+func (opts TransferOptions) chunkSize(s QuerySender, fCode FunctionCode,
+	max uint16) uint16 {
+	if opts.MaxQuantity > 0 && opts.MaxQuantity < max {
+		max = opts.MaxQuantity
+	}
+	if l, ok := s.(quantityLimiter); ok {
+		if limit := l.maxQuantity(fCode); limit > 0 && limit < max {
+			max = limit
+		}
+	}
+	return max
+}
+
+// split returns the consecutive sub-Ranges of r of at most size addresses.
+func (r Range) split(size uint16) []Range {
+	var chunks []Range
+	for start := r.Address; int(start) < r.end(); start += size {
+		chunk := r
+		chunk.Address = start
+		chunk.Quantity = size
+		if int(start)+int(size) > r.end() {
+			chunk.Quantity = uint16(r.end() - int(start))
+		}
+		chunks = append(chunks, chunk)
+		if int(start)+int(size) > 0xFFFF {
+			break
+		}
+	}
+	return chunks
+}
+
+// ReadRange reads r using s, which may be a ClientHandle or a Device, with as
+// many read Queries as needed, and returns the data of the whole Range in
+// the format of a single read Query's response. If a Query fails no further
+// Queries are queued and a *RangeError is returned along with the data read
+// so far, once the Queries already queued with a Pipeline have completed.
+func ReadRange(ctx context.Context, s QuerySender, r Range,
+	opts TransferOptions) ([]byte, error) {
+	fCode, ok := tableReadFunctions[r.Table]
+	if !ok {
+		return nil, fmt.Errorf("Invalid Table: %v", byte(r.Table))
+	}
+	if 0 == r.Quantity || r.end() > 0x10000 {
+		return nil, fmt.Errorf("Invalid %v Range: Address %v Quantity %v",
+			r.Table, r.Address, r.Quantity)
+	}
+	chunks := r.split(opts.chunkSize(s, fCode, r.Table.MaxQuantity()))
+	queries := make([]Query, len(chunks))
+	for i, c := range chunks {
+		var err error
+		if queries[i], err = ReadQuery(c.SlaveID, fCode, c.Address,
+			c.Quantity); nil != err {
+			return nil, err
+		}
+	}
+
+	var bits []bool
+	var data []byte
+	if r.Table.IsBits() {
+		bits = make([]bool, r.Quantity)
+	} else {
+		data = make([]byte, 2*int(r.Quantity))
+	}
+	err := transfer(ctx, s, chunks, queries, opts, func(i int,
+		response []byte) error {
+		c := chunks[i]
+		if err := checkReadData(queries[i], response); nil != err {
+			return err
+		}
+		offset := int(c.Address - r.Address)
+		if r.Table.IsBits() {
+			copy(bits[offset:], unpackCoils(response, int(c.Quantity)))
+		} else {
+			copy(data[2*offset:], response)
+		}
+		return nil
+	})
+	if r.Table.IsBits() {
+		data = packCoils(bits)
+	}
+	return data, err
+}
+
+// WriteRange writes the data to r using s, which may be a ClientHandle or a
+// Device, with as many WriteMultipleCoils or WriteMultipleRegisters Queries
+// as needed. The data is in the format returned by ReadRange. If a Query
+// fails no further Queries are queued and a *RangeError is returned. Without
+// a Pipeline, nothing after the RangeError's Range was written. With a
+// Pipeline, the Queries are sent in any order, so addresses after the Range
+// may have been written as well.
+func WriteRange(ctx context.Context, s QuerySender, r Range, data []byte,
+	opts TransferOptions) error {
+	if !r.Table.Writable() {
+		return fmt.Errorf("Table %v is not writable", r.Table)
+	}
+	if 0 == r.Quantity || r.end() > 0x10000 {
+		return fmt.Errorf("Invalid %v Range: Address %v Quantity %v",
+			r.Table, r.Address, r.Quantity)
+	}
+	var bits []bool
+	var fCode FunctionCode = FunctionWriteMultipleRegisters
+	var max uint16 = maxWriteRegisters
+	if r.Table.IsBits() {
+		var err error
+		if bits, err = DecodeCoils(data, r.Quantity); nil != err {
+			return err
+		}
+		fCode, max = FunctionWriteMultipleCoils, maxWriteCoils
+	} else if len(data) != 2*int(r.Quantity) {
+		return fmt.Errorf("Expected %v bytes of data but got %v",
+			2*r.Quantity, len(data))
+	}
+
+	chunks := r.split(opts.chunkSize(s, fCode, max))
+	queries := make([]Query, len(chunks))
+	for i, c := range chunks {
+		offset := int(c.Address - r.Address)
+		var err error
+		if r.Table.IsBits() {
+			queries[i], err = WriteMultipleCoils(c.SlaveID, c.Address,
+				bits[offset:offset+int(c.Quantity)])
+		} else {
+			values := make([]uint16, c.Quantity)
+			for j := range values {
+				values[j] = binary.BigEndian.Uint16(
+					data[2*(offset+j):])
+			}
+			queries[i], err = WriteMultipleRegisters(c.SlaveID,
+				c.Address, c.Quantity, values)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	return transfer(ctx, s, chunks, queries, opts, nil)
+}
+
+// transferResult is the response to the i-th Query of a transfer.
+type transferResult struct {
+	i    int
+	data []byte
+	err  error
+}
+
+// transfer sends the queries for the chunks using s, keeping up to
+// opts.Pipeline of them queued, and passes each response to handle, if not
+// nil. The queued queries are sent concurrently, in any order. After the
+// first failure no further queries are queued and a *RangeError for the
+// lowest failed chunk is returned once all queued queries have completed.
+func transfer(ctx context.Context, s QuerySender, chunks []Range,
+	queries []Query, opts TransferOptions,
+	handle func(i int, data []byte) error) error {
+	pipeline := opts.Pipeline
+	if pipeline < 1 {
+		pipeline = 1
+	}
+	var total int
+	for _, c := range chunks {
+		total += int(c.Quantity)
+	}
+	results := make(chan transferResult, len(queries))
+	errs := make([]error, len(queries))
+	var next, inFlight, done int
+	var failed bool
+	for next < len(queries) || inFlight > 0 {
+		if next < len(queries) && inFlight < pipeline && !failed {
+			go func(i int) {
+				data, err := s.SendContext(ctx, queries[i])
+				results <- transferResult{i: i, data: data, err: err}
+			}(next)
+			next++
+			inFlight++
+			continue
+		}
+		if 0 == inFlight {
+			break
+		}
+		res := <-results
+		inFlight--
+		if nil == res.err && nil != handle {
+			res.err = handle(res.i, res.data)
+		}
+		if nil != res.err {
+			errs[res.i] = res.err
+			failed = true
+			continue
+		}
+		done += int(chunks[res.i].Quantity)
+		if nil != opts.Progress {
+			opts.Progress(done, total)
+		}
+	}
+	for i, err := range errs {
+		if nil != err {
+			return &RangeError{Range: chunks[i], Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// failingSender fails Queries that include the address fail.
+type failingSender struct {
+	QuerySender
+	fail uint16
+}
+
+var errTestFail = errors.New("Test failure")
+
+func (s failingSender) SendContext(ctx context.Context, q Query) ([]byte,
+	error) {
+	if q.Address <= s.fail && s.fail < q.Address+q.Quantity {
+		return nil, errTestFail
+	}
+	return s.QuerySender.SendContext(ctx, q)
+}
+
+func TestRangeSplit(t *testing.T) {
+	r := Range{SlaveID: 1, Table: TableHoldingRegisters, Address: 65530,
+		Quantity: 6}
+	want := []Range{
+		{1, TableHoldingRegisters, 65530, 4},
+		{1, TableHoldingRegisters, 65534, 2},
+	}
+	if got := r.split(4); !reflect.DeepEqual(got, want) {
+		t.Errorf("split want: %v got: %v", want, got)
+	}
+}
+
+func TestReadWriteRange(t *testing.T) {
+	for _, pipeline := range []int{0, 4} {
+		s := newTestRegisterSender()
+		ctx := context.Background()
+		r := Range{SlaveID: 1, Table: TableHoldingRegisters, Address: 1000,
+			Quantity: 1000}
+		data := dataBlock(EncodeUint16(ByteOrderABCD,
+			make([]uint16, 1000)...)...)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		var calls, lastDone int
+		opts := TransferOptions{Pipeline: pipeline,
+			Progress: func(done, total int) {
+				calls++
+				if done <= lastDone || total != 1000 {
+					t.Errorf("Progress(%v, %v) after %v", done, total,
+						lastDone)
+				}
+				lastDone = done
+			}}
+		if err := WriteRange(ctx, s, r, data, opts); nil != err {
+			t.Fatal(err)
+		}
+		if calls != 9 || lastDone != 1000 {
+			t.Errorf("Progress want: 9 calls, done 1000 got: %v, %v",
+				calls, lastDone)
+		}
+		lastDone = 0
+		got, err := ReadRange(ctx, s, r, opts)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, data) {
+			t.Error("ReadRange data does not match WriteRange data")
+		}
+
+		bits := packCoils([]bool{true, false, true, true, false})
+		c := Range{SlaveID: 1, Table: TableCoils, Address: 3, Quantity: 5}
+		opts = TransferOptions{MaxQuantity: 2, Pipeline: pipeline}
+		if err := WriteRange(ctx, s, c, bits, opts); nil != err {
+			t.Fatal(err)
+		}
+		if got, err := ReadRange(ctx, s, c, opts); nil != err ||
+			!reflect.DeepEqual(got, bits) {
+			t.Errorf("ReadRange coils want: %v got: %v, %v", bits, got,
+				err)
+		}
+	}
+}
+
+func TestReadRangeFailure(t *testing.T) {
+	s := failingSender{QuerySender: newTestRegisterSender(), fail: 300}
+	r := Range{SlaveID: 1, Table: TableHoldingRegisters, Address: 0,
+		Quantity: 500}
+	for _, pipeline := range []int{1, 3} {
+		_, err := ReadRange(context.Background(), s, r,
+			TransferOptions{Pipeline: pipeline})
+		var rErr *RangeError
+		if !errors.As(err, &rErr) {
+			t.Fatalf("Pipeline %v: err want: *RangeError got: %v",
+				pipeline, err)
+		}
+		if rErr.Address != 250 || rErr.Quantity != 125 ||
+			!errors.Is(err, errTestFail) {
+			t.Errorf("Pipeline %v: RangeError want: 250 125 got: %v",
+				pipeline, rErr)
+		}
+	}
+
+	d := &Device{DeviceOptions: DeviceOptions{MaxRegisters: 10}}
+	if size := (TransferOptions{}).chunkSize(d,
+		FunctionReadHoldingRegisters, 125); size != 10 {
+		t.Errorf("Device chunkSize want: 10 got: %v", size)
+	}
+	ir := Range{Table: TableInputRegisters, Quantity: 1}
+	if err := WriteRange(context.Background(), s, ir, []byte{0, 0},
+		TransferOptions{}); nil == err {
+		t.Error("Read only Table err is nil")
+	}
+}
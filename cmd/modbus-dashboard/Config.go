@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+)
+
+// config is the configuration of the dashboard, read from YAML or JSON.
+type config struct {
+	Devices devconfig.Devices `yaml:"devices"`
+}
+
+// Init implements devconfig.Config.
+func (c *config) Init(dir string) error {
+	return c.Devices.Init(dir)
+}
+
+// loadConfig reads the config from filename.
+func loadConfig(filename string) (*config, error) {
+	cfg := &config{}
+	if err := devconfig.Load(filename, cfg); nil != err {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// mapConfig returns the config of a single device polled with the register
+// map d.Map, which is named after the map.
+func mapConfig(d devconfig.Device) (*config, error) {
+	d.Name = strings.TrimSuffix(filepath.Base(d.Map), filepath.Ext(d.Map))
+	cfg := &config{Devices: devconfig.Devices{d}}
+	if err := cfg.Init("."); nil != err {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/lineedit"
+	"github.com/AdamSLevy/modbus/internal/textvalue"
+)
+
+// refresh is the interval at which the screen is redrawn.
+const refresh = 250 * time.Millisecond
+
+// highlight is how long changed values are highlighted.
+const highlight = 2 * time.Second
+
+// ANSI attributes of the screen.
+const (
+	attrReset   = "\x1b[0m"
+	attrBold    = "\x1b[1m"
+	attrReverse = "\x1b[7m"
+	attrChanged = "\x1b[1;33m"
+	attrError   = "\x1b[31m"
+)
+
+// Widths of the columns of the tag table.
+const (
+	maxTagWidth = 32
+	valueWidth  = 16
+	unitsWidth  = 8
+)
+
+// dashboard polls the configured devices and shows the values of their Tags
+// and the health of their communication on a terminal, where the values of
+// writable Tags can be edited.
+type dashboard struct {
+	devices []*device
+	// rows are the Tags of all devices, in the order of their register
+	// maps.
+	rows []*row
+	// results receives the outcome of writes.
+	results chan string
+
+	// mtx guards the values of the rows and the statistics of the
+	// devices.
+	mtx sync.Mutex
+
+	// The state of the user interface, which is only used by its
+	// goroutine. top is the first row shown and page the number of rows
+	// that fit on the screen.
+	selected, top, page int
+	editing             bool
+	input               []rune
+	status              string
+}
+
+// device is a configured device, its Poller and the statistics of its
+// responses.
+type device struct {
+	devconfig.Device
+	ch     modbus.ClientHandle
+	poller *modbus.Poller
+	rows   map[string]*row
+
+	// latency is that of the last response and total that of all
+	// responses.
+	latency, total time.Duration
+	responses      int
+	lastErr        error
+}
+
+// row is a Tag of a device and its last value. Changed is when the value
+// that differs from the one before was read.
+type row struct {
+	d       *device
+	tag     modbus.Tag
+	value   interface{}
+	read    bool
+	quality modbus.Quality
+	time    time.Time
+	changed time.Time
+}
+
+// newDashboard opens the ClientHandles of the devices of cfg and returns the
+// dashboard polling them.
+func newDashboard(cfg *config) (*dashboard, error) {
+	db := &dashboard{results: make(chan string)}
+	for _, dc := range cfg.Devices {
+		d := &device{Device: dc, rows: make(map[string]*row)}
+		var err error
+		if d.ch, err = modbus.GetClientHandle(
+			dc.ConnectionSettings()); nil != err {
+			db.close()
+			return nil, fmt.Errorf("Device %q: %v", dc.Name, err)
+		}
+		db.devices = append(db.devices, d)
+		d.poller = modbus.NewPoller(&timedSender{QuerySender: d.ch, d: d,
+			db: db})
+		if err := d.poller.Add(dc.Poll()); nil != err {
+			db.close()
+			return nil, err
+		}
+		d.poller.OnSample(func(s modbus.Sample) { db.update(d, s) })
+		for _, t := range dc.TagMap.Tags() {
+			r := &row{d: d, tag: t}
+			d.rows[t.Name] = r
+			db.rows = append(db.rows, r)
+		}
+	}
+	return db, nil
+}
+
+func (db *dashboard) close() {
+	for _, d := range db.devices {
+		d.ch.Close()
+	}
+}
+
+// update records the value of the Sample of the device. Values that could not
+// be read keep their last value, with the quality of the Sample.
+func (db *dashboard) update(d *device, s modbus.Sample) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	r, ok := d.rows[s.Tag]
+	if !ok {
+		return
+	}
+	r.quality = s.Quality
+	if modbus.QualityCommError == s.Quality {
+		return
+	}
+	if r.read && !reflect.DeepEqual(r.value, s.Value) {
+		r.changed = s.Time
+	}
+	r.value, r.read, r.time = s.Value, true, s.Time
+}
+
+// timedSender records the latency and errors of the Queries sent to a
+// device.
+type timedSender struct {
+	modbus.QuerySender
+	d  *device
+	db *dashboard
+}
+
+func (s *timedSender) SendContext(ctx context.Context,
+	q modbus.Query) ([]byte, error) {
+	start := time.Now()
+	data, err := s.QuerySender.SendContext(ctx, q)
+	if nil == ctx.Err() {
+		s.db.observe(s.d, time.Since(start), err)
+	}
+	return data, err
+}
+
+// observe records a response of the device, or the error.
+func (db *dashboard) observe(d *device, latency time.Duration, err error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if nil != err {
+		d.lastErr = err
+		return
+	}
+	d.latency = latency
+	d.total += latency
+	d.responses++
+}
+
+// run polls the devices and runs the user interface, reading keys from e and
+// drawing the screen of the size to w, until q is pressed, the keys end or
+// the ctx is done. It closes the ClientHandles when it returns.
+func (db *dashboard) run(ctx context.Context, e *lineedit.Editor,
+	w io.Writer, size func() (int, int)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, d := range db.devices {
+		wg.Add(1)
+		go func(p *modbus.Poller) {
+			defer wg.Done()
+			p.Run(ctx)
+		}(d.poller)
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+		db.close()
+	}()
+
+	// The goroutine reading the keys is left blocked when run returns.
+	keys := make(chan lineedit.Key)
+	keyErr := make(chan error, 1)
+	go func() {
+		for {
+			k, err := e.ReadKey()
+			if nil != err {
+				keyErr <- err
+				return
+			}
+			select {
+			case keys <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		width, height := size()
+		if err := db.draw(w, width, height, time.Now()); nil != err {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case k := <-keys:
+			if db.key(ctx, k) {
+				return nil
+			}
+		case err := <-keyErr:
+			if io.EOF == err {
+				return nil
+			}
+			return err
+		case db.status = <-db.results:
+		case <-ticker.C:
+		}
+	}
+}
+
+// key handles the key and returns whether to quit. Outside of editing, the
+// arrow keys, page keys, j, k, g and G select a row, Enter or e edit the
+// value of the selected row and q quits. While editing, Enter writes the
+// value and Escape cancels.
+func (db *dashboard) key(ctx context.Context, k lineedit.Key) bool {
+	if db.editing {
+		switch k {
+		case lineedit.KeyEnter:
+			db.editing = false
+			db.write(ctx, db.rows[db.selected], string(db.input))
+		case lineedit.KeyEscape, lineedit.KeyCtrlC:
+			db.editing = false
+			db.status = ""
+		case lineedit.KeyBackspace, lineedit.KeyCtrlH:
+			if len(db.input) > 0 {
+				db.input = db.input[:len(db.input)-1]
+			}
+		case lineedit.KeyCtrlU:
+			db.input = nil
+		default:
+			if k > 0 && unicode.IsPrint(rune(k)) {
+				db.input = append(db.input, rune(k))
+			}
+		}
+		return false
+	}
+	switch k {
+	case 'q', lineedit.KeyCtrlC, lineedit.KeyCtrlD:
+		return true
+	case lineedit.KeyUp, 'k':
+		db.selected--
+	case lineedit.KeyDown, 'j':
+		db.selected++
+	case lineedit.KeyPageUp:
+		db.selected -= db.page
+	case lineedit.KeyPageDown:
+		db.selected += db.page
+	case lineedit.KeyHome, 'g':
+		db.selected = 0
+	case lineedit.KeyEnd, 'G':
+		db.selected = len(db.rows) - 1
+	case lineedit.KeyEnter, 'e':
+		db.edit()
+	}
+	if db.selected >= len(db.rows) {
+		db.selected = len(db.rows) - 1
+	}
+	if db.selected < 0 {
+		db.selected = 0
+	}
+	return false
+}
+
+// edit starts editing the value of the selected row, if it is writable.
+func (db *dashboard) edit() {
+	if len(db.rows) == 0 {
+		return
+	}
+	r := db.rows[db.selected]
+	if r.tag.Access&modbus.AccessWrite == 0 || !r.tag.Table.Writable() {
+		db.status = fmt.Sprintf("%v is read-only", r.name())
+		return
+	}
+	db.editing = true
+	db.input = nil
+	db.status = ""
+}
+
+// write writes the value typed for the row in the background. The outcome is
+// sent to the results.
+func (db *dashboard) write(ctx context.Context, r *row, input string) {
+	v, err := textvalue.Parse(r.tag, input)
+	if nil != err {
+		db.status = fmt.Sprintf("%v: Invalid value %q: %v", r.name(),
+			input, err)
+		return
+	}
+	q, err := r.tag.WriteQuery(v)
+	if nil != err {
+		db.status = fmt.Sprintf("%v: %v", r.name(), err)
+		return
+	}
+	db.status = fmt.Sprintf("Writing %v = %v", r.name(), input)
+	go func() {
+		result := fmt.Sprintf("Wrote %v = %v", r.name(), input)
+		if _, err := r.d.ch.SendContext(ctx, q); nil != err {
+			result = fmt.Sprintf("Writing %v failed: %v", r.name(), err)
+		}
+		select {
+		case db.results <- result:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// name returns the name of the row, which is the name of its device and Tag.
+func (r *row) name() string {
+	return r.d.Name + "/" + r.tag.Name
+}
+
+// draw draws the screen over the previous one.
+func (db *dashboard) draw(w io.Writer, width, height int,
+	now time.Time) error {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	for i, line := range db.render(width, height, now) {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString(line)
+		buf.WriteString("\x1b[K")
+	}
+	buf.WriteString("\x1b[J")
+	// The cursor is only shown at the end of the value being edited.
+	if db.editing {
+		buf.WriteString("\x1b[?25h")
+	} else {
+		buf.WriteString("\x1b[?25l")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// render returns the lines of the screen: a title, a table of the devices, a
+// table of the Tags, scrolled to show the selected row, and a status line.
+func (db *dashboard) render(width, height int, now time.Time) []string {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	deviceWidth, tagWidth := len("DEVICE"), len("TAG")
+	for _, d := range db.devices {
+		if n := len(d.Name); n > deviceWidth {
+			deviceWidth = n
+		}
+	}
+	for _, r := range db.rows {
+		if n := len(r.tag.Name); n > tagWidth {
+			tagWidth = n
+		}
+	}
+	if tagWidth > maxTagWidth {
+		tagWidth = maxTagWidth
+	}
+
+	title := fmt.Sprintf(" modbus-dashboard  %v", now.Format("15:04:05"))
+	keys := "up/down select  enter edit  q quit "
+	if n := width - len(title) - len(keys); n > 0 {
+		title += strings.Repeat(" ", n) + keys
+	}
+	lines := []string{style(attrReverse, fit(title, width))}
+
+	lines = append(lines, style(attrBold, fit(fmt.Sprintf(
+		"%v %v %7v %7v %9v %9v  %v", fit("DEVICE", deviceWidth),
+		fit("HOST", 22), "POLLS", "ERRORS", "LATENCY", "AVERAGE",
+		"LAST ERROR"), width)))
+	for _, d := range db.devices {
+		stats, _ := d.poller.Stats(d.Name)
+		var average time.Duration
+		if d.responses > 0 {
+			average = d.total / time.Duration(d.responses)
+		}
+		lastErr := ""
+		if nil != d.lastErr {
+			lastErr = d.lastErr.Error()
+		}
+		line := fit(fmt.Sprintf("%v %v %7v %7v %9v %9v  %v",
+			fit(d.Name, deviceWidth), fit(d.Host, 22), stats.Count,
+			stats.Errors, formatLatency(d.latency),
+			formatLatency(average), lastErr), width)
+		if stats.Errors > 0 {
+			line = style(attrError, line)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "")
+
+	lines = append(lines, style(attrBold, fit(fmt.Sprintf(
+		"%v %v %v %v %-10v %-2v  %v", fit("DEVICE", deviceWidth),
+		fit("TAG", tagWidth), fit("VALUE", valueWidth),
+		fit("UNITS", unitsWidth), "QUALITY", "RW", "UPDATED"), width)))
+	db.page = height - len(lines) - 1
+	if db.page < 1 {
+		db.page = 1
+	}
+	if db.selected < db.top {
+		db.top = db.selected
+	}
+	if db.selected >= db.top+db.page {
+		db.top = db.selected - db.page + 1
+	}
+	for i := db.top; i < len(db.rows) && i < db.top+db.page; i++ {
+		r := db.rows[i]
+		value, quality, updated := "-", "", ""
+		if r.read {
+			value = formatValue(r.value)
+			quality = r.quality.String()
+			updated = r.time.Format("15:04:05.000")
+		}
+		if modbus.QualityCommError == r.quality {
+			quality = r.quality.String()
+		}
+		line := fit(fmt.Sprintf("%v %v %v %v %-10v %-2v  %v",
+			fit(r.d.Name, deviceWidth), fit(r.tag.Name, tagWidth),
+			fit(value, valueWidth), fit(r.tag.Units, unitsWidth),
+			quality, r.tag.Access, updated), width)
+		switch {
+		case i == db.selected:
+			line = style(attrReverse, line)
+		case modbus.QualityGood != r.quality:
+			line = style(attrError, line)
+		case now.Sub(r.changed) < highlight:
+			line = style(attrChanged, line)
+		}
+		lines = append(lines, line)
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	status := db.status
+	if db.editing {
+		r := db.rows[db.selected]
+		status = fmt.Sprintf("Set %v: %v", r.name(), string(db.input))
+	}
+	return append(lines, fit(status, width))
+}
+
+// formatValue formats the value of a Tag, quoting strings.
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
+
+// formatLatency formats the latency to a tenth of a millisecond, or as - if it
+// is zero.
+func formatLatency(d time.Duration) string {
+	if 0 == d {
+		return "-"
+	}
+	return d.Round(100 * time.Microsecond).String()
+}
+
+// fit pads or truncates s to n runes.
+func fit(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s + strings.Repeat(" ", n-len(runes))
+}
+
+// style returns s with the ANSI attribute.
+func style(attr, s string) string {
+	return attr + s + attrReset
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/lineedit"
+	"github.com/AdamSLevy/modbus/modbustest"
+)
+
+// screen collects the output of a dashboard.
+type screen struct {
+	mtx sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *screen) Write(p []byte) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.buf.Write(p)
+}
+
+var ansi = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// frame returns the last frame drawn, without ANSI sequences.
+func (s *screen) frame() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	frames := strings.Split(s.buf.String(), "\x1b[H")
+	return ansi.ReplaceAllString(frames[len(frames)-1], "")
+}
+
+// waitFor waits for a frame containing all of the texts.
+func (s *screen) waitFor(t *testing.T, texts ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		frame := s.frame()
+		missing := ""
+		for _, text := range texts {
+			if !strings.Contains(frame, text) {
+				missing = text
+				break
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Missing %q in frame:\n%v", missing, frame)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	s := modbustest.NewServer()
+	defer s.Close()
+	u := s.Units[1]
+	u.InputRegisters[10] = 215
+	copy(u.HoldingRegisters[100:], modbus.EncodeFloat32(modbus.ByteOrderCDAB,
+		1.5))
+
+	cfg := &config{}
+	if err := devconfig.Read(strings.NewReader(`
+devices:
+  - name: boiler
+    host: `+s.Addr()+`
+    unit: 1
+    interval: 50ms
+    tags:
+      - {name: temp, table: ir, address: 10, type: int16, scale: 0.1,
+         units: degC}
+      - {name: setpoint, table: hr, address: 100, type: float32,
+         order: CDAB}
+      - {name: pump, table: coil, address: 3}
+`), ".", cfg); nil != err {
+		t.Fatal(err)
+	}
+	db, err := newDashboard(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	keys, input := io.Pipe()
+	out := &screen{}
+	done := make(chan error, 1)
+	go func() {
+		done <- db.run(context.Background(), lineedit.New(keys, out, true),
+			out, func() (int, int) { return 100, 12 })
+	}()
+	press := func(k string) {
+		if _, err := io.WriteString(input, k); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	out.waitFor(t, "boiler", s.Addr(), "temp", "21.5", "degC", "good",
+		"setpoint", "1.5", "pump", "false", " rw ")
+
+	// Read-only and invalid values.
+	press("e")
+	out.waitFor(t, "boiler/temp is read-only")
+	press("\x1b[B")
+	press("e")
+	out.waitFor(t, "Set boiler/setpoint: ")
+	press("x\r")
+	out.waitFor(t, `boiler/setpoint: Invalid value "x"`)
+
+	press("e")
+	press("2.55\x7f\r")
+	out.waitFor(t, "Wrote boiler/setpoint = 2.5", "2.5 ")
+	s.Lock()
+	got := modbus.EncodeFloat32(modbus.ByteOrderCDAB, 2.5)
+	if u.HoldingRegisters[100] != got[0] || u.HoldingRegisters[101] != got[1] {
+		t.Errorf("Unexpected registers %v", u.HoldingRegisters[100:102])
+	}
+	s.Unlock()
+
+	press("j")
+	press("e")
+	press("on\r")
+	out.waitFor(t, "Wrote boiler/pump = on", "true")
+
+	// Escape cancels.
+	press("e")
+	press("off")
+	out.waitFor(t, "Set boiler/pump: off")
+	press("\x1b")
+	time.Sleep(50 * time.Millisecond)
+	if strings.Contains(out.frame(), "Set boiler/pump") {
+		t.Error("Editing was not cancelled")
+	}
+
+	// Failed reads are counted and shown.
+	s.Lock()
+	u.Disabled = map[modbus.FunctionCode]bool{
+		modbus.FunctionReadInputRegisters: true}
+	s.Unlock()
+	out.waitFor(t, "comm-error", "Illegal Function")
+
+	press("q")
+	select {
+	case err := <-done:
+		if nil != err {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The dashboard did not quit")
+	}
+}
+
+func TestRender(t *testing.T) {
+	d := &device{Device: devconfig.Device{Name: "plc", Host: "plc:502"},
+		poller: modbus.NewPoller(nil), rows: make(map[string]*row)}
+	db := &dashboard{devices: []*device{d}}
+	for i := 0; i < 10; i++ {
+		r := &row{d: d, tag: modbus.Tag{Name: string(rune('a' + i)),
+			Table: modbus.TableHoldingRegisters, Access: modbus.AccessRead}}
+		d.rows[r.tag.Name] = r
+		db.rows = append(db.rows, r)
+	}
+	now := time.Now()
+	db.update(d, modbus.Sample{Tag: "a", Value: uint16(1), Time: now})
+	db.update(d, modbus.Sample{Tag: "a", Value: uint16(2), Time: now})
+	db.update(d, modbus.Sample{Tag: "b", Value: "x", Time: now})
+
+	lines := db.render(40, 8, now)
+	if len(lines) != 8 {
+		t.Fatalf("Unexpected lines %q", lines)
+	}
+	for _, line := range lines {
+		if n := len([]rune(ansi.ReplaceAllString(line, ""))); n > 40 {
+			t.Errorf("Line longer than the screen: %q", line)
+		}
+	}
+	if !strings.Contains(lines[5], attrReverse) ||
+		!strings.Contains(lines[5], " 2 ") {
+		t.Errorf("Expected the selected row a: %q", lines[5])
+	}
+	if !strings.Contains(lines[6], `"x"`) ||
+		strings.Contains(lines[6], attrChanged) {
+		t.Errorf("Unexpected row b: %q", lines[6])
+	}
+	if !strings.HasPrefix(lines[7], "   ") {
+		t.Errorf("Unexpected status: %q", lines[7])
+	}
+
+	// The changed value is highlighted when it is not selected.
+	db.key(context.Background(), lineedit.KeyDown)
+	lines = db.render(40, 8, now)
+	if !strings.HasPrefix(lines[5], attrChanged) {
+		t.Errorf("Expected the changed row a: %q", lines[5])
+	}
+	lines = db.render(40, 8, now.Add(highlight))
+	if strings.Contains(lines[5], attrChanged) {
+		t.Errorf("Unexpected highlight of row a: %q", lines[5])
+	}
+
+	// The rows scroll with the selection.
+	for i := 0; i < 4; i++ {
+		db.key(context.Background(), lineedit.KeyDown)
+	}
+	lines = db.render(40, 8, now)
+	if !strings.Contains(lines[6], "f ") ||
+		!strings.Contains(lines[6], attrReverse) {
+		t.Errorf("Expected the selected row f: %q", lines)
+	}
+	db.key(context.Background(), lineedit.KeyEnd)
+	db.key(context.Background(), 'e')
+	lines = db.render(40, 8, now)
+	if !strings.Contains(lines[7], "plc/j is read-only") {
+		t.Errorf("Unexpected status: %q", lines[7])
+	}
+	if !db.key(context.Background(), 'q') {
+		t.Error("Expected q to quit")
+	}
+}
@@ -0,0 +1,118 @@
+// Command modbus-dashboard polls Modbus devices using register maps and shows
+// their values live on a full-screen terminal, for monitoring a panel from a
+// laptop.
+//
+// The config file is YAML or JSON:
+//
+//	devices:
+//	  - name: boiler
+//	    host: 192.168.1.10:502
+//	    unit: 1
+//	    interval: 1s
+//	    map: boiler.csv
+//	  - name: meter
+//	    host: /dev/ttyUSB0
+//	    mode: rtu
+//	    baud: 19200
+//	    tags:
+//	      - {name: power, unit: 3, table: ir, address: 0, type: float32}
+//
+// A single device can also be given with flags instead of a config file:
+//
+//	modbus-dashboard -host /dev/ttyUSB0 -mode rtu -unit 3 -map meter.csv
+//
+// The screen shows a table of the devices, with the number of polls, the
+// failed polls, the latency of the last response and the average latency,
+// and the last error, and a table of the values of the tags. Changed values
+// are highlighted for two seconds and values that could not be read are shown
+// in red with their quality.
+//
+// The arrow keys, or j and k, select a tag and Enter, or e, edits the value
+// of a writable tag. Enter writes the value and Escape cancels. Bools may be
+// given as on and off and integers in hex with a 0x prefix. q quits.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/lineedit"
+)
+
+// Size of the screen if the size of the terminal is unknown.
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+func main() {
+	configFile := flag.String("config", "modbus-dashboard.yaml",
+		"Config file")
+	mapFile := flag.String("map", "",
+		"Register map of a single device, instead of the config file")
+	host := flag.String("host", "",
+		"TCP address host:port, or serial device, of the -map device")
+	mode := flag.String("mode", "tcp", "Mode of the -map device: "+
+		"tcp, rtu or ascii")
+	baud := flag.Uint("baud", 19200, "Baud rate of the -map device")
+	unit := flag.Uint("unit", 1, "Unit of the -map device")
+	interval := flag.Duration("interval", time.Second,
+		"Interval of the -map device")
+	flag.Parse()
+
+	var cfg *config
+	var err error
+	if len(*mapFile) > 0 {
+		if *unit > 0xFF {
+			log.Fatalf("Invalid unit: %v", *unit)
+		}
+		cfg, err = mapConfig(devconfig.Device{Host: *host, Mode: *mode,
+			Baud: *baud, Unit: byte(*unit), Interval: *interval,
+			Map: *mapFile})
+	} else {
+		cfg, err = loadConfig(*configFile)
+	}
+	if nil != err {
+		log.Fatal(err)
+	}
+
+	stdin, stdout := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !lineedit.IsTerminal(stdin) || !lineedit.IsTerminal(stdout) {
+		log.Fatal("The dashboard requires a terminal")
+	}
+	db, err := newDashboard(cfg)
+	if nil != err {
+		log.Fatal(err)
+	}
+	restore, err := lineedit.MakeRaw(stdin)
+	if nil != err {
+		db.close()
+		log.Fatal(err)
+	}
+	// Use the alternate screen, which restores the contents of the
+	// terminal on exit.
+	fmt.Print("\x1b[?1049h")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	err = db.run(ctx, lineedit.New(os.Stdin, os.Stdout, true), os.Stdout,
+		func() (int, int) {
+			width, height, err := lineedit.Size(stdout)
+			if nil != err || 0 == width || 0 == height {
+				return defaultWidth, defaultHeight
+			}
+			return width, height
+		})
+	stop()
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	restore()
+	if nil != err {
+		log.Fatal(err)
+	}
+}
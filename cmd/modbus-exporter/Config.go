@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+)
+
+// config is the configuration of the exporter, read from YAML or JSON.
+type config struct {
+	// Listen is the address of the HTTP server serving /metrics.
+	Listen  string            `yaml:"listen"`
+	Devices devconfig.Devices `yaml:"devices"`
+}
+
+// Init implements devconfig.Config.
+func (c *config) Init(dir string) error {
+	return c.Devices.Init(dir)
+}
+
+// loadConfig reads the config from filename.
+func loadConfig(filename string) (*config, error) {
+	cfg := &config{}
+	if err := devconfig.Load(filename, cfg); nil != err {
+		return nil, err
+	}
+	return cfg, nil
+}
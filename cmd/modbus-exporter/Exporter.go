@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+)
+
+// latencyBuckets are the upper bounds in seconds of the buckets of the
+// request latency histogram.
+var latencyBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5,
+}
+
+// exporter polls the configured devices and serves their values and the
+// communication health of their hosts in the Prometheus text format.
+type exporter struct {
+	devices []*device
+
+	mtx    sync.Mutex
+	values map[valueKey]float64
+	hosts  map[string]*hostMetrics
+}
+
+// device is a configured device and its Poller.
+type device struct {
+	devconfig.Device
+	ch     modbus.ClientHandle
+	poller *modbus.Poller
+}
+
+// valueKey are the labels of a value.
+type valueKey struct {
+	device string
+	unit   byte
+	tag    string
+}
+
+// hostMetrics are the request metrics of a host.
+type hostMetrics struct {
+	requests int
+	errors   map[string]int
+	buckets  []int
+	sum      float64
+}
+
+// newExporter opens the ClientHandles of the devices of cfg and returns the
+// exporter polling them.
+func newExporter(cfg *config) (*exporter, error) {
+	e := &exporter{
+		values: make(map[valueKey]float64),
+		hosts:  make(map[string]*hostMetrics),
+	}
+	for _, dc := range cfg.Devices {
+		d := &device{Device: dc}
+		var err error
+		if d.ch, err = modbus.GetClientHandle(
+			dc.ConnectionSettings()); nil != err {
+			e.close()
+			return nil, fmt.Errorf("Device %q: %v", dc.Name, err)
+		}
+		e.devices = append(e.devices, d)
+		d.poller = modbus.NewPoller(&instrumentedSender{
+			QuerySender: d.ch, host: dc.Host, e: e})
+		if err := d.poller.Add(dc.Poll()); nil != err {
+			e.close()
+			return nil, err
+		}
+		d.poller.OnSample(func(s modbus.Sample) { e.update(d, s) })
+	}
+	return e, nil
+}
+
+// run polls the devices until the ctx is done and then closes their
+// ClientHandles.
+func (e *exporter) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, d := range e.devices {
+		wg.Add(1)
+		go func(p *modbus.Poller) {
+			defer wg.Done()
+			p.Run(ctx)
+		}(d.poller)
+	}
+	wg.Wait()
+	e.close()
+}
+
+func (e *exporter) close() {
+	for _, d := range e.devices {
+		d.ch.Close()
+	}
+}
+
+// update records the value of the Sample of the device. Values that could not
+// be read are removed so that they are absent from the metrics rather than
+// outdated.
+func (e *exporter) update(d *device, s modbus.Sample) {
+	t, _ := d.TagMap.Tag(s.Tag)
+	key := valueKey{device: d.Name, unit: t.SlaveID, tag: s.Tag}
+	v, ok := gaugeValue(s.Value)
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !ok || modbus.QualityCommError == s.Quality {
+		delete(e.values, key)
+		return
+	}
+	e.values[key] = v
+}
+
+// gaugeValue returns the value of a Tag as a float64, if it is a number or a
+// bool.
+func gaugeValue(v interface{}) (float64, bool) {
+	if b, ok := v.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	return modbus.ToFloat64(v)
+}
+
+// instrumentedSender records the metrics of the Queries sent to a host.
+type instrumentedSender struct {
+	modbus.QuerySender
+	host string
+	e    *exporter
+}
+
+func (s *instrumentedSender) SendContext(ctx context.Context,
+	q modbus.Query) ([]byte, error) {
+	start := time.Now()
+	data, err := s.QuerySender.SendContext(ctx, q)
+	if nil == ctx.Err() {
+		s.e.observe(s.host, time.Since(start), err)
+	}
+	return data, err
+}
+
+// observe records a request to the host.
+func (e *exporter) observe(host string, latency time.Duration, err error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	m, ok := e.hosts[host]
+	if !ok {
+		m = &hostMetrics{
+			errors:  make(map[string]int),
+			buckets: make([]int, len(latencyBuckets)),
+		}
+		e.hosts[host] = m
+	}
+	m.requests++
+	seconds := latency.Seconds()
+	m.sum += seconds
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			m.buckets[i]++
+		}
+	}
+	if nil != err {
+		m.errors[errorLabel(err)]++
+	}
+}
+
+// errorLabel returns the exception label of a failed request.
+func errorLabel(err error) string {
+	if code, ok := modbus.ExceptionCode(err); ok {
+		return modbus.ExceptionNames[code]
+	}
+	if modbus.IsTimeout(err) {
+		return "timeout"
+	}
+	return "other"
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	e.writeMetrics(bw)
+	bw.Flush()
+}
+
+// writeMetrics writes the metrics sorted by their labels.
+func (e *exporter) writeMetrics(w io.Writer) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	keys := make([]valueKey, 0, len(e.values))
+	for k := range e.values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.device != b.device {
+			return a.device < b.device
+		}
+		if a.unit != b.unit {
+			return a.unit < b.unit
+		}
+		return a.tag < b.tag
+	})
+	writeHeader(w, "modbus_value", "gauge",
+		"Last value read from a register map tag.")
+	for _, k := range keys {
+		writeSample(w, "modbus_value", e.values[k], "device", k.device,
+			"unit", strconv.Itoa(int(k.unit)), "tag", k.tag)
+	}
+
+	hosts := make([]string, 0, len(e.hosts))
+	for host := range e.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	writeHeader(w, "modbus_requests_total", "counter",
+		"Modbus requests sent to a host.")
+	for _, host := range hosts {
+		writeSample(w, "modbus_requests_total",
+			float64(e.hosts[host].requests), "host", host)
+	}
+	writeHeader(w, "modbus_errors_total", "counter",
+		"Failed Modbus requests by exception.")
+	for _, host := range hosts {
+		m := e.hosts[host]
+		labels := make([]string, 0, len(m.errors))
+		for label := range m.errors {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			writeSample(w, "modbus_errors_total", float64(m.errors[label]),
+				"host", host, "exception", label)
+		}
+	}
+	writeHeader(w, "modbus_request_duration_seconds", "histogram",
+		"Latency of Modbus requests, including queuing.")
+	for _, host := range hosts {
+		m := e.hosts[host]
+		for i, le := range latencyBuckets {
+			writeSample(w, "modbus_request_duration_seconds_bucket",
+				float64(m.buckets[i]), "host", host,
+				"le", formatFloat(le))
+		}
+		writeSample(w, "modbus_request_duration_seconds_bucket",
+			float64(m.requests), "host", host, "le", "+Inf")
+		writeSample(w, "modbus_request_duration_seconds_sum", m.sum,
+			"host", host)
+		writeSample(w, "modbus_request_duration_seconds_count",
+			float64(m.requests), "host", host)
+	}
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, typ)
+}
+
+// writeSample writes a sample line with the labels given as name value
+// pairs.
+func writeSample(w io.Writer, name string, value float64, labels ...string) {
+	io.WriteString(w, name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		sep := ","
+		if 0 == i {
+			sep = "{"
+		}
+		fmt.Fprintf(w, "%v%v=\"%v\"", sep, labels[i],
+			labelEscaper.Replace(labels[i+1]))
+	}
+	if len(labels) > 0 {
+		io.WriteString(w, "}")
+	}
+	fmt.Fprintf(w, " %v\n", formatFloat(value))
+}
+
+// labelEscaper escapes label values in the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
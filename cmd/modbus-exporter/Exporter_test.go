@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamSLevy/modbus/modbustest"
+)
+
+const testConfig = `
+devices:
+  - name: boiler
+    host: %HOST%
+    unit: 1
+    interval: 10ms
+    map: boiler.csv
+    tags:
+      - {name: missing, table: hr, address: 5000}
+`
+
+const testMap = `name,table,address,type,scale
+temp,hr,10,int16,0.1
+pump,coil,3,,
+`
+
+func TestExporter(t *testing.T) {
+	s := modbustest.NewServer()
+	defer s.Close()
+	s.Units[1].HoldingRegisters[10] = 215
+	s.Units[1].Coils[3] = true
+
+	dir, err := ioutil.TempDir("", "modbus-exporter")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.yaml")
+	for name, data := range map[string]string{
+		configFile: strings.Replace(testConfig, "%HOST%", s.Addr(), 1),
+		filepath.Join(dir, "boiler.csv"): testMap,
+	} {
+		if err := ioutil.WriteFile(name, []byte(data), 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := loadConfig(configFile)
+	if nil != err {
+		t.Fatal(err)
+	}
+	e, err := newExporter(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	host := `host="` + s.Addr() + `"`
+	want := []string{
+		`modbus_value{device="boiler",unit="1",tag="pump"} 1`,
+		`modbus_value{device="boiler",unit="1",tag="temp"} 21.5`,
+		`modbus_requests_total{` + host + `} `,
+		`modbus_errors_total{` + host +
+			`,exception="illegal-data-address"} `,
+		`modbus_request_duration_seconds_bucket{` + host +
+			`,le="+Inf"} `,
+		`modbus_request_duration_seconds_count{` + host + `} `,
+	}
+	var metrics string
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		metrics = scrape(t, srv.URL)
+		if containsAll(metrics, want) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, line := range want {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("Metrics do not contain %q:\n%v", line, metrics)
+		}
+	}
+	if strings.Contains(metrics, `tag="missing"`) {
+		t.Errorf("Metrics contain the unreadable Tag:\n%v", metrics)
+	}
+}
+
+func scrape(t *testing.T, url string) string {
+	res, err := http.Get(url)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func containsAll(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriteSample(t *testing.T) {
+	var b strings.Builder
+	writeSample(&b, "m", 0.5, "a", `x"y\z`)
+	if want := `m{a="x\"y\\z"} 0.5` + "\n"; b.String() != want {
+		t.Errorf("want: %q got: %q", want, b.String())
+	}
+}
@@ -0,0 +1,82 @@
+// Command modbus-exporter polls Modbus devices using register maps and serves
+// their values and the communication health of their hosts as Prometheus
+// metrics on /metrics.
+//
+// The config file is YAML or JSON:
+//
+//	listen: ":9502"
+//	devices:
+//	  - name: boiler
+//	    host: 192.168.1.10:502
+//	    unit: 1
+//	    interval: 5s
+//	    map: boiler.csv
+//	  - name: meter
+//	    host: /dev/ttyUSB0
+//	    mode: rtu
+//	    baud: 19200
+//	    tags:
+//	      - {name: power, unit: 3, table: ir, address: 0, type: float32}
+//
+// Devices with the same host share one connection. The values are exported as
+// the gauge modbus_value with the labels device, unit and tag. Tags that
+// cannot be read are absent until they are read again.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const defaultListen = ":9502"
+
+func main() {
+	configFile := flag.String("config", "modbus-exporter.yaml",
+		"Config file")
+	listen := flag.String("listen", "",
+		"HTTP listen address, overrides the config (default "+
+			defaultListen+")")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configFile)
+	if nil != err {
+		log.Fatal(err)
+	}
+	if len(*listen) > 0 {
+		cfg.Listen = *listen
+	}
+	if len(cfg.Listen) == 0 {
+		cfg.Listen = defaultListen
+	}
+
+	e, err := newExporter(cfg)
+	if nil != err {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		e.run(ctx)
+		close(done)
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	srv := &http.Server{Addr: cfg.Listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Printf("Serving metrics on %v/metrics", cfg.Listen)
+	if err := srv.ListenAndServe(); http.ErrServerClosed != err {
+		log.Fatal(err)
+	}
+	<-done
+}
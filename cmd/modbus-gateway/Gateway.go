@@ -0,0 +1,685 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/jsonvalue"
+	"github.com/AdamSLevy/modbus/internal/websocket"
+)
+
+// maxBodySize limits the size of the body of write requests.
+const maxBodySize = 1 << 20
+
+// exceptionStatus maps ExceptionNames to the HTTP status codes of requests
+// failing with the exception. All other exceptions, and errors in the
+// response, are 502 Bad Gateway.
+var exceptionStatus = map[string]int{
+	"illegal-function":           http.StatusNotImplemented,
+	"illegal-data-address":       http.StatusNotFound,
+	"illegal-data-value":         http.StatusUnprocessableEntity,
+	"acknowledge":                http.StatusAccepted,
+	"slave-device-busy":          http.StatusServiceUnavailable,
+	"gateway-target-no-response": http.StatusGatewayTimeout,
+}
+
+// gateway serves reads and writes of the configured devices over HTTP, and
+// streams their values to WebSocket clients.
+type gateway struct {
+	devices []*device
+	byName  map[string]*device
+
+	mtx     sync.Mutex
+	clients map[*streamClient]bool
+	closed  bool
+}
+
+// device is a configured device, its ClientHandle and its stream.
+type device struct {
+	*devconfig.Device
+	ch     modbus.ClientHandle
+	stream *stream
+}
+
+// deviceInfo describes a device.
+type deviceInfo struct {
+	Name string       `json:"name"`
+	Host string       `json:"host"`
+	Mode string       `json:"mode"`
+	Unit byte         `json:"unit"`
+	Tags []modbus.Tag `json:"tags,omitempty"`
+}
+
+// tagValue is the value of a Tag.
+type tagValue struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+	Units string      `json:"units,omitempty"`
+}
+
+// tagValues are the values of several Tags. If some of them could not be
+// read, they are missing and Error is the first error.
+type tagValues struct {
+	Values map[string]interface{} `json:"values"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// rangeValues are the values read from, or written to, consecutive
+// addresses.
+type rangeValues struct {
+	Unit    byte            `json:"unit"`
+	Table   modbus.Table    `json:"table"`
+	Address uint16          `json:"address"`
+	Type    modbus.DataType `json:"type"`
+	Values  []interface{}   `json:"values"`
+}
+
+// writeRequest is the body of a write request. It is an object with either a
+// value or a list of values, or else the bare value or list.
+type writeRequest struct {
+	Value  json.RawMessage   `json:"value"`
+	Values []json.RawMessage `json:"values"`
+}
+
+// errorResponse is the body of a failed request. Exception is the name of
+// the Modbus exception, if any.
+type errorResponse struct {
+	Error     string `json:"error"`
+	Exception string `json:"exception,omitempty"`
+}
+
+// httpError is an error of a request that is not caused by the device.
+type httpError struct {
+	status int
+	err    error
+	// allow lists the allowed methods of a 405 Method Not Allowed error.
+	allow []string
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+// errorf returns an httpError with the status.
+func errorf(status int, format string, a ...interface{}) error {
+	return &httpError{status: status, err: fmt.Errorf(format, a...)}
+}
+
+// badRequest returns err as a 400 Bad Request httpError.
+func badRequest(err error) error {
+	return &httpError{status: http.StatusBadRequest, err: err}
+}
+
+// newGateway opens the ClientHandles of the devices of cfg and returns the
+// gateway.
+func newGateway(cfg *config) (*gateway, error) {
+	g := &gateway{
+		byName:  make(map[string]*device),
+		clients: make(map[*streamClient]bool),
+	}
+	for i := range cfg.Devices {
+		d := &device{Device: &cfg.Devices[i]}
+		var err error
+		if d.ch, err = modbus.GetClientHandle(
+			d.ConnectionSettings()); nil != err {
+			g.close()
+			return nil, fmt.Errorf("Device %q: %v", d.Name, err)
+		}
+		d.stream = newStream(d)
+		g.devices = append(g.devices, d)
+		g.byName[d.Name] = d
+	}
+	return g, nil
+}
+
+// run runs the Pollers of the streams until the ctx is done and then
+// disconnects the stream clients.
+func (g *gateway) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(len(g.devices))
+	for _, d := range g.devices {
+		go func(p *modbus.Poller) {
+			defer wg.Done()
+			p.Run(ctx)
+		}(d.stream.poller)
+	}
+	<-ctx.Done()
+	g.mtx.Lock()
+	g.closed = true
+	for c := range g.clients {
+		c.close()
+	}
+	g.mtx.Unlock()
+	wg.Wait()
+}
+
+func (g *gateway) close() {
+	for _, d := range g.devices {
+		d.ch.Close()
+	}
+}
+
+// ServeHTTP serves the request and responds with JSON, or upgrades requests
+// for /stream to WebSocket connections.
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if "/stream" == r.URL.Path {
+		g.serveStream(w, r)
+		return
+	}
+	v, err := g.handle(r)
+	if nil != err {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// serveStream serves a stream client until it disconnects.
+func (g *gateway) serveStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if nil != err {
+		return
+	}
+	c := &streamClient{
+		g:             g,
+		conn:          conn,
+		out:           make(chan interface{}, clientBuffer),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]*subscription),
+	}
+	g.mtx.Lock()
+	if g.closed {
+		g.mtx.Unlock()
+		conn.Close()
+		return
+	}
+	g.clients[c] = true
+	g.mtx.Unlock()
+	c.serve()
+	g.mtx.Lock()
+	delete(g.clients, c)
+	g.mtx.Unlock()
+}
+
+// handle routes the request and returns the value of the response.
+func (g *gateway) handle(r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if "devices" != path[0] {
+		return nil, errorf(http.StatusNotFound, "Not found: %v",
+			r.URL.Path)
+	}
+	if len(path) == 1 {
+		if err := allow(r, http.MethodGet); nil != err {
+			return nil, err
+		}
+		infos := make([]deviceInfo, len(g.devices))
+		for i, d := range g.devices {
+			infos[i] = d.info(false)
+		}
+		return infos, nil
+	}
+	d, ok := g.byName[path[1]]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "Unknown device: %q",
+			path[1])
+	}
+	switch {
+	case len(path) == 2:
+		if err := allow(r, http.MethodGet); nil != err {
+			return nil, err
+		}
+		return d.info(true), nil
+	case len(path) == 3 && "tags" == path[2]:
+		if err := allow(r, http.MethodGet); nil != err {
+			return nil, err
+		}
+		return d.readTags(ctx, r.URL.Query()["name"])
+	case len(path) == 4 && "tags" == path[2]:
+		if err := allow(r, http.MethodGet, http.MethodPut,
+			http.MethodPost); nil != err {
+			return nil, err
+		}
+		if http.MethodGet == r.Method {
+			return d.readTag(ctx, path[3])
+		}
+		return d.writeTag(ctx, path[3], r.Body)
+	case len(path) == 4:
+		if err := allow(r, http.MethodGet, http.MethodPut,
+			http.MethodPost); nil != err {
+			return nil, err
+		}
+		if http.MethodGet == r.Method {
+			return d.readRange(ctx, path[2], path[3], r.URL.Query())
+		}
+		return d.writeRange(ctx, path[2], path[3], r.URL.Query(), r.Body)
+	}
+	return nil, errorf(http.StatusNotFound, "Not found: %v", r.URL.Path)
+}
+
+// allow returns a 405 Method Not Allowed httpError if the method of r is not
+// one of the methods.
+func allow(r *http.Request, methods ...string) error {
+	for _, m := range methods {
+		if m == r.Method {
+			return nil
+		}
+	}
+	return &httpError{status: http.StatusMethodNotAllowed,
+		err:   fmt.Errorf("Method %v not allowed", r.Method),
+		allow: methods}
+}
+
+// info returns the description of the device, with its Tags if tags is
+// true.
+func (d *device) info(tags bool) deviceInfo {
+	info := deviceInfo{Name: d.Name, Host: d.Host, Mode: d.Mode,
+		Unit: d.Unit}
+	if tags {
+		info.Tags = d.TagMap.Tags()
+	}
+	return info
+}
+
+// tag returns the named Tag of the device if it has the access.
+func (d *device) tag(name string, access modbus.Access) (modbus.Tag, error) {
+	t, ok := d.TagMap.Tag(name)
+	if !ok {
+		return t, errorf(http.StatusNotFound, "Unknown Tag: %q", name)
+	}
+	if t.Access&access == 0 {
+		op := "readable"
+		if modbus.AccessWrite == access {
+			op = "writable"
+		}
+		return t, errorf(http.StatusForbidden, "Tag %q is not %v", name,
+			op)
+	}
+	return t, nil
+}
+
+// readTag reads the named Tag.
+func (d *device) readTag(ctx context.Context, name string) (tagValue, error) {
+	t, err := d.tag(name, modbus.AccessRead)
+	if nil != err {
+		return tagValue{}, err
+	}
+	q, err := t.ReadQuery()
+	if nil != err {
+		return tagValue{}, err
+	}
+	data, err := d.ch.SendContext(ctx, q)
+	if nil != err {
+		return tagValue{}, err
+	}
+	v, err := t.Decode(data)
+	if nil != err {
+		return tagValue{}, err
+	}
+	return tagValue{Name: t.Name, Value: jsonValue(v), Units: t.Units}, nil
+}
+
+// readTags reads the named Tags, or all readable Tags if there are no names,
+// with as few Queries as possible.
+func (d *device) readTags(ctx context.Context,
+	names []string) (tagValues, error) {
+	for _, name := range names {
+		if _, err := d.tag(name, modbus.AccessRead); nil != err {
+			return tagValues{}, err
+		}
+	}
+	res := tagValues{Values: make(map[string]interface{})}
+	if len(d.ReadableTags()) == 0 {
+		return res, nil
+	}
+	values, err := d.TagMap.ReadTags(ctx, d.ch,
+		modbus.Planner{MaxGap: d.MaxGap}, names...)
+	if nil != err && len(values) == 0 {
+		return tagValues{}, err
+	}
+	for name, v := range values {
+		res.Values[name] = jsonValue(v)
+	}
+	if nil != err {
+		res.Error = err.Error()
+	}
+	return res, nil
+}
+
+// writeTag writes the value in the body to the named Tag.
+func (d *device) writeTag(ctx context.Context, name string,
+	body io.Reader) (tagValue, error) {
+	t, err := d.tag(name, modbus.AccessWrite)
+	if nil != err {
+		return tagValue{}, err
+	}
+	req, err := readWriteRequest(body)
+	if nil != err {
+		return tagValue{}, err
+	}
+	if len(req.Values) > 0 {
+		return tagValue{}, badRequest(fmt.Errorf(
+			"Tag %q takes a single value", name))
+	}
+	v, err := jsonvalue.Parse(t, req.Value)
+	if nil != err {
+		return tagValue{}, badRequest(err)
+	}
+	q, err := t.WriteQuery(v)
+	if nil != err {
+		return tagValue{}, badRequest(err)
+	}
+	if _, err := d.ch.SendContext(ctx, q); nil != err {
+		return tagValue{}, err
+	}
+	return tagValue{Name: t.Name, Value: v, Units: t.Units}, nil
+}
+
+// rangeTag returns the Tag describing the first value at the address of the
+// table, decoded according to the params.
+func (d *device) rangeTag(table, address string,
+	params url.Values) (modbus.Tag, error) {
+	t := modbus.Tag{Name: table + "/" + address, SlaveID: d.Unit}
+	if err := t.Table.UnmarshalText([]byte(table)); nil != err {
+		return t, errorf(http.StatusNotFound, "Unknown table: %q", table)
+	}
+	a, err := strconv.ParseUint(address, 10, 16)
+	if nil != err {
+		return t, badRequest(fmt.Errorf("Invalid address: %q", address))
+	}
+	t.Address = uint16(a)
+	for name := range params {
+		p := params.Get(name)
+		var err error
+		switch name {
+		case "unit":
+			var unit uint64
+			unit, err = strconv.ParseUint(p, 10, 8)
+			t.SlaveID = byte(unit)
+		case "type":
+			err = t.Type.UnmarshalText([]byte(p))
+		case "order":
+			err = t.ByteOrder.UnmarshalText([]byte(p))
+		case "length":
+			var length uint64
+			length, err = strconv.ParseUint(p, 10, 16)
+			t.Length = uint16(length)
+		case "scale":
+			t.Scale, err = strconv.ParseFloat(p, 64)
+		case "offset":
+			t.Offset, err = strconv.ParseFloat(p, 64)
+		default:
+			err = fmt.Errorf("Unknown parameter")
+		}
+		if nil != err {
+			return t, badRequest(fmt.Errorf("Parameter %v: %v", name,
+				err))
+		}
+	}
+	if err := t.Normalize(); nil != err {
+		return t, badRequest(err)
+	}
+	return t, nil
+}
+
+// valuesRange returns the Range of count consecutive values of the Tag.
+func valuesRange(t modbus.Tag, count int) (modbus.Range, error) {
+	r := t.Range()
+	n := count * int(t.Quantity())
+	if n > 0xFFFF || int(r.Address)+n > 0x10000 {
+		return r, badRequest(fmt.Errorf(
+			"%v values exceed the end of the table", count))
+	}
+	r.Quantity = uint16(n)
+	return r, nil
+}
+
+// readRangeTag returns the rangeTag of the params and the Range of the count
+// of values given by the params.
+func (d *device) readRangeTag(table, address string,
+	params url.Values) (modbus.Tag, modbus.Range, error) {
+	count := 1
+	if p := params.Get("count"); len(p) > 0 {
+		var err error
+		if count, err = strconv.Atoi(p); nil != err || count < 1 {
+			return modbus.Tag{}, modbus.Range{}, badRequest(fmt.Errorf(
+				"Invalid count: %q", p))
+		}
+		params.Del("count")
+	}
+	t, err := d.rangeTag(table, address, params)
+	if nil != err {
+		return t, modbus.Range{}, err
+	}
+	r, err := valuesRange(t, count)
+	return t, r, err
+}
+
+// readRange reads consecutive values starting at the address of the table.
+// The params are those of rangeTag and the count of values.
+func (d *device) readRange(ctx context.Context, table, address string,
+	params url.Values) (rangeValues, error) {
+	t, r, err := d.readRangeTag(table, address, params)
+	if nil != err {
+		return rangeValues{}, err
+	}
+	data, err := modbus.ReadRange(ctx, d.ch, r, modbus.TransferOptions{})
+	if nil != err {
+		return rangeValues{}, err
+	}
+	values, err := decodeValues(t, r, data)
+	if nil != err {
+		return rangeValues{}, err
+	}
+	return rangeValues{Unit: t.SlaveID, Table: t.Table, Address: t.Address,
+		Type: t.Type, Values: values}, nil
+}
+
+// decodeValues decodes the data of the Range r of consecutive values like
+// the Tag t.
+func decodeValues(t modbus.Tag, r modbus.Range,
+	data []byte) ([]interface{}, error) {
+	values := make([]interface{}, r.Quantity/t.Quantity())
+	if t.Table.IsBits() {
+		bits, err := modbus.DecodeCoils(data, r.Quantity)
+		if nil != err {
+			return nil, err
+		}
+		for i, b := range bits {
+			values[i] = b
+		}
+		return values, nil
+	}
+	size := 2 * int(t.Quantity())
+	if len(data) != size*len(values) {
+		return nil, fmt.Errorf("Expected %v bytes but got %v",
+			size*len(values), len(data))
+	}
+	for i := range values {
+		v, err := t.Decode(data[i*size : (i+1)*size])
+		if nil != err {
+			return nil, err
+		}
+		values[i] = jsonValue(v)
+	}
+	return values, nil
+}
+
+// writeRange writes the values in the body to consecutive addresses starting
+// at the address of the table. The params are those of rangeTag. A single
+// value is written with the Tag's WriteQuery, so that devices without
+// support for the write multiple functions can be written.
+func (d *device) writeRange(ctx context.Context, table, address string,
+	params url.Values, body io.Reader) (rangeValues, error) {
+	t, err := d.rangeTag(table, address, params)
+	if nil != err {
+		return rangeValues{}, err
+	}
+	if !t.Table.Writable() {
+		return rangeValues{}, errorf(http.StatusForbidden,
+			"Table %v is not writable", t.Table)
+	}
+	req, err := readWriteRequest(body)
+	if nil != err {
+		return rangeValues{}, err
+	}
+	raw := req.Values
+	if len(req.Value) > 0 {
+		if len(raw) > 0 {
+			return rangeValues{}, badRequest(fmt.Errorf(
+				"Both value and values given"))
+		}
+		raw = []json.RawMessage{req.Value}
+	}
+	if len(raw) == 0 {
+		return rangeValues{}, badRequest(fmt.Errorf("Missing value"))
+	}
+	r, err := valuesRange(t, len(raw))
+	if nil != err {
+		return rangeValues{}, err
+	}
+	values := make([]interface{}, len(raw))
+	for i := range raw {
+		if values[i], err = jsonvalue.Parse(t, raw[i]); nil != err {
+			return rangeValues{}, badRequest(fmt.Errorf("Value %v: %v",
+				i, err))
+		}
+	}
+
+	if len(values) == 1 {
+		q, err := t.WriteQuery(values[0])
+		if nil != err {
+			return rangeValues{}, badRequest(err)
+		}
+		if _, err := d.ch.SendContext(ctx, q); nil != err {
+			return rangeValues{}, err
+		}
+	} else {
+		data, err := encodeValues(t, values)
+		if nil != err {
+			return rangeValues{}, badRequest(err)
+		}
+		if err := modbus.WriteRange(ctx, d.ch, r, data,
+			modbus.TransferOptions{}); nil != err {
+			return rangeValues{}, err
+		}
+	}
+	return rangeValues{Unit: t.SlaveID, Table: t.Table, Address: t.Address,
+		Type: t.Type, Values: values}, nil
+}
+
+// encodeValues returns the values of consecutive Tags like t in the data
+// format of WriteRange.
+func encodeValues(t modbus.Tag, values []interface{}) ([]byte, error) {
+	if t.Table.IsBits() {
+		data := make([]byte, (len(values)+7)/8)
+		for i, v := range values {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf(
+					"Value %v: Expected bool but got %T", i, v)
+			}
+			if b {
+				data[i/8] |= 1 << uint(i%8)
+			}
+		}
+		return data, nil
+	}
+	var data []byte
+	for i, v := range values {
+		regs, err := t.Encode(v)
+		if nil != err {
+			return nil, fmt.Errorf("Value %v: %v", i, err)
+		}
+		for _, reg := range regs {
+			data = append(data, byte(reg>>8), byte(reg))
+		}
+	}
+	return data, nil
+}
+
+// readWriteRequest reads the writeRequest from the body.
+func readWriteRequest(body io.Reader) (writeRequest, error) {
+	var req writeRequest
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize))
+	if nil != err {
+		return req, badRequest(err)
+	}
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		err = fmt.Errorf("Missing value")
+	case '{' == data[0]:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&req)
+	case '[' == data[0]:
+		err = json.Unmarshal(data, &req.Values)
+	default:
+		req.Value = data
+	}
+	if nil != err {
+		return req, badRequest(err)
+	}
+	return req, nil
+}
+
+// jsonValue returns v, or nil if v is a NaN or infinite float, which cannot
+// be represented in JSON.
+func jsonValue(v interface{}) interface{} {
+	if !jsonvalue.IsFinite(v) {
+		return nil
+	}
+	return v
+}
+
+// statusCode returns the HTTP status code of a request that failed with the
+// err.
+func statusCode(err error) int {
+	var hErr *httpError
+	if errors.As(err, &hErr) {
+		return hErr.status
+	}
+	if code, ok := modbus.ExceptionCode(err); ok {
+		if status, ok := exceptionStatus[modbus.ExceptionNames[code]]; ok {
+			return status
+		}
+		return http.StatusBadGateway
+	}
+	if modbus.IsTimeout(err) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// writeError responds with the errorResponse of the err.
+func writeError(w http.ResponseWriter, err error) {
+	res := errorResponse{Error: err.Error()}
+	if code, ok := modbus.ExceptionCode(err); ok {
+		res.Exception = modbus.ExceptionNames[code]
+	}
+	var hErr *httpError
+	if errors.As(err, &hErr) && len(hErr.allow) > 0 {
+		w.Header().Set("Allow", strings.Join(hErr.allow, ", "))
+	}
+	writeJSON(w, statusCode(err), res)
+}
+
+// writeJSON responds with the status and v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
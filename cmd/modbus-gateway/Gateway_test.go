@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/modbustest"
+)
+
+const testConfig = `
+devices:
+  - name: boiler
+    host: %HOST%
+    unit: 1
+    timeout: 100ms
+    tags:
+      - {name: temp, table: ir, address: 10, type: int16, scale: 0.1,
+         units: degC}
+      - {name: setpoint, table: hr, address: 20, type: int16, scale: 0.1}
+      - {name: mode, table: hr, address: 21}
+      - {name: pump, table: coil, address: 3}
+      - {name: alarm, table: hr, address: 22, access: w}
+  - name: plc
+    host: %HOST%
+    timeout: 100ms
+`
+
+func TestGateway(t *testing.T) {
+	s := modbustest.NewServer()
+	defer s.Close()
+	u := s.Units[1]
+	u.InputRegisters[10] = 215
+	copy(u.HoldingRegisters[100:], modbus.EncodeFloat32(modbus.ByteOrderCDAB,
+		1.5, -2))
+	u.Coils[5] = true
+	u.Disabled = map[modbus.FunctionCode]bool{
+		modbus.FunctionReadDiscreteInputs: true}
+
+	cfg := &config{}
+	if err := devconfig.Read(strings.NewReader(strings.Replace(testConfig,
+		"%HOST%", s.Addr(), -1)), ".", cfg); nil != err {
+		t.Fatal(err)
+	}
+	g, err := newGateway(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer g.close()
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+		want               string
+	}{
+		{"GET", "/devices", "", 200, `[{"name":"boiler",`},
+		{"GET", "/devices/boiler", "", 200, `"tags":[{"name":"temp",`},
+		{"GET", "/devices/boiler/tags/temp", "", 200,
+			`{"name":"temp","value":21.5,"units":"degC"}`},
+		{"PUT", "/devices/boiler/tags/setpoint", `30.5`, 200,
+			`{"name":"setpoint","value":30.5}`},
+		{"POST", "/devices/boiler/tags/mode", `{"value": 3}`, 200,
+			`{"name":"mode","value":3}`},
+		{"PUT", "/devices/boiler/tags/pump", `true`, 200, `"value":true`},
+		{"GET", "/devices/boiler/tags?name=setpoint&name=mode", "", 200,
+			`{"values":{"mode":3,"setpoint":30.5}}`},
+		{"GET", "/devices/boiler/tags", "", 200, `"pump":true`},
+		{"PUT", "/devices/boiler/tags/mode", `3.5`, 400, `integer`},
+		{"PUT", "/devices/boiler/tags/mode", `[1, 2]`, 400, `single value`},
+		{"PUT", "/devices/boiler/tags/temp", `20`, 403, `not writable`},
+		{"GET", "/devices/boiler/tags/alarm", "", 403, `not readable`},
+		{"GET", "/devices/boiler/tags/missing", "", 404, `Unknown Tag`},
+		{"DELETE", "/devices/boiler/tags/mode", "", 405, `not allowed`},
+		{"GET", "/devices/missing", "", 404, `Unknown device`},
+		{"GET", "/other", "", 404, `Not found`},
+
+		{"GET", "/devices/plc/hr/100?count=2&type=float32&order=CDAB&unit=1",
+			"", 200, `"type":"float32","values":[1.5,-2]`},
+		{"GET", "/devices/plc/ir/10?unit=1&scale=0.1", "", 200,
+			`"values":[21.5]`},
+		{"GET", "/devices/plc/coil/3?unit=1&count=3", "", 200,
+			`{"unit":1,"table":"coil","address":3,"type":"bool",` +
+				`"values":[true,false,true]}`},
+		{"PUT", "/devices/plc/hr/200?unit=1&type=int32",
+			`{"values": [-1, 70000]}`, 200, `"values":[-1,70000]`},
+		{"PUT", "/devices/plc/coil/10?unit=1", `[true, false, true]`, 200,
+			`"values":[true,false,true]`},
+		{"PUT", "/devices/plc/hr/300?unit=1", `7`, 200, `"values":[7]`},
+		{"PUT", "/devices/plc/ir/0?unit=1", `7`, 403, `not writable`},
+		{"PUT", "/devices/plc/hr/0?unit=1", `{"value": 1, "values": [2]}`,
+			400, `Both`},
+		{"PUT", "/devices/plc/hr/0?unit=1", `{"bogus": 1}`, 400, `bogus`},
+		{"PUT", "/devices/plc/coil/0?unit=1", `[true, 1]`, 400, `bool`},
+		{"GET", "/devices/plc/hr/0?unit=1&type=float", "", 400, `type`},
+		{"GET", "/devices/plc/hr/0?unit=1&bogus=1", "", 400, `bogus`},
+		{"GET", "/devices/plc/hr/65535?unit=1&count=2", "", 400, `exceed`},
+		{"GET", "/devices/plc/hr/x?unit=1", "", 400, `Invalid address`},
+		{"GET", "/devices/plc/xx/0", "", 404, `Unknown table`},
+		{"GET", "/devices/plc/hr/999?unit=1&count=2", "", 404,
+			`"exception":"illegal-data-address"`},
+		{"GET", "/devices/plc/di/0?unit=1", "", 501,
+			`"exception":"illegal-function"`},
+		{"GET", "/devices/plc/hr/0?unit=2", "", 504, `"error"`},
+	} {
+		req, err := http.NewRequest(test.method, srv.URL+test.path,
+			strings.NewReader(test.body))
+		if nil != err {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if nil != err {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if test.status != res.StatusCode ||
+			!strings.Contains(string(body), test.want) {
+			t.Errorf("%v %v: want: %v %v got: %v %s", test.method,
+				test.path, test.status, test.want, res.StatusCode,
+				body)
+		}
+		if "application/json" != res.Header.Get("Content-Type") {
+			t.Errorf("%v %v: Content-Type: %v", test.method, test.path,
+				res.Header.Get("Content-Type"))
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if r := u.HoldingRegisters; 305 != r[20] || 3 != r[21] || 7 != r[300] ||
+		0xFFFF != r[200] || 0xFFFF != r[201] || 1 != r[202] ||
+		0x1170 != r[203] {
+		t.Errorf("Unexpected registers: %v %v %v", r[20:22], r[200:204],
+			r[300])
+	}
+	if !u.Coils[3] || !u.Coils[10] || u.Coils[11] || !u.Coils[12] {
+		t.Errorf("Unexpected coils: %v", u.Coils[:13])
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/websocket"
+)
+
+// tagsPoll is the name of the Poll of the subscribed Tags of a device.
+const tagsPoll = "tags"
+
+// clientBuffer is the number of messages queued for a stream client. Clients
+// that fall further behind are disconnected.
+const clientBuffer = 256
+
+// streamRequest is a message from a stream client. Subscribe requests
+// subscribe to the Tags, and to the range, of the Device. Range has the form
+// of the path and parameters of a read by address, e.g. "hr/100?count=2". The
+// ID of the request identifies the subscription and unsubscribe requests
+// cancel the subscription with their ID.
+type streamRequest struct {
+	ID     string   `json:"id"`
+	Op     string   `json:"op"`
+	Device string   `json:"device"`
+	Tags   []string `json:"tags"`
+	Range  string   `json:"range"`
+}
+
+// streamReply is the reply to a streamRequest.
+type streamReply struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// updateMessage is a changed value of a Tag, or the changed values of a
+// range, of a subscription.
+type updateMessage struct {
+	Subscription string         `json:"subscription"`
+	Device       string         `json:"device"`
+	Tag          string         `json:"tag,omitempty"`
+	Range        string         `json:"range,omitempty"`
+	Value        interface{}    `json:"value"`
+	Units        string         `json:"units,omitempty"`
+	Quality      modbus.Quality `json:"quality"`
+	Time         time.Time      `json:"time"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// stream polls the points that the stream clients of a device subscribe to
+// with one Poller, which is shared by all clients. The subscribed Tags are
+// read by a single Poll and each subscribed range by a Poll of its own, so
+// that a point watched by many clients is read only once per Interval.
+type stream struct {
+	d      *device
+	poller *modbus.Poller
+	filter *modbus.ChangeFilter
+
+	mtx    sync.Mutex
+	points map[string]*point
+}
+
+// point is a Tag or a range that is subscribed to by at least one
+// subscription.
+type point struct {
+	// key identifies the point. It is "tag:" and the name of a Tag, or
+	// the name of the Poll of a range.
+	key string
+	tag modbus.Tag
+	// rng is the Range of a range, which holds values like the tag, and
+	// query reads it. Both are empty for a Tag.
+	rng   modbus.Range
+	query modbus.Query
+	// subs maps the subscriptions to the range as they requested it.
+	subs map[*subscription]string
+	last *updateMessage
+}
+
+// subscription is a subscription of a stream client.
+type subscription struct {
+	id     string
+	c      *streamClient
+	s      *stream
+	points []*point
+}
+
+// newStream returns the stream of the device.
+func newStream(d *device) *stream {
+	s := &stream{
+		d:      d,
+		poller: modbus.NewPoller(d.ch),
+		filter: &modbus.ChangeFilter{},
+		points: make(map[string]*point),
+	}
+	s.poller.OnChange(s.filter, s.publish)
+	return s
+}
+
+// newPoint returns the point of the named Tag, or of the range if name is
+// empty. The range is relative to the stream, e.g. "hr/100?count=2".
+func (s *stream) newPoint(name, rng string) (*point, error) {
+	if len(name) > 0 {
+		t, err := s.d.tag(name, modbus.AccessRead)
+		if nil != err {
+			return nil, err
+		}
+		return &point{key: "tag:" + t.Name, tag: t}, nil
+	}
+	u, err := url.Parse(rng)
+	if nil != err {
+		return nil, fmt.Errorf("Invalid range: %q", rng)
+	}
+	path := strings.Split(u.Path, "/")
+	if len(path) != 2 {
+		return nil, fmt.Errorf("Invalid range: %q", rng)
+	}
+	t, r, err := s.d.readRangeTag(path[0], path[1], u.Query())
+	if nil != err {
+		return nil, err
+	}
+	if max := t.Table.MaxQuantity(); r.Quantity > max {
+		return nil, fmt.Errorf("Subscribed ranges are limited to %v "+
+			"addresses", max)
+	}
+	q, err := t.Table.ReadQuery(r.SlaveID, r.Address, r.Quantity)
+	if nil != err {
+		return nil, err
+	}
+	// Ranges of the same values share a point, however they are written.
+	key := fmt.Sprintf("range:%v/%v/%v/%v?type=%v&order=%v&length=%v"+
+		"&scale=%v&offset=%v", r.SlaveID, r.Table, r.Address, r.Quantity,
+		t.Type, t.ByteOrder, t.Length, t.Scale, t.Offset)
+	return &point{key: key, tag: t, rng: r, query: q}, nil
+}
+
+// subscribe adds the points, with the ranges as requested, to the
+// subscription, which receives their last values right away. The Polls of new
+// points are added to the Poller.
+func (s *stream) subscribe(sub *subscription, points []*point,
+	ranges []string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var replan bool
+	for i, p := range points {
+		if existing, ok := s.points[p.key]; ok {
+			p = existing
+		} else {
+			s.points[p.key] = p
+			p.subs = make(map[*subscription]string)
+			if 0 == p.rng.Quantity {
+				s.filter.Reset(tagsPoll, p.tag.Name)
+				replan = true
+			} else {
+				s.filter.Reset(p.key, "")
+				if err := s.poller.Add(modbus.Poll{Name: p.key,
+					Interval: s.d.Interval,
+					Query:    p.query}); nil != err {
+					log.Printf("Device %q: %v", s.d.Name, err)
+				}
+			}
+		}
+		p.subs[sub] = ranges[i]
+		sub.points = append(sub.points, p)
+		if nil != p.last {
+			sub.c.send(p.update(sub))
+		}
+	}
+	if replan {
+		s.replanTags()
+	}
+}
+
+// unsubscribe removes the points of the subscription. The Polls of points
+// without subscriptions are removed from the Poller.
+func (s *stream) unsubscribe(sub *subscription) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var replan bool
+	for _, p := range sub.points {
+		delete(p.subs, sub)
+		if len(p.subs) > 0 {
+			continue
+		}
+		delete(s.points, p.key)
+		if 0 == p.rng.Quantity {
+			replan = true
+		} else {
+			s.poller.Remove(p.key)
+		}
+	}
+	sub.points = nil
+	if replan {
+		s.replanTags()
+	}
+}
+
+// replanTags replaces the Poll of the subscribed Tags. It must be called
+// with the mtx locked.
+func (s *stream) replanTags() {
+	var tags []modbus.Tag
+	for _, p := range s.points {
+		if 0 == p.rng.Quantity {
+			tags = append(tags, p.tag)
+		}
+	}
+	s.poller.Remove(tagsPoll)
+	if len(tags) == 0 {
+		return
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	if err := s.poller.Add(modbus.Poll{Name: tagsPoll,
+		Interval: s.d.Interval, Tags: tags,
+		Planner: modbus.Planner{MaxGap: s.d.MaxGap}}); nil != err {
+		log.Printf("Device %q: %v", s.d.Name, err)
+	}
+}
+
+// publish sends the ChangeEvent to the subscriptions of its point.
+func (s *stream) publish(e modbus.ChangeEvent) {
+	key := e.Poll
+	if len(e.Tag) > 0 {
+		key = "tag:" + e.Tag
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	p, ok := s.points[key]
+	if !ok {
+		// The point was unsubscribed while it was read.
+		return
+	}
+	msg := updateMessage{
+		Device:  s.d.Name,
+		Quality: e.Quality,
+		Time:    e.Time,
+	}
+	if nil != e.Err {
+		msg.Error = e.Err.Error()
+	}
+	if 0 == p.rng.Quantity {
+		msg.Tag = p.tag.Name
+		msg.Units = p.tag.Units
+		msg.Value = jsonValue(e.Value)
+	} else if nil != e.Data {
+		values, err := decodeValues(p.tag, p.rng, e.Data)
+		if nil != err {
+			msg.Error = err.Error()
+		}
+		msg.Value = values
+	}
+	p.last = &msg
+	for sub := range p.subs {
+		sub.c.send(p.update(sub))
+	}
+}
+
+// update returns the last update of the point for the subscription.
+func (p *point) update(sub *subscription) updateMessage {
+	msg := *p.last
+	msg.Subscription = sub.id
+	msg.Range = p.subs[sub]
+	return msg
+}
+
+// streamClient is a WebSocket connection of a client of the stream.
+type streamClient struct {
+	g    *gateway
+	conn *websocket.Conn
+	out  chan interface{}
+	done chan struct{}
+
+	// subscriptions are only accessed by the goroutine reading requests.
+	subscriptions map[string]*subscription
+	closeOnce     sync.Once
+}
+
+// serve handles the requests of the client until it disconnects.
+func (c *streamClient) serve() {
+	go c.write()
+	defer func() {
+		for _, sub := range c.subscriptions {
+			sub.s.unsubscribe(sub)
+		}
+		close(c.done)
+		c.close()
+	}()
+	for {
+		msgType, data, err := c.conn.ReadMessage()
+		if nil != err {
+			return
+		}
+		var req streamRequest
+		if websocket.TextMessage != msgType {
+			err = fmt.Errorf("Expected a text message")
+		} else {
+			err = json.Unmarshal(data, &req)
+		}
+		if nil == err {
+			err = c.handle(req)
+		}
+		if nil != err {
+			c.send(streamReply{ID: req.ID, Error: err.Error()})
+		}
+	}
+}
+
+// handle handles the request and replies if it succeeds.
+func (c *streamClient) handle(req streamRequest) error {
+	switch req.Op {
+	case "subscribe":
+		if _, ok := c.subscriptions[req.ID]; ok {
+			return fmt.Errorf("Duplicate subscription id: %q", req.ID)
+		}
+		d, ok := c.g.byName[req.Device]
+		if !ok {
+			return fmt.Errorf("Unknown device: %q", req.Device)
+		}
+		var points []*point
+		var ranges []string
+		for _, name := range req.Tags {
+			p, err := d.stream.newPoint(name, "")
+			if nil != err {
+				return err
+			}
+			points = append(points, p)
+			ranges = append(ranges, "")
+		}
+		if len(req.Range) > 0 {
+			p, err := d.stream.newPoint("", req.Range)
+			if nil != err {
+				return err
+			}
+			points = append(points, p)
+			ranges = append(ranges, req.Range)
+		}
+		if len(points) == 0 {
+			return fmt.Errorf("No tags or range to subscribe to")
+		}
+		sub := &subscription{id: req.ID, c: c, s: d.stream}
+		c.subscriptions[req.ID] = sub
+		c.send(streamReply{ID: req.ID, OK: true})
+		d.stream.subscribe(sub, points, ranges)
+	case "unsubscribe":
+		sub, ok := c.subscriptions[req.ID]
+		if !ok {
+			return fmt.Errorf("Unknown subscription id: %q", req.ID)
+		}
+		sub.s.unsubscribe(sub)
+		delete(c.subscriptions, req.ID)
+		c.send(streamReply{ID: req.ID, OK: true})
+	default:
+		return fmt.Errorf("Unknown op: %q", req.Op)
+	}
+	return nil
+}
+
+// send queues the message for the client, or disconnects the client if it
+// cannot keep up.
+func (c *streamClient) send(msg interface{}) {
+	select {
+	case c.out <- msg:
+	default:
+		c.close()
+	}
+}
+
+// write writes the queued messages to the client until it disconnects.
+func (c *streamClient) write() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.out:
+			data, err := json.Marshal(msg)
+			if nil == err {
+				err = c.conn.WriteMessage(websocket.TextMessage, data)
+			}
+			if nil != err {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// close closes the connection of the client, which ends serve.
+func (c *streamClient) close() {
+	c.closeOnce.Do(func() {
+		c.conn.Close()
+	})
+}
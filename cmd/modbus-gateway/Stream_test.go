@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/websocket"
+	"github.com/AdamSLevy/modbus/modbustest"
+)
+
+const testStreamConfig = `
+devices:
+  - name: boiler
+    host: %HOST%
+    unit: 1
+    interval: 10ms
+    tags:
+      - {name: temp, table: ir, address: 10, type: int16, scale: 0.1}
+      - {name: mode, table: hr, address: 21}
+      - {name: alarm, table: hr, address: 22, access: w}
+  - name: plc
+    host: %HOST%
+    interval: 10ms
+`
+
+// streamMessage holds the fields of replies and updates used by the tests.
+type streamMessage struct {
+	ID           string      `json:"id"`
+	OK           bool        `json:"ok"`
+	Error        string      `json:"error"`
+	Subscription string      `json:"subscription"`
+	Value        interface{} `json:"value"`
+}
+
+// testStreamClient is a client of the stream of a test gateway.
+type testStreamClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialStream(t *testing.T, url string) *testStreamClient {
+	conn, err := websocket.Dial("ws" + strings.TrimPrefix(url, "http") +
+		"/stream")
+	if nil != err {
+		t.Fatal(err)
+	}
+	return &testStreamClient{t: t, conn: conn}
+}
+
+// request sends the request and returns the error of the reply.
+func (c *testStreamClient) request(req string) string {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage,
+		[]byte(req)); nil != err {
+		c.t.Fatal(err)
+	}
+	var id struct{ ID string }
+	json.Unmarshal([]byte(req), &id)
+	m := c.next(func(m streamMessage) bool {
+		return len(m.Subscription) == 0 && id.ID == m.ID
+	})
+	if m.OK == (len(m.Error) > 0) {
+		c.t.Errorf("%v: Unexpected reply: %+v", req, m)
+	}
+	return m.Error
+}
+
+// next returns the next message for which match returns true.
+func (c *testStreamClient) next(match func(streamMessage) bool) streamMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if nil != err {
+			c.t.Fatal(err)
+		}
+		var m streamMessage
+		if err := json.Unmarshal(data, &m); nil != err {
+			c.t.Fatal(err)
+		}
+		if match(m) {
+			return m
+		}
+	}
+}
+
+// value returns the next value of the subscription.
+func (c *testStreamClient) value(subscription string) interface{} {
+	c.t.Helper()
+	return c.next(func(m streamMessage) bool {
+		return subscription == m.Subscription
+	}).Value
+}
+
+func TestStream(t *testing.T) {
+	s := modbustest.NewServer()
+	defer s.Close()
+	u := s.Units[1]
+	u.InputRegisters[10] = 215
+	u.HoldingRegisters[100] = 7
+
+	cfg := &config{}
+	if err := devconfig.Read(strings.NewReader(strings.Replace(
+		testStreamConfig, "%HOST%", s.Addr(), -1)), ".", cfg); nil != err {
+		t.Fatal(err)
+	}
+	g, err := newGateway(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer g.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		g.run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	c1 := dialStream(t, srv.URL)
+	c2 := dialStream(t, srv.URL)
+	for _, req := range []string{
+		`{"op": "subscribe", "id": "x", "device": "missing", "tags": ["a"]}`,
+		`{"op": "subscribe", "id": "x", "device": "boiler", "tags": ["a"]}`,
+		`{"op": "subscribe", "id": "x", "device": "boiler", ` +
+			`"tags": ["alarm"]}`,
+		`{"op": "subscribe", "id": "x", "device": "boiler"}`,
+		`{"op": "subscribe", "id": "x", "device": "plc", "range": "hr"}`,
+		`{"op": "subscribe", "id": "x", "device": "plc", ` +
+			`"range": "hr/0?count=200"}`,
+		`{"op": "unsubscribe", "id": "x"}`,
+		`{"op": "bogus", "id": "x"}`,
+	} {
+		if len(c1.request(req)) == 0 {
+			t.Errorf("%v: Expected an error", req)
+		}
+	}
+
+	for _, req := range []string{
+		`{"op": "subscribe", "id": "a", "device": "boiler", ` +
+			`"tags": ["temp", "mode"]}`,
+		`{"op": "subscribe", "id": "r", "device": "plc", ` +
+			`"range": "hr/100?unit=1&count=2"}`,
+	} {
+		if err := c1.request(req); len(err) > 0 {
+			t.Fatal(err)
+		}
+	}
+	if err := c1.request(`{"op": "subscribe", "id": "a", ` +
+		`"device": "boiler", "tags": ["temp"]}`); len(err) == 0 {
+		t.Error("Expected an error for a duplicate subscription")
+	}
+	for _, req := range []string{
+		`{"op": "subscribe", "id": "b", "device": "boiler", ` +
+			`"tags": ["temp"]}`,
+		`{"op": "subscribe", "id": "r", "device": "plc", ` +
+			`"range": "hr/0100?count=2&unit=1"}`,
+	} {
+		if err := c2.request(req); len(err) > 0 {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []*testStreamClient{c1, c2} {
+		if v := c.value("r"); "[7 0]" != toString(v) {
+			t.Errorf("Unexpected initial range values: %v", v)
+		}
+	}
+	if v := c2.value("b"); 21.5 != v {
+		t.Errorf("Unexpected initial value: %v", v)
+	}
+
+	// Both clients share the points and the Polls.
+	g.byName["boiler"].stream.mtx.Lock()
+	if n := len(g.byName["boiler"].stream.points); 2 != n {
+		t.Errorf("Expected 2 boiler points but got %v", n)
+	}
+	g.byName["boiler"].stream.mtx.Unlock()
+	g.byName["plc"].stream.mtx.Lock()
+	if n := len(g.byName["plc"].stream.points); 1 != n {
+		t.Errorf("Expected 1 plc point but got %v", n)
+	}
+	g.byName["plc"].stream.mtx.Unlock()
+
+	s.Lock()
+	u.HoldingRegisters[101] = 8
+	s.Unlock()
+	for _, c := range []*testStreamClient{c1, c2} {
+		if v := c.value("r"); "[7 8]" != toString(v) {
+			t.Errorf("Unexpected range values: %v", v)
+		}
+	}
+
+	if err := c1.request(`{"op": "unsubscribe", "id": "a"}`); len(err) > 0 {
+		t.Fatal(err)
+	}
+	g.byName["boiler"].stream.mtx.Lock()
+	if _, ok := g.byName["boiler"].stream.points["tag:mode"]; ok {
+		t.Error("The unsubscribed point was not removed")
+	}
+	g.byName["boiler"].stream.mtx.Unlock()
+
+	// The points of disconnected clients are removed.
+	c2.conn.Close()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		g.byName["boiler"].stream.mtx.Lock()
+		n := len(g.byName["boiler"].stream.points)
+		g.byName["boiler"].stream.mtx.Unlock()
+		if 0 == n {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no boiler points but got %v", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	c1.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := c1.conn.ReadMessage(); nil != err {
+			break
+		}
+	}
+}
+
+// toString formats the JSON value v like a Go slice.
+func toString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return strings.Replace(string(data), ",", " ", -1)
+}
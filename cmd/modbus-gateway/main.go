@@ -0,0 +1,127 @@
+// Command modbus-gateway serves reads and writes of Modbus devices as a
+// HTTP/JSON API, for clients that cannot speak Modbus themselves.
+//
+// The config file is YAML or JSON:
+//
+//	listen: ":8080"
+//	devices:
+//	  - name: boiler
+//	    host: 192.168.1.10:502
+//	    unit: 1
+//	    map: boiler.csv
+//	  - name: plc
+//	    host: 192.168.1.20:502
+//	    interval: 1s
+//
+// Devices without tags can only be accessed by address. The endpoints are:
+//
+//	GET  /devices                          the configured devices
+//	GET  /devices/<device>                 the device and its tags
+//	GET  /devices/<device>/tags            all readable tags, or ?name=a&name=b
+//	GET  /devices/<device>/tags/<tag>      {"name": "temp", "value": 21.5}
+//	PUT  /devices/<device>/tags/<tag>      {"value": 21.5}, or just 21.5
+//	GET  /devices/<device>/<table>/<addr>  {"values": [...]}
+//	PUT  /devices/<device>/<table>/<addr>  {"values": [...]} or {"value": 1}
+//
+// The tables are coil, di, ir and hr. Reads and writes by address take the
+// parameters unit, which defaults to the unit of the device, type, order,
+// length, scale and offset, as in register maps. Reads also take the count
+// of values. For example
+//
+//	GET /devices/plc/hr/100?count=4&type=float32&order=CDAB
+//
+// returns 4 float32 values stored in the 8 holding registers at 100. Writes
+// of a single value use the write single functions for coils and single
+// registers.
+//
+// Failed requests respond with {"error": "...", "exception": "..."}, where
+// exception is the name of the Modbus exception, if any. Exceptions map to
+// the status codes:
+//
+//	illegal-function            501 Not Implemented
+//	illegal-data-address        404 Not Found
+//	illegal-data-value          422 Unprocessable Entity
+//	acknowledge                 202 Accepted
+//	slave-device-busy           503 Service Unavailable
+//	gateway-target-no-response  504 Gateway Timeout
+//
+// Timeouts are 504 Gateway Timeout and all other errors of the device are
+// 502 Bad Gateway.
+//
+// WebSocket clients connected to /stream receive the changes of the values
+// they subscribe to. They send requests as JSON text messages:
+//
+//	{"op": "subscribe", "id": "1", "device": "boiler", "tags": ["temp"]}
+//	{"op": "subscribe", "id": "2", "device": "plc", "range": "hr/100?count=2"}
+//	{"op": "unsubscribe", "id": "1"}
+//
+// Each request is answered with {"id": "1", "ok": true}, or false and an
+// error. The id of a subscribe request identifies the subscription, whose
+// values are sent when they change, starting with the current values:
+//
+//	{"subscription": "1", "device": "boiler", "tag": "temp", "value": 21.5,
+//	 "units": "degC", "quality": "good", "time": "..."}
+//	{"subscription": "2", "device": "plc", "range": "hr/100?count=2",
+//	 "value": [7, 8], "quality": "good", "time": "..."}
+//
+// The subscribed values of each device are polled at the interval of the
+// device by one shared poller, no matter how many clients subscribe to them.
+// Ranges are limited to what a single read can return.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const defaultListen = ":8080"
+
+func main() {
+	configFile := flag.String("config", "modbus-gateway.yaml",
+		"Config file")
+	listen := flag.String("listen", "",
+		"HTTP listen address, overrides the config (default "+
+			defaultListen+")")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configFile)
+	if nil != err {
+		log.Fatal(err)
+	}
+	if len(*listen) > 0 {
+		cfg.Listen = *listen
+	}
+	if len(cfg.Listen) == 0 {
+		cfg.Listen = defaultListen
+	}
+
+	g, err := newGateway(cfg)
+	if nil != err {
+		log.Fatal(err)
+	}
+	defer g.close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		g.run(ctx)
+		close(done)
+	}()
+
+	srv := &http.Server{Addr: cfg.Listen, Handler: g}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Printf("Serving on %v", cfg.Listen)
+	if err := srv.ListenAndServe(); http.ErrServerClosed != err {
+		log.Fatal(err)
+	}
+	<-done
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/jsonvalue"
+	"github.com/AdamSLevy/modbus/internal/mqtt"
+)
+
+// Status payloads of the <prefix>/status topic.
+const (
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+// bridge publishes the polled values of the devices to MQTT and writes the
+// values of the commands it receives.
+type bridge struct {
+	cfg      *config
+	client   *mqtt.Client
+	devices  map[string]*device
+	filter   *modbus.ChangeFilter
+	commands chan command
+
+	// values are the last value Messages by topic. They are published
+	// again on each connection, since the filter does not report values
+	// again that could not be published while the broker was
+	// disconnected. The mtx also orders the publishing of values.
+	mtx    sync.Mutex
+	values map[string]mqtt.Message
+}
+
+// device is a configured device and its Poller.
+type device struct {
+	*devconfig.Device
+	ch     modbus.ClientHandle
+	poller *modbus.Poller
+}
+
+// command is a write request received on a set topic.
+type command struct {
+	device  *device
+	tag     string
+	payload []byte
+}
+
+// valueMessage is the payload of a value topic.
+type valueMessage struct {
+	Value   interface{}    `json:"value"`
+	Quality modbus.Quality `json:"quality"`
+	Time    time.Time      `json:"time"`
+	Unit    byte           `json:"unit"`
+	Units   string         `json:"units,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// commandMessage is the payload of a set topic, if it is an object. Otherwise
+// the payload is the value itself.
+type commandMessage struct {
+	ID    string          `json:"id"`
+	Value json.RawMessage `json:"value"`
+}
+
+// resultMessage is the payload of a result topic.
+type resultMessage struct {
+	ID    string `json:"id,omitempty"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// newBridge opens the ClientHandles of the devices of cfg and returns the
+// bridge.
+func newBridge(cfg *config) (*bridge, error) {
+	b := &bridge{
+		cfg:     cfg,
+		devices: make(map[string]*device),
+		filter: &modbus.ChangeFilter{
+			ChangeOptions: modbus.ChangeOptions{Integrity: cfg.Integrity},
+		},
+		commands: make(chan command, 64),
+		values:   make(map[string]mqtt.Message),
+	}
+	b.client = mqtt.NewClient(mqtt.Options{
+		Addr:      cfg.Broker,
+		ClientID:  cfg.ClientID,
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		KeepAlive: cfg.KeepAlive,
+		Will: &mqtt.Message{Topic: b.topic("status"),
+			Payload: []byte(statusOffline), Retain: true},
+		OnConnect: func() {
+			b.client.Publish(mqtt.Message{Topic: b.topic("status"),
+				Payload: []byte(statusOnline), Retain: true})
+			b.publishValues()
+		},
+		OnConnectionLost: func(err error) {
+			log.Printf("MQTT connection lost: %v", err)
+		},
+	})
+	for i := range cfg.Devices {
+		d := &device{Device: &cfg.Devices[i]}
+		var err error
+		if d.ch, err = modbus.GetClientHandle(
+			d.ConnectionSettings()); nil != err {
+			b.close()
+			return nil, fmt.Errorf("Device %q: %v", d.Name, err)
+		}
+		b.devices[d.Name] = d
+		d.poller = modbus.NewPoller(d.ch)
+		if err := d.poller.Add(d.Poll()); nil != err {
+			b.close()
+			return nil, err
+		}
+		d.poller.OnChange(b.filter, func(e modbus.ChangeEvent) {
+			b.publishValue(d, e.Sample)
+		})
+	}
+	b.client.Subscribe(b.topic("+", "+", "set"), b.receiveCommand)
+	return b, nil
+}
+
+// topic returns the topic of the levels below the prefix.
+func (b *bridge) topic(levels ...string) string {
+	return b.cfg.Prefix + "/" + strings.Join(levels, "/")
+}
+
+// run runs the MQTT client, the pollers and the command worker until the ctx
+// is done and then closes the ClientHandles.
+func (b *bridge) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2 + len(b.devices))
+	go func() {
+		defer wg.Done()
+		b.client.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		b.execute(ctx)
+	}()
+	for _, d := range b.devices {
+		go func(p *modbus.Poller) {
+			defer wg.Done()
+			p.Run(ctx)
+		}(d.poller)
+	}
+	wg.Wait()
+	b.close()
+}
+
+func (b *bridge) close() {
+	for _, d := range b.devices {
+		d.ch.Close()
+	}
+}
+
+// publishValue publishes the Sample of the device to its value topic as a
+// retained message, and keeps it for publishValues.
+func (b *bridge) publishValue(d *device, s modbus.Sample) {
+	t, _ := d.TagMap.Tag(s.Tag)
+	msg := valueMessage{
+		Value:   s.Value,
+		Quality: s.Quality,
+		Time:    s.Time,
+		Unit:    t.SlaveID,
+		Units:   t.Units,
+	}
+	if nil != s.Err {
+		msg.Error = s.Err.Error()
+	}
+	if !jsonvalue.IsFinite(s.Value) {
+		msg.Value = nil
+		msg.Error = fmt.Sprintf("Value %v cannot be represented in JSON",
+			s.Value)
+	}
+	payload, err := json.Marshal(msg)
+	if nil != err {
+		log.Printf("Device %q Tag %q: %v", d.Name, s.Tag, err)
+		return
+	}
+	m := mqtt.Message{Topic: b.topic(d.Name, s.Tag), Payload: payload,
+		Retain: true}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.values[m.Topic] = m
+	if err := b.client.Publish(m); nil != err {
+		log.Printf("Device %q Tag %q: %v", d.Name, s.Tag, err)
+	}
+}
+
+// publishValues publishes the last value Message of each topic again, so
+// that the broker retains the values reported while it was disconnected.
+func (b *bridge) publishValues() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, m := range b.values {
+		if err := b.client.Publish(m); nil != err {
+			log.Printf("Topic %q: %v", m.Topic, err)
+			return
+		}
+	}
+}
+
+// receiveCommand queues the command received on a set topic.
+func (b *bridge) receiveCommand(m mqtt.Message) {
+	levels := strings.Split(strings.TrimPrefix(m.Topic, b.cfg.Prefix+"/"),
+		"/")
+	if len(levels) != 3 {
+		return
+	}
+	d, ok := b.devices[levels[0]]
+	if !ok {
+		b.publishResult(levels[0], levels[1], resultMessage{
+			Error: fmt.Sprintf("Unknown device: %q", levels[0])})
+		return
+	}
+	select {
+	case b.commands <- command{device: d, tag: levels[1],
+		payload: m.Payload}:
+	default:
+		b.publishResult(d.Name, levels[1], resultMessage{
+			Error: "Too many pending commands"})
+	}
+}
+
+// execute writes the values of the queued commands, one at a time, until the
+// ctx is done.
+func (b *bridge) execute(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-b.commands:
+			b.publishResult(c.device.Name, c.tag, b.write(ctx, c))
+		}
+	}
+}
+
+// write validates and writes the value of the command and returns its result.
+func (b *bridge) write(ctx context.Context, c command) resultMessage {
+	var res resultMessage
+	value := json.RawMessage(bytes.TrimSpace(c.payload))
+	if len(value) > 0 && '{' == value[0] {
+		var msg commandMessage
+		if err := json.Unmarshal(value, &msg); nil != err {
+			res.Error = err.Error()
+			return res
+		}
+		res.ID, value = msg.ID, msg.Value
+	}
+	t, ok := c.device.TagMap.Tag(c.tag)
+	if !ok {
+		res.Error = fmt.Sprintf("Unknown Tag: %q", c.tag)
+		return res
+	}
+	v, err := jsonvalue.Parse(t, value)
+	if nil == err {
+		err = c.device.TagMap.Write(ctx, c.device.ch, t.Name, v)
+	}
+	if nil != err {
+		res.Error = err.Error()
+		return res
+	}
+	res.OK = true
+	return res
+}
+
+// publishResult publishes the result of a command.
+func (b *bridge) publishResult(device, tag string, res resultMessage) {
+	payload, _ := json.Marshal(res)
+	b.client.Publish(mqtt.Message{Topic: b.topic(device, tag, "result"),
+		Payload: payload})
+}
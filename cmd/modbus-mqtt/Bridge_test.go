@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/mqtt"
+	"github.com/AdamSLevy/modbus/modbustest"
+)
+
+const testConfig = `
+prefix: site/modbus
+keepalive: 1s
+devices:
+  - name: boiler
+    host: %HOST%
+    unit: 1
+    interval: 10ms
+    tags:
+      - {name: temp, table: hr, address: 10, type: int16, scale: 0.1,
+         units: degC, access: r}
+      - {name: setpoint, table: hr, address: 20, type: int16, scale: 0.1}
+      - {name: mode, table: hr, address: 21}
+      - {name: pump, table: coil, address: 3}
+`
+
+func TestConfig(t *testing.T) {
+	for _, cfg := range []string{
+		`{prefix: "a/#", devices: [{name: a, host: h, tags: [{name: x, ` +
+			`table: hr, address: 0}]}]}`,
+		`{devices: [{name: a/b, host: h, tags: [{name: x, table: hr, ` +
+			`address: 0}]}]}`,
+		`{devices: [{name: a, host: h, tags: [{name: "x+", table: hr, ` +
+			`address: 0}]}]}`,
+	} {
+		if err := devconfig.Read(strings.NewReader(cfg), ".",
+			&config{}); nil == err {
+			t.Errorf("Expected an error for %v", cfg)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	s := modbustest.NewServer()
+	defer s.Close()
+	s.Units[1].HoldingRegisters[10] = 215
+	broker, err := mqtt.NewBroker("127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	cfg := &config{Broker: broker.Addr()}
+	if err := devconfig.Read(strings.NewReader(strings.Replace(testConfig,
+		"%HOST%", s.Addr(), 1)), ".", cfg); nil != err {
+		t.Fatal(err)
+	}
+	b, err := newBridge(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	messages := make(chan mqtt.Message, 100)
+	client := mqtt.NewClient(mqtt.Options{Addr: broker.Addr(),
+		ClientID: "test", ReconnectDelay: 10 * time.Millisecond})
+	client.Subscribe("site/modbus/#", func(m mqtt.Message) {
+		messages <- m
+	})
+	go client.Run(ctx)
+
+	// receive returns the payload of the next Message on the topic.
+	receive := func(topic string) []byte {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case m := <-messages:
+				if m.Topic == topic {
+					return m.Payload
+				}
+			case <-timeout:
+				t.Fatalf("No Message received on %v", topic)
+			}
+		}
+	}
+
+	var value valueMessage
+	if err := json.Unmarshal(receive("site/modbus/boiler/temp"),
+		&value); nil != err {
+		t.Fatal(err)
+	}
+	if 21.5 != value.Value || "degC" != value.Units || 1 != value.Unit {
+		t.Errorf("Unexpected value: %+v", value)
+	}
+
+	// command publishes the payload to the set topic of the tag and returns
+	// the result.
+	command := func(tag, payload string) resultMessage {
+		t.Helper()
+		for !client.Connected() {
+			time.Sleep(5 * time.Millisecond)
+		}
+		client.Publish(mqtt.Message{
+			Topic:   "site/modbus/boiler/" + tag + "/set",
+			Payload: []byte(payload)})
+		var res resultMessage
+		if err := json.Unmarshal(receive("site/modbus/boiler/"+tag+
+			"/result"), &res); nil != err {
+			t.Fatal(err)
+		}
+		return res
+	}
+	for _, test := range []struct {
+		tag, payload string
+		ok           bool
+	}{
+		{"setpoint", `{"id": "1", "value": 30.5}`, true},
+		{"mode", `3`, true},
+		{"mode", `3.5`, false},
+		{"mode", `"auto"`, false},
+		{"pump", `true`, true},
+		{"pump", `1`, false},
+		{"temp", `20`, false},
+		{"unknown", `1`, false},
+		{"setpoint", `{"id": "2"}`, false},
+		{"setpoint", `{bad`, false},
+	} {
+		res := command(test.tag, test.payload)
+		if res.OK != test.ok || (!res.OK && len(res.Error) == 0) {
+			t.Errorf("%v %v: Unexpected result: %+v", test.tag,
+				test.payload, res)
+		}
+	}
+	s.Lock()
+	if r := s.Units[1].HoldingRegisters; 305 != r[20] || 3 != r[21] ||
+		!s.Units[1].Coils[3] {
+		t.Errorf("Unexpected registers: %v %v", r[20:22],
+			s.Units[1].Coils[3])
+	}
+	s.Unlock()
+
+	// The bridge reconnects and keeps accepting commands. Commands sent
+	// before it has resubscribed are lost, so they are repeated.
+	broker.Disconnect()
+	retry := time.NewTicker(100 * time.Millisecond)
+	defer retry.Stop()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case <-retry.C:
+			client.Publish(mqtt.Message{Topic: "site/modbus/boiler/mode/set",
+				Payload: []byte(`{"id": "3", "value": 4}`)})
+		case m := <-messages:
+			if "site/modbus/boiler/mode/result" != m.Topic {
+				continue
+			}
+			var res resultMessage
+			json.Unmarshal(m.Payload, &res)
+			if !res.OK || "3" != res.ID {
+				t.Errorf("Unexpected result after reconnecting: %+v",
+					res)
+			}
+			return
+		case <-deadline:
+			t.Fatal("No result after reconnecting")
+		}
+	}
+}
+
+func TestBridgeReconnect(t *testing.T) {
+	s := modbustest.NewServer()
+	defer s.Close()
+	s.Units[1].HoldingRegisters[10] = 215
+	// The broker is started after the values have been polled.
+	broker, err := mqtt.NewBroker("127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	addr := broker.Addr()
+	broker.Close()
+
+	cfg := &config{Broker: addr}
+	if err := devconfig.Read(strings.NewReader(strings.Replace(testConfig,
+		"%HOST%", s.Addr(), 1)), ".", cfg); nil != err {
+		t.Fatal(err)
+	}
+	b, err := newBridge(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if broker, err = mqtt.NewBroker(addr); nil != err {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	messages := make(chan mqtt.Message, 100)
+	client := mqtt.NewClient(mqtt.Options{Addr: addr, ClientID: "test",
+		ReconnectDelay: 10 * time.Millisecond})
+	client.Subscribe("site/modbus/boiler/temp", func(m mqtt.Message) {
+		messages <- m
+	})
+	go client.Run(ctx)
+	select {
+	case m := <-messages:
+		var value valueMessage
+		if err := json.Unmarshal(m.Payload, &value); nil != err ||
+			21.5 != value.Value {
+			t.Errorf("Unexpected value: %s", m.Payload)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("The value polled while disconnected was not published")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdamSLevy/modbus/internal/devconfig"
+	"github.com/AdamSLevy/modbus/internal/mqtt"
+)
+
+// Default settings of the config.
+const (
+	defaultBroker    = "localhost:1883"
+	defaultClientID  = "modbus-mqtt"
+	defaultPrefix    = "modbus"
+	defaultIntegrity = time.Minute
+)
+
+// config is the configuration of the bridge, read from YAML or JSON.
+type config struct {
+	// Broker is the host and port of the MQTT broker.
+	Broker    string        `yaml:"broker"`
+	ClientID  string        `yaml:"client_id"`
+	Username  string        `yaml:"username"`
+	Password  string        `yaml:"password"`
+	KeepAlive time.Duration `yaml:"keepalive"`
+	// Prefix is the first level, or levels, of all topics.
+	Prefix string `yaml:"prefix"`
+	// Integrity is the longest time an unchanged value is not published.
+	Integrity time.Duration     `yaml:"integrity"`
+	Devices   devconfig.Devices `yaml:"devices"`
+}
+
+// Init implements devconfig.Config.
+func (c *config) Init(dir string) error {
+	if len(c.Broker) == 0 {
+		c.Broker = defaultBroker
+	}
+	if len(c.ClientID) == 0 {
+		c.ClientID = defaultClientID
+	}
+	if len(c.Prefix) == 0 {
+		c.Prefix = defaultPrefix
+	}
+	if 0 == c.Integrity {
+		c.Integrity = defaultIntegrity
+	}
+	if !mqtt.ValidTopic(c.Prefix) {
+		return fmt.Errorf("Invalid prefix: %q", c.Prefix)
+	}
+	if err := c.Devices.Init(dir); nil != err {
+		return err
+	}
+	for _, d := range c.Devices {
+		if !mqtt.ValidTopic(d.Name) || strings.Contains(d.Name, "/") {
+			return fmt.Errorf("Device name %q is not a valid topic level",
+				d.Name)
+		}
+		for _, t := range d.TagMap.Tags() {
+			if !mqtt.ValidTopic(t.Name) ||
+				strings.Contains(t.Name, "/") {
+				return fmt.Errorf("Tag name %q is not a valid topic "+
+					"level", t.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// loadConfig reads the config from filename.
+func loadConfig(filename string) (*config, error) {
+	cfg := &config{}
+	if err := devconfig.Load(filename, cfg); nil != err {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,57 @@
+// Command modbus-mqtt polls Modbus devices using register maps, publishes
+// their values to an MQTT broker and writes the values it receives on command
+// topics.
+//
+// The config file is YAML or JSON:
+//
+//	broker: localhost:1883
+//	prefix: modbus
+//	integrity: 1m
+//	devices:
+//	  - name: boiler
+//	    host: 192.168.1.10:502
+//	    unit: 1
+//	    interval: 5s
+//	    map: boiler.csv
+//
+// The topics below the prefix are:
+//
+//	status                    "online", or "offline" when the bridge is lost
+//	<device>/<tag>            {"value": 21.5, "quality": "good", "time": ...}
+//	<device>/<tag>/set        21.5, or {"id": "42", "value": 21.5}
+//	<device>/<tag>/result     {"id": "42", "ok": false, "error": "..."}
+//
+// Values are retained and published when they change, or when they have not
+// been published for the integrity period. Commands are validated against the
+// register map and executed in the order they are received. The bridge
+// reconnects whenever the connection to the broker is lost and then publishes
+// the last value of each tag again.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	configFile := flag.String("config", "modbus-mqtt.yaml", "Config file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configFile)
+	if nil != err {
+		log.Fatal(err)
+	}
+	b, err := newBridge(cfg)
+	if nil != err {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+	log.Printf("Bridging %v devices to %v", len(cfg.Devices), cfg.Broker)
+	b.run(ctx)
+}
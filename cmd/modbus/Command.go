@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/textvalue"
+)
+
+// options are the flags that apply to all commands.
+type options struct {
+	cs   modbus.ConnectionSettings
+	unit byte
+	// format holds the Type, ByteOrder, Length, Scale and Offset of the
+	// values.
+	format modbus.Tag
+}
+
+// command reads or writes once. Reads return the reading to output and
+// writes return nil.
+type command func(ctx context.Context, ch modbus.ClientHandle) (*reading,
+	error)
+
+// reading is the response to a read command.
+type reading struct {
+	time time.Time
+	// tag is the first of the values, which are stored at consecutive
+	// addresses. The data is in the format of the response to a read
+	// Query. The responses of other functions have no tag and are
+	// output as raw data.
+	tag   modbus.Tag
+	count int
+	fCode modbus.FunctionCode
+	data  []byte
+}
+
+// usageError is an error in the command line.
+type usageError struct {
+	error
+}
+
+func usagef(format string, a ...interface{}) error {
+	return usageError{fmt.Errorf(format, a...)}
+}
+
+// readFunctions maps the read FunctionCodes to their Table.
+var readFunctions = map[modbus.FunctionCode]modbus.Table{
+	modbus.FunctionReadCoils:            modbus.TableCoils,
+	modbus.FunctionReadDiscreteInputs:   modbus.TableDiscreteInputs,
+	modbus.FunctionReadHoldingRegisters: modbus.TableHoldingRegisters,
+	modbus.FunctionReadInputRegisters:   modbus.TableInputRegisters,
+}
+
+// functionCode returns the FunctionCode of the name, which is not case
+// sensitive.
+func functionCode(name string) (modbus.FunctionCode, bool) {
+	for s, fCode := range modbus.FunctionCodes {
+		if strings.EqualFold(s, name) {
+			return fCode, true
+		}
+	}
+	return 0, false
+}
+
+// parseCommand returns the command of the arguments and whether it is a read
+// command.
+func (o *options) parseCommand(args []string) (command, bool, error) {
+	if len(args) == 0 {
+		return nil, false, usagef("Missing command")
+	}
+	name, args := args[0], args[1:]
+	switch name {
+	case "read":
+		cmd, err := o.parseRead(args)
+		return cmd, true, err
+	case "write":
+		cmd, err := o.parseWrite(args)
+		return cmd, false, err
+	}
+	fCode, ok := functionCode(name)
+	if !ok {
+		return nil, false, usagef("Unknown command: %q", name)
+	}
+	if table, ok := readFunctions[fCode]; ok {
+		cmd, err := o.parseReadFunction(fCode, table, args)
+		return cmd, true, err
+	}
+	if modbus.FunctionReportServerID == fCode {
+		if len(args) > 0 {
+			return nil, false, usagef("Usage: ReportServerID")
+		}
+		q, err := modbus.ReportServerID(o.unit)
+		if nil != err {
+			return nil, false, usageError{err}
+		}
+		return func(ctx context.Context,
+			ch modbus.ClientHandle) (*reading, error) {
+			data, err := ch.SendContext(ctx, q)
+			if nil != err {
+				return nil, err
+			}
+			return &reading{time: time.Now(),
+				tag:   modbus.Tag{SlaveID: q.SlaveID},
+				fCode: fCode, data: data}, nil
+		}, true, nil
+	}
+	q, err := o.parseWriteFunction(fCode, args)
+	if nil != err {
+		return nil, false, err
+	}
+	return sendQuery(q), false, nil
+}
+
+// parseRead parses the arguments of the read command:
+// <table> <address> [count].
+func (o *options) parseRead(args []string) (command, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, usagef("Usage: read <table> <address> [count]")
+	}
+	table, err := parseTable(args[0])
+	if nil != err {
+		return nil, err
+	}
+	t, err := o.newTag(table, args[1])
+	if nil != err {
+		return nil, err
+	}
+	count := 1
+	if len(args) > 2 {
+		if count, err = parseCount(args[2]); nil != err {
+			return nil, err
+		}
+	}
+	r := t.Range()
+	n := count * int(t.Quantity())
+	if int(r.Address)+n > 0x10000 {
+		return nil, usagef("%v values exceed the end of the table",
+			count)
+	}
+	r.Quantity = uint16(n)
+	return func(ctx context.Context,
+		ch modbus.ClientHandle) (*reading, error) {
+		data, err := modbus.ReadRange(ctx, ch, r,
+			modbus.TransferOptions{})
+		if nil != err {
+			return nil, err
+		}
+		return &reading{time: time.Now(), tag: t, count: count,
+			fCode: readFunction(table), data: data}, nil
+	}, nil
+}
+
+// parseReadFunction parses the arguments of the read functions:
+// <address> [quantity]. Unlike the read command, the quantity is the number
+// of addresses, which must hold whole values.
+func (o *options) parseReadFunction(fCode modbus.FunctionCode,
+	table modbus.Table, args []string) (command, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, usagef("Usage: %v <address> [quantity]",
+			modbus.FunctionNames[fCode])
+	}
+	t, err := o.newTag(table, args[0])
+	if nil != err {
+		return nil, err
+	}
+	quantity := 1
+	if len(args) > 1 {
+		if quantity, err = parseCount(args[1]); nil != err {
+			return nil, err
+		}
+	}
+	if quantity%int(t.Quantity()) != 0 {
+		return nil, usagef("Quantity %v does not hold whole %v values",
+			quantity, t.Type)
+	}
+	q, err := modbus.ReadQuery(t.SlaveID, fCode, t.Address,
+		uint16(quantity))
+	if nil != err {
+		return nil, usageError{err}
+	}
+	return func(ctx context.Context,
+		ch modbus.ClientHandle) (*reading, error) {
+		data, err := ch.SendContext(ctx, q)
+		if nil != err {
+			return nil, err
+		}
+		return &reading{time: time.Now(), tag: t,
+			count: quantity / int(t.Quantity()), fCode: fCode,
+			data: data}, nil
+	}, nil
+}
+
+// readFunction returns the read FunctionCode of the table.
+func readFunction(table modbus.Table) modbus.FunctionCode {
+	for fCode, t := range readFunctions {
+		if t == table {
+			return fCode
+		}
+	}
+	return 0
+}
+
+// parseWrite parses the arguments of the write command:
+// <table> <address> <value>... A single value is written with the write
+// single functions where possible, since some devices do not support the
+// write multiple functions.
+func (o *options) parseWrite(args []string) (command, error) {
+	if len(args) < 3 {
+		return nil, usagef("Usage: write <table> <address> <value>...")
+	}
+	table, err := parseTable(args[0])
+	if nil != err {
+		return nil, err
+	}
+	if !table.Writable() {
+		return nil, usagef("Table %v is not writable", table)
+	}
+	t, err := o.newTag(table, args[1])
+	if nil != err {
+		return nil, err
+	}
+	values, err := parseValues(t, args[2:])
+	if nil != err {
+		return nil, err
+	}
+	var q modbus.Query
+	if len(values) == 1 {
+		q, err = t.WriteQuery(values[0])
+	} else {
+		q, err = writeMultipleQuery(t, values)
+	}
+	if nil != err {
+		return nil, usageError{err}
+	}
+	return sendQuery(q), nil
+}
+
+// parseWriteFunction parses the arguments of the write functions, which are
+// <address> <value>... or, for MaskWriteRegister,
+// <address> <and mask> <or mask>.
+func (o *options) parseWriteFunction(fCode modbus.FunctionCode,
+	args []string) (modbus.Query, error) {
+	name := modbus.FunctionNames[fCode]
+	if modbus.FunctionMaskWriteRegister == fCode {
+		if len(args) != 3 {
+			return modbus.Query{}, usagef(
+				"Usage: %v <address> <and mask> <or mask>", name)
+		}
+		var v [3]uint16
+		for i := range v {
+			var err error
+			if v[i], err = parseUint16(args[i]); nil != err {
+				return modbus.Query{}, err
+			}
+		}
+		q, err := modbus.MaskWriteRegister(o.unit, v[0], v[1], v[2])
+		if nil != err {
+			return q, usageError{err}
+		}
+		return q, nil
+	}
+
+	var table modbus.Table
+	var single bool
+	switch fCode {
+	case modbus.FunctionWriteSingleCoil:
+		table, single = modbus.TableCoils, true
+	case modbus.FunctionWriteSingleRegister:
+		table, single = modbus.TableHoldingRegisters, true
+	case modbus.FunctionWriteMultipleCoils:
+		table = modbus.TableCoils
+	case modbus.FunctionWriteMultipleRegisters:
+		table = modbus.TableHoldingRegisters
+	default:
+		return modbus.Query{}, usagef("Function %v is not supported",
+			name)
+	}
+	if len(args) < 2 || single && len(args) != 2 {
+		if single {
+			return modbus.Query{}, usagef("Usage: %v <address> <value>",
+				name)
+		}
+		return modbus.Query{}, usagef("Usage: %v <address> <value>...",
+			name)
+	}
+	t, err := o.newTag(table, args[0])
+	if nil != err {
+		return modbus.Query{}, err
+	}
+	values, err := parseValues(t, args[1:])
+	if nil != err {
+		return modbus.Query{}, err
+	}
+	var q modbus.Query
+	switch {
+	case !single:
+		q, err = writeMultipleQuery(t, values)
+	case modbus.TableCoils == table:
+		q, err = t.WriteQuery(values[0])
+	default:
+		var regs []uint16
+		if regs, err = t.Encode(values[0]); nil == err {
+			if len(regs) != 1 {
+				return q, usagef("%v values do not fit in a "+
+					"single register", t.Type)
+			}
+			q, err = modbus.WriteSingleRegister(t.SlaveID, t.Address,
+				regs[0])
+		}
+	}
+	if nil != err {
+		return q, usageError{err}
+	}
+	return q, nil
+}
+
+// writeMultipleQuery returns the WriteMultipleCoils or
+// WriteMultipleRegisters Query of the values of consecutive Tags like t.
+func writeMultipleQuery(t modbus.Tag, values []interface{}) (modbus.Query,
+	error) {
+	if t.Table.IsBits() {
+		bits := make([]bool, len(values))
+		for i, v := range values {
+			bits[i] = v.(bool)
+		}
+		return modbus.WriteMultipleCoils(t.SlaveID, t.Address, bits)
+	}
+	var regs []uint16
+	for i, v := range values {
+		r, err := t.Encode(v)
+		if nil != err {
+			return modbus.Query{}, fmt.Errorf("Value %v: %v", i, err)
+		}
+		regs = append(regs, r...)
+	}
+	return modbus.WriteMultipleRegisters(t.SlaveID, t.Address,
+		uint16(len(regs)), regs)
+}
+
+// sendQuery returns the command sending the write Query q.
+func sendQuery(q modbus.Query) command {
+	return func(ctx context.Context, ch modbus.ClientHandle) (*reading,
+		error) {
+		_, err := ch.SendContext(ctx, q)
+		return nil, err
+	}
+}
+
+// newTag returns the Tag of the value at the address of the table in the
+// format of the options.
+func (o *options) newTag(table modbus.Table,
+	address string) (modbus.Tag, error) {
+	a, err := parseUint16(address)
+	if nil != err {
+		return modbus.Tag{}, err
+	}
+	t := o.format
+	t.Name = fmt.Sprintf("%v/%v", table, a)
+	t.SlaveID = o.unit
+	t.Table = table
+	t.Address = a
+	if table.IsBits() {
+		// The format only applies to registers.
+		t = modbus.Tag{Name: t.Name, SlaveID: t.SlaveID, Table: table,
+			Address: a}
+	}
+	if err := t.Normalize(); nil != err {
+		return t, usageError{err}
+	}
+	return t, nil
+}
+
+// parseTable returns the Table with the name.
+func parseTable(name string) (modbus.Table, error) {
+	var table modbus.Table
+	if err := table.UnmarshalText([]byte(name)); nil != err {
+		return table, usagef("Unknown table: %q", name)
+	}
+	return table, nil
+}
+
+// parseUint parses a decimal number, or a hex, octal or binary one with a
+// 0x, 0o or 0b prefix. A leading zero without a prefix does not make it
+// octal, so zero padded numbers are decimal.
+func parseUint(s string, bitSize int) (uint64, error) {
+	if len(s) > 2 && '0' == s[0] && strings.ContainsRune("xXoObB", rune(s[1])) {
+		return strconv.ParseUint(s, 0, bitSize)
+	}
+	return strconv.ParseUint(s, 10, bitSize)
+}
+
+// parseUint16 parses an address or register value, see parseUint.
+func parseUint16(s string) (uint16, error) {
+	v, err := parseUint(s, 16)
+	if nil != err {
+		return 0, usagef("Invalid address or value: %q", s)
+	}
+	return uint16(v), nil
+}
+
+// parseCount parses a positive count or quantity.
+func parseCount(s string) (int, error) {
+	v, err := parseUint(s, 16)
+	if nil != err || 0 == v {
+		return 0, usagef("Invalid count: %q", s)
+	}
+	return int(v), nil
+}
+
+// parseValues parses the values to write to consecutive Tags like t.
+func parseValues(t modbus.Tag, args []string) ([]interface{}, error) {
+	values := make([]interface{}, len(args))
+	for i, s := range args {
+		var err error
+		if values[i], err = textvalue.Parse(t, s); nil != err {
+			return nil, usagef("Value %q: %v", s, err)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/modbustest"
+)
+
+func newTestServer() *modbustest.Server {
+	s := modbustest.NewServer()
+	u := s.Units[1]
+	copy(u.HoldingRegisters[100:], modbus.EncodeFloat32(modbus.ByteOrderCDAB,
+		1.5, -2))
+	u.InputRegisters[10] = 215
+	copy(u.InputRegisters[20:], []uint16{0x4869, 0x2100})
+	u.Coils[3] = true
+	u.ServerID = []byte{0x42}
+	u.Disabled = map[modbus.FunctionCode]bool{
+		modbus.FunctionReadDiscreteInputs: true}
+	return s
+}
+
+// runArgs runs the command line args, after the flags connecting to the
+// Server, and returns the exit status and the output.
+func runArgs(s *modbustest.Server, args string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), append([]string{
+		"-host", s.Addr(), "-timeout", "100ms"},
+		strings.Fields(args)...), strings.NewReader(""), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+
+	for _, test := range []struct {
+		args   string
+		status int
+		want   string
+	}{
+		{"-type float32 -order CDAB read hr 100 2", 0, "1.5 -2\n"},
+		{"-format hex -type float32 -order CDAB read hr 100 2", 0,
+			"0x0000 0x3FC0 0x0000 0xC000\n"},
+		{"-format dec ReadHoldingRegisters 100 2", 0, "0 16320\n"},
+		{"-type int16 -scale 0.1 read ir 0xA", 0, "21.5\n"},
+		{"-type string -length 2 read ir 20", 0, "\"Hi!\"\n"},
+		{"read coil 2 3", 0, "false true false\n"},
+		{"-format hex readcoils 2 3", 0, "0 1 0\n"},
+		{"-format dec ReportServerID", 0, "66 255\n"},
+		{"ReportServerID", 0, "42ff\n"},
+
+		{"write hr 200 7", 0, ""},
+		{"write hr 201 0x10 0xFFFF", 0, ""},
+		{"-type float32 write hr 203 2.5", 0, ""},
+		{"read hr 200 3", 0, "7 16 65535\n"},
+		{"-type float32 read hr 203", 0, "2.5\n"},
+		{"WriteSingleRegister 200 8", 0, ""},
+		{"MaskWriteRegister 200 0x000F 0x0010", 0, ""},
+		{"WriteMultipleRegisters 210 1 2", 0, ""},
+		{"read hr 200", 0, "24\n"},
+		{"read hr 210 2", 0, "1 2\n"},
+		{"write coil 10 on", 0, ""},
+		{"WriteMultipleCoils 11 1 true", 0, ""},
+		{"WriteSingleCoil 13 1", 0, ""},
+		{"read coil 10 5", 0, "true true true true false\n"},
+
+		// Errors of the device.
+		{"read di 0", 1, ""},
+		{"read hr 999 2", 1, ""},
+		{"-unit 2 read hr 0", 1, ""},
+
+		// Errors of the command line.
+		{"", 2, ""},
+		{"bogus", 2, ""},
+		{"-mode tcpx read hr 0", 2, ""},
+		{"-format xml read hr 0", 2, ""},
+		{"-type float128 read hr 0", 2, ""},
+		{"-n 2 read hr 0", 2, ""},
+		{"-poll 1s write hr 0 1", 2, ""},
+		{"read xx 0", 2, ""},
+		{"read hr 65536", 2, ""},
+		{"read hr 0 0", 2, ""},
+		{"-type uint32 read hr 65535", 2, ""},
+		{"-type uint32 ReadHoldingRegisters 0 3", 2, ""},
+		{"ReadHoldingRegisters 0 126", 2, ""},
+		{"write ir 0 1", 2, ""},
+		{"write hr 0 x", 2, ""},
+		{"write hr 0 1.5", 2, ""},
+		{"write hr 0 -1", 2, ""},
+		{"write coil 0 2", 2, ""},
+		{"write hr 0", 2, ""},
+		{"-type uint32 WriteSingleRegister 0 1", 2, ""},
+		{"WriteSingleCoil 0 1 1", 2, ""},
+		{"MaskWriteRegister 0 1", 2, ""},
+		{"ReportServerID 1", 2, ""},
+	} {
+		status, stdout, stderr := runArgs(s, test.args)
+		if test.status != status {
+			t.Errorf("%v: Expected status %v but got %v: %v", test.args,
+				test.status, status, stderr)
+			continue
+		}
+		if test.want != stdout {
+			t.Errorf("%v: Expected %q but got %q", test.args, test.want,
+				stdout)
+		}
+		if (0 == status) != (len(stderr) == 0) {
+			t.Errorf("%v: Unexpected stderr: %q", test.args, stderr)
+		}
+	}
+}
+
+func TestRunPoll(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+	u := s.Units[1]
+
+	status, stdout, _ := runArgs(s,
+		"-poll 10ms -n 3 -format csv -type int16 read ir 10 2")
+	if 0 != status {
+		t.Fatalf("Unexpected status: %v", status)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 4 || "time,ir/10,ir/11" != lines[0] {
+		t.Fatalf("Unexpected CSV: %q", stdout)
+	}
+	row := regexp.MustCompile(`^\d{4}-\d\d-\d\dT[0-9:.]+\S*,215,0$`)
+	for _, line := range lines[1:] {
+		if !row.MatchString(line) {
+			t.Errorf("Unexpected CSV row: %q", line)
+		}
+	}
+
+	status, stdout, _ = runArgs(s, "-poll 10ms -n 2 -format hex read hr 0")
+	if 0 != status {
+		t.Fatalf("Unexpected status: %v", status)
+	}
+	line := regexp.MustCompile(`^\S+ 0x0000$`)
+	for _, l := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		if !line.MatchString(l) {
+			t.Errorf("Unexpected line: %q", l)
+		}
+	}
+
+	status, stdout, _ = runArgs(s, "-poll 10ms -n 2 -format json "+
+		"-type float32 -order CDAB read hr 100 2")
+	if 0 != status {
+		t.Fatalf("Unexpected status: %v", status)
+	}
+	dec := json.NewDecoder(strings.NewReader(stdout))
+	for i := 0; i < 2; i++ {
+		var v map[string]interface{}
+		if err := dec.Decode(&v); nil != err {
+			t.Fatal(err)
+		}
+		delete(v, "time")
+		data, _ := json.Marshal(v)
+		if want := `{"address":100,"table":"hr","type":"float32",` +
+			`"unit":1,"values":[1.5,-2]}`; want != string(data) {
+			t.Errorf("Expected %v but got %s", want, data)
+		}
+	}
+
+	// Failed polls are reported and polling continues.
+	s.Lock()
+	u.Disabled[modbus.FunctionReadHoldingRegisters] = true
+	s.Unlock()
+	status, stdout, stderr := runArgs(s, "-poll 10ms -n 2 read hr 0")
+	if 1 != status || len(stdout) > 0 ||
+		len(strings.Split(strings.TrimSpace(stderr), "\n")) != 2 {
+		t.Errorf("Unexpected status %v, output %q and errors %q", status,
+			stdout, stderr)
+	}
+
+	// Polling stops when the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if status := run(ctx, []string{"-host", s.Addr(), "-timeout", "100ms",
+		"-poll", "10ms", "read", "ir", "10"}, strings.NewReader(""),
+		&bytes.Buffer{}, &bytes.Buffer{}); 0 != status {
+		t.Errorf("Unexpected status: %v", status)
+	}
+}
+
+func TestRunScan(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+
+	status, stdout, stderr := runArgs(s, "-step 16384 scan 1-2")
+	want := `unit 1
+  functions:   ReadCoils ReadHoldingRegisters ReadInputRegisters ` +
+		`ReportServerID
+  unsupported: ReadDiscreteInputs
+  server id:   42ff
+  coil 0-999
+  ir   0-999
+  hr   0-999
+`
+	if 0 != status || want != stdout {
+		t.Errorf("Unexpected status %v and report %q: %v", status, stdout,
+			stderr)
+	}
+	status, stdout, stderr = runArgs(s,
+		"-step 16384 -probe-writes scan 1")
+	if 0 != status || !strings.Contains(stdout, " WriteSingleCoil "+
+		"WriteMultipleCoils WriteMultipleRegisters ReportServerID "+
+		"MaskWriteRegister\n") {
+		t.Errorf("Unexpected status %v and report %q: %v", status, stdout,
+			stderr)
+	}
+
+	status, stdout, _ = runArgs(s, "-step 16384 -format json scan 1")
+	var results []jsonScanResult
+	if err := json.Unmarshal([]byte(stdout), &results); nil != err {
+		t.Fatal(err)
+	}
+	if 0 != status || len(results) != 1 || 1 != results[0].Unit ||
+		len(results[0].Ranges) != 3 || "42ff" != results[0].ServerID {
+		t.Errorf("Unexpected status %v and results %+v", status, results)
+	}
+
+	status, stdout, stderr = runArgs(s, "-step 16384 -format csv scan 1")
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if 0 != status || len(lines) != 1+3*maxMapAddresses ||
+		"name,unit,table,address" != lines[0] ||
+		"u1_coil_0,1,coil,0" != lines[1] ||
+		len(strings.Split(strings.TrimSpace(stderr), "\n")) != 3 {
+		t.Errorf("Unexpected status %v and map %q: %v", status, stdout,
+			stderr)
+	}
+	if _, err := modbus.ReadTagMapCSV(strings.NewReader(
+		stdout)); nil != err {
+		t.Error(err)
+	}
+
+	for _, args := range []string{"scan 3", "scan 2-1", "scan 1 2",
+		"scan 256", "-step 0 scan", "-poll 1s scan 1"} {
+		status, _, stderr := runArgs(s, args)
+		want := 2
+		if "scan 3" == args {
+			want = 1
+		}
+		if want != status {
+			t.Errorf("%v: Expected status %v but got %v: %v", args, want,
+				status, stderr)
+		}
+	}
+}
+
+func TestParseUint(t *testing.T) {
+	for s, want := range map[string]uint64{"100": 100, "0100": 100,
+		"0108": 108, "0x10": 16, "0X10": 16, "0o10": 8, "0b10": 2, "0": 0} {
+		if v, err := parseUint(s, 16); nil != err || want != v {
+			t.Errorf("parseUint(%q) want: %v got: %v, %v", s, want, v, err)
+		}
+	}
+	for _, s := range []string{"", "0x", "010a", "-1", "70000"} {
+		if v, err := parseUint(s, 16); nil == err {
+			t.Errorf("parseUint(%q) returned %v", s, v)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/jsonvalue"
+)
+
+// timeFormat is the format of the times in the text and CSV output.
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// formats are the output formats.
+var formats = map[string]bool{
+	"hex":   true,
+	"dec":   true,
+	"typed": true,
+	"json":  true,
+	"csv":   true,
+}
+
+// output writes readings in one of the formats. The text formats hex, dec and
+// typed write a line of space separated values per reading, prefixed with
+// the time of the reading if times is set. Hex and dec show the raw
+// registers, or 0 and 1 for coils and discrete inputs, while typed shows the
+// values in the format of the options. JSON writes an object per line and
+// CSV a row per reading, after a header row.
+type output struct {
+	w      io.Writer
+	format string
+	times  bool
+
+	csv    *csv.Writer
+	header bool
+}
+
+// jsonReading is the JSON output of a reading of values.
+type jsonReading struct {
+	Time    time.Time       `json:"time"`
+	Unit    byte            `json:"unit"`
+	Table   modbus.Table    `json:"table"`
+	Address uint16          `json:"address"`
+	Type    modbus.DataType `json:"type"`
+	Values  []interface{}   `json:"values"`
+}
+
+// jsonResponse is the JSON output of a reading of raw data.
+type jsonResponse struct {
+	Time     time.Time `json:"time"`
+	Unit     byte      `json:"unit"`
+	Function string    `json:"function"`
+	Data     string    `json:"data"`
+}
+
+// newOutput returns the output of the format to w.
+func newOutput(w io.Writer, format string, times bool) *output {
+	return &output{w: w, format: format, times: times, csv: csv.NewWriter(w)}
+}
+
+// write writes the reading.
+func (o *output) write(r *reading) error {
+	switch o.format {
+	case "json":
+		return o.writeJSON(r)
+	case "csv":
+		return o.writeCSV(r)
+	}
+	var fields []string
+	var err error
+	if "typed" == o.format {
+		fields, err = typedFields(r, strconv.Quote)
+	} else {
+		fields, err = rawFields(r, "hex" == o.format)
+	}
+	if nil != err {
+		return err
+	}
+	if o.times {
+		fields = append([]string{r.time.Format(timeFormat)}, fields...)
+	}
+	_, err = fmt.Fprintln(o.w, strings.Join(fields, " "))
+	return err
+}
+
+// writeJSON writes the reading as a JSON object on a line.
+func (o *output) writeJSON(r *reading) error {
+	var v interface{}
+	if 0 == r.tag.Table {
+		v = jsonResponse{Time: r.time, Unit: r.tag.SlaveID,
+			Function: modbus.FunctionNames[r.fCode],
+			Data:     hex.EncodeToString(r.data)}
+	} else {
+		values, err := decodeValues(r)
+		if nil != err {
+			return err
+		}
+		for i := range values {
+			if !jsonvalue.IsFinite(values[i]) {
+				values[i] = nil
+			}
+		}
+		v = jsonReading{Time: r.time, Unit: r.tag.SlaveID,
+			Table: r.tag.Table, Address: r.tag.Address,
+			Type: r.tag.Type, Values: values}
+	}
+	data, err := json.Marshal(v)
+	if nil != err {
+		return err
+	}
+	_, err = fmt.Fprintf(o.w, "%s\n", data)
+	return err
+}
+
+// writeCSV writes the reading as a row, preceded by the header row if it is
+// the first. The header names the columns after the addresses of the values.
+func (o *output) writeCSV(r *reading) error {
+	fields, err := typedFields(r, func(s string) string { return s })
+	if nil != err {
+		return err
+	}
+	if !o.header {
+		o.header = true
+		header := []string{"time"}
+		if 0 == r.tag.Table {
+			header = append(header, modbus.FunctionNames[r.fCode])
+		}
+		for i := 0; i < r.count; i++ {
+			header = append(header, fmt.Sprintf("%v/%v", r.tag.Table,
+				int(r.tag.Address)+i*int(r.tag.Quantity())))
+		}
+		o.csv.Write(header)
+	}
+	o.csv.Write(append([]string{r.time.Format(timeFormat)}, fields...))
+	o.csv.Flush()
+	return o.csv.Error()
+}
+
+// typedFields returns the values of the reading formatted as text, with
+// strings formatted by str. Raw data is formatted as a hex string.
+func typedFields(r *reading, str func(string) string) ([]string, error) {
+	if 0 == r.tag.Table {
+		return []string{hex.EncodeToString(r.data)}, nil
+	}
+	values, err := decodeValues(r)
+	if nil != err {
+		return nil, err
+	}
+	fields := make([]string, len(values))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			fields[i] = str(s)
+		} else {
+			fields[i] = fmt.Sprint(v)
+		}
+	}
+	return fields, nil
+}
+
+// rawFields returns the registers of the reading in hex or decimal, 0 or 1
+// for bits, or the bytes of raw data.
+func rawFields(r *reading, hexadecimal bool) ([]string, error) {
+	var fields []string
+	switch {
+	case 0 == r.tag.Table:
+		for _, b := range r.data {
+			if hexadecimal {
+				fields = append(fields, fmt.Sprintf("0x%02X", b))
+			} else {
+				fields = append(fields, strconv.Itoa(int(b)))
+			}
+		}
+	case r.tag.Table.IsBits():
+		bits, err := modbus.DecodeCoils(r.data,
+			uint16(r.count)*r.tag.Quantity())
+		if nil != err {
+			return nil, err
+		}
+		for _, b := range bits {
+			if b {
+				fields = append(fields, "1")
+			} else {
+				fields = append(fields, "0")
+			}
+		}
+	default:
+		regs, err := modbus.DecodeUint16(r.data, modbus.ByteOrderABCD)
+		if nil != err {
+			return nil, err
+		}
+		for _, reg := range regs {
+			if hexadecimal {
+				fields = append(fields, fmt.Sprintf("0x%04X", reg))
+			} else {
+				fields = append(fields, strconv.Itoa(int(reg)))
+			}
+		}
+	}
+	return fields, nil
+}
+
+// decodeValues returns the values of the reading, decoded like its Tag.
+func decodeValues(r *reading) ([]interface{}, error) {
+	values := make([]interface{}, r.count)
+	if r.tag.Table.IsBits() {
+		bits, err := modbus.DecodeCoils(r.data, uint16(r.count))
+		if nil != err {
+			return nil, err
+		}
+		for i, b := range bits {
+			values[i] = b
+		}
+		return values, nil
+	}
+	size := 2 * int(r.tag.Quantity())
+	if len(r.data) != size*r.count {
+		return nil, fmt.Errorf("Expected %v bytes but got %v",
+			size*r.count, len(r.data))
+	}
+	for i := range values {
+		v, err := r.tag.Decode(r.data[i*size : (i+1)*size])
+		if nil != err {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+// scanTimeout is the response timeout of scans unless -timeout is given.
+const scanTimeout = 100 * time.Millisecond
+
+// maxMapAddresses limits the number of Tags of a range in a starter register
+// map.
+const maxMapAddresses = 100
+
+// jsonScanResult is the JSON output of a modbus.ScanResult.
+type jsonScanResult struct {
+	Unit        byte            `json:"unit"`
+	Functions   []string        `json:"functions"`
+	Unsupported []string        `json:"unsupported"`
+	ServerID    string          `json:"serverID,omitempty"`
+	Ranges      []jsonScanRange `json:"ranges"`
+}
+
+// jsonScanRange is the JSON output of a modbus.ScanRange.
+type jsonScanRange struct {
+	Table modbus.Table `json:"table"`
+	First uint16       `json:"first"`
+	Last  uint16       `json:"last"`
+}
+
+// parseScan parses the arguments of the scan command, [first[-last]], into
+// the SlaveIDs to scan.
+func parseScan(args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, usagef("Usage: scan [first[-last]]")
+	}
+	first, last := 1, 247
+	if len(args) > 0 {
+		ids := strings.SplitN(args[0], "-", 2)
+		var err error
+		if first, err = parseUnit(ids[0]); nil != err {
+			return nil, err
+		}
+		last = first
+		if len(ids) > 1 {
+			if last, err = parseUnit(ids[1]); nil != err {
+				return nil, err
+			}
+		}
+		if last < first {
+			return nil, usagef("Invalid units: %q", args[0])
+		}
+	}
+	var slaveIDs []byte
+	for id := first; id <= last; id++ {
+		slaveIDs = append(slaveIDs, byte(id))
+	}
+	return slaveIDs, nil
+}
+
+// parseUnit parses a SlaveID, see parseUint.
+func parseUnit(s string) (int, error) {
+	v, err := parseUint(s, 8)
+	if nil != err {
+		return 0, usagef("Invalid unit: %q", s)
+	}
+	return int(v), nil
+}
+
+// scan scans the bus and writes the devices found in the format, which is a
+// report for the text formats, JSON, or a starter register map for CSV.
+func scan(ctx context.Context, ch modbus.ClientHandle, opts modbus.ScanOptions,
+	format string, stdout, stderr io.Writer) error {
+	results, err := modbus.Scan(ctx, ch, opts)
+	if nil != err {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("No devices found")
+	}
+	switch format {
+	case "json":
+		return writeScanJSON(stdout, results)
+	case "csv":
+		return writeScanMap(stdout, stderr, results)
+	}
+	return writeScanReport(stdout, results)
+}
+
+// functions returns the names of the FunctionCodes that are supported, or
+// not, by the device in the order of their codes.
+func functions(res modbus.ScanResult, supported bool) []string {
+	var codes []int
+	for fCode, ok := range res.Functions {
+		if ok == supported {
+			codes = append(codes, int(fCode))
+		}
+	}
+	sort.Ints(codes)
+	names := []string{}
+	for _, fCode := range codes {
+		names = append(names, modbus.FunctionNames[modbus.FunctionCode(fCode)])
+	}
+	return names
+}
+
+// writeScanReport writes a section per device:
+//
+//	unit 2
+//	  functions:   ReadHoldingRegisters ReadInputRegisters
+//	  unsupported: ReadCoils
+//	  server id:   42ff
+//	  hr 0-999
+func writeScanReport(w io.Writer, results []modbus.ScanResult) error {
+	for _, res := range results {
+		fmt.Fprintf(w, "unit %v\n", res.SlaveID)
+		fmt.Fprintf(w, "  functions:   %v\n",
+			strings.Join(functions(res, true), " "))
+		if unsupported := functions(res, false); len(unsupported) > 0 {
+			fmt.Fprintf(w, "  unsupported: %v\n",
+				strings.Join(unsupported, " "))
+		}
+		if len(res.ServerID) > 0 {
+			fmt.Fprintf(w, "  server id:   %x\n", res.ServerID)
+		}
+		for _, r := range res.Ranges {
+			if _, err := fmt.Fprintf(w, "  %-4v %v-%v\n", r.Table, r.First,
+				r.Last); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeScanJSON writes the results as a JSON array.
+func writeScanJSON(w io.Writer, results []modbus.ScanResult) error {
+	out := make([]jsonScanResult, len(results))
+	for i, res := range results {
+		out[i] = jsonScanResult{
+			Unit:        res.SlaveID,
+			Functions:   functions(res, true),
+			Unsupported: functions(res, false),
+			ServerID:    hex.EncodeToString(res.ServerID),
+			Ranges:      []jsonScanRange{},
+		}
+		for _, r := range res.Ranges {
+			out[i].Ranges = append(out[i].Ranges, jsonScanRange(r))
+		}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if nil != err {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// writeScanMap writes a CSV register map with a Tag of the default type for
+// each readable address, named after its unit, table and address. Ranges
+// with more than maxMapAddresses addresses are truncated, which is reported
+// to stderr.
+func writeScanMap(stdout, stderr io.Writer,
+	results []modbus.ScanResult) error {
+	w := csv.NewWriter(stdout)
+	w.Write([]string{"name", "unit", "table", "address"})
+	for _, res := range results {
+		for _, r := range res.Ranges {
+			last := int(r.Last)
+			if last-int(r.First) >= maxMapAddresses {
+				last = int(r.First) + maxMapAddresses - 1
+				fmt.Fprintf(stderr, "Unit %v %v %v-%v truncated to %v "+
+					"addresses\n", res.SlaveID, r.Table, r.First, r.Last,
+					maxMapAddresses)
+			}
+			for a := int(r.First); a <= last; a++ {
+				w.Write([]string{
+					fmt.Sprintf("u%v_%v_%v", res.SlaveID, r.Table, a),
+					strconv.Itoa(int(res.SlaveID)),
+					r.Table.String(),
+					strconv.Itoa(a),
+				})
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/lineedit"
+)
+
+// historyFile is the name of the file in the home directory that keeps the
+// history of the shell.
+const historyFile = ".modbus_history"
+
+// shellCommands are the commands of the shell besides the functions.
+var shellCommands = []string{"read", "write", "watch", "type", "interval",
+	"help", "exit", "quit"}
+
+const shellHelp = `Commands:
+  read <table> <unit> <address> [count] [type] [order]
+  write <table> <unit> <address> <value>...
+  watch <table> <unit> <address> [count] [type] [order]
+  <function> <unit> <arguments>
+  type [type] [order] [length]
+  interval [duration]
+  help
+  exit
+Tables: coil, di, ir, hr
+Functions: %v
+`
+
+// errExit is returned by shell.exec to end the session.
+var errExit = errors.New("Exit")
+
+// shell is an interactive session on a connection. Commands name the unit
+// to send to and the values are in the format of the session unless the
+// command gives a type or byte order.
+type shell struct {
+	opts     options
+	ch       modbus.ClientHandle
+	e        *lineedit.Editor
+	w        io.Writer
+	interval time.Duration
+	// redraw is set if watch can redraw its output in place.
+	redraw bool
+}
+
+// runShell runs an interactive shell on a single connection until exit or
+// the end of stdin and returns the exit status. If stdin is a terminal,
+// lines are edited with history and tab completion.
+func runShell(ctx context.Context, opts options, interval time.Duration,
+	stdin io.Reader, stdout, stderr io.Writer) int {
+	ch, err := modbus.GetClientHandle(opts.cs)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	defer ch.Close()
+
+	edit := false
+	if f, ok := stdin.(*os.File); ok && lineedit.IsTerminal(int(f.Fd())) {
+		restore, err := lineedit.MakeRaw(int(f.Fd()))
+		if nil == err {
+			defer restore()
+			edit = true
+		}
+	}
+	if 0 == interval {
+		interval = time.Second
+	}
+	s := &shell{opts: opts, ch: ch, e: lineedit.New(stdin, stdout, edit),
+		w: stdout, interval: interval, redraw: edit}
+	s.e.Prompt = "modbus> "
+	s.e.Complete = complete
+	if edit {
+		loadHistory(s.e)
+		defer saveHistory(s.e)
+	}
+
+	for nil == ctx.Err() {
+		line, err := s.e.ReadLine()
+		if lineedit.ErrInterrupt == err {
+			continue
+		}
+		if nil != err {
+			break
+		}
+		s.e.AddHistory(line)
+		if err := s.exec(ctx, line); nil != err {
+			if errExit == err {
+				break
+			}
+			if nil == ctx.Err() {
+				fmt.Fprintln(stderr, err)
+			}
+		}
+	}
+	return 0
+}
+
+// exec executes the command line.
+func (s *shell) exec(ctx context.Context, line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	name, args := args[0], args[1:]
+	switch name {
+	case "exit", "quit":
+		return errExit
+	case "help":
+		_, err := fmt.Fprintf(s.w, shellHelp,
+			strings.Join(functionNames(), ", "))
+		return err
+	case "type":
+		return s.setFormat(args)
+	case "interval":
+		if len(args) > 0 {
+			d, err := time.ParseDuration(args[0])
+			if nil != err || len(args) > 1 || d <= 0 {
+				return usagef("Usage: interval [duration]")
+			}
+			s.interval = d
+		}
+		_, err := fmt.Fprintln(s.w, s.interval)
+		return err
+	}
+
+	var cmd command
+	var err error
+	o := s.opts
+	switch name {
+	case "read", "watch":
+		if cmd, err = o.parseShellRead(name, args); nil != err {
+			return err
+		}
+	case "write":
+		if len(args) < 4 {
+			return usagef("Usage: write <table> <unit> <address> " +
+				"<value>...")
+		}
+		if err := o.setUnit(args[1]); nil != err {
+			return err
+		}
+		cmd, err = o.parseWrite(append([]string{args[0]}, args[2:]...))
+		if nil != err {
+			return err
+		}
+	default:
+		if _, ok := functionCode(name); !ok {
+			return usagef("Unknown command: %q", name)
+		}
+		if len(args) == 0 {
+			return usagef("Usage: %v <unit> <arguments>", name)
+		}
+		if err := o.setUnit(args[0]); nil != err {
+			return err
+		}
+		if cmd, _, err = o.parseCommand(append([]string{name},
+			args[1:]...)); nil != err {
+			return err
+		}
+	}
+	if "watch" == name {
+		return s.watch(ctx, cmd)
+	}
+	r, err := cmd(ctx, s.ch)
+	if nil != err {
+		return err
+	}
+	if nil == r {
+		_, err = fmt.Fprintln(s.w, "ok")
+		return err
+	}
+	return writeView(s.w, r)
+}
+
+// parseShellRead parses the arguments of the read and watch commands:
+// <table> <unit> <address> [count] [type] [order].
+func (o *options) parseShellRead(name string, args []string) (command,
+	error) {
+	if len(args) < 3 {
+		return nil, usagef("Usage: %v <table> <unit> <address> [count] "+
+			"[type] [order]", name)
+	}
+	if err := o.setUnit(args[1]); nil != err {
+		return nil, err
+	}
+	rest := parseFormat(&o.format, args[3:])
+	if len(rest) > 1 {
+		return nil, usagef("Unexpected arguments: %v",
+			strings.Join(rest[1:], " "))
+	}
+	return o.parseRead(append([]string{args[0], args[2]}, rest...))
+}
+
+// setUnit sets the unit of the options.
+func (o *options) setUnit(s string) error {
+	unit, err := parseUnit(s)
+	if nil != err {
+		return err
+	}
+	o.unit = byte(unit)
+	return nil
+}
+
+// parseFormat sets the Type and ByteOrder of t to those named in args and
+// returns the other arguments.
+func parseFormat(t *modbus.Tag, args []string) []string {
+	var rest []string
+	for _, arg := range args {
+		if dataType, ok := modbus.DataTypesByName[strings.ToLower(
+			arg)]; ok {
+			t.Type = dataType
+			if modbus.DataTypeString != dataType {
+				t.Length = 0
+			}
+			continue
+		}
+		if order, ok := modbus.ByteOrderByName[strings.ToUpper(
+			arg)]; ok {
+			t.ByteOrder = order
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest
+}
+
+// setFormat sets, and prints, the format of the session:
+// [type] [order] [length].
+func (s *shell) setFormat(args []string) error {
+	o := s.opts
+	rest := parseFormat(&o.format, args)
+	if len(rest) > 1 {
+		return usagef("Usage: type [type] [order] [length]")
+	}
+	if len(rest) > 0 {
+		length, err := parseCount(rest[0])
+		if nil != err {
+			return usagef("Unknown type, byte order or length: %q",
+				rest[0])
+		}
+		o.format.Length = uint16(length)
+	}
+	// The format is validated with a register Tag.
+	if _, err := o.newTag(modbus.TableHoldingRegisters, "0"); nil != err {
+		return err
+	}
+	s.opts = o
+	f := o.format
+	var err error
+	if modbus.DataTypeString == f.Type {
+		_, err = fmt.Fprintf(s.w, "%v %v %v\n", f.Type, f.ByteOrder,
+			f.Length)
+	} else {
+		_, err = fmt.Fprintf(s.w, "%v %v\n", f.Type, f.ByteOrder)
+	}
+	return err
+}
+
+// watch repeats the read command at the interval of the session and shows
+// its latest result, in place if possible, until a key is pressed or, if
+// lines are not edited, a line is entered. Failed reads are shown without
+// stopping. Unless the ctx is done, watch only returns once the key has been
+// read, so that the key is not taken from the next command, and an error
+// writing the output is returned then.
+func (s *shell) watch(ctx context.Context, cmd command) error {
+	stop := make(chan error, 1)
+	go func() {
+		stop <- s.e.WaitKey()
+	}()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	lines := 0
+	var werr error
+	for {
+		if nil == werr {
+			lines, werr = s.show(ctx, cmd, lines)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return werr
+		case <-ticker.C:
+		}
+	}
+}
+
+// show runs the read command and shows its result in place of the previous
+// result, which is the given number of lines, and returns the number of lines
+// shown.
+func (s *shell) show(ctx context.Context, cmd command, lines int) (int,
+	error) {
+	r, err := cmd(ctx, s.ch)
+	if nil != ctx.Err() {
+		return lines, nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%v\n", time.Now().Format(timeFormat))
+	if nil == err {
+		err = writeView(&buf, r)
+	}
+	if nil != err {
+		fmt.Fprintln(&buf, err)
+	}
+	if s.redraw && lines > 0 {
+		// Move up to the previous result and clear it.
+		fmt.Fprintf(s.w, "\x1b[%vA\x1b[J", lines)
+	}
+	_, err = s.w.Write(buf.Bytes())
+	return bytes.Count(buf.Bytes(), []byte("\n")), err
+}
+
+// writeView writes the decoded and hex views of the reading as a row per
+// value with its address, registers and value:
+//
+//	hr 100  0x3FC0 0x0000  1.5
+//	coil 5  1              true
+//
+// Raw data is written in hex after the function name.
+func writeView(w io.Writer, r *reading) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if 0 == r.tag.Table {
+		fmt.Fprintf(tw, "%v\t% X\n", modbus.FunctionNames[r.fCode],
+			r.data)
+		return tw.Flush()
+	}
+	raw, err := rawFields(r, true)
+	if nil != err {
+		return err
+	}
+	values, err := typedFields(r, strconv.Quote)
+	if nil != err {
+		return err
+	}
+	q := int(r.tag.Quantity())
+	for i, v := range values {
+		fmt.Fprintf(tw, "%v %v\t%v\t%v\n", r.tag.Table,
+			int(r.tag.Address)+i*q, strings.Join(raw[i*q:(i+1)*q], " "),
+			v)
+	}
+	return tw.Flush()
+}
+
+// complete returns the completions of the last word of the line, which are
+// the commands and function names, the tables, and the types and byte
+// orders, depending on its position.
+func complete(line string) []string {
+	args := strings.Fields(line)
+	if len(args) == 0 || strings.HasSuffix(line, " ") {
+		args = append(args, "")
+	}
+	word := args[len(args)-1]
+	var candidates []string
+	switch name, n := args[0], len(args); {
+	case 1 == n:
+		candidates = append(candidates, shellCommands...)
+		candidates = append(candidates, functionNames()...)
+	case 2 == n && ("read" == name || "write" == name ||
+		"watch" == name):
+		for _, table := range modbus.TableNames {
+			candidates = append(candidates, table)
+		}
+	case "type" == name && n <= 3,
+		n >= 5 && ("read" == name || "watch" == name):
+		for _, dataType := range modbus.DataTypeNames {
+			candidates = append(candidates, dataType)
+		}
+		for _, order := range modbus.ByteOrderNames {
+			candidates = append(candidates, order)
+		}
+	}
+	var completions []string
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c), strings.ToLower(word)) {
+			completions = append(completions, c)
+		}
+	}
+	sort.Slice(completions, func(i, j int) bool {
+		return strings.ToLower(completions[i]) <
+			strings.ToLower(completions[j])
+	})
+	return completions
+}
+
+// loadHistory loads the history of the editor from the historyFile, if it
+// exists.
+func loadHistory(e *lineedit.Editor) {
+	home, err := os.UserHomeDir()
+	if nil != err {
+		return
+	}
+	f, err := os.Open(filepath.Join(home, historyFile))
+	if nil != err {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e.AddHistory(scanner.Text())
+	}
+}
+
+// saveHistory saves the history of the editor to the historyFile.
+func saveHistory(e *lineedit.Editor) {
+	home, err := os.UserHomeDir()
+	if nil != err {
+		return
+	}
+	history := e.History()
+	if len(history) == 0 {
+		return
+	}
+	os.WriteFile(filepath.Join(home, historyFile),
+		[]byte(strings.Join(history, "\n")+"\n"), 0600)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	"github.com/AdamSLevy/modbus/internal/lineedit"
+)
+
+func TestShell(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+
+	input := `read hr 1 100 2 float32 CDAB
+write coil 1 5 on
+read coil 1 4 3
+ReadInputRegisters 1 10
+type float32 cdab
+read hr 1 102
+ReportServerID 1
+write hr 1 110 2.5 -1
+read hr 1 110 2
+type string ABCD 2
+read ir 1 20
+watch ir 1 10 1 int16
+
+interval 10ms
+read di 1 0
+read hr 2 0
+read xx 1 0
+write ir 1 0 1
+bogus
+ReadCoils
+type float128
+
+exit
+read hr 1 0
+`
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), []string{"-host", s.Addr(),
+		"-timeout", "100ms", "shell"}, strings.NewReader(input), &stdout,
+		&stderr)
+	if 0 != status {
+		t.Fatalf("Unexpected status %v: %v", status, stderr.String())
+	}
+	want := `hr 100  0x0000 0x3FC0  1.5
+hr 102  0x0000 0xC000  -2
+ok
+coil 4  0  false
+coil 5  1  true
+coil 6  0  false
+ir 10  0x00D7  215
+float32 CDAB
+hr 102  0x0000 0xC000  -2
+ReportServerID  42 FF
+ok
+hr 110  0x0000 0x4020  2.5
+hr 112  0x0000 0xBF80  -1
+string ABCD 2
+ir 20  0x4869 0x2100  "Hi!"
+TIME
+ir 10  0x00D7  215
+10ms
+`
+	got := regexp.MustCompile(`(?m)^\d{4}-\d\d-\d\dT\S+$`).ReplaceAllString(
+		stdout.String(), "TIME")
+	if want != got {
+		t.Errorf("Expected:\n%v\nbut got:\n%v", want, got)
+	}
+	if errors := strings.Split(strings.TrimSpace(stderr.String()),
+		"\n"); len(errors) != 7 {
+		t.Errorf("Unexpected errors: %q", errors)
+	}
+}
+
+// errWriter fails every write.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errors.New("Write failed")
+}
+
+func TestWatchWriteError(t *testing.T) {
+	e := lineedit.New(strings.NewReader("\nnext\n"), ioutil.Discard, false)
+	s := &shell{e: e, w: errWriter{}, interval: 10 * time.Millisecond}
+	err := s.watch(context.Background(), func(ctx context.Context,
+		ch modbus.ClientHandle) (*reading, error) {
+		return nil, errors.New("Read failed")
+	})
+	if nil == err {
+		t.Error("Write error is nil")
+	}
+	// Only the line that stopped watch is read.
+	if line, err := e.ReadLine(); "next" != line || nil != err {
+		t.Errorf("ReadLine want: next got: %q %v", line, err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want []string
+	}{
+		{"wr", []string{"write", "WriteMultipleCoils",
+			"WriteMultipleRegisters", "WriteSingleCoil",
+			"WriteSingleRegister"}},
+		{"readh", []string{"ReadHoldingRegisters"}},
+		{"read ", []string{"coil", "di", "hr", "ir"}},
+		{"watch h", []string{"hr"}},
+		{"read hr 1 100 f", []string{"float32", "float64"}},
+		{"read hr 1 100 10 c", []string{"CDAB"}},
+		{"type u", []string{"uint16", "uint32", "uint64"}},
+		{"read hr 1 ", nil},
+		{"write hr 1 0 ", nil},
+	} {
+		if got := complete(test.line); !reflect.DeepEqual(test.want,
+			got) {
+			t.Errorf("%q: Expected %q but got %q", test.line, test.want,
+				got)
+		}
+	}
+}
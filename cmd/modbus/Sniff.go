@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+// jsonTransaction is the JSON output of a modbus.Transaction.
+type jsonTransaction struct {
+	Request  *jsonFrame `json:"request,omitempty"`
+	Response *jsonFrame `json:"response,omitempty"`
+	// Latency is in milliseconds.
+	Latency float64 `json:"latency,omitempty"`
+}
+
+// jsonFrame is the JSON output of a modbus.SniffedFrame.
+type jsonFrame struct {
+	Time       time.Time `json:"time"`
+	Unit       byte      `json:"unit"`
+	Function   string    `json:"function"`
+	Exception  string    `json:"exception,omitempty"`
+	Text       string    `json:"text"`
+	Raw        string    `json:"raw"`
+	ChecksumOK bool      `json:"checksumOK"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// sniff listens to the serial bus of the options without sending anything
+// and writes the Transactions in the format.
+func sniff(ctx context.Context, opts options, silence time.Duration,
+	format string, stdout io.Writer) error {
+	if modbus.ModeTCP == opts.cs.Mode {
+		return usagef("Sniff requires -mode rtu or ascii")
+	}
+	if "typed" != format && "json" != format {
+		return usagef("Sniff supports the typed and json formats")
+	}
+	port, err := modbus.OpenSerialTap(opts.cs.Host, opts.cs.Baud)
+	if nil != err {
+		return err
+	}
+	defer port.Close()
+	return writeSniff(ctx, port, modbus.SniffOptions{Mode: opts.cs.Mode,
+		Baud: opts.cs.Baud, Silence: silence, Timeout: opts.cs.Timeout},
+		format, stdout)
+}
+
+// writeSniff sniffs r and writes the Transactions in the format until the
+// end of r or the ctx is done, which is not an error.
+func writeSniff(ctx context.Context, r io.Reader, opts modbus.SniffOptions,
+	format string, w io.Writer) error {
+	var werr error
+	err := modbus.Sniff(ctx, r, opts, func(t modbus.Transaction) {
+		if nil != werr {
+			return
+		}
+		if "json" == format {
+			werr = writeTransactionJSON(w, t)
+		} else {
+			werr = writeTransaction(w, t)
+		}
+	})
+	if nil != ctx.Err() {
+		err = nil
+	}
+	if nil == err {
+		err = werr
+	}
+	return err
+}
+
+// writeTransaction writes a line per frame of the Transaction with its time
+// and decoded text. Responses are followed by their latency, and valid
+// requests without a response by "no response":
+//
+//	2024-01-02T15:04:05.000Z RTU request slave=1 ReadHoldingRegisters(0x03) address=0 quantity=2 crc=0x0BC4 ok
+//	2024-01-02T15:04:05.012Z RTU response slave=1 ReadHoldingRegisters(0x03) bytes=4 registers=[0x3FC0 0x0000] crc=0x1BF6 ok 12ms
+//
+// Malformed frames are followed by the error and the raw frame.
+func writeTransaction(w io.Writer, t modbus.Transaction) error {
+	var lines []string
+	if nil != t.Request {
+		line := frameText(t.Request)
+		if nil == t.Response && nil == t.Request.Err &&
+			t.Request.ChecksumOK && 0 != t.Request.SlaveID {
+			line += " no response"
+		}
+		lines = append(lines, line)
+	}
+	if nil != t.Response {
+		line := frameText(t.Response)
+		if nil != t.Request {
+			line += fmt.Sprintf(" %v",
+				t.Latency().Round(100*time.Microsecond))
+		}
+		lines = append(lines, line)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// frameText returns the time and decoded text of the frame, followed by the
+// error and the raw frame if it is malformed.
+func frameText(f *modbus.SniffedFrame) string {
+	text := fmt.Sprintf("%v %v", f.Time.Format(timeFormat), f.Frame)
+	if nil != f.Err {
+		text += fmt.Sprintf(": %v (%v)", f.Err, rawText(f))
+	}
+	return text
+}
+
+// rawText returns the raw frame in hex, or as text for ASCII.
+func rawText(f *modbus.SniffedFrame) string {
+	if modbus.ModeASCII == f.Mode {
+		return strings.TrimSpace(string(f.Raw))
+	}
+	return hex.EncodeToString(f.Raw)
+}
+
+// writeTransactionJSON writes the Transaction as a JSON object on a line.
+func writeTransactionJSON(w io.Writer, t modbus.Transaction) error {
+	out := jsonTransaction{Request: newJSONFrame(t.Request),
+		Response: newJSONFrame(t.Response),
+		Latency:  t.Latency().Seconds() * 1000}
+	data, err := json.Marshal(out)
+	if nil != err {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// newJSONFrame returns the JSON output of the frame, or nil.
+func newJSONFrame(f *modbus.SniffedFrame) *jsonFrame {
+	if nil == f {
+		return nil
+	}
+	out := &jsonFrame{Time: f.Time, Unit: f.SlaveID,
+		Function: modbus.FunctionNames[f.FunctionCode],
+		Text:     f.Frame.String(), Raw: rawText(f),
+		ChecksumOK: f.ChecksumOK}
+	if 0 != f.Exception {
+		out.Exception = modbus.ExceptionNames[uint16(f.Exception)]
+	}
+	if nil != f.Err {
+		out.Error = f.Err.Error()
+	}
+	return out
+}
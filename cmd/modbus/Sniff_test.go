@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+func TestWriteSniff(t *testing.T) {
+	// A read request and its response and an unanswered write request,
+	// delivered in a single chunk.
+	bus, _ := hex.DecodeString("010300000002c40b" +
+		"0103043fc00000f61b" + "02060001000799fb")
+	opts := modbus.SniffOptions{Mode: modbus.ModeRTU}
+
+	var out bytes.Buffer
+	if err := writeSniff(context.Background(), bytes.NewReader(bus), opts,
+		"typed", &out); nil != err {
+		t.Fatal(err)
+	}
+	want := regexp.MustCompile(`^\S+ RTU request slave=1 ` +
+		`ReadHoldingRegisters\(0x03\) address=0 quantity=2 crc=0x0BC4 ok
+\S+ RTU response slave=1 ReadHoldingRegisters\(0x03\) bytes=4 ` +
+		`registers=\[0x3FC0 0x0000\] crc=0x1BF6 ok \S+s
+\S+ RTU request slave=2 WriteSingleRegister\(0x06\) address=1 ` +
+		`registers=\[0x0007\] crc=0xFB99 ok no response
+$`)
+	if !want.MatchString(out.String()) {
+		t.Errorf("Unexpected log:\n%v", out.String())
+	}
+
+	out.Reset()
+	if err := writeSniff(context.Background(), bytes.NewReader(
+		[]byte{1, 3, 0}), opts, "typed", &out); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "(010300)\n") {
+		t.Errorf("Unexpected log of malformed frame: %v", out.String())
+	}
+
+	out.Reset()
+	if err := writeSniff(context.Background(), bytes.NewReader(bus), opts,
+		"json", &out); nil != err {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Unexpected JSON: %v", out.String())
+	}
+	var tr jsonTransaction
+	if err := json.Unmarshal([]byte(lines[0]), &tr); nil != err {
+		t.Fatal(err)
+	}
+	if nil == tr.Request || nil == tr.Response ||
+		"ReadHoldingRegisters" != tr.Response.Function ||
+		"0103043fc00000f61b" != tr.Response.Raw ||
+		!tr.Response.ChecksumOK {
+		t.Errorf("Unexpected transaction: %v", lines[0])
+	}
+}
+
+func TestRunSniff(t *testing.T) {
+	for _, args := range []string{"sniff", "-mode rtu -format csv sniff",
+		"-mode rtu sniff 1", "-mode rtu -silence -1s sniff"} {
+		var stdout, stderr bytes.Buffer
+		status := run(context.Background(), append([]string{
+			"-host", "/dev/null"}, strings.Fields(args)...),
+			strings.NewReader(""), &stdout, &stderr)
+		if 2 != status {
+			t.Errorf("%v: Expected status 2 but got %v: %v", args, status,
+				stderr.String())
+		}
+	}
+}
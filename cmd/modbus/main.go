@@ -0,0 +1,336 @@
+// Command modbus reads and writes coils and registers of Modbus devices from
+// the shell, in any mode, scans buses for devices and sniffs serial buses:
+//
+//	modbus [flags] read <table> <address> [count]
+//	modbus [flags] write <table> <address> <value>...
+//	modbus [flags] <function> <arguments>
+//	modbus [flags] scan [first[-last]]
+//	modbus [flags] shell
+//	modbus [flags] sniff
+//
+// The tables are coil, di, ir and hr. Read reads count values, of the type
+// given by the flags, and write writes the values to consecutive addresses.
+// A single value is written with the write single functions, for devices
+// without support for the write multiple functions. For example
+//
+//	modbus -host 192.168.1.20:502 -type float32 -order CDAB read hr 100 4
+//	modbus -host /dev/ttyUSB0 -mode rtu -baud 9600 -unit 3 write coil 5 on
+//
+// Functions are sent as a single Query and named as in FunctionNames, not
+// case sensitive:
+//
+//	ReadCoils, ReadDiscreteInputs,
+//	ReadHoldingRegisters, ReadInputRegisters  <address> [quantity]
+//	WriteSingleCoil, WriteSingleRegister      <address> <value>
+//	WriteMultipleCoils, WriteMultipleRegisters <address> <value>...
+//	MaskWriteRegister                         <address> <and mask> <or mask>
+//	ReportServerID
+//
+// The quantity of the read functions is the number of addresses, rather than
+// values. Addresses and integers may be given in hex with a 0x prefix. Coils
+// are written as 1, 0, true, false, on or off.
+//
+// The output format is one of
+//
+//	typed  the values, strings quoted: 1.5 -2
+//	hex    the registers: 0x0000 0x3FC0 0x0000 0xC000
+//	dec    the registers: 0 16320 0 49152
+//	json   {"time": "...", "unit": 1, "table": "hr", "address": 100,
+//	        "type": "float32", "values": [1.5, -2]}
+//	csv    time,hr/100,hr/102 followed by a row per read
+//
+// Coils and discrete inputs are 0 and 1 in hex and dec, and the data of
+// ReportServerID is output as bytes. Writes output nothing.
+//
+// With -poll, reads are repeated at the interval until interrupted, or -n
+// times. The text formats are then prefixed with the time of each read and
+// failed reads are reported without stopping the polling.
+//
+// Scan looks for the devices responding to the units first to last, 1 to 247
+// by default, on a serial bus or behind a TCP gateway. Unless -timeout is
+// given, the timeout is 100ms. For each device found, scan reports the
+// functions it supports and the readable address ranges of its tables:
+//
+//	modbus -host /dev/ttyUSB0 -mode rtu scan 1-10
+//	unit 2
+//	  functions:   ReadHoldingRegisters ReadInputRegisters
+//	  unsupported: ReadCoils ReadDiscreteInputs
+//	  ir   0-99
+//	  hr   0-999
+//
+// The ranges are found by probing every -step addresses, so shorter ranges
+// between the probes can be missed. Only read functions are sent unless
+// -probe-writes is given, which also probes WriteSingleCoil,
+// WriteMultipleCoils and WriteMultipleRegisters with invalid values that
+// devices reject without writing, and MaskWriteRegister with masks that leave
+// holding register 0 unchanged, although the device reads and writes it back.
+// WriteSingleRegister is never probed. With -format json the report is JSON,
+// and with -format csv it is a starter register map with a tag for each
+// readable address, up to 100 per range.
+//
+// Shell opens an interactive session on a single connection, for exploring
+// devices. Its commands name the unit, and reads and watches may name the
+// type and byte order, which default to those of the session:
+//
+//	modbus -host 192.168.1.20:502 shell
+//	modbus> read hr 1 100 2 float32 CDAB
+//	hr 100  0x0000 0x3FC0  1.5
+//	hr 102  0x0000 0xC000  -2
+//	modbus> write coil 1 5 on
+//	ok
+//	modbus> watch ir 1 0 4
+//
+// Watch repeats a read at the interval of -poll, 1s by default, until a key
+// is pressed. The session type is set with the type command, and help lists
+// the commands. On a terminal, lines are edited with the usual keys, the
+// history is kept in ~/.modbus_history, and commands, function names, tables,
+// types and byte orders are completed with tab.
+//
+// Sniff listens to an RTU or ASCII bus through a serial port, without
+// sending anything, and logs the requests of its master, which may be
+// another program or device, paired with the responses of the slaves:
+//
+//	modbus -host /dev/ttyUSB0 -mode rtu -baud 9600 sniff
+//	2024-01-02T15:04:05.000Z RTU request slave=1 ReadHoldingRegisters(0x03) address=0 quantity=2 crc=0x0BC4 ok
+//	2024-01-02T15:04:05.012Z RTU response slave=1 ReadHoldingRegisters(0x03) bytes=4 registers=[0x3FC0 0x0000] crc=0x1BF6 ok 12ms
+//
+// RTU frames end after 3.5 character times of silence, or -silence. Requests
+// that are not answered within -timeout are logged with "no response", and
+// malformed frames with their error and raw bytes. With -format json, each
+// transaction is a JSON object on a line.
+//
+// The exit status is 1 if a read or write failed, or no device was found, and
+// 2 if the command line is invalid.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	status := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(status)
+}
+
+// run runs the command line args and returns the exit status. Only the shell
+// reads stdin.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout,
+	stderr io.Writer) int {
+	fs := flag.NewFlagSet("modbus", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	host := fs.String("host", "",
+		"TCP address host:port, or serial device for RTU and ASCII")
+	mode := fs.String("mode", "tcp", "Mode: tcp, rtu or ascii")
+	baud := fs.Uint("baud", 19200, "Baud rate for RTU and ASCII")
+	timeout := fs.Duration("timeout", time.Second, "Response timeout")
+	debug := fs.Bool("debug", false, "Log the frames sent and received")
+	unit := fs.Uint("unit", 1, "Unit, i.e. SlaveID")
+	dataType := fs.String("type", "uint16", "Type of the register values")
+	order := fs.String("order", "ABCD", "Byte order of the register values")
+	length := fs.Uint("length", 0, "Number of registers of string values")
+	scale := fs.Float64("scale", 0, "Scale of the register values, "+
+		"value = scale*raw + offset")
+	offset := fs.Float64("offset", 0, "Offset of the register values")
+	format := fs.String("format", "typed",
+		"Output format: typed, hex, dec, json or csv")
+	poll := fs.Duration("poll", 0, "Repeat reads at the interval")
+	n := fs.Int("n", 0, "Number of polls, 0 polls until interrupted")
+	step := fs.Uint("step", modbus.DefaultScanStep,
+		"Distance between the addresses probed by scan")
+	probeWrites := fs.Bool("probe-writes", false,
+		"Also probe the write functions in scan, see the documentation")
+	silence := fs.Duration("silence", 0, "Silence ending the RTU frames "+
+		"of sniff, 3.5 characters by default")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage:\n"+
+			"  modbus [flags] read <table> <address> [count]\n"+
+			"  modbus [flags] write <table> <address> <value>...\n"+
+			"  modbus [flags] <function> <arguments>\n"+
+			"  modbus [flags] scan [first[-last]]\n"+
+			"  modbus [flags] shell\n"+
+			"  modbus [flags] sniff\n\n"+
+			"Tables: coil, di, ir, hr\nFunctions: %v\n\nFlags:\n",
+			strings.Join(functionNames(), ", "))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); nil != err {
+		return 2
+	}
+
+	opts := options{}
+	err := func() error {
+		var ok bool
+		opts.cs.Mode, ok = modbus.ModeByName[strings.ToUpper(*mode)]
+		if !ok {
+			return usagef("Invalid mode: %q", *mode)
+		}
+		if len(*host) == 0 {
+			return usagef("Missing -host")
+		}
+		opts.cs.Host = *host
+		opts.cs.Baud = *baud
+		opts.cs.Timeout = *timeout
+		opts.cs.Debug = *debug
+		if *unit > 0xFF {
+			return usagef("Invalid unit: %v", *unit)
+		}
+		opts.unit = byte(*unit)
+		if err := opts.format.Type.UnmarshalText(
+			[]byte(*dataType)); nil != err {
+			return usageError{err}
+		}
+		if err := opts.format.ByteOrder.UnmarshalText(
+			[]byte(*order)); nil != err {
+			return usageError{err}
+		}
+		if *length > 0xFFFF {
+			return usagef("Invalid length: %v", *length)
+		}
+		opts.format.Length = uint16(*length)
+		opts.format.Scale = *scale
+		opts.format.Offset = *offset
+		if !formats[*format] {
+			return usagef("Invalid format: %q", *format)
+		}
+		if *poll < 0 || *n < 0 || *n > 0 && 0 == *poll {
+			return usagef("-n requires a positive -poll interval")
+		}
+		if 0 == *step || *step > 0xFFFF {
+			return usagef("Invalid step: %v", *step)
+		}
+		if *silence < 0 {
+			return usagef("Invalid silence: %v", *silence)
+		}
+		return nil
+	}()
+	if nil != err {
+		return fail(stderr, err)
+	}
+	if "scan" == fs.Arg(0) {
+		slaveIDs, err := parseScan(fs.Args()[1:])
+		if nil == err && *poll > 0 {
+			err = usagef("Only reads can be polled")
+		}
+		if nil != err {
+			return fail(stderr, err)
+		}
+		timeoutSet := false
+		fs.Visit(func(f *flag.Flag) {
+			timeoutSet = timeoutSet || "timeout" == f.Name
+		})
+		if !timeoutSet {
+			opts.cs.Timeout = scanTimeout
+		}
+		ch, err := modbus.GetClientHandle(opts.cs)
+		if nil != err {
+			return fail(stderr, err)
+		}
+		defer ch.Close()
+		if err := scan(ctx, ch, modbus.ScanOptions{SlaveIDs: slaveIDs,
+			Step: uint16(*step), ProbeWrites: *probeWrites}, *format,
+			stdout, stderr); nil != err {
+			return fail(stderr, err)
+		}
+		return 0
+	}
+	if "sniff" == fs.Arg(0) {
+		if fs.NArg() > 1 {
+			return fail(stderr, usagef("Usage: sniff"))
+		}
+		if err := sniff(ctx, opts, *silence, *format,
+			stdout); nil != err {
+			return fail(stderr, err)
+		}
+		return 0
+	}
+	if "shell" == fs.Arg(0) {
+		if fs.NArg() > 1 {
+			return fail(stderr, usagef("Usage: shell"))
+		}
+		return runShell(ctx, opts, *poll, stdin, stdout, stderr)
+	}
+	cmd, read, err := opts.parseCommand(fs.Args())
+	if nil != err {
+		return fail(stderr, err)
+	}
+	if *poll > 0 && !read {
+		return fail(stderr, usagef("Only reads can be polled"))
+	}
+
+	ch, err := modbus.GetClientHandle(opts.cs)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	defer ch.Close()
+	out := newOutput(stdout, *format, *poll > 0)
+	if 0 == *poll {
+		r, err := cmd(ctx, ch)
+		if nil == err && nil != r {
+			err = out.write(r)
+		}
+		if nil != err {
+			return fail(stderr, err)
+		}
+		return 0
+	}
+
+	status := 0
+	ticker := time.NewTicker(*poll)
+	defer ticker.Stop()
+	for i := 0; 0 == *n || i < *n; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return status
+			case <-ticker.C:
+			}
+		}
+		r, err := cmd(ctx, ch)
+		if nil != ctx.Err() {
+			return status
+		}
+		if nil != err {
+			fmt.Fprintf(stderr, "%v %v\n", time.Now().Format(timeFormat),
+				err)
+			status = 1
+			continue
+		}
+		if err := out.write(r); nil != err {
+			return fail(stderr, err)
+		}
+	}
+	return status
+}
+
+// fail reports the err and returns the exit status for it.
+func fail(stderr io.Writer, err error) int {
+	fmt.Fprintln(stderr, err)
+	if _, ok := err.(usageError); ok {
+		return 2
+	}
+	return 1
+}
+
+// functionNames returns the sorted FunctionNames.
+func functionNames() []string {
+	var names []string
+	for _, name := range modbus.FunctionNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
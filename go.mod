@@ -1,6 +1,9 @@
 module github.com/AdamSLevy/modbus
 
+go 1.16
+
 require (
 	github.com/tarm/serial v0.0.0-20180830175751-b334f1953d3d
-	golang.org/x/sys v0.0.0-20180828065106-d99a578cf41b // indirect
+	golang.org/x/sys v0.0.0-20180828065106-d99a578cf41b
+	gopkg.in/yaml.v2 v2.4.0
 )
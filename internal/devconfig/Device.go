@@ -0,0 +1,200 @@
+// Package devconfig reads the device sections of the config files of the
+// commands, which poll devices using register maps.
+package devconfig
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Default settings of a Device.
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultTimeout  = time.Second
+)
+
+// Device is a device, or a set of slaves on one bus, that is polled with one
+// register map.
+type Device struct {
+	// Name identifies the device, e.g. in metric labels or topics.
+	Name string `yaml:"name"`
+	// Host, Mode ("tcp", "rtu" or "ascii"), Baud and Timeout are the
+	// modbus.ConnectionSettings.
+	Host    string        `yaml:"host"`
+	Mode    string        `yaml:"mode"`
+	Baud    uint          `yaml:"baud"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval is the time between polls.
+	Interval time.Duration `yaml:"interval"`
+	// Unit is the SlaveID of Tags without a unit.
+	Unit byte `yaml:"unit"`
+	// MaxGap is the Planner's MaxGap.
+	MaxGap uint16 `yaml:"maxgap"`
+	// Map is the file name of a register map, relative to the config file,
+	// and Tags are defined inline. Both may be used.
+	Map  string       `yaml:"map"`
+	Tags []modbus.Tag `yaml:"tags"`
+
+	// TagMap holds the Tags of the Map and the inline Tags after Init.
+	TagMap *modbus.TagMap `yaml:"-"`
+}
+
+// Devices are the devices of a config.
+type Devices []Device
+
+// Config is implemented by the configs of the commands. Init validates the
+// config after it has been read and resolves file names relative to dir.
+type Config interface {
+	Init(dir string) error
+}
+
+// Load reads cfg from the YAML or JSON file and initializes it.
+func Load(filename string, cfg Config) error {
+	data, err := ioutil.ReadFile(filename)
+	if nil != err {
+		return err
+	}
+	if err := Read(bytes.NewReader(data), filepath.Dir(filename),
+		cfg); nil != err {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	return nil
+}
+
+// Read reads cfg from YAML or JSON and initializes it with dir. Unknown fields
+// are an error.
+func Read(r io.Reader, dir string, cfg Config) error {
+	data, err := ioutil.ReadAll(r)
+	if nil != err {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); nil != err {
+		return err
+	}
+	return cfg.Init(dir)
+}
+
+// Init initializes each Device and checks that there is at least one, that
+// their names are unique and that each has Tags.
+func (ds Devices) Init(dir string) error {
+	return ds.init(dir, true)
+}
+
+// InitOptionalTags is like Init but allows Devices without Tags, which can
+// only be accessed by address.
+func (ds Devices) InitOptionalTags(dir string) error {
+	return ds.init(dir, false)
+}
+
+func (ds Devices) init(dir string, requireTags bool) error {
+	if len(ds) == 0 {
+		return fmt.Errorf("No devices configured")
+	}
+	names := make(map[string]bool)
+	for i := range ds {
+		d := &ds[i]
+		if err := d.Init(dir); nil != err {
+			return fmt.Errorf("Device %q: %v", d.Name, err)
+		}
+		if requireTags && len(d.TagMap.Tags()) == 0 {
+			return fmt.Errorf("Device %q: No tags", d.Name)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("Duplicate device name: %q", d.Name)
+		}
+		names[d.Name] = true
+	}
+	return nil
+}
+
+// Device returns the Device with the name.
+func (ds Devices) Device(name string) (*Device, bool) {
+	for i := range ds {
+		if ds[i].Name == name {
+			return &ds[i], true
+		}
+	}
+	return nil, false
+}
+
+// Init validates d, fills in the defaults and loads its TagMap, which may be
+// empty.
+func (d *Device) Init(dir string) error {
+	if len(d.Name) == 0 {
+		return fmt.Errorf("Missing name")
+	}
+	if len(d.Host) == 0 {
+		return fmt.Errorf("Missing host")
+	}
+	if len(d.Mode) == 0 {
+		d.Mode = "tcp"
+	}
+	if _, ok := modbus.ModeByName[strings.ToUpper(d.Mode)]; !ok {
+		return fmt.Errorf("Invalid mode: %q", d.Mode)
+	}
+	if 0 == d.Timeout {
+		d.Timeout = DefaultTimeout
+	}
+	if 0 == d.Interval {
+		d.Interval = DefaultInterval
+	}
+	tags := append([]modbus.Tag{}, d.Tags...)
+	if len(d.Map) > 0 {
+		if !filepath.IsAbs(d.Map) {
+			d.Map = filepath.Join(dir, d.Map)
+		}
+		m, err := modbus.LoadTagMap(d.Map)
+		if nil != err {
+			return err
+		}
+		tags = append(m.Tags(), tags...)
+	}
+	for i := range tags {
+		if 0 == tags[i].SlaveID {
+			tags[i].SlaveID = d.Unit
+		}
+	}
+	var err error
+	d.TagMap, err = modbus.NewTagMap(tags...)
+	return err
+}
+
+// ConnectionSettings returns the ConnectionSettings of the device.
+func (d *Device) ConnectionSettings() modbus.ConnectionSettings {
+	return modbus.ConnectionSettings{
+		Mode:    modbus.ModeByName[strings.ToUpper(d.Mode)],
+		Host:    d.Host,
+		Baud:    d.Baud,
+		Timeout: d.Timeout,
+	}
+}
+
+// ReadableTags returns the Tags of the device that can be polled.
+func (d *Device) ReadableTags() []modbus.Tag {
+	var tags []modbus.Tag
+	for _, t := range d.TagMap.Tags() {
+		if t.Access&modbus.AccessRead != 0 {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// Poll returns the Poll of the ReadableTags of the device, named after the
+// device.
+func (d *Device) Poll() modbus.Poll {
+	return modbus.Poll{
+		Name:     d.Name,
+		Interval: d.Interval,
+		Tags:     d.ReadableTags(),
+		Planner:  modbus.Planner{MaxGap: d.MaxGap},
+	}
+}
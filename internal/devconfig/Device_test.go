@@ -0,0 +1,68 @@
+package devconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+type testConfig struct {
+	Devices Devices `yaml:"devices"`
+}
+
+func (c *testConfig) Init(dir string) error {
+	return c.Devices.Init(dir)
+}
+
+type optionalTagsConfig struct {
+	Devices Devices `yaml:"devices"`
+}
+
+func (c *optionalTagsConfig) Init(dir string) error {
+	return c.Devices.InitOptionalTags(dir)
+}
+
+func TestRead(t *testing.T) {
+	for _, cfg := range []string{
+		`devices: []`,
+		`devices: [{name: a, tags: [{name: x, table: hr, address: 0}]}]`,
+		`devices: [{name: a, host: h, mode: can, tags: [{name: x, ` +
+			`table: hr, address: 0}]}]`,
+		`devices: [{name: a, host: h}]`,
+		`devices: [{name: a, host: h, bogus: 1}]`,
+		`devices: [{name: a, host: h, map: missing.csv}]`,
+		`devices: [{name: a, host: h, tags: [{name: x, table: hr, ` +
+			`address: 0}]}, {name: a, host: h, tags: [{name: x, ` +
+			`table: hr, address: 0}]}]`,
+	} {
+		if err := Read(strings.NewReader(cfg), ".",
+			&testConfig{}); nil == err {
+			t.Errorf("Expected an error for %v", cfg)
+		}
+	}
+
+	if err := Read(strings.NewReader(`devices: [{name: a, host: h}]`), ".",
+		&optionalTagsConfig{}); nil != err {
+		t.Errorf("Device without tags: %v", err)
+	}
+
+	cfg := &testConfig{}
+	if err := Read(strings.NewReader(`{"devices": [{"name": "a",
+		"host": "h", "unit": 2, "interval": "1s",
+		"tags": [{"name": "x", "table": "hr", "address": 0},
+			{"name": "y", "table": "hr", "address": 1, "access": "w"}]}]}`),
+		".", cfg); nil != err {
+		t.Fatal(err)
+	}
+	d, ok := cfg.Devices.Device("a")
+	if !ok {
+		t.Fatal("Device a not found")
+	}
+	tags := d.ReadableTags()
+	if DefaultTimeout != d.Timeout || 1e9 != d.Interval ||
+		len(tags) != 1 || 2 != tags[0].SlaveID {
+		t.Errorf("Unexpected Device: %+v", d)
+	}
+	if cs := d.ConnectionSettings(); "h" != cs.Host || 0 != cs.Mode {
+		t.Errorf("Unexpected ConnectionSettings: %+v", cs)
+	}
+}
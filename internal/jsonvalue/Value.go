@@ -0,0 +1,62 @@
+// Package jsonvalue converts between JSON and the values of Tags for the
+// commands that accept values in JSON.
+package jsonvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+// Parse returns the JSON value for writing to the Tag. Numbers for unscaled
+// integer Tags must be integers.
+func Parse(t modbus.Tag, value json.RawMessage) (interface{}, error) {
+	if len(bytes.TrimSpace(value)) == 0 {
+		return nil, fmt.Errorf("Missing value")
+	}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); nil != err {
+		return nil, err
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		// Bools and strings are checked by Tag.WriteQuery.
+		return v, nil
+	}
+	switch t.Type {
+	case modbus.DataTypeFloat32, modbus.DataTypeFloat64:
+		return n.Float64()
+	}
+	if 0 != t.Scale {
+		return n.Float64()
+	}
+	if i, err := n.Int64(); nil == err {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); nil == err {
+		return u, nil
+	}
+	return nil, fmt.Errorf("Tag %q: Expected an integer but got %v",
+		t.Name, n)
+}
+
+// IsFinite returns false if v is a NaN or infinite float, which cannot be
+// represented in JSON.
+func IsFinite(v interface{}) bool {
+	var f float64
+	switch v := v.(type) {
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	default:
+		return true
+	}
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
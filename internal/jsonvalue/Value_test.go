@@ -0,0 +1,56 @@
+package jsonvalue
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+func TestParse(t *testing.T) {
+	integer := modbus.Tag{Name: "i", Type: modbus.DataTypeInt32}
+	scaled := modbus.Tag{Name: "s", Type: modbus.DataTypeInt16, Scale: 0.1}
+	float := modbus.Tag{Name: "f", Type: modbus.DataTypeFloat32}
+	for _, test := range []struct {
+		modbus.Tag
+		value string
+		want  interface{}
+	}{
+		{integer, `-3`, int64(-3)},
+		{integer, `18446744073709551615`, uint64(math.MaxUint64)},
+		{scaled, `21.5`, 21.5},
+		{float, `2`, 2.0},
+		{integer, `true`, true},
+		{integer, ` "on" `, "on"},
+	} {
+		v, err := Parse(test.Tag, json.RawMessage(test.value))
+		if nil != err {
+			t.Errorf("%v: %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.want, v) {
+			t.Errorf("%v: want: %#v got: %#v", test.value, test.want, v)
+		}
+	}
+	for _, value := range []string{``, ` `, `1.5`, `{bad`} {
+		if _, err := Parse(integer, json.RawMessage(value)); nil == err {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestIsFinite(t *testing.T) {
+	for v, want := range map[interface{}]bool{
+		1.5:                  true,
+		float32(math.Inf(1)): false,
+		math.NaN():           false,
+		"NaN":                true,
+		uint16(7):            true,
+	} {
+		if IsFinite(v) != want {
+			t.Errorf("%#v: want: %v", v, want)
+		}
+	}
+}
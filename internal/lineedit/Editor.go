@@ -0,0 +1,359 @@
+// Package lineedit reads lines from a terminal with the editing keys of a
+// shell, history and tab completion, for the interactive commands. It
+// supports the VT100 escape sequences of common terminal emulators.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInterrupt is returned by ReadLine if Ctrl-C is pressed.
+var ErrInterrupt = errors.New("Interrupt")
+
+// MaxHistory limits the number of lines in the history.
+const MaxHistory = 1000
+
+// Key is a key read by ReadKey. Printable keys and control keys are their
+// rune and the cursor and editing keys, which terminals send as escape
+// sequences, are negative.
+type Key rune
+
+// Control keys.
+const (
+	KeyCtrlA     Key = 1
+	KeyCtrlB     Key = 2
+	KeyCtrlC     Key = 3
+	KeyCtrlD     Key = 4
+	KeyCtrlE     Key = 5
+	KeyCtrlF     Key = 6
+	KeyCtrlH     Key = 8
+	KeyTab       Key = 9
+	KeyCtrlJ     Key = 10
+	KeyCtrlK     Key = 11
+	KeyCtrlL     Key = 12
+	KeyEnter     Key = 13
+	KeyCtrlN     Key = 14
+	KeyCtrlP     Key = 16
+	KeyCtrlU     Key = 21
+	KeyCtrlW     Key = 23
+	KeyEscape    Key = 27
+	KeyBackspace Key = 127
+)
+
+// Cursor and editing keys.
+const (
+	KeyUp Key = -(iota + 1)
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	// KeyUnknown is an escape sequence of another key.
+	KeyUnknown
+)
+
+// Editor reads lines from a terminal in raw mode and echoes them while they
+// are edited, or reads lines as they are from other input. Editors are not
+// safe for concurrent use.
+type Editor struct {
+	// Prompt is written before each edited line.
+	Prompt string
+	// Complete, if not nil, returns the completions of the last word of
+	// line, which is the text before the cursor. Completions replace the
+	// whole word.
+	Complete func(line string) []string
+
+	r    *bufio.Reader
+	w    io.Writer
+	edit bool
+
+	history []string
+
+	// line is the edited line and pos the cursor position in it.
+	line []rune
+	pos  int
+	// index is the index into history of the recalled line, and saved
+	// the edited line while recalling history.
+	index int
+	saved []rune
+}
+
+// New returns an Editor reading from r. If edit is true, r is a terminal in
+// raw mode, see MakeRaw, and the edited line is echoed to w. Otherwise r
+// provides whole lines, e.g. a terminal in its normal mode or a pipe, and
+// nothing is echoed.
+func New(r io.Reader, w io.Writer, edit bool) *Editor {
+	return &Editor{r: bufio.NewReader(r), w: w, edit: edit}
+}
+
+// History returns the lines of the history, oldest first.
+func (e *Editor) History() []string {
+	return append([]string{}, e.history...)
+}
+
+// AddHistory appends the line to the history, unless it is empty or repeats
+// the last line. The oldest lines are dropped beyond MaxHistory.
+func (e *Editor) AddHistory(line string) {
+	if len(strings.TrimSpace(line)) == 0 ||
+		len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > MaxHistory {
+		e.history = e.history[len(e.history)-MaxHistory:]
+	}
+}
+
+// ReadLine returns the next line without its line ending. It returns io.EOF
+// at the end of the input or if Ctrl-D is pressed on an empty line, and
+// ErrInterrupt if Ctrl-C is pressed.
+func (e *Editor) ReadLine() (string, error) {
+	if !e.edit {
+		line, err := e.r.ReadString('\n')
+		if nil != err && (io.EOF != err || len(line) == 0) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	e.line, e.pos, e.index, e.saved = nil, 0, len(e.history), nil
+	e.refresh()
+	for {
+		k, err := e.ReadKey()
+		if nil != err {
+			return "", err
+		}
+		switch k {
+		case KeyEnter, KeyCtrlJ:
+			fmt.Fprint(e.w, "\r\n")
+			return string(e.line), nil
+		case KeyCtrlC:
+			fmt.Fprint(e.w, "^C\r\n")
+			return "", ErrInterrupt
+		case KeyCtrlD:
+			if len(e.line) == 0 {
+				fmt.Fprint(e.w, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteRunes(e.pos, e.pos+1)
+		case KeyDelete:
+			e.deleteRunes(e.pos, e.pos+1)
+		case KeyCtrlA, KeyHome:
+			e.pos = 0
+		case KeyCtrlE, KeyEnd:
+			e.pos = len(e.line)
+		case KeyCtrlB, KeyLeft:
+			e.move(-1)
+		case KeyCtrlF, KeyRight:
+			e.move(1)
+		case KeyCtrlH, KeyBackspace:
+			if e.pos > 0 {
+				e.deleteRunes(e.pos-1, e.pos)
+			}
+		case KeyCtrlK:
+			e.line = e.line[:e.pos]
+		case KeyCtrlU:
+			e.deleteRunes(0, e.pos)
+		case KeyCtrlW:
+			start := e.pos
+			for start > 0 && unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			e.deleteRunes(start, e.pos)
+		case KeyCtrlL:
+			fmt.Fprint(e.w, "\x1b[H\x1b[2J")
+		case KeyCtrlP, KeyUp:
+			e.recall(-1)
+		case KeyCtrlN, KeyDown:
+			e.recall(1)
+		case KeyTab:
+			e.complete()
+		default:
+			if k > 0 && unicode.IsPrint(rune(k)) {
+				e.insert([]rune{rune(k)})
+			}
+		}
+		e.refresh()
+	}
+}
+
+// WaitKey blocks until a key is pressed or, if lines are not edited, a line
+// is read.
+func (e *Editor) WaitKey() error {
+	if !e.edit {
+		_, err := e.r.ReadString('\n')
+		return err
+	}
+	_, err := e.ReadKey()
+	return err
+}
+
+// ReadKey reads the next key from a terminal in raw mode. An escape key that
+// is not followed by more input right away is KeyEscape.
+func (e *Editor) ReadKey() (Key, error) {
+	r, _, err := e.r.ReadRune()
+	if nil != err {
+		return 0, err
+	}
+	if KeyEscape != Key(r) || 0 == e.r.Buffered() {
+		return Key(r), nil
+	}
+	b, err := e.r.ReadByte()
+	if nil != err {
+		return 0, err
+	}
+	if '[' != b && 'O' != b {
+		return KeyUnknown, nil
+	}
+	// The sequence ends with a letter or a tilde, after optional
+	// parameters.
+	var params []byte
+	for {
+		if b, err = e.r.ReadByte(); nil != err {
+			return 0, err
+		}
+		if b >= '0' && b <= '9' || ';' == b {
+			params = append(params, b)
+			continue
+		}
+		break
+	}
+	switch b {
+	case 'A':
+		return KeyUp, nil
+	case 'B':
+		return KeyDown, nil
+	case 'C':
+		return KeyRight, nil
+	case 'D':
+		return KeyLeft, nil
+	case 'H':
+		return KeyHome, nil
+	case 'F':
+		return KeyEnd, nil
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return KeyHome, nil
+		case "4", "8":
+			return KeyEnd, nil
+		case "3":
+			return KeyDelete, nil
+		case "5":
+			return KeyPageUp, nil
+		case "6":
+			return KeyPageDown, nil
+		}
+	}
+	return KeyUnknown, nil
+}
+
+// refresh redraws the prompt and the line and positions the cursor.
+func (e *Editor) refresh() {
+	fmt.Fprintf(e.w, "\r%v%v\x1b[K", e.Prompt, string(e.line))
+	if n := len(e.line) - e.pos; n > 0 {
+		fmt.Fprintf(e.w, "\x1b[%vD", n)
+	}
+}
+
+// move moves the cursor by n runes within the line.
+func (e *Editor) move(n int) {
+	e.pos += n
+	if e.pos < 0 {
+		e.pos = 0
+	}
+	if e.pos > len(e.line) {
+		e.pos = len(e.line)
+	}
+}
+
+// insert inserts the runes at the cursor and moves the cursor after them.
+func (e *Editor) insert(runes []rune) {
+	line := append([]rune{}, e.line[:e.pos]...)
+	line = append(line, runes...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(runes)
+}
+
+// deleteRunes deletes the runes from start to end, if they exist, and moves
+// the cursor to start.
+func (e *Editor) deleteRunes(start, end int) {
+	if end > len(e.line) {
+		end = len(e.line)
+	}
+	if start >= end {
+		return
+	}
+	e.line = append(e.line[:start], e.line[end:]...)
+	e.pos = start
+}
+
+// recall replaces the line with the previous, or next, line of the history.
+// The edited line is restored after the last line of the history.
+func (e *Editor) recall(dir int) {
+	index := e.index + dir
+	if index < 0 || index > len(e.history) {
+		return
+	}
+	if e.index == len(e.history) {
+		e.saved = e.line
+	}
+	e.index = index
+	if index == len(e.history) {
+		e.line = e.saved
+	} else {
+		e.line = []rune(e.history[index])
+	}
+	e.pos = len(e.line)
+}
+
+// complete completes the word before the cursor. A single completion is
+// inserted followed by a space. Multiple completions are extended to their
+// common prefix or, if that does not extend the word, listed in their order.
+func (e *Editor) complete() {
+	if nil == e.Complete {
+		return
+	}
+	before := string(e.line[:e.pos])
+	start := strings.LastIndexFunc(before, unicode.IsSpace) + 1
+	word := before[start:]
+	completions := e.Complete(before)
+	if len(completions) == 0 {
+		return
+	}
+	prefix := completions[0]
+	for _, c := range completions[1:] {
+		prefix = commonPrefix(prefix, c)
+	}
+	if len(completions) == 1 {
+		prefix += " "
+	}
+	if prefix != word && strings.HasPrefix(strings.ToLower(prefix),
+		strings.ToLower(word)) {
+		e.deleteRunes(utf8.RuneCountInString(before[:start]), e.pos)
+		e.insert([]rune(prefix))
+		return
+	}
+	fmt.Fprintf(e.w, "\r\n%v\r\n", strings.Join(completions, "  "))
+}
+
+// commonPrefix returns the longest common prefix of a and b.
+func commonPrefix(a, b string) string {
+	ra, rb := []rune(a), []rune(b)
+	n := 0
+	for n < len(ra) && n < len(rb) && ra[n] == rb[n] {
+		n++
+	}
+	return string(ra[:n])
+}
@@ -0,0 +1,131 @@
+package lineedit
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditorReadLine(t *testing.T) {
+	words := []string{"read", "ReadCoils", "ReadHoldingRegisters", "write",
+		"WriteSingleCoil", "WriteSingleRegister"}
+	complete := func(line string) []string {
+		fields := strings.Fields(line)
+		if len(fields) > 1 || strings.HasSuffix(line, " ") {
+			return nil
+		}
+		word := ""
+		if len(fields) > 0 {
+			word = fields[0]
+		}
+		var completions []string
+		for _, w := range words {
+			if strings.HasPrefix(strings.ToLower(w), strings.ToLower(word)) {
+				completions = append(completions, w)
+			}
+		}
+		return completions
+	}
+
+	for _, test := range []struct {
+		name  string
+		input string
+		lines []string
+	}{
+		{"plain", "read hr 0\r", []string{"read hr 0"}},
+		{"backspace", "reaf\x7fd\r", []string{"read"}},
+		{"cursor", "ead\x1b[D\x1b[D\x1b[Dr\x1b[Fx\r",
+			[]string{"readx"}},
+		{"ctrl keys", "bc\x01a\x05d\x02\x02\x04\r", []string{"abd"}},
+		{"delete key", "abc\x1b[H\x1b[3~\r", []string{"bc"}},
+		{"kill", "abc def\x17\x17x\r12345\x02\x02\x0b\x15\r",
+			[]string{"x", ""}},
+		{"history", "one\rtwo\r\x1b[A\x1b[A\x1b[B!\r\x10\x10\x0e\x0e\r",
+			[]string{"one", "two", "two!", ""}},
+		{"history keeps edit", "one\rtw\x1b[A\x1b[Bo\r",
+			[]string{"one", "two"}},
+		{"complete single", "WriteSingleR\t0\r",
+			[]string{"WriteSingleRegister 0"}},
+		{"complete prefix", "Read\tH\t1\r",
+			[]string{"ReadHoldingRegisters 1"}},
+		{"complete common", "WriteS\tC\t\r",
+			[]string{"WriteSingleCoil "}},
+		{"complete list", "read\t\r", []string{"read"}},
+	} {
+		e := New(strings.NewReader(test.input), ioutil.Discard, true)
+		e.Complete = complete
+		var lines []string
+		for {
+			line, err := e.ReadLine()
+			if io.EOF == err {
+				break
+			}
+			if nil != err {
+				t.Fatalf("%v: %v", test.name, err)
+			}
+			e.AddHistory(line)
+			lines = append(lines, line)
+		}
+		if !reflect.DeepEqual(test.lines, lines) {
+			t.Errorf("%v: expected %q but got %q", test.name, test.lines,
+				lines)
+		}
+	}
+}
+
+func TestEditorKeys(t *testing.T) {
+	var out strings.Builder
+	e := New(strings.NewReader("ab\x03\x04"), &out, true)
+	e.Prompt = "> "
+	if _, err := e.ReadLine(); ErrInterrupt != err {
+		t.Errorf("Expected ErrInterrupt but got %v", err)
+	}
+	if _, err := e.ReadLine(); io.EOF != err {
+		t.Errorf("Expected io.EOF but got %v", err)
+	}
+	if !strings.Contains(out.String(), "\r> ab\x1b[K") {
+		t.Errorf("Unexpected echo %q", out.String())
+	}
+
+	e = New(strings.NewReader("one\r\ntwo"), &out, false)
+	for _, want := range []string{"one", "two"} {
+		if line, err := e.ReadLine(); nil != err || want != line {
+			t.Errorf("Expected %q but got %q, %v", want, line, err)
+		}
+	}
+	if _, err := e.ReadLine(); io.EOF != err {
+		t.Errorf("Expected io.EOF but got %v", err)
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	e := New(strings.NewReader(""), ioutil.Discard, false)
+	for _, line := range []string{"a", "", " ", "b", "b", "a"} {
+		e.AddHistory(line)
+	}
+	if h := e.History(); !reflect.DeepEqual([]string{"a", "b", "a"}, h) {
+		t.Errorf("Unexpected history %q", h)
+	}
+	for i := 0; i < MaxHistory+10; i++ {
+		e.AddHistory(strings.Repeat("x", i%2+1))
+	}
+	if h := e.History(); len(h) != MaxHistory {
+		t.Errorf("Unexpected history length %v", len(h))
+	}
+}
+
+func TestEditorReadKey(t *testing.T) {
+	e := New(strings.NewReader("a\x1b[A\x1b[6~\x1b[2~\x1bx\r\x1b"),
+		ioutil.Discard, true)
+	for _, want := range []Key{'a', KeyUp, KeyPageDown, KeyUnknown,
+		KeyUnknown, KeyEnter, KeyEscape} {
+		if k, err := e.ReadKey(); nil != err || want != k {
+			t.Errorf("Expected key %v but got %v, %v", want, k, err)
+		}
+	}
+	if _, err := e.ReadKey(); io.EOF != err {
+		t.Errorf("Expected io.EOF but got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package lineedit
+
+import "golang.org/x/sys/unix"
+
+// IsTerminal returns whether the file descriptor fd is a terminal.
+func IsTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	return nil == err
+}
+
+// MakeRaw puts the terminal fd into raw mode, in which keys are read as they
+// are pressed without echo or signals, and returns the function restoring
+// its previous mode. Output processing is kept so that newlines still return
+// the cursor to the start of the line.
+func MakeRaw(fd int) (func() error, error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if nil != err {
+		return nil, err
+	}
+	previous := *termios
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK |
+		unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG |
+		unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); nil != err {
+		return nil, err
+	}
+	return func() error {
+		return unix.IoctlSetTermios(fd, unix.TCSETS, &previous)
+	}, nil
+}
+
+// Size returns the width and height of the terminal fd in characters.
+func Size(fd int) (int, int, error) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if nil != err {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
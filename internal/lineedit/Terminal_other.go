@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package lineedit
+
+import "errors"
+
+// IsTerminal returns whether the file descriptor fd is a terminal, which is
+// only detected on Linux.
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeRaw is only supported on Linux and returns an error elsewhere, where
+// lines are read without editing.
+func MakeRaw(fd int) (func() error, error) {
+	return nil, errors.New("Raw terminal mode is not supported")
+}
+
+// Size is only supported on Linux and returns an error elsewhere.
+func Size(fd int) (int, int, error) {
+	return 0, 0, errors.New("Terminal size is not supported")
+}
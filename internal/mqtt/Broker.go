@@ -0,0 +1,255 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// Broker is a minimal MQTT broker. It delivers Messages at QoS 0, keeps
+// retained Messages and publishes the wills of lost clients. Sessions are not
+// persisted, so every connection starts with a clean session.
+type Broker struct {
+	ln net.Listener
+
+	mtx      sync.Mutex
+	conns    map[*brokerConn]bool
+	retained map[string]Message
+	wg       sync.WaitGroup
+}
+
+// brokerConn is the connection of a client to a Broker.
+type brokerConn struct {
+	net.Conn
+	wmtx    sync.Mutex
+	filters map[string]bool
+	will    *Message
+}
+
+// NewBroker returns a Broker listening on addr, e.g. "127.0.0.1:0".
+func NewBroker(addr string) (*Broker, error) {
+	ln, err := net.Listen("tcp", addr)
+	if nil != err {
+		return nil, err
+	}
+	b := &Broker{
+		ln:       ln,
+		conns:    make(map[*brokerConn]bool),
+		retained: make(map[string]Message),
+	}
+	b.wg.Add(1)
+	go b.accept()
+	return b, nil
+}
+
+// Addr returns the address the Broker is listening on.
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Close stops the Broker and closes all connections.
+func (b *Broker) Close() error {
+	err := b.ln.Close()
+	b.Disconnect()
+	b.wg.Wait()
+	return err
+}
+
+// Disconnect closes the connections of all clients, as if the network had
+// failed, so that their wills are published.
+func (b *Broker) Disconnect() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for c := range b.conns {
+		c.Close()
+	}
+}
+
+func (b *Broker) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if nil != err {
+			return
+		}
+		b.wg.Add(1)
+		go b.serve(&brokerConn{Conn: conn, filters: make(map[string]bool)})
+	}
+}
+
+// serve handles the packets of the client on c until it disconnects.
+func (b *Broker) serve(c *brokerConn) {
+	defer b.wg.Done()
+	defer c.Close()
+	b.mtx.Lock()
+	b.conns[c] = true
+	b.mtx.Unlock()
+	defer func() {
+		b.mtx.Lock()
+		delete(b.conns, c)
+		b.mtx.Unlock()
+		if nil != c.will {
+			b.publish(*c.will)
+		}
+	}()
+
+	r := bufio.NewReader(c)
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	p, err := readPacket(r)
+	if nil != err || packetConnect != p.typ {
+		return
+	}
+	keepAlive, ok := c.connect(p)
+	if !ok {
+		c.will = nil
+		c.write(packet{typ: packetConnack, body: []byte{0, 1}})
+		return
+	}
+	if nil != c.write(packet{typ: packetConnack, body: []byte{0, 0}}) {
+		return
+	}
+
+	for {
+		deadline := time.Time{}
+		if keepAlive > 0 {
+			deadline = time.Now().Add(keepAlive * 3 / 2)
+		}
+		c.SetReadDeadline(deadline)
+		p, err := readPacket(r)
+		if nil != err {
+			return
+		}
+		switch p.typ {
+		case packetPublish:
+			m, qos, id, err := parsePublish(p)
+			if nil != err || qos > 1 {
+				return
+			}
+			if 1 == qos {
+				c.write(packet{typ: packetPuback,
+					body: appendUint16(nil, id)})
+			}
+			b.publish(m)
+		case packetSubscribe:
+			if !b.subscribe(c, p) {
+				return
+			}
+		case packetUnsubscribe:
+			rd := reader{b: p.body}
+			id := rd.uint16()
+			for len(rd.b) > 0 && nil == rd.err {
+				filter := rd.string()
+				b.mtx.Lock()
+				delete(c.filters, filter)
+				b.mtx.Unlock()
+			}
+			c.write(packet{typ: packetUnsuback, body: appendUint16(nil, id)})
+		case packetPingreq:
+			c.write(packet{typ: packetPingresp})
+		case packetDisconnect:
+			c.will = nil
+			return
+		default:
+			return
+		}
+	}
+}
+
+// connect parses the CONNECT packet p and returns the keep alive interval of
+// the client.
+func (c *brokerConn) connect(p packet) (time.Duration, bool) {
+	r := reader{b: p.body}
+	protocol := r.string()
+	level := r.byte()
+	flags := r.byte()
+	keepAlive := time.Duration(r.uint16()) * time.Second
+	r.string() // Client identifier
+	if flags&flagWill != 0 {
+		c.will = &Message{
+			Topic:   r.string(),
+			Payload: append([]byte{}, r.bytes()...),
+			Retain:  flags&flagWillRetain != 0,
+		}
+	}
+	return keepAlive, nil == r.err && "MQTT" == protocol &&
+		protocolLevel == level
+}
+
+// subscribe handles the SUBSCRIBE packet p of c and sends the retained
+// Messages matching its filters.
+func (b *Broker) subscribe(c *brokerConn, p packet) bool {
+	r := reader{b: p.body}
+	id := r.uint16()
+	codes := appendUint16(nil, id)
+	var filters []string
+	for len(r.b) > 0 && nil == r.err {
+		filter := r.string()
+		r.byte() // Requested QoS
+		if !ValidFilter(filter) {
+			codes = append(codes, 0x80)
+			continue
+		}
+		codes = append(codes, 0)
+		filters = append(filters, filter)
+	}
+	if nil != r.err || len(codes) == 2 {
+		return false
+	}
+	b.mtx.Lock()
+	var retained []Message
+	for _, filter := range filters {
+		c.filters[filter] = true
+		for _, m := range b.retained {
+			if Match(filter, m.Topic) {
+				retained = append(retained, m)
+			}
+		}
+	}
+	b.mtx.Unlock()
+	if nil != c.write(packet{typ: packetSuback, body: codes}) {
+		return false
+	}
+	for _, m := range retained {
+		c.write(publishPacket(m))
+	}
+	return true
+}
+
+// publish delivers m to the subscribed clients and retains it if requested.
+// A retained Message with an empty Payload deletes the retained Message of
+// its topic.
+func (b *Broker) publish(m Message) {
+	b.mtx.Lock()
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+	var subscribers []*brokerConn
+	for c := range b.conns {
+		for filter := range c.filters {
+			if Match(filter, m.Topic) {
+				subscribers = append(subscribers, c)
+				break
+			}
+		}
+	}
+	b.mtx.Unlock()
+	m.Retain = false
+	p := publishPacket(m)
+	for _, c := range subscribers {
+		c.write(p)
+	}
+}
+
+// write writes the packet to the client.
+func (c *brokerConn) write(p packet) error {
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.Write(p.encode())
+	return err
+}
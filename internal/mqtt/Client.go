@@ -0,0 +1,307 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Default Options.
+const (
+	DefaultKeepAlive      = 30 * time.Second
+	DefaultReconnectDelay = time.Second
+)
+
+// ErrNotConnected is returned by Publish while the Client is not connected.
+var ErrNotConnected = fmt.Errorf("Not connected to the MQTT broker")
+
+// Options configure a Client.
+type Options struct {
+	// Addr is the host and port of the broker.
+	Addr     string
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is the interval of pings. A broker that does not respond
+	// within one and a half KeepAlives is considered lost. If zero,
+	// DefaultKeepAlive is used.
+	KeepAlive time.Duration
+	// ReconnectDelay is the time between connection attempts. If zero,
+	// DefaultReconnectDelay is used.
+	ReconnectDelay time.Duration
+	// Will, if not nil, is published by the broker when the connection is
+	// lost without disconnecting.
+	Will *Message
+	// OnConnect, if not nil, is called after each successful connection,
+	// once the subscriptions have been sent.
+	OnConnect func()
+	// OnConnectionLost, if not nil, is called with the reason the
+	// connection was lost or could not be established.
+	OnConnectionLost func(err error)
+}
+
+// Client is an MQTT client that keeps a connection to its broker while it is
+// running and renews its subscriptions whenever it reconnects. Messages are
+// published and received at QoS 0, so Messages published while the Client is
+// disconnected are lost.
+type Client struct {
+	opts Options
+
+	mtx           sync.Mutex
+	conn          net.Conn
+	subscriptions []subscription
+	packetID      uint16
+}
+
+// subscription is a topic filter and the handler of its Messages.
+type subscription struct {
+	filter  string
+	handler func(Message)
+}
+
+// NewClient returns a Client with the opts. It connects once Run is called.
+func NewClient(opts Options) *Client {
+	if 0 == opts.KeepAlive {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	if 0 == opts.ReconnectDelay {
+		opts.ReconnectDelay = DefaultReconnectDelay
+	}
+	return &Client{opts: opts}
+}
+
+// Subscribe calls handler with the Messages published to topics matching the
+// filter. The handler is called from the goroutine receiving Messages, so it
+// should return quickly.
+func (c *Client) Subscribe(filter string, handler func(Message)) error {
+	if !ValidFilter(filter) {
+		return fmt.Errorf("Invalid topic filter: %q", filter)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.subscriptions = append(c.subscriptions,
+		subscription{filter: filter, handler: handler})
+	if nil == c.conn {
+		return nil
+	}
+	return c.write(c.conn, c.subscribePacket(filter))
+}
+
+// Publish publishes the Message, or returns ErrNotConnected.
+func (c *Client) Publish(m Message) error {
+	if !ValidTopic(m.Topic) {
+		return fmt.Errorf("Invalid topic: %q", m.Topic)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if nil == c.conn {
+		return ErrNotConnected
+	}
+	return c.write(c.conn, publishPacket(m))
+}
+
+// Connected returns whether the Client is connected.
+func (c *Client) Connected() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return nil != c.conn
+}
+
+// write writes the packet to conn. The mtx must be locked.
+func (c *Client) write(conn net.Conn, p packet) error {
+	conn.SetWriteDeadline(time.Now().Add(c.opts.KeepAlive))
+	_, err := conn.Write(p.encode())
+	return err
+}
+
+// subscribePacket returns a SUBSCRIBE packet for the filter. The mtx must be
+// locked.
+func (c *Client) subscribePacket(filter string) packet {
+	c.packetID++
+	if 0 == c.packetID {
+		c.packetID++
+	}
+	body := appendUint16(nil, c.packetID)
+	body = append(appendString(body, filter), 0)
+	return packet{typ: packetSubscribe, flags: 0x02, body: body}
+}
+
+// Run connects to the broker and reconnects whenever the connection is lost,
+// until the ctx is done. It then disconnects and returns ctx.Err().
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		err := c.session(ctx)
+		if nil != ctx.Err() {
+			return ctx.Err()
+		}
+		if nil != c.opts.OnConnectionLost {
+			c.opts.OnConnectionLost(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.opts.ReconnectDelay):
+		}
+	}
+}
+
+// session connects to the broker and receives Messages until the connection
+// is lost or the ctx is done.
+func (c *Client) session(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: c.opts.KeepAlive}
+	conn, err := dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	if nil != err {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if err := c.connect(conn, r); nil != err {
+		return err
+	}
+
+	c.mtx.Lock()
+	c.conn = conn
+	var subErr error
+	for _, sub := range c.subscriptions {
+		subErr = c.write(conn, c.subscribePacket(sub.filter))
+		if nil != subErr {
+			break
+		}
+	}
+	c.mtx.Unlock()
+	defer func() {
+		c.mtx.Lock()
+		c.conn = nil
+		c.mtx.Unlock()
+	}()
+	if nil != subErr {
+		return subErr
+	}
+	if nil != c.opts.OnConnect {
+		c.opts.OnConnect()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.ping(ctx, conn, done)
+	for {
+		conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+		p, err := readPacket(r)
+		if nil != err {
+			return err
+		}
+		if packetPublish != p.typ {
+			continue
+		}
+		m, _, _, err := parsePublish(p)
+		if nil != err {
+			return err
+		}
+		c.dispatch(m)
+	}
+}
+
+// connect sends the CONNECT packet and waits for the CONNACK.
+func (c *Client) connect(conn net.Conn, r *bufio.Reader) error {
+	flags := byte(flagCleanSession)
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, 0)
+	body = appendUint16(body, uint16(c.opts.KeepAlive/time.Second))
+	body = appendString(body, c.opts.ClientID)
+	if w := c.opts.Will; nil != w {
+		flags |= flagWill
+		if w.Retain {
+			flags |= flagWillRetain
+		}
+		body = appendString(body, w.Topic)
+		body = appendString(body, string(w.Payload))
+	}
+	if len(c.opts.Username) > 0 {
+		flags |= flagUsername
+		body = appendString(body, c.opts.Username)
+	}
+	if len(c.opts.Password) > 0 {
+		flags |= flagPassword
+		body = appendString(body, c.opts.Password)
+	}
+	body[7] = flags
+	if err := c.write(conn,
+		packet{typ: packetConnect, body: body}); nil != err {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive))
+	p, err := readPacket(r)
+	if nil != err {
+		return err
+	}
+	if packetConnack != p.typ || len(p.body) != 2 {
+		return fmt.Errorf("Expected CONNACK but got packet type %v", p.typ)
+	}
+	if code := p.body[1]; 0 != code {
+		return fmt.Errorf("Connection refused: %v", connackReason(code))
+	}
+	return nil
+}
+
+// connackReason describes the return code of a CONNACK.
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "Unacceptable protocol version"
+	case 2:
+		return "Identifier rejected"
+	case 3:
+		return "Server unavailable"
+	case 4:
+		return "Bad user name or password"
+	case 5:
+		return "Not authorized"
+	}
+	return fmt.Sprintf("Return code %v", code)
+}
+
+// ping sends a PINGREQ every KeepAlive until done is closed and closes the
+// conn when the ctx is done.
+func (c *Client) ping(ctx context.Context, conn net.Conn, done chan struct{}) {
+	ticker := time.NewTicker(c.opts.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			c.mtx.Lock()
+			c.write(conn, packet{typ: packetDisconnect})
+			c.mtx.Unlock()
+			conn.Close()
+			return
+		case <-ticker.C:
+			c.mtx.Lock()
+			err := c.write(conn, packet{typ: packetPingreq})
+			c.mtx.Unlock()
+			if nil != err {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// dispatch calls the handlers of the subscriptions matching the Message.
+func (c *Client) dispatch(m Message) {
+	c.mtx.Lock()
+	var handlers []func(Message)
+	for _, sub := range c.subscriptions {
+		if Match(sub.filter, m.Topic) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	c.mtx.Unlock()
+	for _, h := range handlers {
+		h(m)
+	}
+}
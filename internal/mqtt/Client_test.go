@@ -0,0 +1,110 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testClient runs a Client of the broker and returns it along with a
+// channel receiving the Messages of the filter and a function stopping it.
+func testClient(t *testing.T, b *Broker, filter string,
+	opts Options) (*Client, <-chan Message, func()) {
+	opts.Addr = b.Addr()
+	opts.ReconnectDelay = 10 * time.Millisecond
+	connected := make(chan struct{}, 10)
+	opts.OnConnect = func() { connected <- struct{}{} }
+	c := NewClient(opts)
+	messages := make(chan Message, 10)
+	if len(filter) > 0 {
+		if err := c.Subscribe(filter, func(m Message) {
+			messages <- m
+		}); nil != err {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("Client did not connect")
+	}
+	// Wait for the SUBACK so that the subscription is active.
+	time.Sleep(20 * time.Millisecond)
+	return c, messages, func() {
+		cancel()
+		<-done
+	}
+}
+
+func receive(t *testing.T, messages <-chan Message) Message {
+	t.Helper()
+	select {
+	case m := <-messages:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("No Message received")
+	}
+	return Message{}
+}
+
+func TestClientBroker(t *testing.T) {
+	b, err := NewBroker("127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	pub, _, stopPub := testClient(t, b, "", Options{ClientID: "pub",
+		Will: &Message{Topic: "status/pub", Payload: []byte("offline"),
+			Retain: true}})
+	if err := pub.Publish(Message{Topic: "a/retained",
+		Payload: []byte("r"), Retain: true}); nil != err {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	sub, messages, stopSub := testClient(t, b, "a/+", Options{
+		ClientID: "sub", KeepAlive: time.Second})
+	defer stopSub()
+	if m := receive(t, messages); "a/retained" != m.Topic || !m.Retain {
+		t.Errorf("Expected the retained Message but got %+v", m)
+	}
+	if err := pub.Publish(Message{Topic: "a/b",
+		Payload: []byte("hello")}); nil != err {
+		t.Fatal(err)
+	}
+	if m := receive(t, messages); "a/b" != m.Topic ||
+		"hello" != string(m.Payload) || m.Retain {
+		t.Errorf("Unexpected Message: %+v", m)
+	}
+	pub.Publish(Message{Topic: "b/c", Payload: []byte("other")})
+
+	// The subscriptions are renewed after reconnecting and the retained
+	// will of the lost publisher is received.
+	status := make(chan Message, 10)
+	sub.Subscribe("status/#", func(m Message) { status <- m })
+	time.Sleep(20 * time.Millisecond)
+	b.Disconnect()
+	stopPub()
+	if m := receive(t, status); "offline" != string(m.Payload) {
+		t.Errorf("Expected the will but got %+v", m)
+	}
+	c, _, stop := testClient(t, b, "", Options{ClientID: "pub2"})
+	defer stop()
+	c.Publish(Message{Topic: "a/after", Payload: []byte("x")})
+	for m := receive(t, messages); "a/after" != m.Topic; {
+		if "a/retained" != m.Topic {
+			t.Errorf("Unexpected Message after reconnecting: %+v", m)
+		}
+		m = receive(t, messages)
+	}
+	if err := pub.Publish(Message{Topic: "a/b"}); ErrNotConnected != err {
+		t.Errorf("Expected ErrNotConnected but got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package mqtt implements the parts of MQTT 3.1.1 needed to publish and
+// subscribe at quality of service 0: a Client that reconnects to its broker,
+// and a small Broker for tests and local use.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Control packet types.
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// CONNECT flags.
+const (
+	flagCleanSession = 0x02
+	flagWill         = 0x04
+	flagWillRetain   = 0x20
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// maxPacketSize limits the size of received packets.
+const maxPacketSize = 1 << 20
+
+// protocolLevel is the protocol level of MQTT 3.1.1.
+const protocolLevel = 4
+
+// Message is a published application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	// Retain asks the broker to keep the Message for future subscribers.
+	// Received Messages are marked Retain if they were kept.
+	Retain bool
+}
+
+// packet is a control packet.
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads a control packet from r.
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if nil != err {
+		return packet{}, err
+	}
+	var length, shift uint
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if nil != err {
+			return packet{}, err
+		}
+		length |= uint(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return packet{}, fmt.Errorf("Malformed remaining length")
+		}
+		shift += 7
+	}
+	if length > maxPacketSize {
+		return packet{}, fmt.Errorf("Packet of %v bytes too large", length)
+	}
+	p := packet{typ: header >> 4, flags: header & 0x0f,
+		body: make([]byte, length)}
+	if _, err := io.ReadFull(r, p.body); nil != err {
+		return packet{}, err
+	}
+	return p, nil
+}
+
+// encode returns the packet with its fixed header.
+func (p packet) encode() []byte {
+	b := []byte{p.typ<<4 | p.flags}
+	length := len(p.body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if 0 == length {
+			break
+		}
+	}
+	return append(b, p.body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// reader decodes the fields of a packet body.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uint16() uint16 {
+	if nil != r.err {
+		return 0
+	}
+	if len(r.b) < 2 {
+		r.err = fmt.Errorf("Packet too short")
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *reader) byte() byte {
+	if nil != r.err {
+		return 0
+	}
+	if len(r.b) < 1 {
+		r.err = fmt.Errorf("Packet too short")
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := int(r.uint16())
+	if nil != r.err {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = fmt.Errorf("Packet too short")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+// publishPacket returns the PUBLISH packet of the Message at QoS 0.
+func publishPacket(m Message) packet {
+	p := packet{typ: packetPublish}
+	if m.Retain {
+		p.flags = 0x01
+	}
+	p.body = append(appendString(nil, m.Topic), m.Payload...)
+	return p
+}
+
+// parsePublish returns the Message of the PUBLISH packet, its QoS and its
+// packet identifier, which is zero at QoS 0.
+func parsePublish(p packet) (Message, byte, uint16, error) {
+	qos := (p.flags >> 1) & 0x03
+	r := reader{b: p.body}
+	m := Message{Topic: r.string(), Retain: p.flags&0x01 != 0}
+	var id uint16
+	if qos > 0 {
+		id = r.uint16()
+	}
+	if nil != r.err {
+		return Message{}, 0, 0, r.err
+	}
+	if qos > 2 || !ValidTopic(m.Topic) {
+		return Message{}, 0, 0, fmt.Errorf("Invalid PUBLISH")
+	}
+	m.Payload = append([]byte{}, r.b...)
+	return m, qos, id, nil
+}
+
+// ValidTopic returns whether topic is a valid topic name to publish to.
+func ValidTopic(topic string) bool {
+	return len(topic) > 0 && !strings.ContainsAny(topic, "+#\x00")
+}
+
+// ValidFilter returns whether filter is a valid topic filter to subscribe to.
+func ValidFilter(filter string) bool {
+	if len(filter) == 0 || strings.ContainsRune(filter, 0) {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") &&
+			("#" != level || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(level, "+") && "+" != level {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns whether the topic matches the filter. A + level in the filter
+// matches any one level and a trailing # level matches any number of levels,
+// including none. Topics starting with $ are not matched by a wildcard at the
+// first level.
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") &&
+		(strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if "#" == level {
+			return true
+		}
+		if i >= len(t) || ("+" != level && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
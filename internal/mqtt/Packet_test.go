@@ -0,0 +1,56 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestPacketEncoding(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 100000} {
+		p := packet{typ: packetPublish, flags: 1, body: make([]byte, size)}
+		got, err := readPacket(bufio.NewReader(bytes.NewReader(p.encode())))
+		if nil != err || got.typ != p.typ || got.flags != p.flags ||
+			len(got.body) != size {
+			t.Errorf("Packet of %v bytes: got %v %v %v %v", size, got.typ,
+				got.flags, len(got.body), err)
+		}
+	}
+	malformed := []byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}
+	if _, err := readPacket(bufio.NewReader(
+		bytes.NewReader(malformed))); nil == err {
+		t.Error("Expected an error for a malformed remaining length")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"#", "$SYS/a", false},
+		{"+/a", "$SYS/a", false},
+		{"a/b", "a/b/c", false},
+	} {
+		if got := Match(test.filter, test.topic); got != test.match {
+			t.Errorf("Match(%q, %q) want: %v got: %v", test.filter,
+				test.topic, test.match, got)
+		}
+	}
+	for filter, valid := range map[string]bool{
+		"a/#": true, "+/b/+": true, "a/#/b": false, "a#": false,
+		"a/b+": false, "": false,
+	} {
+		if ValidFilter(filter) != valid {
+			t.Errorf("ValidFilter(%q) want: %v", filter, valid)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package textvalue parses the values of Tags as typed by a person, for the
+// commands that write values given on the command line or in a terminal.
+package textvalue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+// Parse parses the value to write to the Tag. Bools may be given as on and
+// off, strings are taken verbatim and integers may be given in hex, octal or
+// binary with a 0x, 0o or 0b prefix.
+func Parse(t modbus.Tag, s string) (interface{}, error) {
+	switch t.Type {
+	case modbus.DataTypeBool:
+		switch strings.ToLower(s) {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+		return strconv.ParseBool(s)
+	case modbus.DataTypeString:
+		return s, nil
+	case modbus.DataTypeFloat32, modbus.DataTypeFloat64:
+		return strconv.ParseFloat(s, 64)
+	}
+	if 0 != t.Scale {
+		return strconv.ParseFloat(s, 64)
+	}
+	if i, err := strconv.ParseInt(s, 0, 64); nil == err {
+		return i, nil
+	}
+	u, err := strconv.ParseUint(s, 0, 64)
+	if nil != err {
+		return nil, fmt.Errorf("Expected an integer")
+	}
+	return u, nil
+}
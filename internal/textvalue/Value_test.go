@@ -0,0 +1,48 @@
+package textvalue
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+func TestParse(t *testing.T) {
+	bit := modbus.Tag{Name: "b", Type: modbus.DataTypeBool}
+	integer := modbus.Tag{Name: "i", Type: modbus.DataTypeInt32}
+	scaled := modbus.Tag{Name: "s", Type: modbus.DataTypeInt16, Scale: 0.1}
+	float := modbus.Tag{Name: "f", Type: modbus.DataTypeFloat32}
+	str := modbus.Tag{Name: "t", Type: modbus.DataTypeString, Length: 2}
+	for _, test := range []struct {
+		modbus.Tag
+		value string
+		want  interface{}
+	}{
+		{bit, "On", true},
+		{bit, "0", false},
+		{integer, "-3", int64(-3)},
+		{integer, "0x10", int64(16)},
+		{integer, "18446744073709551615", uint64(math.MaxUint64)},
+		{scaled, "21.5", 21.5},
+		{float, "2", 2.0},
+		{str, " a b", " a b"},
+	} {
+		v, err := Parse(test.Tag, test.value)
+		if nil != err {
+			t.Errorf("%v: %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.want, v) {
+			t.Errorf("%v: want: %#v got: %#v", test.value, test.want, v)
+		}
+	}
+	for _, test := range []struct {
+		modbus.Tag
+		value string
+	}{{bit, "2"}, {integer, "1.5"}, {integer, ""}, {float, "x"}} {
+		if _, err := Parse(test.Tag, test.value); nil == err {
+			t.Errorf("Expected an error for %q", test.value)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Package websocket implements the parts of the WebSocket protocol, RFC 6455,
+// needed to push messages to browsers: the server handshake, a client for
+// testing, fragmented messages and the control frames. Extensions and
+// subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The message types, which are the opcodes of their frames.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// opContinuation is the opcode of the frames following the first frame of a
+// fragmented message.
+const opContinuation = 0
+
+// MaxMessageSize limits the size of received messages.
+const MaxMessageSize = 1 << 20
+
+// writeTimeout limits the time for writing a frame.
+const writeTimeout = 10 * time.Second
+
+// acceptGUID is appended to the key of the handshake to compute the accept
+// header.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Conn is a WebSocket connection. ReadMessage must be called from one
+// goroutine at a time, while WriteMessage and Close may be called
+// concurrently.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// client is true for the client side of the connection, which masks
+	// the frames it sends.
+	client bool
+
+	wmtx      sync.Mutex
+	closeSent bool
+}
+
+// Upgrade performs the server handshake of a WebSocket connection. If the
+// request is not a valid handshake, it responds with an error and returns the
+// error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	var err error
+	status := http.StatusBadRequest
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case http.MethodGet != r.Method:
+		status = http.StatusMethodNotAllowed
+		err = fmt.Errorf("Method %v not allowed", r.Method)
+	case !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket"):
+		err = fmt.Errorf("Not a WebSocket handshake")
+	case "13" != r.Header.Get("Sec-WebSocket-Version"):
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		status = http.StatusUpgradeRequired
+		err = fmt.Errorf("Unsupported WebSocket version")
+	case !validKey(key):
+		err = fmt.Errorf("Invalid Sec-WebSocket-Key")
+	}
+	if nil != err {
+		http.Error(w, err.Error(), status)
+		return nil, err
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		err = fmt.Errorf("Connection cannot be hijacked")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+	conn, rw, err := hj.Hijack()
+	if nil != err {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	if _, err := conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")); nil != err {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, r: rw.Reader}, nil
+}
+
+// Dial opens a WebSocket connection to the ws:// URL.
+func Dial(rawurl string) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if nil != err {
+		return nil, err
+	}
+	if "ws" != u.Scheme {
+		return nil, fmt.Errorf("Unsupported scheme: %q", u.Scheme)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if nil != err {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); nil != err {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	conn.SetDeadline(time.Now().Add(writeTimeout))
+	if err := req.Write(conn); nil != err {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, req)
+	if nil != err {
+		conn.Close()
+		return nil, err
+	}
+	res.Body.Close()
+	if http.StatusSwitchingProtocols != res.StatusCode ||
+		acceptKey(key) != res.Header.Get("Sec-WebSocket-Accept") {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake failed: %v",
+			res.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return &Conn{conn: conn, r: r, client: true}, nil
+}
+
+// headerContains returns whether the comma separated values of the header
+// contain the token, which is not case sensitive.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validKey returns whether the key is the base64 encoding of 16 bytes.
+func validKey(key string) bool {
+	b, err := base64.StdEncoding.DecodeString(key)
+	return nil == err && len(b) == 16
+}
+
+// acceptKey returns the Sec-WebSocket-Accept header for the key.
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// ReadMessage returns the type and the data of the next text or binary
+// message. Pings are answered while waiting. When the peer closes the
+// connection the close is acknowledged and io.EOF is returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var msgType int
+	var msg []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if nil != err {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err := c.writeFrame(PongMessage, payload); nil != err {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			c.writeClose(payload)
+			return 0, nil, io.EOF
+		case opContinuation:
+			if 0 == msgType {
+				return 0, nil, c.fail("Unexpected continuation frame")
+			}
+		case TextMessage, BinaryMessage:
+			if 0 != msgType {
+				return 0, nil, c.fail("Expected a continuation frame")
+			}
+			msgType = opcode
+		default:
+			return 0, nil, c.fail(fmt.Sprintf("Invalid opcode: %v",
+				opcode))
+		}
+		if len(msg)+len(payload) > MaxMessageSize {
+			return 0, nil, c.fail("Message too large")
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msgType, msg, nil
+		}
+	}
+}
+
+// readFrame reads the next frame and returns its payload unmasked.
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.r, h[:]); nil != err {
+		return
+	}
+	fin = h[0]&0x80 != 0
+	opcode = int(h[0] & 0x0F)
+	if h[0]&0x70 != 0 {
+		err = c.fail("Reserved bits set")
+		return
+	}
+	// Frames from clients must be masked, frames from servers must not.
+	masked := h[1]&0x80 != 0
+	if masked == c.client {
+		err = c.fail("Invalid masking")
+		return
+	}
+	n := uint64(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); nil != err {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); nil != err {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= CloseMessage && (n > 125 || !fin) {
+		err = c.fail("Invalid control frame")
+		return
+	}
+	if n > MaxMessageSize {
+		err = c.fail("Message too large")
+		return
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); nil != err {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); nil != err {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// fail closes the connection with a protocol error and returns the error.
+func (c *Conn) fail(reason string) error {
+	status := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(status, 1002)
+	c.writeClose(append(status, reason...))
+	c.conn.Close()
+	return errors.New("WebSocket protocol error: " + reason)
+}
+
+// WriteMessage sends the data as a single frame of the message type.
+func (c *Conn) WriteMessage(msgType int, data []byte) error {
+	return c.writeFrame(msgType, data)
+}
+
+// writeFrame sends a frame, masked if c is a client.
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if CloseMessage == opcode {
+		c.closeSent = true
+	}
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(opcode))
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, maskBit|127)
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, ext[:]...)
+	}
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); nil != err {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// writeClose sends a close frame with the payload, unless one was sent.
+func (c *Conn) writeClose(payload []byte) {
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	c.writeFrame(CloseMessage, payload)
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *Conn) Close() error {
+	c.writeClose([]byte{0x03, 0xE8})
+	return c.conn.Close()
+}
+
+// SetReadDeadline sets the deadline of ReadMessage.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer returns a server echoing the messages of its WebSocket clients.
+func echoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		c, err := Upgrade(w, r)
+		if nil != err {
+			return
+		}
+		defer c.Close()
+		for {
+			msgType, data, err := c.ReadMessage()
+			if nil != err {
+				return
+			}
+			if err := c.WriteMessage(msgType, data); nil != err {
+				t.Error(err)
+				return
+			}
+		}
+	}))
+}
+
+func TestConn(t *testing.T) {
+	srv := echoServer(t)
+	defer srv.Close()
+	c, err := Dial("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		data := bytes.Repeat([]byte{'x'}, size)
+		if err := c.WriteMessage(BinaryMessage, data); nil != err {
+			t.Fatal(err)
+		}
+		msgType, got, err := c.ReadMessage()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if BinaryMessage != msgType || !bytes.Equal(data, got) {
+			t.Errorf("Size %v: Unexpected echo of type %v and size %v",
+				size, msgType, len(got))
+		}
+	}
+
+	// A fragmented message with an interleaved ping.
+	for _, f := range []struct {
+		opcode int
+		fin    bool
+		data   string
+	}{
+		{TextMessage, false, "hello "},
+		{PingMessage, true, "ping"},
+		{opContinuation, true, "world"},
+	} {
+		if err := c.writeFragment(f.opcode, f.fin, []byte(f.data)); nil != err {
+			t.Fatal(err)
+		}
+	}
+	msgType, got, err := c.ReadMessage()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if TextMessage != msgType || "hello world" != string(got) {
+		t.Errorf("Unexpected echo: %v %q", msgType, got)
+	}
+
+	if err := c.writeFrame(CloseMessage, []byte{0x03, 0xE8}); nil != err {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadMessage(); io.EOF != err {
+		t.Errorf("Expected io.EOF after closing but got %v", err)
+	}
+}
+
+// writeFragment sends a frame that may not be the final frame of its
+// message.
+func (c *Conn) writeFragment(opcode int, fin bool, payload []byte) error {
+	if fin {
+		return c.writeFrame(opcode, payload)
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{byte(opcode), 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	srv := echoServer(t)
+	defer srv.Close()
+	for _, test := range []struct {
+		header http.Header
+		status int
+	}{
+		{http.Header{}, http.StatusBadRequest},
+		{http.Header{"Connection": {"keep-alive, Upgrade"},
+			"Upgrade": {"websocket"}, "Sec-WebSocket-Version": {"8"}},
+			http.StatusUpgradeRequired},
+		{http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"},
+			"Sec-WebSocket-Version": {"13"},
+			"Sec-WebSocket-Key":     {"short"}},
+			http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		req.Header = test.header
+		res, err := http.DefaultClient.Do(req)
+		if nil != err {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if test.status != res.StatusCode {
+			t.Errorf("%v: want: %v got: %v", test.header, test.status,
+				res.StatusCode)
+		}
+	}
+}
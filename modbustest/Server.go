@@ -0,0 +1,298 @@
+// Package modbustest provides an in-process Modbus TCP slave for testing
+// programs that use the modbus package without real devices.
+package modbustest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+// Exception codes returned by the Server.
+const (
+	ExceptionIllegalFunction = 0x01
+	ExceptionDataAddress     = 0x02
+	ExceptionDataValue       = 0x03
+)
+
+// Unit holds the data of a simulated slave device. The lengths of the slices
+// are the sizes of the Tables and accesses beyond them are answered with an
+// Illegal Data Address exception.
+type Unit struct {
+	Coils            []bool
+	DiscreteInputs   []bool
+	InputRegisters   []uint16
+	HoldingRegisters []uint16
+	// ServerID is returned, followed by the run indicator, in response to
+	// ReportServerID.
+	ServerID []byte
+	// Disabled FunctionCodes are answered with an Illegal Function
+	// exception.
+	Disabled map[modbus.FunctionCode]bool
+}
+
+// NewUnit returns a Unit with Tables of size addresses.
+func NewUnit(size int) *Unit {
+	return &Unit{
+		Coils:            make([]bool, size),
+		DiscreteInputs:   make([]bool, size),
+		InputRegisters:   make([]uint16, size),
+		HoldingRegisters: make([]uint16, size),
+		ServerID:         []byte{0x01},
+	}
+}
+
+// Server is a Modbus TCP slave serving the Units on a local port. Requests
+// for SlaveIDs without a Unit are not answered, like on a serial bus.
+type Server struct {
+	// Lock the Server to access the Units or Delay while it is serving.
+	sync.Mutex
+	Units map[byte]*Unit
+	// Delay is the time the Server waits before responding.
+	Delay time.Duration
+
+	ln       net.Listener
+	conns    map[net.Conn]bool
+	requests int
+	wg       sync.WaitGroup
+}
+
+// NewServer starts and returns a Server with a Unit of 1000 addresses for
+// SlaveID 1. It panics if no local port can be opened, since it is intended
+// for tests.
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		panic("modbustest: " + err.Error())
+	}
+	s := &Server{
+		Units: map[byte]*Unit{1: NewUnit(1000)},
+		ln:    ln,
+		conns: make(map[net.Conn]bool),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// Addr returns the host and port of the Server, for use as the Host of
+// modbus.ConnectionSettings.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// ConnectionSettings returns the ConnectionSettings of a client of the
+// Server.
+func (s *Server) ConnectionSettings() modbus.ConnectionSettings {
+	return modbus.ConnectionSettings{
+		Mode:    modbus.ModeTCP,
+		Host:    s.Addr(),
+		Timeout: time.Second,
+	}
+}
+
+// Requests returns the number of requests received so far.
+func (s *Server) Requests() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.requests
+}
+
+// Close stops the Server, closes all client connections and waits for them
+// to be finished.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if nil != err {
+			return
+		}
+		s.Lock()
+		s.conns[c] = true
+		s.Unlock()
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+// serve answers the requests received on c until it is closed.
+func (s *Server) serve(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.Lock()
+		delete(s.conns, c)
+		s.Unlock()
+		c.Close()
+	}()
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(c, header); nil != err {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:6]))
+		if length < 2 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(c, pdu); nil != err {
+			return
+		}
+
+		s.Lock()
+		s.requests++
+		delay := s.Delay
+		var response []byte
+		if u, ok := s.Units[header[6]]; ok {
+			response = u.handle(pdu)
+		}
+		s.Unlock()
+		if nil == response {
+			continue
+		}
+		time.Sleep(delay)
+
+		adu := make([]byte, 7+len(response))
+		copy(adu, header[:4])
+		binary.BigEndian.PutUint16(adu[4:], uint16(len(response)+1))
+		adu[6] = header[6]
+		copy(adu[7:], response)
+		if _, err := c.Write(adu); nil != err {
+			return
+		}
+	}
+}
+
+// handle returns the response PDU to the request pdu.
+func (u *Unit) handle(pdu []byte) []byte {
+	fCode := modbus.FunctionCode(pdu[0])
+	exception := func(code byte) []byte {
+		return []byte{pdu[0] | 0x80, code}
+	}
+	if u.Disabled[fCode] {
+		return exception(ExceptionIllegalFunction)
+	}
+	if fCode == modbus.FunctionReportServerID {
+		response := []byte{pdu[0], byte(len(u.ServerID) + 1)}
+		response = append(response, u.ServerID...)
+		return append(response, 0xFF)
+	}
+	if len(pdu) < 5 {
+		return exception(ExceptionDataValue)
+	}
+	address := int(binary.BigEndian.Uint16(pdu[1:]))
+	value := binary.BigEndian.Uint16(pdu[3:])
+	quantity := int(value)
+	inRange := func(size int) bool {
+		return address+quantity <= size
+	}
+
+	switch fCode {
+	case modbus.FunctionReadCoils, modbus.FunctionReadDiscreteInputs:
+		bits := u.Coils
+		if fCode == modbus.FunctionReadDiscreteInputs {
+			bits = u.DiscreteInputs
+		}
+		if quantity < 1 || quantity > 2000 {
+			return exception(ExceptionDataValue)
+		}
+		if !inRange(len(bits)) {
+			return exception(ExceptionDataAddress)
+		}
+		data := make([]byte, (quantity+7)/8)
+		for i, b := range bits[address : address+quantity] {
+			if b {
+				data[i/8] |= 1 << uint(i%8)
+			}
+		}
+		return append([]byte{pdu[0], byte(len(data))}, data...)
+
+	case modbus.FunctionReadHoldingRegisters,
+		modbus.FunctionReadInputRegisters:
+		registers := u.HoldingRegisters
+		if fCode == modbus.FunctionReadInputRegisters {
+			registers = u.InputRegisters
+		}
+		if quantity < 1 || quantity > 125 {
+			return exception(ExceptionDataValue)
+		}
+		if !inRange(len(registers)) {
+			return exception(ExceptionDataAddress)
+		}
+		response := []byte{pdu[0], byte(2 * quantity)}
+		for _, r := range registers[address : address+quantity] {
+			response = append(response, byte(r>>8), byte(r))
+		}
+		return response
+
+	case modbus.FunctionWriteSingleCoil:
+		if value != 0xFF00 && value != 0x0000 {
+			return exception(ExceptionDataValue)
+		}
+		if address >= len(u.Coils) {
+			return exception(ExceptionDataAddress)
+		}
+		u.Coils[address] = value == 0xFF00
+		return pdu[:5]
+
+	case modbus.FunctionWriteSingleRegister:
+		if address >= len(u.HoldingRegisters) {
+			return exception(ExceptionDataAddress)
+		}
+		u.HoldingRegisters[address] = value
+		return pdu[:5]
+
+	case modbus.FunctionWriteMultipleCoils:
+		if quantity < 1 || quantity > 1968 || len(pdu) < 6 ||
+			len(pdu) != 6+int(pdu[5]) || int(pdu[5]) != (quantity+7)/8 {
+			return exception(ExceptionDataValue)
+		}
+		if !inRange(len(u.Coils)) {
+			return exception(ExceptionDataAddress)
+		}
+		for i := 0; i < quantity; i++ {
+			u.Coils[address+i] = pdu[6+i/8]&(1<<uint(i%8)) != 0
+		}
+		return pdu[:5]
+
+	case modbus.FunctionWriteMultipleRegisters:
+		if quantity < 1 || quantity > 123 || len(pdu) < 6 ||
+			len(pdu) != 6+int(pdu[5]) || int(pdu[5]) != 2*quantity {
+			return exception(ExceptionDataValue)
+		}
+		if !inRange(len(u.HoldingRegisters)) {
+			return exception(ExceptionDataAddress)
+		}
+		for i := 0; i < quantity; i++ {
+			u.HoldingRegisters[address+i] =
+				binary.BigEndian.Uint16(pdu[6+2*i:])
+		}
+		return pdu[:5]
+
+	case modbus.FunctionMaskWriteRegister:
+		if len(pdu) != 7 {
+			return exception(ExceptionDataValue)
+		}
+		if address >= len(u.HoldingRegisters) {
+			return exception(ExceptionDataAddress)
+		}
+		and, or := value, binary.BigEndian.Uint16(pdu[5:])
+		r := u.HoldingRegisters[address]
+		u.HoldingRegisters[address] = (r & and) | (or &^ and)
+		return pdu
+	}
+	return exception(ExceptionIllegalFunction)
+}
@@ -0,0 +1,78 @@
+package modbustest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AdamSLevy/modbus"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Units[2] = NewUnit(10)
+	s.Units[2].Disabled = map[modbus.FunctionCode]bool{
+		modbus.FunctionWriteSingleCoil: true,
+	}
+	s.Units[1].InputRegisters[5] = 0x1234
+
+	cs := s.ConnectionSettings()
+	cs.Timeout = 100 * time.Millisecond
+	ch, err := modbus.GetClientHandle(cs)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ch.Close()
+	ctx := context.Background()
+
+	if err := ch.WriteRegisters(ctx, 1, 10, []uint16{1, 2, 3}); nil != err {
+		t.Fatal(err)
+	}
+	if err := ch.MaskWriteRegister(ctx, 1, 11, 0x00F0, 0x0F0F); nil != err {
+		t.Fatal(err)
+	}
+	registers, err := ch.ReadHoldingRegisters(ctx, 1, 10, 3)
+	if want := []uint16{1, 0x0F0F, 3}; nil != err ||
+		!reflect.DeepEqual(registers, want) {
+		t.Errorf("ReadHoldingRegisters want: %v got: %v %v", want,
+			registers, err)
+	}
+	if err := ch.WriteCoils(ctx, 1, 3, []bool{true, false, true}); nil != err {
+		t.Fatal(err)
+	}
+	coils, err := ch.ReadCoils(ctx, 1, 2, 4)
+	if want := []bool{false, true, false, true}; nil != err ||
+		!reflect.DeepEqual(coils, want) {
+		t.Errorf("ReadCoils want: %v got: %v %v", want, coils, err)
+	}
+	inputs, err := ch.ReadInputRegisters(ctx, 1, 5, 1)
+	if nil != err || inputs[0] != 0x1234 {
+		t.Errorf("ReadInputRegisters want: [4660] got: %v %v", inputs,
+			err)
+	}
+
+	for _, test := range []struct {
+		name string
+		err  error
+		code uint16
+	}{
+		{"Address", ch.WriteRegister(ctx, 2, 10, 1), ExceptionDataAddress},
+		{"Disabled", ch.WriteCoil(ctx, 2, 0, true),
+			ExceptionIllegalFunction},
+	} {
+		if code, ok := modbus.ExceptionCode(test.err); !ok ||
+			code != test.code {
+			t.Errorf("%v: Expected exception %v but got %v", test.name,
+				test.code, test.err)
+		}
+	}
+
+	if _, err := ch.ReadCoils(ctx, 3, 0, 1); !modbus.IsTimeout(err) {
+		t.Errorf("Unknown unit: Expected a timeout but got %v", err)
+	}
+	if n := s.Requests(); n != 9 {
+		t.Errorf("Expected 9 requests but got %v", n)
+	}
+}
@@ -1,16 +1,73 @@
 package modbus
 
 import (
+	"errors"
+	"time"
+
 	"github.com/tarm/serial"
 )
 
+// DefaultTurnaroundDelay is the turnaround delay used on serial lines when
+// ConnectionSettings.TurnaroundDelay is zero.
+const DefaultTurnaroundDelay = 100 * time.Millisecond
+
+// errBroadcastRead is returned when a Query that is not a write is addressed
+// to SlaveID 0.
+var errBroadcastRead = errors.New(
+	"Only write functions may be broadcast to SlaveID 0")
+
+// serialReadTimeout is the longest time a single read from a serial port may
+// block. The response timeout is enforced by retrying reads until the
+// deadline so that it can be changed with SetTimeout after the port has been
+// opened, which the serial port does not support.
+const serialReadTimeout = 100 * time.Millisecond
+
 // newSerialPort is used by both the ASCIIPackager and the RTUPackager to set
 // up the serial port implementing their Transporter interface.
 func newSerialPort(c ConnectionSettings) (*serial.Port, error) {
+	readTimeout := c.Timeout
+	if readTimeout > serialReadTimeout {
+		readTimeout = serialReadTimeout
+	}
 	conf := &serial.Config{
 		Name:        c.Host,
 		Baud:        int(c.Baud),
-		ReadTimeout: c.Timeout,
+		ReadTimeout: readTimeout,
 	}
 	return serial.OpenPort(conf)
 }
+
+// turnaround tracks the turnaround delay that must be observed after a
+// broadcast on a serial line, during which the slaves process the request
+// and no other query may be sent. It is used by both the ASCIIPackager and
+// the RTUPackager.
+type turnaround struct {
+	delay      time.Duration
+	quietUntil time.Time
+}
+
+func newTurnaround(c ConnectionSettings) turnaround {
+	delay := c.TurnaroundDelay
+	if delay == 0 {
+		delay = DefaultTurnaroundDelay
+	}
+	return turnaround{delay: delay}
+}
+
+// wait blocks until the turnaround delay of the last broadcast has elapsed.
+func (t *turnaround) wait() {
+	time.Sleep(time.Until(t.quietUntil))
+}
+
+// start starts the turnaround delay after a broadcast has been sent.
+func (t *turnaround) start() {
+	t.quietUntil = time.Now().Add(t.delay)
+}
+
+// checkBroadcast returns an error if q is a broadcast but not a write.
+func checkBroadcast(q Query) error {
+	if q.SlaveID == 0 && !isWriteFunction(q.FunctionCode) {
+		return errBroadcastRead
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTurnaround(t *testing.T) {
+	ta := newTurnaround(ConnectionSettings{})
+	if ta.delay != DefaultTurnaroundDelay {
+		t.Errorf("delay want: %v got: %v", DefaultTurnaroundDelay, ta.delay)
+	}
+	ta = newTurnaround(ConnectionSettings{
+		TurnaroundDelay: 30 * time.Millisecond})
+	start := time.Now()
+	ta.wait()
+	if time.Since(start) >= ta.delay {
+		t.Error("wait blocked without a broadcast")
+	}
+	ta.start()
+	ta.wait()
+	if time.Since(start) < ta.delay {
+		t.Error("wait did not observe the turnaround delay")
+	}
+}
+
+func TestCheckBroadcast(t *testing.T) {
+	q, _ := WriteMultipleRegisters(0, 0, 1, []uint16{1})
+	if err := checkBroadcast(q); nil != err {
+		t.Error(err)
+	}
+	q, _ = ReadHoldingRegisters(0, 0, 1)
+	if err := checkBroadcast(q); nil == err {
+		t.Error("Broadcast read err is nil")
+	}
+	q, _ = ReadHoldingRegisters(1, 0, 1)
+	if err := checkBroadcast(q); nil != err {
+		t.Error(err)
+	}
+}